@@ -1,18 +1,18 @@
 package main
 
 import (
+	"HealthHubConnect/internal/models"
 	"HealthHubConnect/internal/utils"
 	"fmt"
 )
 
 func main() {
 
-	tokenPair, _ := utils.GenerateTokenPair(5)
+	tokenPair, _ := utils.GenerateTokenPair(5, models.RolePatient, "")
 	fmt.Println(tokenPair.AccessToken)
 	// fmt.Println(tokenPair.RefreshToken)
-	// fmt.Println(utils.ExtractUserIDFromToken(tokenPair.AccessToken, env.Jwt.AccessTokenSecret))
+	// fmt.Println(utils.ExtractUserIDFromToken(tokenPair.AccessToken))
 	// fmt.Println(utils.ValidateToken(tokenPair.RefreshToken, env.Jwt.RefreshTokenSecret, "refresh"))
-	// fmt.Println(utils.RefreshAccessTokens(tokenPair.RefreshToken))
 
 	// db, _ := database.InitDB()
 	// password := "password"
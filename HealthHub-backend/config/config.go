@@ -30,6 +30,29 @@ type JwtConfig struct {
 	RefreshTokenSecret []byte
 	AccessTokenTTL     time.Duration
 	RefreshTokenTTL    time.Duration
+	Issuer             string
+
+	// MFATokenSecret signs the short-lived token handed out between the
+	// password and the second factor
+	MFATokenSecret []byte
+
+	// asymmetric keys for access tokens. SigningKeyID picks the key new tokens
+	// are signed with, every listed key is still accepted and published in the
+	// JWKS so tokens signed before a rotation stay valid until they expire.
+	// Without keys access tokens fall back to HS256 with AccessTokenSecret.
+	SigningKeyID string
+	SigningKeys  []JwtSigningKey
+	// AcceptHS256AccessTokens keeps HS256 access tokens valid once tokens are
+	// signed with SigningKeyID. Set it while moving to keys until the old
+	// tokens have expired, then drop it and AccessTokenSecret.
+	AcceptHS256AccessTokens bool
+}
+
+type JwtSigningKey struct {
+	ID            string
+	Algorithm     string // RS256 or EdDSA
+	PrivateKeyPEM string // PKCS#8 or PKCS#1, may be empty for a retired key that only verifies
+	PublicKeyPEM  string // PKIX, derived from the private key when empty
 }
 
 type HashConfig struct {
@@ -64,3 +87,17 @@ type GoogleMapsConfig struct {
 	RequestTimeout      time.Duration
 	MaxRetries          int
 }
+
+// OIDCProviderConfig registers an OpenID Connect identity provider, e.g. a
+// hospital's Keycloak, Azure AD or Okta tenant. Endpoints and signing keys are
+// read from the provider's discovery document under IssuerURL.
+type OIDCProviderConfig struct {
+	Name         string // url slug, /auth/oidc/{Name}/...
+	DisplayName  string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	LinkByEmail  bool // sign in existing users whose verified email matches instead of asking them to link first
+}
@@ -4,9 +4,11 @@ import (
 	"HealthHubConnect/internal/models"
 	"database/sql"
 	"errors"
+	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
@@ -17,7 +19,18 @@ var (
 var modelsToMigrate = []interface{}{
 	&models.User{},
 	&models.OAuthAccount{},
+	&models.OIDCLoginState{},
+	&models.APIKey{},
+	&models.Delegation{},
+	&models.AuditLog{},
+	&models.AccountDeletionRequest{},
+	&models.RefreshSession{},
+	&models.UserMFA{},
+	&models.MFARecoveryCode{},
+	&models.AdminSettings{},
 	&models.LoginAttempt{},
+	&models.LoginLockout{},
+	&models.OneTimeCode{},
 	&models.HealthProfile{},
 	&models.EmergencyContact{},
 	&models.Allergy{},
@@ -27,9 +40,27 @@ var modelsToMigrate = []interface{}{
 	&models.ChatMessage{},
 	&models.Hospital{},
 	&models.Appointment{},
+	&models.AppointmentEvent{},
+	&models.AppointmentSeries{},
+	&models.SlotHold{},
+	&models.SlotClaim{},
+	&models.WaitlistEntry{},
+	&models.WaitlistOffer{},
+	&models.AppointmentReminder{},
+	&models.NotificationPreference{},
+	&models.CalendarFeed{},
 	&models.DoctorAvailability{},
 	&models.DoctorProfile{},
+	&models.DoctorSearchEntry{},
+	&models.DoctorSearchFacet{},
 	&models.DoctorSchedule{},
+	&models.ScheduleVersion{},
+	&models.BlockedSlot{},
+	&models.DoctorTimeOff{},
+	&models.HolidayCalendar{},
+	&models.Holiday{},
+	&models.DoctorHolidayCalendar{},
+	&models.FrontDeskAssignment{},
 	&models.Bill{},
 }
 
@@ -39,6 +70,8 @@ func InitDB() error {
 	//using sqlite for tesing purposes only
 	db, err = gorm.Open(sqlite.Open("healthhub.db"), &gorm.Config{
 		PrepareStmt: true,
+		// timestamps are compared as text, keep them all in one zone
+		NowFunc: func() time.Time { return time.Now().UTC() },
 	})
 	if err != nil {
 		return err
@@ -53,7 +86,53 @@ func InitDB() error {
 		return err
 	}
 
-	return nil
+	return backfillSlotClaims(db)
+}
+
+// backfillSlotClaims gives a seat to the active appointments booked before
+// slot claims existed, so bookings made since count them. Their seats are
+// numbered in booking order, any double booking among them is kept for the
+// doctor to sort out. Walk-ins take no seat.
+func backfillSlotClaims(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		claimed := tx.Model(&models.SlotClaim{}).Select("appointment_id").Where("appointment_id IS NOT NULL")
+
+		var appointments []models.Appointment
+		if err := tx.Select("id", "doctor_id", "start_time", "end_time").
+			Where("walk_in = ? AND is_cancelled = ?", false, false).
+			Where("status NOT IN ?", []models.AppointmentStatus{
+				models.StatusCancelled,
+				models.StatusCompleted,
+				models.StatusNoShow,
+			}).
+			Where("id NOT IN (?)", claimed).
+			Order("id asc").
+			Find(&appointments).Error; err != nil {
+			return err
+		}
+
+		for _, appointment := range appointments {
+			appointmentID := appointment.ID
+			claim := models.SlotClaim{
+				DoctorID:      appointment.DoctorID,
+				SlotStart:     appointment.StartTime.UTC(),
+				SlotEnd:       appointment.EndTime.UTC(),
+				AppointmentID: &appointmentID,
+			}
+			for seat := 0; ; seat++ {
+				claim.ID = 0
+				claim.Seat = seat
+				result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&claim)
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected == 1 {
+					break
+				}
+			}
+		}
+		return nil
+	})
 }
 
 func Close() error {
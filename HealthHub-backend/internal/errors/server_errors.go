@@ -8,6 +8,7 @@ type CustomError struct {
 	Message    string
 	ErrorCode  string
 	StatusCode int
+	Details    interface{}
 }
 
 func (err *CustomError) Error() string {
@@ -102,6 +103,17 @@ func NewForbiddenError(message string) *CustomError {
 	}
 }
 
+func NewPermissionDeniedError(role string, action string) *CustomError {
+	if role == "" {
+		role = "unknown"
+	}
+	return &CustomError{
+		Message:    "role '" + role + "' is not permitted to " + action + " this resource",
+		ErrorCode:  "PERMISSION_DENIED",
+		StatusCode: http.StatusForbidden,
+	}
+}
+
 func NewNotFoundError(message string) *CustomError {
 	return &CustomError{
 		Message:    message,
@@ -126,6 +138,31 @@ func NewConflictError(message string) *CustomError {
 	}
 }
 
+func NewTooManyRequestsError(message string) *CustomError {
+	return &CustomError{
+		Message:    message,
+		ErrorCode:  "TOO_MANY_REQUESTS",
+		StatusCode: http.StatusTooManyRequests,
+	}
+}
+
+func NewAccountLockedError(message string) *CustomError {
+	return &CustomError{
+		Message:    message,
+		ErrorCode:  "ACCOUNT_LOCKED",
+		StatusCode: http.StatusLocked,
+	}
+}
+
+func NewSlotUnavailableError(message string, details interface{}) *CustomError {
+	return &CustomError{
+		Message:    message,
+		ErrorCode:  "SLOT_UNAVAILABLE",
+		StatusCode: http.StatusUnprocessableEntity,
+		Details:    details,
+	}
+}
+
 // for testing some pointer based errors
 type AppError struct {
 	Message    string `json:"message"`
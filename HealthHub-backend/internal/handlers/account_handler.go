@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/services"
+	"HealthHubConnect/internal/utils"
+)
+
+type AccountHandler struct {
+	accountService *services.AccountService
+}
+
+func NewAccountHandler(accountService *services.AccountService) *AccountHandler {
+	return &AccountHandler{
+		accountService: accountService,
+	}
+}
+
+// Export sends the signed-in user's data as a zip download
+func (h *AccountHandler) Export(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	archive, filename, err := h.accountService.Export(ctx, userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
+
+func (h *AccountHandler) RequestDeletion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	var input services.DeletionRequestInput
+	if err := ParseRequestBody(w, r, &input); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	request, err := h.accountService.RequestDeletion(ctx, userID, input)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusAccepted, request)
+}
+
+func (h *AccountHandler) GetDeletionRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	request, err := h.accountService.GetDeletionRequest(ctx, userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, request)
+}
+
+func (h *AccountHandler) CancelDeletion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	if err := h.accountService.CancelDeletion(ctx, userID); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]string{
+		"message": "Account deletion cancelled",
+	})
+}
+
+func (h *AccountHandler) GetNotificationPreference(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	preference, err := h.accountService.GetNotificationPreference(ctx, userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, preference)
+}
+
+func (h *AccountHandler) UpdateNotificationPreference(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	var req models.NotificationPreferenceRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	preference, err := h.accountService.UpdateNotificationPreference(ctx, userID, &req)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, preference)
+}
+
+func (h *AccountHandler) GetTimezone(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	setting, err := h.accountService.GetTimezone(ctx, userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, setting)
+}
+
+func (h *AccountHandler) UpdateTimezone(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	var req models.TimezoneSetting
+	if err := ParseRequestBody(w, r, &req); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	setting, err := h.accountService.UpdateTimezone(ctx, userID, &req)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, setting)
+}
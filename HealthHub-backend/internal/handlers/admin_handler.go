@@ -118,11 +118,15 @@ func (h *AdminHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, tokens, err := h.adminService.LoginAdmin(r.Context(), req.Email, req.Password)
+	user, tokens, challenge, err := h.adminService.LoginAdmin(r.Context(), req.Email, req.Password)
 	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
+	if challenge != nil {
+		GenerateResponse(&w, http.StatusOK, mfaChallengeResponse(challenge))
+		return
+	}
 
 	GenerateResponse(&w, http.StatusOK, map[string]interface{}{
 		"success": true,
@@ -234,6 +238,25 @@ func (h *AdminHandler) ActivateUser(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (h *AdminHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value("userID").(uint)
+	userID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewValidationError("invalid user ID"))
+		return
+	}
+
+	if err := h.adminService.UnlockUser(r.Context(), adminID, uint(userID)); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "User unlocked successfully",
+	})
+}
+
 func (h *AdminHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	adminID := r.Context().Value("userID").(uint)
 	userID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
@@ -350,6 +373,61 @@ func (h *AdminHandler) GetSystemSettings(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+func (h *AdminHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value("userID").(uint)
+
+	var input services.CreateAPIKeyInput
+	if err := ParseRequestBody(w, r, &input); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	key, plaintext, err := h.adminService.CreateAPIKey(r.Context(), adminID, input)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	// the plaintext key is only ever returned here
+	GenerateResponse(&w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"api_key": key,
+		"key":     plaintext,
+	})
+}
+
+func (h *AdminHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	includeRevoked := r.URL.Query().Get("include_revoked") == "true"
+	keys, err := h.adminService.ListAPIKeys(r.Context(), includeRevoked)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+	GenerateResponse(&w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    keys,
+	})
+}
+
+func (h *AdminHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value("userID").(uint)
+	keyID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewValidationError("invalid api key ID"))
+		return
+	}
+
+	if err := h.adminService.RevokeAPIKey(r.Context(), adminID, uint(keyID)); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "API key revoked successfully",
+	})
+}
+
 func (h *AdminHandler) CreateBackup(w http.ResponseWriter, r *http.Request) {
 	adminID := r.Context().Value("userID").(uint)
 	backup, err := h.adminService.CreateBackup(r.Context(), adminID)
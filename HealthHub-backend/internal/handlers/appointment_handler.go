@@ -5,9 +5,11 @@ import (
 	"HealthHubConnect/internal/models"
 	"HealthHubConnect/internal/services"
 	"HealthHubConnect/internal/utils"
+	"context"
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"HealthHubConnect/internal/repositories"
@@ -33,6 +35,20 @@ func NewAppointmentHandler(
 	}
 }
 
+// callerLocation returns the zone the signed-in user reads and writes times
+// in, UTC when they haven't set one
+func (h *AppointmentHandler) callerLocation(r *http.Request) *time.Location {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		return time.UTC
+	}
+	user, err := h.userRepository.FindByID(r.Context(), userID)
+	if err != nil {
+		return time.UTC
+	}
+	return utils.TimezoneOrUTC(user.Timezone)
+}
+
 func (h *AppointmentHandler) CreateAppointment(w http.ResponseWriter, r *http.Request) {
 	userID, err := getUserIDFromContext(r)
 	if err != nil {
@@ -46,7 +62,8 @@ func (h *AppointmentHandler) CreateAppointment(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	appointment, err := req.ToAppointment(userID)
+	loc := h.callerLocation(r)
+	appointment, err := req.ToAppointment(userID, loc)
 	if err != nil {
 		GenerateErrorResponse(&w, e.NewValidationError(err.Error()))
 		return
@@ -57,12 +74,12 @@ func (h *AppointmentHandler) CreateAppointment(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	if err := h.appointmentService.CreateAppointment(appointment); err != nil {
+	if err := h.appointmentService.CreateAppointment(r.Context(), appointment); err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
-	GenerateResponse(&w, http.StatusCreated, appointment)
+	GenerateResponse(&w, http.StatusCreated, appointment.In(loc))
 }
 
 func (h *AppointmentHandler) UpdateAppointmentStatus(w http.ResponseWriter, r *http.Request) {
@@ -79,26 +96,89 @@ func (h *AppointmentHandler) UpdateAppointmentStatus(w http.ResponseWriter, r *h
 		return
 	}
 
-	if err := h.doctorRepository.ValidateDoctorAccess(r.Context(), userID); err != nil {
+	var req models.AppointmentStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		GenerateErrorResponse(&w, e.NewBadRequestError("invalid request body"))
+		return
+	}
+
+	charge, err := h.appointmentService.UpdateAppointmentStatus(r.Context(), uint(id), userID, req.Status, req.Reason)
+	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
-	var status struct {
-		Status models.AppointmentStatus `json:"status"`
+	GenerateResponse(&w, http.StatusOK, statusResponse("Appointment status updated successfully", charge))
+}
+
+// statusResponse adds what a cancellation or no-show cost the patient to the
+// message
+func statusResponse(message string, charge *models.AppointmentCharge) map[string]interface{} {
+	response := map[string]interface{}{"message": message}
+	if charge != nil {
+		response["charge"] = charge
 	}
-	if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
-		GenerateErrorResponse(&w, e.NewBadRequestError("invalid request body"))
+	return response
+}
+
+// setStatus moves the appointment in the URL to status, the request body may
+// carry a reason for the history
+func (h *AppointmentHandler) setStatus(w http.ResponseWriter, r *http.Request, status models.AppointmentStatus, message string) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewBadRequestError("invalid appointment ID"))
+		return
+	}
+
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength > 0 {
+		if err := ParseRequestBody(w, r, &req); err != nil {
+			GenerateErrorResponse(&w, err)
+			return
+		}
+	}
+
+	charge, err := h.appointmentService.UpdateAppointmentStatus(r.Context(), uint(id), userID, status, req.Reason)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, statusResponse(message, charge))
+}
+
+func (h *AppointmentHandler) GetAppointmentHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewBadRequestError("invalid appointment ID"))
 		return
 	}
 
-	if err := h.appointmentService.UpdateAppointmentStatus(uint(id), status.Status); err != nil {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
-	GenerateResponse(&w, http.StatusOK, map[string]string{
-		"message": "Appointment status updated successfully",
+	events, err := h.appointmentService.GetAppointmentHistory(r.Context(), uint(id), userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]interface{}{
+		"appointment_id": id,
+		"events":         events,
 	})
 }
 
@@ -110,7 +190,7 @@ func (h *AppointmentHandler) GetAppointmentStatus(w http.ResponseWriter, r *http
 		return
 	}
 
-	appointment, err := h.appointmentService.GetAppointmentByID(uint(id))
+	appointment, err := h.appointmentService.GetAppointmentByID(r.Context(), uint(id))
 	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
@@ -143,7 +223,7 @@ func (h *AppointmentHandler) GetAppointment(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	appointment, err := h.appointmentService.GetAppointmentByID(uint(id))
+	appointment, err := h.appointmentService.GetAppointmentByID(r.Context(), uint(id))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
@@ -172,7 +252,7 @@ func (h *AppointmentHandler) GetMyAppointments(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	appointments, err := h.appointmentService.GetPatientAppointments(uid)
+	appointments, err := h.appointmentService.GetPatientAppointments(r.Context(), uid)
 	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
@@ -180,7 +260,7 @@ func (h *AppointmentHandler) GetMyAppointments(w http.ResponseWriter, r *http.Re
 
 	w.Header().Set("Content-Type", "application/json")
 	GenerateResponse(&w, http.StatusOK, map[string]interface{}{
-		"appointments": appointments,
+		"appointments": models.AppointmentsIn(appointments, h.callerLocation(r)),
 		"count":        len(appointments),
 	})
 }
@@ -263,19 +343,69 @@ func (h *AppointmentHandler) GetAvailableSlots(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	slots, err := h.appointmentService.GetAvailableSlots(uint(doctorID), date)
+	filter, err := slotFilterFromQuery(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	slots, err := h.appointmentService.GetAvailableSlots(uint(doctorID), date, filter)
 	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
 	GenerateResponse(&w, http.StatusOK, map[string]interface{}{
-		"slots": slots,
+		"slots": models.SlotsIn(slots, h.callerLocation(r)),
 		"date":  dateStr,
 		"count": len(slots),
 	})
 }
 
+// slotFilterFromQuery reads the practice location and distance a slot search
+// is narrowed to: affiliation or hospital_id, and lat, lng and radius_km
+func slotFilterFromQuery(r *http.Request) (models.SlotFilter, error) {
+	query := r.URL.Query()
+	filter := models.SlotFilter{Affiliation: strings.TrimSpace(query.Get("affiliation"))}
+
+	if hospitalID := query.Get("hospital_id"); hospitalID != "" {
+		id, err := strconv.ParseUint(hospitalID, 10, 32)
+		if err != nil {
+			return filter, e.NewBadRequestError("invalid hospital_id")
+		}
+		filter.HospitalID = uint(id)
+	}
+
+	latStr, lngStr := query.Get("lat"), query.Get("lng")
+	if (latStr == "") != (lngStr == "") {
+		return filter, e.NewBadRequestError("lat and lng must be given together")
+	}
+	if latStr != "" {
+		lat, err := strconv.ParseFloat(latStr, 64)
+		if err != nil || lat < -90 || lat > 90 {
+			return filter, e.NewBadRequestError("invalid lat")
+		}
+		lng, err := strconv.ParseFloat(lngStr, 64)
+		if err != nil || lng < -180 || lng > 180 {
+			return filter, e.NewBadRequestError("invalid lng")
+		}
+		filter.Near = &models.Location{Latitude: lat, Longitude: lng}
+	}
+
+	if radius := query.Get("radius_km"); radius != "" {
+		km, err := strconv.ParseFloat(radius, 64)
+		if err != nil || km <= 0 {
+			return filter, e.NewBadRequestError("invalid radius_km")
+		}
+		if filter.Near == nil {
+			return filter, e.NewBadRequestError("radius_km needs lat and lng")
+		}
+		filter.RadiusKm = km
+	}
+
+	return filter, nil
+}
+
 func (h *AppointmentHandler) GetUpcomingAppointments(w http.ResponseWriter, r *http.Request) {
 	userID, err := getUserIDFromContext(r)
 	if err != nil {
@@ -283,18 +413,13 @@ func (h *AppointmentHandler) GetUpcomingAppointments(w http.ResponseWriter, r *h
 		return
 	}
 
-	if err := h.doctorRepository.ValidateDoctorAccess(r.Context(), userID); err != nil {
-		GenerateErrorResponse(&w, err)
-		return
-	}
-
 	appointments, err := h.appointmentService.GetDoctorUpcomingAppointments(userID)
 	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
-	GenerateResponse(&w, http.StatusOK, appointments)
+	GenerateResponse(&w, http.StatusOK, models.AppointmentsIn(appointments, h.callerLocation(r)))
 }
 
 func (h *AppointmentHandler) GetPastAppointments(w http.ResponseWriter, r *http.Request) {
@@ -304,19 +429,13 @@ func (h *AppointmentHandler) GetPastAppointments(w http.ResponseWriter, r *http.
 		return
 	}
 
-	//check doctor access(wasnt working earlier)
-	if err := h.doctorRepository.ValidateDoctorAccess(r.Context(), userID); err != nil {
-		GenerateErrorResponse(&w, err)
-		return
-	}
-
 	appointments, err := h.appointmentService.GetDoctorPastAppointments(userID)
 	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
-	GenerateResponse(&w, http.StatusOK, appointments)
+	GenerateResponse(&w, http.StatusOK, models.AppointmentsIn(appointments, h.callerLocation(r)))
 }
 
 func (h *AppointmentHandler) GetMyUpcomingAppointments(w http.ResponseWriter, r *http.Request) {
@@ -326,14 +445,14 @@ func (h *AppointmentHandler) GetMyUpcomingAppointments(w http.ResponseWriter, r
 		return
 	}
 
-	appointments, err := h.appointmentService.GetPatientUpcomingAppointments(userID)
+	appointments, err := h.appointmentService.GetPatientUpcomingAppointments(r.Context(), userID)
 	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
 	GenerateResponse(&w, http.StatusOK, map[string]interface{}{
-		"appointments": appointments,
+		"appointments": models.AppointmentsIn(appointments, h.callerLocation(r)),
 		"count":        len(appointments),
 		"message":      "Upcoming appointments retrieved successfully",
 		"user_id":      userID, // for debugging Todo: remove in prod(dont forget)
@@ -347,13 +466,13 @@ func (h *AppointmentHandler) GetMyPastAppointments(w http.ResponseWriter, r *htt
 		return
 	}
 
-	appointments, err := h.appointmentService.GetPatientPastAppointments(userID)
+	appointments, err := h.appointmentService.GetPatientPastAppointments(r.Context(), userID)
 	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
-	GenerateResponse(&w, http.StatusOK, appointments)
+	GenerateResponse(&w, http.StatusOK, models.AppointmentsIn(appointments, h.callerLocation(r)))
 }
 
 func (h *AppointmentHandler) CancelAppointment(w http.ResponseWriter, r *http.Request) {
@@ -370,43 +489,59 @@ func (h *AppointmentHandler) CancelAppointment(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	if err := h.appointmentService.CancelAppointment(uint(id), userID); err != nil {
+	charge, err := h.appointmentService.CancelAppointment(r.Context(), uint(id), userID)
+	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
-	GenerateResponse(&w, http.StatusOK, map[string]string{"message": "Appointment cancelled successfully"})
+	GenerateResponse(&w, http.StatusOK, statusResponse("Appointment cancelled successfully", charge))
 }
 
-func (h *AppointmentHandler) GetTodayAppointments(w http.ResponseWriter, r *http.Request) {
-	userID, err := getUserIDFromContext(r)
+// GetCancellationCharge shows what cancelling the appointment now would cost,
+// so the patient can decide before cancelling
+func (h *AppointmentHandler) GetCancellationCharge(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
 	if err != nil {
-		GenerateErrorResponse(&w, err)
+		GenerateErrorResponse(&w, e.NewBadRequestError("invalid appointment ID"))
 		return
 	}
 
-	if err := h.doctorRepository.ValidateDoctorAccess(r.Context(), userID); err != nil {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
-	appointments, err := h.appointmentService.GetDoctorTodayAppointments(userID)
+	charge, err := h.appointmentService.GetCancellationCharge(r.Context(), uint(id), userID)
 	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
-	GenerateResponse(&w, http.StatusOK, appointments)
+	GenerateResponse(&w, http.StatusOK, charge)
 }
 
-func (h *AppointmentHandler) GetWeekAppointments(w http.ResponseWriter, r *http.Request) {
+func (h *AppointmentHandler) GetTodayAppointments(w http.ResponseWriter, r *http.Request) {
 	userID, err := getUserIDFromContext(r)
 	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
-	if err := h.doctorRepository.ValidateDoctorAccess(r.Context(), userID); err != nil {
+	appointments, err := h.appointmentService.GetDoctorTodayAppointments(userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, models.AppointmentsIn(appointments, h.callerLocation(r)))
+}
+
+func (h *AppointmentHandler) GetWeekAppointments(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
@@ -417,10 +552,26 @@ func (h *AppointmentHandler) GetWeekAppointments(w http.ResponseWriter, r *http.
 		return
 	}
 
-	GenerateResponse(&w, http.StatusOK, appointments)
+	GenerateResponse(&w, http.StatusOK, models.AppointmentsIn(appointments, h.callerLocation(r)))
 }
 
 func (h *AppointmentHandler) ConfirmAppointment(w http.ResponseWriter, r *http.Request) {
+	h.setStatus(w, r, models.StatusConfirmed, "Appointment confirmed")
+}
+
+func (h *AppointmentHandler) CheckInAppointment(w http.ResponseWriter, r *http.Request) {
+	h.setStatus(w, r, models.StatusCheckedIn, "Patient checked in")
+}
+
+func (h *AppointmentHandler) StartAppointment(w http.ResponseWriter, r *http.Request) {
+	h.setStatus(w, r, models.StatusInProgress, "Appointment started")
+}
+
+func (h *AppointmentHandler) CompleteAppointment(w http.ResponseWriter, r *http.Request) {
+	h.setStatus(w, r, models.StatusCompleted, "Appointment completed")
+}
+
+func (h *AppointmentHandler) RescheduleAppointment(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 32)
 	if err != nil {
@@ -428,30 +579,76 @@ func (h *AppointmentHandler) ConfirmAppointment(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	var req models.AppointmentRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	if err := h.appointmentService.RescheduleAppointment(r.Context(), uint(id), userID, &req); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]string{"message": "Appointment rescheduled successfully"})
+}
+
+func (h *AppointmentHandler) MarkNoShow(w http.ResponseWriter, r *http.Request) {
+	h.setStatus(w, r, models.StatusNoShow, "Appointment marked as no-show")
+}
+
+// // Helper function to get userID from context (just checking if its workin in utils)
+// func getUserIDFromContext(r *http.Request) (uint, error) {
+// 	userID := r.Context().Value("userID")
+// 	if userID == nil {
+// 		return 0, e.NewNotAuthorizedError("user ID not found in context")
+// 	}
+
+// 	// Handle different types of userID (float64 from JWT claims)
+// 	switch v := userID.(type) {
+// 	case float64:
+// 		return uint(v), nil
+// 	case uint:
+// 		return v, nil
+// 	case int:
+// 		return uint(v), nil
+// 	default:
+// 		return 0, e.NewNotAuthorizedError("invalid user ID format")
+// 	}
+// }
+
+func (h *AppointmentHandler) CreateHold(w http.ResponseWriter, r *http.Request) {
 	userID, err := getUserIDFromContext(r)
 	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
-	if err := h.doctorRepository.ValidateDoctorAccess(r.Context(), userID); err != nil {
+	var req models.SlotHoldRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
-	if err := h.appointmentService.UpdateAppointmentStatus(uint(id), models.StatusConfirmed); err != nil {
+	hold, err := h.appointmentService.CreateHold(r.Context(), userID, &req)
+	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
-	GenerateResponse(&w, http.StatusOK, map[string]string{"message": "Appointment confirmed"})
+	GenerateResponse(&w, http.StatusCreated, hold.In(h.callerLocation(r)))
 }
 
-func (h *AppointmentHandler) CompleteAppointment(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id, err := strconv.ParseUint(vars["id"], 10, 32)
+func (h *AppointmentHandler) GetHold(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
 	if err != nil {
-		GenerateErrorResponse(&w, e.NewBadRequestError("invalid appointment ID"))
+		GenerateErrorResponse(&w, e.NewBadRequestError("invalid hold ID"))
 		return
 	}
 
@@ -461,52 +658,142 @@ func (h *AppointmentHandler) CompleteAppointment(w http.ResponseWriter, r *http.
 		return
 	}
 
-	if err := h.doctorRepository.ValidateDoctorAccess(r.Context(), userID); err != nil {
+	hold, err := h.appointmentService.GetHold(r.Context(), uint(id), userID)
+	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
-	if err := h.appointmentService.UpdateAppointmentStatus(uint(id), models.StatusCompleted); err != nil {
+	GenerateResponse(&w, http.StatusOK, hold.In(h.callerLocation(r)))
+}
+
+func (h *AppointmentHandler) ReleaseHold(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewBadRequestError("invalid hold ID"))
+		return
+	}
+
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
-	GenerateResponse(&w, http.StatusOK, map[string]string{"message": "Appointment completed"})
+	if err := h.appointmentService.ReleaseHold(r.Context(), uint(id), userID); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]string{"message": "Hold released"})
 }
 
-func (h *AppointmentHandler) RescheduleAppointment(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id, err := strconv.ParseUint(vars["id"], 10, 32)
+func (h *AppointmentHandler) ConfirmHold(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
 	if err != nil {
-		GenerateErrorResponse(&w, e.NewBadRequestError("invalid appointment ID"))
+		GenerateErrorResponse(&w, e.NewBadRequestError("invalid hold ID"))
 		return
 	}
 
-	var req models.AppointmentRequest
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	var req models.ConfirmHoldRequest
 	if err := ParseRequestBody(w, r, &req); err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
+	appointment, err := h.appointmentService.ConfirmHold(r.Context(), uint(id), userID, &req)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusCreated, appointment.In(h.callerLocation(r)))
+}
+
+func (h *AppointmentHandler) CreateSeries(w http.ResponseWriter, r *http.Request) {
 	userID, err := getUserIDFromContext(r)
 	if err != nil {
+		GenerateErrorResponse(&w, e.NewNotAuthorizedError("unauthorized access"))
+		return
+	}
+
+	var req models.AppointmentSeriesRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
-	if err := h.appointmentService.RescheduleAppointment(uint(id), userID, &req); err != nil {
+	loc := h.callerLocation(r)
+	first, err := req.ToAppointment(userID, loc)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewValidationError(err.Error()))
+		return
+	}
+
+	recurrence, err := req.Recurrence.ToRecurrence(loc)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewValidationError(err.Error()))
+		return
+	}
+
+	if _, err := h.userRepository.FindByID(r.Context(), req.DoctorID); err != nil {
+		GenerateErrorResponse(&w, e.NewNotFoundError("doctor not found"))
+		return
+	}
+
+	result, err := h.appointmentService.CreateSeries(r.Context(), first, recurrence)
+	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
-	GenerateResponse(&w, http.StatusOK, map[string]string{"message": "Appointment rescheduled successfully"})
+	GenerateResponse(&w, http.StatusCreated, result.In(loc))
 }
 
-func (h *AppointmentHandler) MarkNoShow(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id, err := strconv.ParseUint(vars["id"], 10, 32)
+func (h *AppointmentHandler) GetSeries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
 	if err != nil {
-		GenerateErrorResponse(&w, e.NewBadRequestError("invalid appointment ID"))
+		GenerateErrorResponse(&w, e.NewBadRequestError("invalid series ID"))
+		return
+	}
+
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	series, err := h.appointmentService.GetSeries(r.Context(), uint(id), userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, series.In(h.callerLocation(r)))
+}
+
+func (h *AppointmentHandler) CancelSeries(w http.ResponseWriter, r *http.Request) {
+	h.changeSeries(w, r, h.appointmentService.CancelSeries)
+}
+
+func (h *AppointmentHandler) RescheduleSeries(w http.ResponseWriter, r *http.Request) {
+	h.changeSeries(w, r, h.appointmentService.RescheduleSeries)
+}
+
+type seriesChange func(ctx context.Context, seriesID uint, userID uint, req *models.SeriesChangeRequest) (*models.SeriesChangeResult, error)
+
+// changeSeries decodes a SeriesChangeRequest for the series in the URL and
+// applies it with change
+func (h *AppointmentHandler) changeSeries(w http.ResponseWriter, r *http.Request, change seriesChange) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewBadRequestError("invalid series ID"))
 		return
 	}
 
@@ -516,35 +803,129 @@ func (h *AppointmentHandler) MarkNoShow(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := h.doctorRepository.ValidateDoctorAccess(r.Context(), userID); err != nil {
+	var req models.SeriesChangeRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
-	if err := h.appointmentService.UpdateAppointmentStatus(uint(id), models.StatusNoShow); err != nil {
+	result, err := change(r.Context(), uint(id), userID, &req)
+	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
-	GenerateResponse(&w, http.StatusOK, map[string]string{"message": "Appointment marked as no-show"})
+	GenerateResponse(&w, http.StatusOK, result.In(h.callerLocation(r)))
 }
 
-// // Helper function to get userID from context (just checking if its workin in utils)
-// func getUserIDFromContext(r *http.Request) (uint, error) {
-// 	userID := r.Context().Value("userID")
-// 	if userID == nil {
-// 		return 0, e.NewNotAuthorizedError("user ID not found in context")
-// 	}
+func (h *AppointmentHandler) JoinWaitlist(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
 
-// 	// Handle different types of userID (float64 from JWT claims)
-// 	switch v := userID.(type) {
-// 	case float64:
-// 		return uint(v), nil
-// 	case uint:
-// 		return v, nil
-// 	case int:
-// 		return uint(v), nil
-// 	default:
-// 		return 0, e.NewNotAuthorizedError("invalid user ID format")
-// 	}
-// }
+	var req models.WaitlistRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	entry, err := h.appointmentService.JoinWaitlist(r.Context(), userID, &req)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusCreated, entry)
+}
+
+func (h *AppointmentHandler) GetMyWaitlist(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	entries, err := h.appointmentService.GetWaitlist(r.Context(), userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, entries)
+}
+
+func (h *AppointmentHandler) LeaveWaitlist(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewBadRequestError("invalid waitlist entry ID"))
+		return
+	}
+
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	if err := h.appointmentService.LeaveWaitlist(r.Context(), uint(id), userID); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]string{"message": "Removed from waitlist"})
+}
+
+func (h *AppointmentHandler) GetWaitlistOffer(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	offer, err := h.appointmentService.GetWaitlistOffer(r.Context(), mux.Vars(r)["token"], userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, offer.In(h.callerLocation(r)))
+}
+
+func (h *AppointmentHandler) ClaimWaitlistOffer(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	var req models.ConfirmHoldRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	appointment, err := h.appointmentService.ClaimWaitlistOffer(r.Context(), mux.Vars(r)["token"], userID, &req)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusCreated, appointment.In(h.callerLocation(r)))
+}
+
+func (h *AppointmentHandler) DeclineWaitlistOffer(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	if err := h.appointmentService.DeclineWaitlistOffer(r.Context(), mux.Vars(r)["token"], userID); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]string{"message": "Offer declined"})
+}
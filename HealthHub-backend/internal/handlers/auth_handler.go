@@ -92,11 +92,15 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	user, tokens, err := h.userService.Login(ctx, req.Email, req.Password)
+	user, tokens, challenge, err := h.userService.Login(ctx, req.Email, req.Password)
 	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
+	if challenge != nil {
+		GenerateResponse(&w, http.StatusOK, mfaChallengeResponse(challenge))
+		return
+	}
 
 	GenerateResponse(&w, http.StatusOK, map[string]interface{}{
 		"user":   user,
@@ -147,19 +151,55 @@ func (h *UserHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// ctx := r.Context()
-	TokenPair, err := utils.RefreshAccessTokens(refreshToken)
+	ctx := r.Context()
+	_, tokenPair, err := h.userService.RefreshUserToken(ctx, refreshToken)
 	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
 	response := map[string]interface{}{
-		"tokens": TokenPair,
+		"tokens": tokenPair,
 	}
 	GenerateResponse(&w, http.StatusOK, response)
 }
 
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	refreshToken := r.Header.Get("Refresh-Token")
+	if refreshToken == "" {
+		GenerateErrorResponse(&w, e.NewValidationError("refresh token required"))
+		return
+	}
+
+	ctx := r.Context()
+	if err := h.userService.Logout(ctx, refreshToken); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]string{
+		"message": "logged out",
+	})
+}
+
+func (h *UserHandler) LogoutAllDevices(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewNotAuthorizedError("unauthorized"))
+		return
+	}
+
+	if err := h.userService.LogoutAllDevices(ctx, userID); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]string{
+		"message": "logged out of all devices",
+	})
+}
+
 func (h *UserHandler) GoogleLogin(w http.ResponseWriter, r *http.Request) {
 	url := env.GoogleOAuthConfig.AuthCodeURL(env.OAuthStateString)
 	GenerateResponse(&w, http.StatusOK, map[string]string{
@@ -187,7 +227,7 @@ func (h *UserHandler) GoogleCallback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	user, tokens, err := h.userService.HandleGoogleCallback(ctx, code)
+	user, tokens, challenge, err := h.userService.HandleGoogleCallback(ctx, code)
 	if err != nil {
 		redirectURL := fmt.Sprintf("%s?error=%s",
 			env.OAuthRedirects.ErrorRedirect,
@@ -196,20 +236,7 @@ func (h *UserHandler) GoogleCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	baseRedirect := env.OAuthRedirects.ExistingUserRedirect
-	if user.IsNewUser {
-		baseRedirect = env.OAuthRedirects.NewUserRedirect
-	}
-
-	redirectURL := fmt.Sprintf("%s?access_token=%s&refresh_token=%s&is_new_user=%t",
-		baseRedirect,
-		url.QueryEscape(tokens.AccessToken),
-		url.QueryEscape(tokens.RefreshToken),
-		user.IsNewUser)
-
-	w.Header().Set("Access-Control-Allow-Origin", env.FrontendConfig.BaseURL)
-	w.Header().Set("Access-Control-Allow-Credentials", "true")
-	http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
+	redirectOAuthLogin(w, r, user, tokens, challenge)
 }
 
 func (h *UserHandler) ResendOTP(w http.ResponseWriter, r *http.Request) {
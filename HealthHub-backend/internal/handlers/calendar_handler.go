@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/services"
+	"HealthHubConnect/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+type CalendarHandler struct {
+	calendarService *services.CalendarService
+}
+
+func NewCalendarHandler(calendarService *services.CalendarService) *CalendarHandler {
+	return &CalendarHandler{
+		calendarService: calendarService,
+	}
+}
+
+func (h *CalendarHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	feed, err := h.calendarService.GetFeed(ctx, userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, calendarFeedResponse(r, feed))
+}
+
+// RotateFeed creates the user's feed, or replaces its token if they have one
+func (h *CalendarHandler) RotateFeed(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	feed, err := h.calendarService.RotateFeed(ctx, userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusCreated, calendarFeedResponse(r, feed))
+}
+
+func (h *CalendarHandler) RevokeFeed(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	if err := h.calendarService.RevokeFeed(ctx, userID); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]string{"message": "calendar feed revoked"})
+}
+
+// Feed serves the calendar to subscribed calendar apps, the token in the path
+// is the only credential
+func (h *CalendarHandler) Feed(w http.ResponseWriter, r *http.Request) {
+	calendar, err := h.calendarService.Feed(r.Context(), mux.Vars(r)["token"])
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="healthhub.ics"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(calendar)))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(calendar)
+}
+
+// calendarFeedResponse builds the subscription URL from the host the request
+// came in on, so it points at this API whatever it is deployed behind
+func calendarFeedResponse(r *http.Request, feed *models.CalendarFeed) models.CalendarFeedResponse {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "https" || proto == "http" {
+		scheme = proto
+	}
+
+	return models.CalendarFeedResponse{
+		URL:       fmt.Sprintf("%s://%s/v1/calendar/%s.ics", scheme, r.Host, feed.Token),
+		CreatedAt: feed.CreatedAt,
+	}
+}
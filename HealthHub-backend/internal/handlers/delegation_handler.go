@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/services"
+	"HealthHubConnect/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+type DelegationHandler struct {
+	delegationService *services.DelegationService
+}
+
+func NewDelegationHandler(delegationService *services.DelegationService) *DelegationHandler {
+	return &DelegationHandler{
+		delegationService: delegationService,
+	}
+}
+
+func parseIDParam(r *http.Request, name string) (uint, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)[name], 10, 32)
+	if err != nil {
+		return 0, e.NewValidationError("invalid " + name)
+	}
+	return uint(id), nil
+}
+
+// Grant gives a caregiver access to the signed-in patient's account
+func (h *DelegationHandler) Grant(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	var input services.GrantDelegationInput
+	if err := ParseRequestBody(w, r, &input); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	delegation, err := h.delegationService.Grant(ctx, userID, input)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusCreated, delegation)
+}
+
+func (h *DelegationHandler) ListGranted(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	delegations, err := h.delegationService.ListGranted(ctx, userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]interface{}{
+		"delegations": delegations,
+	})
+}
+
+func (h *DelegationHandler) ListReceived(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	delegations, err := h.delegationService.ListReceived(ctx, userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]interface{}{
+		"delegations": delegations,
+	})
+}
+
+func (h *DelegationHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	delegationID, err := parseIDParam(r, "id")
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	if err := h.delegationService.Revoke(ctx, userID, delegationID); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]string{
+		"message": "Delegated access revoked",
+	})
+}
+
+// GrantForMinor lets an admin give a guardian access to a minor's account
+func (h *DelegationHandler) GrantForMinor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	adminID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	patientID, err := parseIDParam(r, "id")
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	var input services.GrantDelegationInput
+	if err := ParseRequestBody(w, r, &input); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	delegation, err := h.delegationService.GrantForMinor(ctx, adminID, patientID, input)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusCreated, delegation)
+}
+
+func (h *DelegationHandler) ListPatientDelegations(w http.ResponseWriter, r *http.Request) {
+	patientID, err := parseIDParam(r, "id")
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	delegations, err := h.delegationService.ListGranted(r.Context(), patientID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]interface{}{
+		"delegations": delegations,
+	})
+}
+
+func (h *DelegationHandler) RevokeAsAdmin(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	adminID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	delegationID, err := parseIDParam(r, "id")
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	if err := h.delegationService.RevokeAsAdmin(ctx, adminID, delegationID); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]string{
+		"message": "Delegated access revoked",
+	})
+}
@@ -58,12 +58,17 @@ func (h *DoctorHandler) Login(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Doctor login attempt for email: %s", req.Email)
 
 	ctx := r.Context()
-	user, tokens, err := h.userService.LoginWithRole(ctx, req.Email, req.Password, models.RoleDoctor)
+	user, tokens, challenge, err := h.userService.LoginWithRole(ctx, req.Email, req.Password, models.RoleDoctor)
 	if err != nil {
 		log.Printf("Doctor login failed for email %s: %v", req.Email, err)
 		GenerateErrorResponse(&w, err)
 		return
 	}
+	if challenge != nil {
+		log.Printf("Doctor login for email %s awaiting second factor", req.Email)
+		GenerateResponse(&w, http.StatusOK, mfaChallengeResponse(challenge))
+		return
+	}
 
 	log.Printf("Doctor login successful for email: %s", req.Email)
 	GenerateResponse(&w, http.StatusOK, map[string]interface{}{
@@ -128,13 +128,16 @@ func (h *DoctorProfileHandler) SaveSchedule(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	if err := h.doctorService.SaveSchedule(r.Context(), userID, &req); err != nil {
+	impact, err := h.doctorService.SaveSchedule(r.Context(), userID, &req)
+	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
 	}
 
-	GenerateResponse(&w, http.StatusOK, map[string]string{
-		"message": "Schedule saved successfully",
+	GenerateResponse(&w, http.StatusOK, map[string]interface{}{
+		"message":  "Schedule saved successfully",
+		"version":  impact.Version.Version,
+		"orphaned": impact.Orphaned,
 	})
 }
 
@@ -154,6 +157,106 @@ func (h *DoctorProfileHandler) GetSchedule(w http.ResponseWriter, r *http.Reques
 	GenerateResponse(&w, http.StatusOK, scheduleResponse)
 }
 
+func (h *DoctorProfileHandler) ListScheduleTemplates(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	templates, err := h.doctorService.ListScheduleTemplates(r.Context(), userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, templates)
+}
+
+func (h *DoctorProfileHandler) SaveScheduleTemplate(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	var req models.ScheduleTemplateRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	impact, err := h.doctorService.SaveScheduleTemplate(r.Context(), userID, &req)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusCreated, impact)
+}
+
+// PreviewScheduleTemplate shows the weekdays a template or weekly schedule
+// would change and the booked appointments it would orphan, saving nothing
+func (h *DoctorProfileHandler) PreviewScheduleTemplate(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	var req models.ScheduleTemplateRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	impact, err := h.doctorService.PreviewScheduleTemplate(r.Context(), userID, &req)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, impact)
+}
+
+func (h *DoctorProfileHandler) ListScheduleVersions(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	versions, err := h.doctorService.ListScheduleVersions(r.Context(), userID, r.URL.Query().Get("name"))
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, versions)
+}
+
+func (h *DoctorProfileHandler) GetScheduleVersion(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewBadRequestError("invalid schedule version ID"))
+		return
+	}
+
+	version, err := h.doctorService.GetScheduleVersion(r.Context(), userID, uint(id))
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, version)
+}
+
 type ExtendAvailabilityRequest struct {
 	WeeksToAdd int `json:"weeks_to_add" validate:"required,min=1,max=52"`
 }
@@ -181,19 +284,44 @@ func (h *DoctorProfileHandler) ExtendAvailability(w http.ResponseWriter, r *http
 	})
 }
 
+// ListDoctors searches doctors by free text in q and by name, narrowed by
+// any facet given as a parameter of its name and by fee_min and fee_max
 func (h *DoctorProfileHandler) ListDoctors(w http.ResponseWriter, r *http.Request) {
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-
-	filters := make(map[string]interface{})
-	if specialization := r.URL.Query().Get("specialization"); specialization != "" {
-		filters["specialization"] = specialization
+	params := r.URL.Query()
+	page, _ := strconv.Atoi(params.Get("page"))
+	limit, _ := strconv.Atoi(params.Get("limit"))
+
+	query := &models.DoctorSearchQuery{
+		Text:    params.Get("q"),
+		Name:    params.Get("name"),
+		Filters: map[string]string{},
+		Page:    page,
+		Limit:   limit,
+	}
+	for _, facet := range models.SearchFacets {
+		if value := params.Get(facet); value != "" {
+			query.Filters[facet] = value
+		}
+	}
+	switch query.Filters[models.FacetConsultationType] {
+	case "", models.ConsultationOnline, models.ConsultationInPerson:
+	default:
+		GenerateErrorResponse(&w, e.NewBadRequestError(fmt.Sprintf("consultation_type must be %s or %s", models.ConsultationOnline, models.ConsultationInPerson)))
+		return
 	}
-	if name := r.URL.Query().Get("name"); name != "" {
-		filters["name"] = name
+
+	for param, fee := range map[string]**float64{"fee_min": &query.FeeMin, "fee_max": &query.FeeMax} {
+		if value := params.Get(param); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed < 0 {
+				GenerateErrorResponse(&w, e.NewBadRequestError(fmt.Sprintf("invalid %s", param)))
+				return
+			}
+			*fee = &parsed
+		}
 	}
 
-	response, err := h.doctorService.ListDoctors(r.Context(), filters, page, limit)
+	response, err := h.doctorService.ListDoctors(r.Context(), query)
 	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
@@ -256,6 +384,30 @@ func (h *DoctorProfileHandler) BlockSlot(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+func (h *DoctorProfileHandler) UnblockSlot(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	blockID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewBadRequestError("invalid blocked slot ID"))
+		return
+	}
+
+	if err := h.doctorService.UnblockSlot(r.Context(), userID, uint(blockID)); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]string{
+		"message": "Slot unblocked successfully",
+	})
+}
+
 func (h *DoctorProfileHandler) GetAvailableSlots(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	doctorID, err := strconv.ParseUint(vars["doctorId"], 10, 32)
@@ -281,7 +433,13 @@ func (h *DoctorProfileHandler) GetAvailableSlots(w http.ResponseWriter, r *http.
 		return
 	}
 
-	slots, err := h.doctorService.GetAvailableSlots(uint(doctorID), date)
+	filter, err := slotFilterFromQuery(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	slots, err := h.doctorService.GetAvailableSlots(uint(doctorID), date, filter)
 	if err != nil {
 		GenerateErrorResponse(&w, err)
 		return
@@ -378,6 +536,12 @@ func validateBillingSettings(settings *models.BillingSettings) error {
 	if settings.ConsultationFees.FollowUp.Amount < 0 {
 		return fmt.Errorf("follow-up consultation amount cannot be negative")
 	}
+	if refund := settings.ConsultationFees.CancellationPolicy.RefundPercent; refund < 0 || refund > 100 {
+		return fmt.Errorf("cancellation refund percentage must be between 0 and 100")
+	}
+	if settings.ConsultationFees.CancellationPolicy.MinCancelHours < 0 {
+		return fmt.Errorf("minimum cancellation notice cannot be negative")
+	}
 
 	if len(settings.PaymentMethods) == 0 {
 		return fmt.Errorf("at least one payment method is required")
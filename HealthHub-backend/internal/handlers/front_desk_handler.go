@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/services"
+	wsManager "HealthHubConnect/internal/websocket"
+	"HealthHubConnect/pkg/logger"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// FrontDeskHandler serves receptionists at a doctor's front desk and the
+// waiting room displays showing the doctor's queue
+type FrontDeskHandler struct {
+	*AppointmentHandler
+	manager *wsManager.Manager
+}
+
+func NewFrontDeskHandler(appointmentHandler *AppointmentHandler, manager *wsManager.Manager) *FrontDeskHandler {
+	return &FrontDeskHandler{
+		AppointmentHandler: appointmentHandler,
+		manager:            manager,
+	}
+}
+
+func (h *FrontDeskHandler) ListStaff(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	staff, err := h.appointmentService.ListFrontDeskStaff(r.Context(), userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, staff)
+}
+
+func (h *FrontDeskHandler) AddStaff(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	var req models.FrontDeskStaffRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	assignment, err := h.appointmentService.AddFrontDeskStaff(r.Context(), userID, &req)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusCreated, assignment)
+}
+
+func (h *FrontDeskHandler) RemoveStaff(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	receptionistID, err := strconv.ParseUint(mux.Vars(r)["receptionistId"], 10, 32)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewBadRequestError("invalid receptionist ID"))
+		return
+	}
+
+	if err := h.appointmentService.RemoveFrontDeskStaff(r.Context(), userID, uint(receptionistID)); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]string{
+		"message": "Receptionist removed from the front desk",
+	})
+}
+
+func (h *FrontDeskHandler) ListDoctors(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	doctors, err := h.appointmentService.FrontDeskDoctors(r.Context(), userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, doctors)
+}
+
+func (h *FrontDeskHandler) FindPatients(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	var phone int64
+	if phoneStr := r.URL.Query().Get("phone"); phoneStr != "" {
+		if phone, err = strconv.ParseInt(phoneStr, 10, 64); err != nil {
+			GenerateErrorResponse(&w, e.NewBadRequestError("invalid phone number"))
+			return
+		}
+	}
+
+	patients, err := h.appointmentService.FindFrontDeskPatients(r.Context(), userID, r.URL.Query().Get("email"), phone)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, patients)
+}
+
+func (h *FrontDeskHandler) BookAppointment(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	var req models.FrontDeskBookingRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	loc := h.callerLocation(r)
+	appointment, err := req.ToAppointment(req.PatientID, loc)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewValidationError(err.Error()))
+		return
+	}
+
+	if err := h.appointmentService.BookAtFrontDesk(r.Context(), userID, appointment); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusCreated, appointment.In(loc))
+}
+
+func (h *FrontDeskHandler) RegisterWalkIn(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	var req models.WalkInRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	appointment, err := h.appointmentService.RegisterWalkIn(r.Context(), userID, &req)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusCreated, appointment.In(h.callerLocation(r)))
+}
+
+func (h *FrontDeskHandler) CheckIn(w http.ResponseWriter, r *http.Request) {
+	h.setFrontDeskStatus(w, r, models.StatusCheckedIn, "Patient checked in")
+}
+
+func (h *FrontDeskHandler) MarkNoShow(w http.ResponseWriter, r *http.Request) {
+	h.setFrontDeskStatus(w, r, models.StatusNoShow, "Appointment marked as no-show")
+}
+
+func (h *FrontDeskHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	h.setFrontDeskStatus(w, r, models.StatusCancelled, "Appointment cancelled")
+}
+
+// setFrontDeskStatus is setStatus for the desk, which may only touch the
+// appointments of the doctors it works for
+func (h *FrontDeskHandler) setFrontDeskStatus(w http.ResponseWriter, r *http.Request, status models.AppointmentStatus, message string) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewBadRequestError("invalid appointment ID"))
+		return
+	}
+
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength > 0 {
+		if err := ParseRequestBody(w, r, &req); err != nil {
+			GenerateErrorResponse(&w, err)
+			return
+		}
+	}
+
+	appointment, charge, err := h.appointmentService.UpdateFrontDeskStatus(r.Context(), uint(id), userID, status, req.Reason)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	response := statusResponse(message, charge)
+	response["appointment"] = appointment.In(h.callerLocation(r))
+	GenerateResponse(&w, http.StatusOK, response)
+}
+
+func (h *FrontDeskHandler) GetQueue(w http.ResponseWriter, r *http.Request) {
+	doctorID, err := strconv.ParseUint(mux.Vars(r)["doctorId"], 10, 32)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewBadRequestError("invalid doctor ID"))
+		return
+	}
+
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	queue, err := h.appointmentService.GetQueue(r.Context(), uint(doctorID), userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, queue.In(h.callerLocation(r)))
+}
+
+// QueueSocket subscribes a waiting room display to the doctor's queue. It
+// gets the queue as it is on connecting and again whenever it changes, with
+// times in the doctor's zone.
+func (h *FrontDeskHandler) QueueSocket(w http.ResponseWriter, r *http.Request) {
+	doctorID, err := strconv.ParseUint(mux.Vars(r)["doctorId"], 10, 32)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewBadRequestError("invalid doctor ID"))
+		return
+	}
+
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	queue, err := h.appointmentService.GetQueue(r.Context(), uint(doctorID), userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+	snapshot, err := json.Marshal(WSResponse{Type: "queue", Payload: queue})
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.GetLogger().ServerLogger.Error().Err(err).Msg("WebSocket upgrade failed")
+		return
+	}
+
+	// the display is a public screen, it isn't registered as the signed-in
+	// user so their personal messages never reach it
+	client := &wsManager.Client{
+		Conn:  conn,
+		Send:  make(chan []byte, 16),
+		Topic: services.QueueTopic(uint(doctorID)),
+	}
+	client.Send <- snapshot
+	h.manager.Register(client)
+
+	go h.readUntilClosed(client)
+	go writePump(client)
+}
+
+// readUntilClosed keeps a display's connection alive on its pongs and lets
+// it go when it closes. Displays only listen, anything they send is ignored.
+func (h *FrontDeskHandler) readUntilClosed(client *wsManager.Client) {
+	defer func() {
+		h.manager.Unregister(client)
+		client.Conn.Close()
+	}()
+
+	client.Conn.SetReadLimit(4096)
+	client.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	client.Conn.SetPongHandler(func(string) error {
+		client.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		return nil
+	})
+
+	for {
+		if _, _, err := client.Conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
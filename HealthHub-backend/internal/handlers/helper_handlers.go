@@ -9,6 +9,7 @@ import (
 	"time"
 
 	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/utils"
 	"HealthHubConnect/pkg/logger"
 )
 
@@ -135,3 +136,20 @@ func HealthCheck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// JWKS publishes the public keys access tokens are signed with, for services
+// that verify HealthHub tokens on their own
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	keySet, err := utils.PublicJWKS()
+	if err != nil {
+		http.Error(w, "signing keys unavailable", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(keySet); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
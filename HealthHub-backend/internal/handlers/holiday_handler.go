@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/services"
+	"HealthHubConnect/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+type HolidayHandler struct {
+	holidayService *services.HolidayService
+}
+
+func NewHolidayHandler(holidayService *services.HolidayService) *HolidayHandler {
+	return &HolidayHandler{
+		holidayService: holidayService,
+	}
+}
+
+func (h *HolidayHandler) CreateCalendar(w http.ResponseWriter, r *http.Request) {
+	var req models.HolidayCalendarRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	calendar, err := h.holidayService.CreateCalendar(r.Context(), &req)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusCreated, calendar)
+}
+
+func (h *HolidayHandler) ListCalendars(w http.ResponseWriter, r *http.Request) {
+	calendars, err := h.holidayService.ListCalendars(r.Context())
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, calendars)
+}
+
+func (h *HolidayHandler) DeleteCalendar(w http.ResponseWriter, r *http.Request) {
+	calendarID, err := calendarIDFromPath(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	if err := h.holidayService.DeleteCalendar(r.Context(), calendarID); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]string{
+		"message": "Holiday calendar deleted successfully",
+	})
+}
+
+func (h *HolidayHandler) AddHoliday(w http.ResponseWriter, r *http.Request) {
+	calendarID, err := calendarIDFromPath(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	var req models.HolidayRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	holiday, err := h.holidayService.AddHoliday(r.Context(), calendarID, &req)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusCreated, holiday)
+}
+
+func (h *HolidayHandler) RemoveHoliday(w http.ResponseWriter, r *http.Request) {
+	calendarID, err := calendarIDFromPath(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	holidayID, err := strconv.ParseUint(mux.Vars(r)["holidayId"], 10, 32)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewBadRequestError("invalid holiday ID"))
+		return
+	}
+
+	if err := h.holidayService.RemoveHoliday(r.Context(), calendarID, uint(holidayID)); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]string{
+		"message": "Holiday removed successfully",
+	})
+}
+
+// DoctorCalendars lists the holiday calendars with the ones the doctor
+// follows marked
+func (h *HolidayHandler) DoctorCalendars(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	calendars, err := h.holidayService.DoctorCalendars(ctx, userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, calendars)
+}
+
+func (h *HolidayHandler) FollowCalendar(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	calendarID, err := calendarIDFromPath(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	calendar, err := h.holidayService.FollowCalendar(ctx, userID, calendarID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, calendar)
+}
+
+func (h *HolidayHandler) UnfollowCalendar(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	calendarID, err := calendarIDFromPath(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	if err := h.holidayService.UnfollowCalendar(ctx, userID, calendarID); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]string{
+		"message": "Holiday calendar unfollowed successfully",
+	})
+}
+
+func calendarIDFromPath(r *http.Request) (uint, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		return 0, e.NewBadRequestError("invalid holiday calendar ID")
+	}
+	return uint(id), nil
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"net/http"
+
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/services"
+	"HealthHubConnect/internal/utils"
+)
+
+type MFAHandler struct {
+	userService *services.UserService
+	mfaService  *services.MFAService
+}
+
+func NewMFAHandler(userService *services.UserService, mfaService *services.MFAService) *MFAHandler {
+	return &MFAHandler{
+		userService: userService,
+		mfaService:  mfaService,
+	}
+}
+
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token" validate:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type MFAEnrollWithTokenRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+func mfaChallengeResponse(challenge *services.MFAChallenge) map[string]interface{} {
+	return map[string]interface{}{
+		"mfa_required":        true,
+		"mfa_token":           challenge.MFAToken,
+		"enrollment_required": challenge.EnrollmentRequired,
+		"expires_in":          challenge.ExpiresIn,
+	}
+}
+
+// VerifyLogin is the second login step, taking either a TOTP code or a recovery code
+func (h *MFAHandler) VerifyLogin(w http.ResponseWriter, r *http.Request) {
+	var req MFALoginRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+	if req.MFAToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		GenerateErrorResponse(&w, e.NewValidationError("mfa_token and either code or recovery_code are required"))
+		return
+	}
+
+	ctx := r.Context()
+	user, tokens, recoveryCodes, err := h.userService.CompleteMFALogin(ctx, req.MFAToken, req.Code, req.RecoveryCode)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"user":   user,
+		"tokens": tokens,
+	}
+	if recoveryCodes != nil {
+		response["recovery_codes"] = recoveryCodes
+	}
+	GenerateResponse(&w, http.StatusOK, response)
+}
+
+// EnrollWithToken starts enrollment for accounts the MFA policy forces to enroll at login
+func (h *MFAHandler) EnrollWithToken(w http.ResponseWriter, r *http.Request) {
+	var req MFAEnrollWithTokenRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	enrollment, err := h.mfaService.BeginEnrollmentWithToken(r.Context(), req.MFAToken)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, enrollment)
+}
+
+func (h *MFAHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+	role, err := utils.GetUserRoleFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	status, err := h.mfaService.GetStatus(ctx, userID, role)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, status)
+}
+
+func (h *MFAHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	enrollment, err := h.mfaService.BeginEnrollmentForUser(ctx, userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, enrollment)
+}
+
+func (h *MFAHandler) ConfirmEnrollment(w http.ResponseWriter, r *http.Request) {
+	var req MFACodeRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	recoveryCodes, err := h.mfaService.ConfirmEnrollment(ctx, userID, req.Code)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]interface{}{
+		"message":        "two-factor authentication enabled",
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+func (h *MFAHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var req MFACodeRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	recoveryCodes, err := h.mfaService.RegenerateRecoveryCodes(ctx, userID, req.Code)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]interface{}{
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+func (h *MFAHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	var req MFACodeRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	if err := h.mfaService.Disable(ctx, userID, req.Code); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]string{
+		"message": "two-factor authentication disabled",
+	})
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"HealthHubConnect/env"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/services"
+	"HealthHubConnect/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+type OAuthHandler struct {
+	userService  *services.UserService
+	oauthService *services.OAuthService
+}
+
+func NewOAuthHandler(userService *services.UserService, oauthService *services.OAuthService) *OAuthHandler {
+	return &OAuthHandler{
+		userService:  userService,
+		oauthService: oauthService,
+	}
+}
+
+// redirectOAuthLogin sends the browser back to the frontend after a provider
+// login, with either the tokens or the MFA challenge to answer first
+func redirectOAuthLogin(w http.ResponseWriter, r *http.Request, user *models.User, tokens utils.TokenPair, challenge *services.MFAChallenge) {
+	var redirectURL string
+	if challenge != nil {
+		redirectURL = fmt.Sprintf("%s?mfa_token=%s&enrollment_required=%t",
+			env.OAuthRedirects.ExistingUserRedirect,
+			url.QueryEscape(challenge.MFAToken),
+			challenge.EnrollmentRequired)
+	} else {
+		baseRedirect := env.OAuthRedirects.ExistingUserRedirect
+		if user.IsNewUser {
+			baseRedirect = env.OAuthRedirects.NewUserRedirect
+		}
+
+		redirectURL = fmt.Sprintf("%s?access_token=%s&refresh_token=%s&is_new_user=%t",
+			baseRedirect,
+			url.QueryEscape(tokens.AccessToken),
+			url.QueryEscape(tokens.RefreshToken),
+			user.IsNewUser)
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", env.FrontendConfig.BaseURL)
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
+}
+
+func redirectOAuthError(w http.ResponseWriter, r *http.Request, message string) {
+	redirectURL := fmt.Sprintf("%s?error=%s",
+		env.OAuthRedirects.ErrorRedirect,
+		url.QueryEscape(message))
+	http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
+}
+
+func (h *OAuthHandler) ListProviders(w http.ResponseWriter, r *http.Request) {
+	GenerateResponse(&w, http.StatusOK, map[string]interface{}{
+		"providers": h.oauthService.Providers(),
+	})
+}
+
+func (h *OAuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	authURL, err := h.oauthService.BeginLogin(ctx, mux.Vars(r)["provider"])
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]string{
+		"url": authURL,
+	})
+}
+
+func (h *OAuthHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		redirectOAuthError(w, r, providerError)
+		return
+	}
+
+	code := query.Get("code")
+	state := query.Get("state")
+	if code == "" || state == "" {
+		redirectOAuthError(w, r, "missing_code")
+		return
+	}
+
+	ctx := r.Context()
+	result, err := h.oauthService.HandleCallback(ctx, mux.Vars(r)["provider"], code, state)
+	if err != nil {
+		redirectOAuthError(w, r, err.Error())
+		return
+	}
+
+	if result.LinkedProvider != "" {
+		redirectURL := fmt.Sprintf("%s?linked=%s",
+			env.OAuthRedirects.ExistingUserRedirect,
+			url.QueryEscape(result.LinkedProvider))
+		http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
+		return
+	}
+
+	user, tokens, challenge, err := h.userService.ContinueExternalLogin(ctx, result.User)
+	if err != nil {
+		redirectOAuthError(w, r, err.Error())
+		return
+	}
+
+	redirectOAuthLogin(w, r, user, tokens, challenge)
+}
+
+func (h *OAuthHandler) LinkedAccounts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	accounts, err := h.oauthService.LinkedAccounts(ctx, userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]interface{}{
+		"accounts": accounts,
+	})
+}
+
+// Link starts the provider flow that attaches its account to the signed-in user
+func (h *OAuthHandler) Link(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	authURL, err := h.oauthService.BeginLink(ctx, userID, mux.Vars(r)["provider"])
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]string{
+		"url": authURL,
+	})
+}
+
+func (h *OAuthHandler) Unlink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	provider := mux.Vars(r)["provider"]
+	if err := h.oauthService.Unlink(ctx, userID, provider); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]string{
+		"message": fmt.Sprintf("%s account unlinked", provider),
+	})
+}
@@ -15,8 +15,9 @@ type APIResponse struct {
 }
 
 type APIErrorDescription struct {
-	Message   string `json:"message"`
-	ErrorCode string `json:"error_code"`
+	Message   string      `json:"message"`
+	ErrorCode string      `json:"error_code"`
+	Details   interface{} `json:"details,omitempty"`
 }
 
 func GenerateResponse(w *http.ResponseWriter, status int, data interface{}) {
@@ -42,7 +43,7 @@ func GenerateErrorResponse(w *http.ResponseWriter, errorObject error) {
 	response := APIResponse{
 		Success: false,
 		Code:    errorObjectCustom.StatusCode,
-		Data:    APIErrorDescription{Message: errorObjectCustom.Message, ErrorCode: errorObjectCustom.ErrorCode},
+		Data:    APIErrorDescription{Message: errorObjectCustom.Message, ErrorCode: errorObjectCustom.ErrorCode, Details: errorObjectCustom.Details},
 	}
 	(*w).Header().Set("Content-Type", "application/json")
 	(*w).WriteHeader(errorObjectCustom.StatusCode)
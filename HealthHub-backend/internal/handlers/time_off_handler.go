@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *AppointmentHandler) CreateTimeOff(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	var req models.TimeOffRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	result, err := h.appointmentService.CreateTimeOff(r.Context(), userID, &req)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusCreated, result.In(h.callerLocation(r)))
+}
+
+func (h *AppointmentHandler) ListTimeOff(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	timeOff, err := h.appointmentService.ListTimeOff(r.Context(), userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	loc := h.callerLocation(r)
+	for i := range timeOff {
+		timeOff[i] = timeOff[i].In(loc)
+	}
+	GenerateResponse(&w, http.StatusOK, timeOff)
+}
+
+func (h *AppointmentHandler) GetTimeOff(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewBadRequestError("invalid time off ID"))
+		return
+	}
+
+	result, err := h.appointmentService.GetTimeOff(r.Context(), uint(id), userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, result.In(h.callerLocation(r)))
+}
+
+func (h *AppointmentHandler) DeleteTimeOff(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewBadRequestError("invalid time off ID"))
+		return
+	}
+
+	if err := h.appointmentService.DeleteTimeOff(r.Context(), uint(id), userID); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, map[string]string{
+		"message": "Time off removed successfully",
+	})
+}
+
+func (h *AppointmentHandler) ResolveTimeOff(w http.ResponseWriter, r *http.Request) {
+	h.resolveLeave(w, r, "invalid time off ID", h.appointmentService.ResolveTimeOff)
+}
+
+func (h *AppointmentHandler) GetHolidays(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	impacts, err := h.appointmentService.GetHolidays(r.Context(), userID)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	loc := h.callerLocation(r)
+	for i := range impacts {
+		impacts[i] = impacts[i].In(loc)
+	}
+	GenerateResponse(&w, http.StatusOK, impacts)
+}
+
+func (h *AppointmentHandler) ResolveHoliday(w http.ResponseWriter, r *http.Request) {
+	h.resolveLeave(w, r, "invalid holiday ID", h.appointmentService.ResolveHoliday)
+}
+
+type leaveResolution func(ctx context.Context, id uint, doctorID uint, req *models.TimeOffActionRequest) (*models.TimeOffActionResult, error)
+
+// resolveLeave decodes a TimeOffActionRequest for the time off or holiday in
+// the URL and applies it with resolve
+func (h *AppointmentHandler) resolveLeave(w http.ResponseWriter, r *http.Request, invalidID string, resolve leaveResolution) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		GenerateErrorResponse(&w, e.NewBadRequestError(invalidID))
+		return
+	}
+
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	var req models.TimeOffActionRequest
+	if err := ParseRequestBody(w, r, &req); err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	result, err := resolve(r.Context(), uint(id), userID, &req)
+	if err != nil {
+		GenerateErrorResponse(&w, err)
+		return
+	}
+
+	GenerateResponse(&w, http.StatusOK, result.In(h.callerLocation(r)))
+}
@@ -95,7 +95,7 @@ func (h *WebSocketHandler) HandleWebSocket(w http.ResponseWriter, r *http.Reques
 		Msg("WebSocket connection established")
 
 	go h.readPump(client, r.Context())
-	go h.writePump(client)
+	go writePump(client)
 }
 
 type WSResponse struct {
@@ -315,7 +315,7 @@ func (h *WebSocketHandler) readPump(client *wsManager.Client, ctx context.Contex
 	}
 }
 
-func (h *WebSocketHandler) writePump(client *wsManager.Client) {
+func writePump(client *wsManager.Client) {
 	loggerManager := logger.GetLogger()
 	ticker := time.NewTicker(30 * time.Second)
 	defer func() {
@@ -4,6 +4,8 @@ import (
 	"HealthHubConnect/env"
 	"HealthHubConnect/internal/database"
 	"HealthHubConnect/internal/handlers"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/services"
 	"HealthHubConnect/pkg/logger"
 	"HealthHubConnect/routes"
 	"context"
@@ -18,11 +20,20 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	accountErasureInterval = time.Hour
+	slotHoldExpiryInterval = time.Minute
+	waitlistOfferInterval  = time.Minute
+	reminderInterval       = time.Minute
+)
+
 var (
 	server     *http.Server
 	Loggers    *logger.LoggerManager
 	MapsClient *maps.Client
 	WsManager  *websocket.Manager
+
+	stopBackgroundJobs context.CancelFunc
 )
 
 func Init() error {
@@ -39,13 +50,32 @@ func Init() error {
 	}
 	Loggers.GeneralLogger.Info().Msg("Successfully initialized Google Maps client")
 
-	database.InitDB()
+	// a failed migration or claim backfill would let slots be overbooked
+	if err := database.InitDB(); err != nil {
+		Loggers.DBLogger.Error().Err(err).Msg("Failed to migrate database")
+		return err
+	}
 	db, err := database.GetDB()
 	if err != nil {
 		Loggers.DBLogger.Error().Err(err).Msg("Failed to initialize database")
 		return err
 	}
 
+	if err := repositories.SetupDoctorSearch(context.Background(), db); err != nil {
+		Loggers.DBLogger.Error().Err(err).Msg("Failed to set up doctor search")
+		return err
+	}
+
+	var jobsCtx context.Context
+	jobsCtx, stopBackgroundJobs = context.WithCancel(context.Background())
+	startAccountErasure(jobsCtx, db)
+	startSlotHoldExpiry(jobsCtx, db)
+	startAppointmentReminders(jobsCtx, db)
+	if err := startWaitlistEscalation(jobsCtx, db); err != nil {
+		Loggers.GeneralLogger.Error().Err(err).Msg("Failed to start waitlist offer escalation")
+		return err
+	}
+
 	Loggers.GeneralLogger.Info().Msg("Successfully initialized application")
 	// utils.SendEmail("ujjwaliiii40@gmail.com", "how are you", "sent from zoho")
 
@@ -85,6 +115,10 @@ func Cleanup() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
+	if stopBackgroundJobs != nil {
+		stopBackgroundJobs()
+	}
+
 	if server != nil {
 		if err := server.Shutdown(ctx); err != nil {
 			return fmt.Errorf("server shutdown failed: %w", err)
@@ -99,6 +133,124 @@ func Cleanup() error {
 	return nil
 }
 
+// startAccountErasure erases the accounts whose deletion grace period is over,
+// once at startup and then every accountErasureInterval
+func startAccountErasure(ctx context.Context, db *gorm.DB) {
+	accountService := services.NewAccountService(repositories.NewAccountRepository(db), repositories.NewUserRepository(db))
+
+	go func() {
+		ticker := time.NewTicker(accountErasureInterval)
+		defer ticker.Stop()
+
+		for {
+			erased, err := accountService.ProcessDueDeletions(ctx)
+			if err != nil {
+				Loggers.DBLogger.Error().Err(err).Msg("Failed to process account deletion requests")
+			} else if erased > 0 {
+				Loggers.GeneralLogger.Info().Msgf("Erased %d accounts after their deletion grace period", erased)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// startSlotHoldExpiry expires the slot holds that ran out every
+// slotHoldExpiryInterval. Bookings already ignore expired holds, this marks
+// them expired and frees their seats
+func startSlotHoldExpiry(ctx context.Context, db *gorm.DB) {
+	appointmentRepo := repositories.NewAppointmentRepository(db)
+
+	go func() {
+		ticker := time.NewTicker(slotHoldExpiryInterval)
+		defer ticker.Stop()
+
+		for {
+			expired, err := appointmentRepo.ExpireHolds(time.Now())
+			if err != nil {
+				Loggers.DBLogger.Error().Err(err).Msg("Failed to expire slot holds")
+			} else if expired > 0 {
+				Loggers.GeneralLogger.Info().Msgf("Expired %d slot holds", expired)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// startWaitlistEscalation passes the waitlist offers nobody claimed within
+// their window on to the next patient in line, every waitlistOfferInterval
+func startWaitlistEscalation(ctx context.Context, db *gorm.DB) error {
+	appointmentService, err := services.NewAppointmentService(
+		repositories.NewAppointmentRepository(db),
+		*repositories.NewUserRepository(db),
+		repositories.NewDoctorRepository(db),
+		repositories.NewWaitlistRepository(db),
+		repositories.NewTimeOffRepository(db),
+		repositories.NewFrontDeskRepository(db),
+		WsManager,
+	)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(waitlistOfferInterval)
+		defer ticker.Stop()
+
+		for {
+			expired, err := appointmentService.ExpireWaitlistOffers(ctx, time.Now())
+			if err != nil {
+				Loggers.DBLogger.Error().Err(err).Msg("Failed to escalate waitlist offers")
+			} else if expired > 0 {
+				Loggers.GeneralLogger.Info().Msgf("Passed %d unclaimed waitlist offers on", expired)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// startAppointmentReminders sends the appointment reminders that came due,
+// every reminderInterval. Reminders already recorded as sent are skipped, so
+// a restart doesn't send them again
+func startAppointmentReminders(ctx context.Context, db *gorm.DB) {
+	reminderService := services.NewReminderService(repositories.NewReminderRepository(db), repositories.NewAdminRepository(db))
+
+	go func() {
+		ticker := time.NewTicker(reminderInterval)
+		defer ticker.Stop()
+
+		for {
+			sent, err := reminderService.SendDue(ctx, time.Now())
+			if err != nil {
+				Loggers.DBLogger.Error().Err(err).Msg("Failed to send appointment reminders")
+			} else if sent > 0 {
+				Loggers.GeneralLogger.Info().Msgf("Sent %d appointment reminders", sent)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
 func initGoogleMapsClient() (*maps.Client, error) {
 	client, err := maps.NewClient(maps.WithAPIKey(env.GoogleMaps.APIKey))
 	if err != nil {
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+type AccountDeletionStatus string
+
+const (
+	DeletionPending   AccountDeletionStatus = "PENDING"
+	DeletionCancelled AccountDeletionStatus = "CANCELLED"
+	DeletionCompleted AccountDeletionStatus = "COMPLETED"
+)
+
+// AccountDeletionRequest is a patient's request to erase their account. It
+// can be cancelled until ScheduledFor, after which the account is erased.
+type AccountDeletionRequest struct {
+	Base
+	UserID       uint                  `json:"user_id" gorm:"not null;index"`
+	Status       AccountDeletionStatus `json:"status" gorm:"size:16;not null;index"`
+	Reason       string                `json:"reason,omitempty" gorm:"size:500"`
+	ScheduledFor time.Time             `json:"scheduled_for" gorm:"index"`
+	CancelledAt  *time.Time            `json:"cancelled_at,omitempty"`
+	CompletedAt  *time.Time            `json:"completed_at,omitempty"`
+}
+
+// AccountData is everything stored about a user, as handed out in an export
+type AccountData struct {
+	User              User                `json:"user"`
+	HealthProfile     *HealthProfile      `json:"health_profile"`
+	EmergencyContacts []EmergencyContact  `json:"emergency_contacts"`
+	Allergies         []Allergy           `json:"allergies"`
+	Medications       []Medication        `json:"medications"`
+	VitalSigns        []VitalSign         `json:"vital_signs"`
+	Appointments      []Appointment       `json:"appointments"`
+	AppointmentSeries []AppointmentSeries `json:"appointment_series"`
+	WaitlistEntries   []WaitlistEntry     `json:"waitlist_entries"`
+	Prescriptions     []Prescription      `json:"prescriptions"`
+	Bills             []Bill              `json:"bills"`
+	ChatMessages      []ChatMessage       `json:"chat_messages"`
+}
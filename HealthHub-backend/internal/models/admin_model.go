@@ -1,16 +1,93 @@
 package models
 
-import "time"
+import (
+	"sort"
+	"time"
+)
 
 type AdminSettings struct {
 	Base
-	AdminID            uint      `json:"admin_id"`
-	MaintenanceMode    bool      `json:"maintenance_mode"`
-	LastBackupDate     time.Time `json:"last_backup_date"`
-	SystemVersion      string    `json:"system_version"`
-	EmailNotifications bool      `json:"email_notifications"`
-	MaxLoginAttempts   int       `json:"max_login_attempts"`
-	SessionTimeout     int       `json:"session_timeout"`
+	AdminID            uint       `json:"admin_id"`
+	MaintenanceMode    bool       `json:"maintenance_mode"`
+	LastBackupDate     time.Time  `json:"last_backup_date"`
+	SystemVersion      string     `json:"system_version"`
+	EmailNotifications bool       `json:"email_notifications"`
+	MaxLoginAttempts   int        `json:"max_login_attempts"`
+	SessionTimeout     int        `json:"session_timeout"`
+	MFARequiredRoles   []UserRole `json:"mfa_required_roles" gorm:"serializer:json"`
+
+	// login throttling, all in minutes. zero means use the default
+	LockoutWindow      int `json:"lockout_window"`
+	LockoutBaseMinutes int `json:"lockout_base_minutes"`
+	LockoutMaxMinutes  int `json:"lockout_max_minutes"`
+	MaxIPLoginAttempts int `json:"max_ip_login_attempts"`
+
+	// appointment reminders, in minutes before the start. empty means 24h and 1h
+	ReminderOffsets []int `json:"reminder_offsets" gorm:"serializer:json"`
+}
+
+// LockoutPolicy is the effective throttling config with defaults filled in
+type LockoutPolicy struct {
+	MaxAccountAttempts int
+	MaxIPAttempts      int
+	Window             time.Duration
+	BaseDuration       time.Duration
+	MaxDuration        time.Duration
+}
+
+func (s *AdminSettings) LockoutPolicy() LockoutPolicy {
+	policy := LockoutPolicy{
+		MaxAccountAttempts: 5,
+		MaxIPAttempts:      20,
+		Window:             15 * time.Minute,
+		BaseDuration:       15 * time.Minute,
+		MaxDuration:        24 * time.Hour,
+	}
+	if s.MaxLoginAttempts > 0 {
+		policy.MaxAccountAttempts = s.MaxLoginAttempts
+	}
+	if s.MaxIPLoginAttempts > 0 {
+		policy.MaxIPAttempts = s.MaxIPLoginAttempts
+	}
+	if s.LockoutWindow > 0 {
+		policy.Window = time.Duration(s.LockoutWindow) * time.Minute
+	}
+	if s.LockoutBaseMinutes > 0 {
+		policy.BaseDuration = time.Duration(s.LockoutBaseMinutes) * time.Minute
+	}
+	if s.LockoutMaxMinutes > 0 {
+		policy.MaxDuration = time.Duration(s.LockoutMaxMinutes) * time.Minute
+	}
+	return policy
+}
+
+// ReminderSchedule is how long before an appointment its reminders go out,
+// furthest first
+func (s *AdminSettings) ReminderSchedule() []time.Duration {
+	if len(s.ReminderOffsets) == 0 {
+		return []time.Duration{24 * time.Hour, time.Hour}
+	}
+
+	offsets := make([]time.Duration, 0, len(s.ReminderOffsets))
+	seen := map[int]bool{}
+	for _, minutes := range s.ReminderOffsets {
+		if minutes <= 0 || seen[minutes] {
+			continue
+		}
+		seen[minutes] = true
+		offsets = append(offsets, time.Duration(minutes)*time.Minute)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] > offsets[j] })
+	return offsets
+}
+
+func (s *AdminSettings) RequiresMFA(role UserRole) bool {
+	for _, r := range s.MFARequiredRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
 }
 
 type SystemStats struct {
@@ -24,16 +101,20 @@ type SystemStats struct {
 	LastUpdated       time.Time `json:"last_updated"`
 }
 
+// AuditLog records an admin action, or with ActorID set one taken by another
+// user. OnBehalfOfID is set when a caregiver acted for that user.
 type AuditLog struct {
 	Base
-	AdminID    uint        `json:"admin_id"`
-	Action     string      `json:"action"`
-	EntityType string      `json:"entity_type"`
-	EntityID   uint        `json:"entity_id"`
-	Changes    string      `json:"changes"`
-	IPAddress  string      `json:"ip_address"`
-	Timestamp  time.Time   `json:"timestamp"`
-	Status     AuditStatus `json:"status"`
+	AdminID      uint        `json:"admin_id"`
+	ActorID      uint        `json:"actor_id,omitempty" gorm:"index"`
+	OnBehalfOfID uint        `json:"on_behalf_of_id,omitempty" gorm:"index"`
+	Action       string      `json:"action"`
+	EntityType   string      `json:"entity_type"`
+	EntityID     uint        `json:"entity_id"`
+	Changes      string      `json:"changes"`
+	IPAddress    string      `json:"ip_address"`
+	Timestamp    time.Time   `json:"timestamp"`
+	Status       AuditStatus `json:"status"`
 }
 
 type AuditStatus string
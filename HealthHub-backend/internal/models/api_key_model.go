@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+const (
+	ScopeAppointmentsRead  = "appointments:read"
+	ScopeAppointmentsWrite = "appointments:write"
+	ScopePrescriptionsRead = "prescriptions:read"
+	ScopeHospitalsRead     = "hospitals:read"
+)
+
+// APIScopes lists every scope an API key can be granted
+var APIScopes = []string{
+	ScopeAppointmentsRead,
+	ScopeAppointmentsWrite,
+	ScopePrescriptionsRead,
+	ScopeHospitalsRead,
+}
+
+type APIKeyOwnerType string
+
+const (
+	APIKeyOwnerAdmin        APIKeyOwnerType = "admin"
+	APIKeyOwnerOrganization APIKeyOwnerType = "organization"
+)
+
+// APIKey is a credential for partner systems calling without a user login.
+// The key is shown once at creation; Prefix identifies it in lookups and
+// listings, only the HMAC of the whole key is stored.
+type APIKey struct {
+	Base
+	Name         string          `json:"name" gorm:"not null"`
+	Prefix       string          `json:"prefix" gorm:"size:32;not null;uniqueIndex"`
+	KeyHash      string          `json:"-" gorm:"not null"`
+	Scopes       []string        `json:"scopes" gorm:"serializer:json"`
+	OwnerType    APIKeyOwnerType `json:"owner_type" gorm:"size:16;not null"`
+	OwnerID      uint            `json:"owner_id,omitempty"` // admin user for admin owned keys
+	Organization string          `json:"organization,omitempty"`
+	CreatedBy    uint            `json:"created_by"`
+	ExpiresAt    time.Time       `json:"expires_at"`
+	LastUsedAt   *time.Time      `json:"last_used_at,omitempty"`
+	LastUsedIP   string          `json:"last_used_ip,omitempty"`
+	RevokedAt    *time.Time      `json:"revoked_at,omitempty"`
+}
+
+func (k *APIKey) IsUsable(now time.Time) bool {
+	return k.RevokedAt == nil && now.Before(k.ExpiresAt)
+}
@@ -0,0 +1,19 @@
+package models
+
+// AppointmentCharge is what cancelling or missing an appointment costs the
+// patient under the doctor's policies. Fee is newly billed, RefundAmount and
+// RetainedAmount split what the patient had already paid.
+type AppointmentCharge struct {
+	AppointmentID    uint              `json:"appointment_id"`
+	Status           AppointmentStatus `json:"status"`
+	Currency         string            `json:"currency"`
+	HoursNotice      float64           `json:"hours_notice"`
+	MinNoticeHours   float64           `json:"min_notice_hours"`
+	LateCancellation bool              `json:"late_cancellation"`
+	Fee              float64           `json:"fee"`
+	RefundAmount     float64           `json:"refund_amount"`
+	RetainedAmount   float64           `json:"retained_amount"`
+	Policy           string            `json:"policy,omitempty"`
+	BillID           *uint             `json:"bill_id,omitempty"`
+	FeeBillID        *uint             `json:"fee_bill_id,omitempty"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// AppointmentEvent records one status change of an appointment, who made it
+// and why. FromStatus is empty for the event that created the appointment.
+type AppointmentEvent struct {
+	ID            uint              `json:"id" gorm:"primaryKey"`
+	AppointmentID uint              `json:"appointment_id" gorm:"not null;index"`
+	FromStatus    AppointmentStatus `json:"from_status,omitempty" gorm:"type:varchar(20)"`
+	ToStatus      AppointmentStatus `json:"to_status" gorm:"type:varchar(20);not null"`
+	ActorID       uint              `json:"actor_id" gorm:"index"`
+	ActorRole     UserRole          `json:"actor_role" gorm:"type:varchar(20)"`
+	OnBehalfOfID  *uint             `json:"on_behalf_of_id,omitempty"`
+	Reason        string            `json:"reason,omitempty" gorm:"type:text"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+type AppointmentStatusRequest struct {
+	Status AppointmentStatus `json:"status" validate:"required"`
+	Reason string            `json:"reason,omitempty"`
+}
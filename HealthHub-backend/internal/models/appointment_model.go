@@ -3,25 +3,26 @@ package models
 import (
 	"fmt"
 	"time"
+
+	"gorm.io/gorm"
 )
 
-func (r *AppointmentRequest) ToAppointment(patientID uint) (*Appointment, error) {
+// ToAppointment reads the request's date and clock times in loc, the zone of
+// the user booking. Wall times skipped by a DST change are refused.
+func (r *AppointmentRequest) ToAppointment(patientID uint, loc *time.Location) (*Appointment, error) {
 	date, err := time.Parse("2006-01-02", r.Date)
 	if err != nil {
 		return nil, fmt.Errorf("invalid date format: use YYYY-MM-DD")
 	}
 
-	startTimeStr := fmt.Sprintf("%s %s", r.Date, r.StartTime)
-	endTimeStr := fmt.Sprintf("%s %s", r.Date, r.EndTime)
-
-	startTime, err := time.Parse("2006-01-02 15:04:05", startTimeStr)
+	startTime, err := parseWallTime(r.Date, r.StartTime, loc)
 	if err != nil {
-		return nil, fmt.Errorf("invalid start time format: use HH:mm:ss")
+		return nil, fmt.Errorf("invalid start time: %v", err)
 	}
 
-	endTime, err := time.Parse("2006-01-02 15:04:05", endTimeStr)
+	endTime, err := parseWallTime(r.Date, r.EndTime, loc)
 	if err != nil {
-		return nil, fmt.Errorf("invalid end time format: use HH:mm:ss")
+		return nil, fmt.Errorf("invalid end time: %v", err)
 	}
 
 	return &Appointment{
@@ -39,15 +40,76 @@ func (r *AppointmentRequest) ToAppointment(patientID uint) (*Appointment, error)
 	}, nil
 }
 
+// parseWallTime places a "15:04:05" clock time on date in loc
+func parseWallTime(date, clock string, loc *time.Location) (time.Time, error) {
+	value := fmt.Sprintf("%s %s", date, clock)
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("use HH:mm:ss")
+	}
+	if t.Format("2006-01-02 15:04:05") != value {
+		return time.Time{}, fmt.Errorf("%s does not exist in %s because of a daylight saving change", value, loc)
+	}
+	return t, nil
+}
+
+// CalendarDate returns the calendar day of t, in t's own zone, as midnight
+// UTC. Dates are stored this way so they compare the same on every server.
+func CalendarDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// BeforeSave stores the appointment's instants in UTC, the database compares
+// them as text
+func (a *Appointment) BeforeSave(tx *gorm.DB) error {
+	a.StartTime = a.StartTime.UTC()
+	a.EndTime = a.EndTime.UTC()
+	a.Date = CalendarDate(a.Date)
+	for _, at := range []**time.Time{&a.CancelledAt, &a.CheckedInAt, &a.StartedAt, &a.CompletedAt} {
+		if *at != nil {
+			utc := (*at).UTC()
+			*at = &utc
+		}
+	}
+	return nil
+}
+
+// In returns a copy of the appointment with its times shown in loc, its date
+// becomes the day it starts on there
+func (a Appointment) In(loc *time.Location) Appointment {
+	a.StartTime = a.StartTime.In(loc)
+	a.EndTime = a.EndTime.In(loc)
+	a.Date = time.Date(a.StartTime.Year(), a.StartTime.Month(), a.StartTime.Day(), 0, 0, 0, 0, loc)
+	for _, at := range []**time.Time{&a.CancelledAt, &a.CheckedInAt, &a.StartedAt, &a.CompletedAt} {
+		if *at != nil {
+			local := (*at).In(loc)
+			*at = &local
+		}
+	}
+	a.CreatedAt = a.CreatedAt.In(loc)
+	a.UpdatedAt = a.UpdatedAt.In(loc)
+	return a
+}
+
+func AppointmentsIn(appointments []Appointment, loc *time.Location) []Appointment {
+	local := make([]Appointment, len(appointments))
+	for i := range appointments {
+		local[i] = appointments[i].In(loc)
+	}
+	return local
+}
+
 type AppointmentStatus string
 type AppointmentType string
 
 const (
-	StatusPending   AppointmentStatus = "PENDING"
-	StatusConfirmed AppointmentStatus = "CONFIRMED"
-	StatusCancelled AppointmentStatus = "CANCELLED"
-	StatusCompleted AppointmentStatus = "COMPLETED"
-	StatusNoShow    AppointmentStatus = "NO_SHOW"
+	StatusPending    AppointmentStatus = "PENDING"
+	StatusConfirmed  AppointmentStatus = "CONFIRMED"
+	StatusCheckedIn  AppointmentStatus = "CHECKED_IN"
+	StatusInProgress AppointmentStatus = "IN_PROGRESS"
+	StatusCancelled  AppointmentStatus = "CANCELLED"
+	StatusCompleted  AppointmentStatus = "COMPLETED"
+	StatusNoShow     AppointmentStatus = "NO_SHOW"
 
 	TypeOnline  AppointmentType = "ONLINE"
 	TypeOffline AppointmentType = "OFFLINE"
@@ -79,8 +141,13 @@ type Appointment struct {
 	IsCancelled  bool              `json:"is_cancelled" gorm:"default:false"`
 	CancelledAt  *time.Time        `json:"cancelled_at"`
 	CancelledBy  *uint             `json:"cancelled_by"`
+	CheckedInAt  *time.Time        `json:"checked_in_at,omitempty"`
+	StartedAt    *time.Time        `json:"started_at,omitempty"`
+	CompletedAt  *time.Time        `json:"completed_at,omitempty"`
+	WalkIn       bool              `json:"walk_in,omitempty" gorm:"default:false"`
 	Reminder     bool              `json:"reminder" gorm:"default:true"`
 	MeetLink     string            `json:"meet_link,omitempty" gorm:"type:text"`
+	SeriesID     *uint             `json:"series_id,omitempty" gorm:"index"`
 	Prescription *Prescription     `json:"prescription,omitempty" gorm:"foreignKey:AppointmentID"`
 	Bill         *Bill             `json:"bill,omitempty" gorm:"foreignKey:AppointmentID"`
 	CreatedAt    time.Time         `json:"created_at"`
@@ -111,9 +178,82 @@ type DoctorAvailability struct {
 }
 
 type TimeSlot struct {
-	StartTime time.Time `json:"start_time"`
-	EndTime   time.Time `json:"end_time"`
-	Available bool      `json:"available"`
+	StartTime time.Time     `json:"start_time"`
+	EndTime   time.Time     `json:"end_time"`
+	Available bool          `json:"available"`
+	Capacity  int           `json:"capacity"`
+	Booked    int           `json:"booked"`
+	Remaining int           `json:"remaining"`
+	Blocked   bool          `json:"blocked,omitempty"`
+	Location  *SlotLocation `json:"location,omitempty"`
+}
+
+// SlotLocation is the practice an in-person slot takes place at
+type SlotLocation struct {
+	Name       string   `json:"name"`
+	Address    string   `json:"address"`
+	Latitude   float64  `json:"latitude,omitempty"`
+	Longitude  float64  `json:"longitude,omitempty"`
+	HospitalID uint     `json:"hospital_id,omitempty"`
+	DistanceKm *float64 `json:"distance_km,omitempty"`
+}
+
+func (l SlotLocation) HasCoordinates() bool {
+	return l.Latitude != 0 || l.Longitude != 0
+}
+
+// FullAddress is the name and address of the practice as stamped on
+// appointments
+func (l SlotLocation) FullAddress() string {
+	switch {
+	case l.Name == "":
+		return l.Address
+	case l.Address == "":
+		return l.Name
+	}
+	return l.Name + ", " + l.Address
+}
+
+// SlotFilter narrows a slot search to one practice location and to the slots
+// within RadiusKm of Near. Without a radius Near only fills in the distances.
+type SlotFilter struct {
+	Affiliation string
+	HospitalID  uint
+	Near        *Location
+	RadiusKm    float64
+}
+
+func SlotsIn(slots []TimeSlot, loc *time.Location) []TimeSlot {
+	local := make([]TimeSlot, len(slots))
+	for i, slot := range slots {
+		slot.StartTime = slot.StartTime.In(loc)
+		slot.EndTime = slot.EndTime.In(loc)
+		local[i] = slot
+	}
+	return local
+}
+
+type SlotRejectionReason string
+
+const (
+	SlotInPast       SlotRejectionReason = "IN_PAST"
+	SlotTooSoon      SlotRejectionReason = "TOO_SOON"
+	SlotTooFarAhead  SlotRejectionReason = "TOO_FAR_AHEAD"
+	SlotDayClosed    SlotRejectionReason = "DAY_CLOSED"
+	SlotOutsideHours SlotRejectionReason = "OUTSIDE_WORKING_HOURS"
+	SlotDuringBreak  SlotRejectionReason = "DURING_BREAK"
+	SlotBlocked      SlotRejectionReason = "BLOCKED"
+	SlotTimeOff      SlotRejectionReason = "TIME_OFF"
+	SlotHoliday      SlotRejectionReason = "HOLIDAY"
+	SlotNotBookable  SlotRejectionReason = "NOT_A_SLOT"
+	SlotFull         SlotRejectionReason = "SLOT_FULL"
+)
+
+// SlotRejection explains why a requested time can't be booked and offers the
+// nearest slots that can
+type SlotRejection struct {
+	Reason      SlotRejectionReason `json:"reason"`
+	Suggestions []TimeSlot          `json:"suggestions"`
 }
 
 type AppointmentSlotRequest struct {
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWallTime(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		date    string
+		clock   string
+		loc     *time.Location
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name:  "standard time",
+			date:  "2026-01-15",
+			clock: "09:30:00",
+			loc:   newYork,
+			want:  time.Date(2026, 1, 15, 14, 30, 0, 0, time.UTC),
+		},
+		{
+			name:    "skipped by spring forward in New York",
+			date:    "2026-03-08",
+			clock:   "02:30:00",
+			loc:     newYork,
+			wantErr: true,
+		},
+		{
+			name:  "just after spring forward in New York",
+			date:  "2026-03-08",
+			clock: "03:00:00",
+			loc:   newYork,
+			want:  time.Date(2026, 3, 8, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "skipped by spring forward in London",
+			date:    "2026-03-29",
+			clock:   "01:15:00",
+			loc:     london,
+			wantErr: true,
+		},
+		{
+			name:  "repeated by fall back takes the first",
+			date:  "2026-11-01",
+			clock: "01:30:00",
+			loc:   newYork,
+			want:  time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC),
+		},
+		{
+			name:  "after fall back",
+			date:  "2026-11-01",
+			clock: "03:00:00",
+			loc:   newYork,
+			want:  time.Date(2026, 11, 1, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "malformed clock",
+			date:    "2026-01-15",
+			clock:   "9am",
+			loc:     newYork,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseWallTime(tt.date, tt.clock, tt.loc)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseWallTime(%q, %q) = %v, want an error", tt.date, tt.clock, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseWallTime(%q, %q) failed: %v", tt.date, tt.clock, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseWallTime(%q, %q) = %v, want %v", tt.date, tt.clock, got.UTC(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type RecurrenceFrequency string
+type SeriesStatus string
+type SeriesScope string
+
+const (
+	FrequencyDaily   RecurrenceFrequency = "DAILY"
+	FrequencyWeekly  RecurrenceFrequency = "WEEKLY"
+	FrequencyMonthly RecurrenceFrequency = "MONTHLY"
+
+	SeriesActive    SeriesStatus = "ACTIVE"
+	SeriesCancelled SeriesStatus = "CANCELLED"
+
+	// SeriesScopeThis changes only the chosen occurrence, SeriesScopeFollowing
+	// the chosen one and every later one, SeriesScopeAll every upcoming one
+	SeriesScopeThis      SeriesScope = "THIS"
+	SeriesScopeFollowing SeriesScope = "FOLLOWING"
+	SeriesScopeAll       SeriesScope = "ALL"
+
+	MaxSeriesOccurrences = 52
+	// MaxSeriesAdvanceBooking replaces MaxAdvanceBooking for the occurrences
+	// of a series, so a course of treatment can be booked in one go
+	MaxSeriesAdvanceBooking = 26 * 7 * 24 * time.Hour
+)
+
+// Recurrence is an RRULE-style rule: every Interval days, weeks or months,
+// ending after Count occurrences or on Until
+type Recurrence struct {
+	Frequency RecurrenceFrequency `json:"frequency" gorm:"type:varchar(10);not null"`
+	Interval  int                 `json:"interval" gorm:"not null;default:1"`
+	Count     int                 `json:"count,omitempty"`
+	Until     *time.Time          `json:"until,omitempty"`
+}
+
+// RRule renders the rule in RFC 5545 form, e.g. FREQ=WEEKLY;INTERVAL=2;COUNT=6
+func (r Recurrence) RRule() string {
+	rule := fmt.Sprintf("FREQ=%s;INTERVAL=%d", r.Frequency, r.Interval)
+	if r.Count > 0 {
+		return rule + fmt.Sprintf(";COUNT=%d", r.Count)
+	}
+	if r.Until != nil {
+		return rule + ";UNTIL=" + r.Until.UTC().Format("20060102T150405Z")
+	}
+	return rule
+}
+
+// Occurrences returns the start of every occurrence beginning with first.
+// Monthly rules skip months that don't have first's day, as RRULE does.
+func (r Recurrence) Occurrences(first time.Time) []time.Time {
+	var starts []time.Time
+	for step := 0; len(starts) < MaxSeriesOccurrences; step++ {
+		var next time.Time
+		switch r.Frequency {
+		case FrequencyDaily:
+			next = first.AddDate(0, 0, step*r.Interval)
+		case FrequencyWeekly:
+			next = first.AddDate(0, 0, 7*step*r.Interval)
+		case FrequencyMonthly:
+			next = first.AddDate(0, step*r.Interval, 0)
+			if next.Day() != first.Day() {
+				continue
+			}
+		default:
+			return starts
+		}
+
+		if r.Until != nil && next.After(*r.Until) {
+			break
+		}
+		starts = append(starts, next)
+		if r.Count > 0 && len(starts) == r.Count {
+			break
+		}
+	}
+	return starts
+}
+
+// AppointmentSeries is a recurring booking. Each occurrence is an Appointment
+// pointing back at the series, the appointments are what is actually booked
+// when occurrences have been moved or cancelled. Occurrences keep their wall
+// clock time in Timezone across DST changes.
+type AppointmentSeries struct {
+	ID           uint            `json:"id" gorm:"primaryKey"`
+	PatientID    uint            `json:"patient_id" gorm:"not null;index"`
+	DoctorID     uint            `json:"doctor_id" gorm:"not null;index"`
+	Type         AppointmentType `json:"type" gorm:"type:varchar(20);not null"`
+	Description  string          `json:"description"`
+	Address      string          `json:"address,omitempty"`
+	Latitude     float64         `json:"latitude,omitempty"`
+	Longitude    float64         `json:"longitude,omitempty"`
+	StartTime    time.Time       `json:"start_time" gorm:"not null"`
+	EndTime      time.Time       `json:"end_time" gorm:"not null"`
+	Recurrence   `gorm:"embedded"`
+	Rule         string        `json:"rrule" gorm:"column:rrule"`
+	Timezone     string        `json:"timezone" gorm:"type:varchar(64)"`
+	Status       SeriesStatus  `json:"status" gorm:"type:varchar(20);not null;index"`
+	Appointments []Appointment `json:"appointments,omitempty" gorm:"foreignKey:SeriesID"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+}
+
+func (AppointmentSeries) TableName() string {
+	return "appointment_series"
+}
+
+// BeforeSave stores the series' instants in UTC like appointments
+func (s *AppointmentSeries) BeforeSave(tx *gorm.DB) error {
+	s.StartTime = s.StartTime.UTC()
+	s.EndTime = s.EndTime.UTC()
+	if s.Until != nil {
+		until := s.Until.UTC()
+		s.Until = &until
+	}
+	return nil
+}
+
+// In returns a copy of the series with its times shown in loc
+func (s AppointmentSeries) In(loc *time.Location) AppointmentSeries {
+	s.StartTime = s.StartTime.In(loc)
+	s.EndTime = s.EndTime.In(loc)
+	if s.Appointments != nil {
+		s.Appointments = AppointmentsIn(s.Appointments, loc)
+	}
+	s.CreatedAt = s.CreatedAt.In(loc)
+	s.UpdatedAt = s.UpdatedAt.In(loc)
+	return s
+}
+
+// RecurrenceRequest takes either an RRULE string or the rule's parts
+type RecurrenceRequest struct {
+	RRule     string              `json:"rrule,omitempty"`
+	Frequency RecurrenceFrequency `json:"frequency,omitempty"`
+	Interval  int                 `json:"interval,omitempty"`
+	Count     int                 `json:"count,omitempty"`
+	Until     string              `json:"until,omitempty"` // Format: "2006-01-02"
+}
+
+type AppointmentSeriesRequest struct {
+	AppointmentRequest
+	Recurrence RecurrenceRequest `json:"recurrence"`
+}
+
+// ToRecurrence checks the rule and fills in its defaults. An until date is
+// read as a day in loc.
+func (r *RecurrenceRequest) ToRecurrence(loc *time.Location) (Recurrence, error) {
+	recurrence := Recurrence{
+		Frequency: RecurrenceFrequency(strings.ToUpper(string(r.Frequency))),
+		Interval:  r.Interval,
+		Count:     r.Count,
+	}
+	until := r.Until
+
+	if r.RRule != "" {
+		parts, err := parseRRule(r.RRule)
+		if err != nil {
+			return Recurrence{}, err
+		}
+		recurrence = Recurrence{Frequency: RecurrenceFrequency(parts["FREQ"])}
+		if v, ok := parts["INTERVAL"]; ok {
+			if recurrence.Interval, err = strconv.Atoi(v); err != nil {
+				return Recurrence{}, fmt.Errorf("invalid INTERVAL in rrule")
+			}
+		}
+		if v, ok := parts["COUNT"]; ok {
+			if recurrence.Count, err = strconv.Atoi(v); err != nil {
+				return Recurrence{}, fmt.Errorf("invalid COUNT in rrule")
+			}
+		}
+		until = parts["UNTIL"]
+	}
+
+	switch recurrence.Frequency {
+	case FrequencyDaily, FrequencyWeekly, FrequencyMonthly:
+	default:
+		return Recurrence{}, fmt.Errorf("recurrence frequency must be DAILY, WEEKLY or MONTHLY")
+	}
+	if recurrence.Interval == 0 {
+		recurrence.Interval = 1
+	}
+	if recurrence.Interval < 0 {
+		return Recurrence{}, fmt.Errorf("recurrence interval must be positive")
+	}
+
+	if until != "" {
+		day, err := parseUntil(until, loc)
+		if err != nil {
+			return Recurrence{}, err
+		}
+		recurrence.Until = &day
+	}
+	if (recurrence.Count > 0) == (recurrence.Until != nil) {
+		return Recurrence{}, fmt.Errorf("recurrence needs either a count or an until date")
+	}
+	if recurrence.Count < 0 || recurrence.Count > MaxSeriesOccurrences {
+		return Recurrence{}, fmt.Errorf("recurrence count must be between 1 and %d", MaxSeriesOccurrences)
+	}
+	return recurrence, nil
+}
+
+func parseRRule(rule string) (map[string]string, error) {
+	parts := map[string]string{}
+	rule = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(rule)), "RRULE:")
+	for _, part := range strings.Split(rule, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid rrule part %q", part)
+		}
+		switch key {
+		case "FREQ", "INTERVAL", "COUNT", "UNTIL":
+			parts[key] = value
+		default:
+			return nil, fmt.Errorf("unsupported rrule part %s", key)
+		}
+	}
+	return parts, nil
+}
+
+// parseUntil reads a date or an RRULE UNTIL value, the whole of that day in
+// loc is included
+func parseUntil(value string, loc *time.Location) (time.Time, error) {
+	if day, err := time.Parse("20060102T150405Z", value); err == nil {
+		return day, nil
+	}
+	for _, layout := range []string{"2006-01-02", "20060102"} {
+		if day, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return day.AddDate(0, 0, 1).Add(-time.Second), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid until date: use YYYY-MM-DD")
+}
+
+// SeriesConflict is an occurrence that could not be booked or changed
+type SeriesConflict struct {
+	Occurrence    int                 `json:"occurrence"`
+	AppointmentID uint                `json:"appointment_id,omitempty"`
+	StartTime     time.Time           `json:"start_time"`
+	EndTime       time.Time           `json:"end_time"`
+	Reason        SlotRejectionReason `json:"reason,omitempty"`
+	Message       string              `json:"message"`
+	Suggestions   []TimeSlot          `json:"suggestions,omitempty"`
+}
+
+func ConflictsIn(conflicts []SeriesConflict, loc *time.Location) []SeriesConflict {
+	local := make([]SeriesConflict, len(conflicts))
+	for i, conflict := range conflicts {
+		conflict.StartTime = conflict.StartTime.In(loc)
+		conflict.EndTime = conflict.EndTime.In(loc)
+		if conflict.Suggestions != nil {
+			conflict.Suggestions = SlotsIn(conflict.Suggestions, loc)
+		}
+		local[i] = conflict
+	}
+	return local
+}
+
+type SeriesBookingResult struct {
+	Series    *AppointmentSeries `json:"series"`
+	Conflicts []SeriesConflict   `json:"conflicts"`
+}
+
+func (r SeriesBookingResult) In(loc *time.Location) SeriesBookingResult {
+	if r.Series != nil {
+		series := r.Series.In(loc)
+		r.Series = &series
+	}
+	r.Conflicts = ConflictsIn(r.Conflicts, loc)
+	return r
+}
+
+// SeriesChangeRequest cancels or moves occurrences of a series. For a move
+// the chosen occurrence goes to Date and StartTime-EndTime and the following
+// ones are shifted by the same amount.
+type SeriesChangeRequest struct {
+	AppointmentID uint        `json:"appointment_id"`
+	Scope         SeriesScope `json:"scope" validate:"required,oneof=THIS FOLLOWING ALL"`
+	Date          string      `json:"date,omitempty"`       // Format: "2006-01-02"
+	StartTime     string      `json:"start_time,omitempty"` // Format: "15:04:05"
+	EndTime       string      `json:"end_time,omitempty"`   // Format: "15:04:05"
+	Reason        string      `json:"reason,omitempty"`
+}
+
+type SeriesChangeResult struct {
+	SeriesID     uint                `json:"series_id"`
+	Appointments []Appointment       `json:"appointments"`
+	Charges      []AppointmentCharge `json:"charges,omitempty"`
+	Conflicts    []SeriesConflict    `json:"conflicts"`
+}
+
+func (r SeriesChangeResult) In(loc *time.Location) SeriesChangeResult {
+	r.Appointments = AppointmentsIn(r.Appointments, loc)
+	r.Conflicts = ConflictsIn(r.Conflicts, loc)
+	return r
+}
@@ -7,17 +7,88 @@ import (
 	"golang.org/x/oauth2"
 )
 
+// OAuthAccount links an external identity to a user. ProviderID is the
+// subject the provider knows the user by, unique per provider only.
 type OAuthAccount struct {
 	Base
-	User       User      `json:"user" gorm:"foreignKey:UserID"`
-	UserID     uint      `json:"user_id"`
-	Provider   string    `json:"provider"`
-	ProviderID string    `json:"provider_id" gorm:"uniqueIndex"`
+	User       User      `json:"-" gorm:"foreignKey:UserID"`
+	UserID     uint      `json:"user_id" gorm:"index"`
+	Provider   string    `json:"provider" gorm:"size:64;uniqueIndex:idx_oauth_provider_subject"`
+	ProviderID string    `json:"provider_id" gorm:"uniqueIndex:idx_oauth_provider_subject"`
+	Email      string    `json:"email"`
 	Token      string    `json:"-"`
 	TokenType  string    `json:"-"`
 	ExpiresAt  time.Time `json:"-"`
 }
 
+// OIDCLoginState is what the callback of one authorization request checks
+// against: the state, the nonce the ID token has to echo and the PKCE
+// verifier. LinkUserID is set when a signed-in user is linking a provider.
+type OIDCLoginState struct {
+	Base
+	State        string    `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	Provider     string    `json:"provider" gorm:"size:64;not null"`
+	Nonce        string    `json:"-" gorm:"size:64;not null"`
+	CodeVerifier string    `json:"-" gorm:"size:128;not null"`
+	LinkUserID   *uint     `json:"link_user_id,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"index"`
+}
+
+// RefreshSession is one issued refresh token. Every token minted by rotating
+// a login shares the login's FamilyID, so a replayed token can revoke them all.
+type RefreshSession struct {
+	Base
+	UserID        uint       `json:"user_id" gorm:"not null;index"`
+	FamilyID      string     `json:"family_id" gorm:"size:64;not null;index"`
+	TokenID       string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	IPAddress     string     `json:"ip_address"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	UsedAt        *time.Time `json:"used_at,omitempty"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	RevokedReason string     `json:"revoked_reason,omitempty"`
+}
+
+type PrincipalType string
+
+const (
+	PrincipalUser   PrincipalType = "user"
+	PrincipalAPIKey PrincipalType = "api_key"
+)
+
+// Principal is who a request acts as, whether it came with a user's access
+// token or a partner's API key. UserID and Role are zero for keys owned by an
+// organization rather than a user.
+//
+// When a caregiver acts on behalf of a patient, UserID and Role are the
+// patient's, ActorID is the caregiver and Scopes are those of the delegation.
+type Principal struct {
+	Type         PrincipalType `json:"type"`
+	UserID       uint          `json:"user_id,omitempty"`
+	Role         UserRole      `json:"role,omitempty"`
+	APIKeyID     uint          `json:"api_key_id,omitempty"`
+	Organization string        `json:"organization,omitempty"`
+	Scopes       []string      `json:"scopes,omitempty"`
+	ActorID      uint          `json:"actor_id,omitempty"`
+	DelegationID uint          `json:"delegation_id,omitempty"`
+}
+
+func (p *Principal) IsAPIKey() bool {
+	return p.Type == PrincipalAPIKey
+}
+
+func (p *Principal) IsDelegated() bool {
+	return p.ActorID != 0
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	for _, granted := range p.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
 type JWTClaims struct {
 	jwt.RegisteredClaims
 	UserID string   `json:"user_id"`
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// CalendarFeed is a user's secret iCalendar subscription. Whoever has the
+// token can read the feed, rotating it cuts off old subscriptions.
+type CalendarFeed struct {
+	ID        uint      `json:"-" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex"`
+	Token     string    `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type CalendarFeedResponse struct {
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
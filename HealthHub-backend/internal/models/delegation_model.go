@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+const (
+	ScopeHealthRead  = "health:read"
+	ScopeHealthWrite = "health:write"
+)
+
+// DelegationScopes lists every scope a patient can grant a caregiver
+var DelegationScopes = []string{
+	ScopeAppointmentsRead,
+	ScopeAppointmentsWrite,
+	ScopeHealthRead,
+	ScopeHealthWrite,
+}
+
+// Delegation lets a caregiver act on behalf of a patient, within its scopes and
+// only between StartsAt and ExpiresAt. GrantedBy is the patient, or the admin
+// who set it up for a minor.
+type Delegation struct {
+	Base
+	PatientID    uint       `json:"patient_id" gorm:"not null;index"`
+	DelegateID   uint       `json:"delegate_id" gorm:"not null;index"`
+	Relationship string     `json:"relationship"`
+	Scopes       []string   `json:"scopes" gorm:"serializer:json"`
+	GrantedBy    uint       `json:"granted_by"`
+	StartsAt     time.Time  `json:"starts_at"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy    *uint      `json:"revoked_by,omitempty"`
+}
+
+func (d *Delegation) IsActive(now time.Time) bool {
+	return d.RevokedAt == nil && !now.Before(d.StartsAt) && now.Before(d.ExpiresAt)
+}
@@ -20,6 +20,9 @@ type DoctorProfile struct {
 	SpecJSON        string          `json:"-" gorm:"column:spec_json;type:jsonb"`
 	Specializations SpecInfo        `json:"specializations" gorm:"-"`
 	BillingSettings json.RawMessage `json:"billing_settings" gorm:"type:json;default:'{}'"`
+	// Timezone is the IANA zone the doctor's schedule is written in, the
+	// doctor's own timezone when empty
+	Timezone string `json:"timezone" gorm:"type:varchar(64)"`
 }
 
 type DoctorUserInfo struct {
@@ -101,14 +104,16 @@ type Qualifications struct {
 }
 
 type Affiliation struct {
-	Name         string `json:"name"`
-	Phone        string `json:"phone"`
-	Address      string `json:"address"`
-	City         string `json:"city"`
-	State        string `json:"state"`
-	Country      string `json:"country"`
-	Designation  string `json:"designation"`
-	WorkingHours string `json:"workingHours"`
+	Name         string  `json:"name"`
+	Phone        string  `json:"phone"`
+	Address      string  `json:"address"`
+	City         string  `json:"city"`
+	State        string  `json:"state"`
+	Country      string  `json:"country"`
+	Designation  string  `json:"designation"`
+	WorkingHours string  `json:"workingHours"`
+	Latitude     float64 `json:"latitude,omitempty"`
+	Longitude    float64 `json:"longitude,omitempty"`
 }
 
 type ConsultationType struct {
@@ -159,10 +164,12 @@ type SpecInfo struct {
 }
 
 type BlockSlotRequest struct {
-	Date      string `json:"date" validate:"required"`
-	StartTime string `json:"start_time" validate:"required"`
-	EndTime   string `json:"end_time" validate:"required"`
-	Reason    string `json:"reason,omitempty"`
+	Date         string `json:"date" validate:"required"`
+	StartTime    string `json:"start_time" validate:"required"`
+	EndTime      string `json:"end_time" validate:"required"`
+	Reason       string `json:"reason,omitempty"`
+	IsRecurring  bool   `json:"is_recurring,omitempty"`
+	RecurringDay string `json:"recurring_day,omitempty"` // e.g. "monday", defaults to the weekday of Date
 }
 
 type PatientListResponse struct {
@@ -184,26 +191,9 @@ type PatientInfo struct {
 }
 
 type BillingSettings struct {
-	ConsultationFees struct {
-		Online struct {
-			Amount       float64 `json:"amount"`
-			Currency     string  `json:"currency"`
-			DurationMins int     `json:"duration_minutes"`
-		} `json:"online"`
-		InPerson struct {
-			Amount       float64 `json:"amount"`
-			Currency     string  `json:"currency"`
-			DurationMins int     `json:"duration_minutes"`
-		} `json:"in_person"`
-		FollowUp struct {
-			Amount       float64 `json:"amount"`
-			Currency     string  `json:"currency"`
-			DurationMins int     `json:"duration_minutes"`
-			ValidityDays int     `json:"validity_days"`
-		} `json:"follow_up"`
-	} `json:"consultation_fees"`
-	PaymentMethods []string `json:"payment_methods"`
-	BankDetails    []struct {
+	ConsultationFees ConsultationFee `json:"consultation_fees"`
+	PaymentMethods   []string        `json:"payment_methods"`
+	BankDetails      []struct {
 		BankName      string `json:"bank_name"`
 		AccountNumber string `json:"account_number"`
 		IFSC          string `json:"ifsc"`
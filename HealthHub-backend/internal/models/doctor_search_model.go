@@ -0,0 +1,189 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Facets of the doctor search, they name the facet counts returned and the
+// filters taken
+const (
+	FacetSpecialization   = "specialization"
+	FacetSubspecialty     = "subspecialty"
+	FacetLanguage         = "language"
+	FacetProcedure        = "procedure"
+	FacetCity             = "city"
+	FacetConsultationType = "consultation_type"
+	FacetFeeRange         = "fee_range"
+
+	ConsultationOnline   = "online"
+	ConsultationInPerson = "in_person"
+)
+
+// SearchFacets lists the facets in the order they are shown
+var SearchFacets = []string{
+	FacetSpecialization, FacetSubspecialty, FacetLanguage, FacetProcedure,
+	FacetCity, FacetConsultationType, FacetFeeRange,
+}
+
+// FeeRange is a band of consultation fees from Min up to Max, Max is zero
+// for the open top band
+type FeeRange struct {
+	Label string
+	Min   float64
+	Max   float64
+}
+
+// DoctorFeeRanges are the bands the fee_range facet counts doctors in
+var DoctorFeeRanges = []FeeRange{
+	{Label: "0-500", Min: 0, Max: 500},
+	{Label: "500-1000", Min: 500, Max: 1000},
+	{Label: "1000-2000", Min: 1000, Max: 2000},
+	{Label: "2000+", Min: 2000},
+}
+
+func feeRangeOf(fee float64) string {
+	for _, band := range DoctorFeeRanges {
+		if fee >= band.Min && (band.Max == 0 || fee < band.Max) {
+			return band.Label
+		}
+	}
+	return DoctorFeeRanges[0].Label
+}
+
+// DoctorSearchEntry is a doctor's row in the search index, rebuilt from the
+// profile each time it is saved. The text columns feed the full-text index
+// and weigh in this order when ranking.
+type DoctorSearchEntry struct {
+	DoctorID    uint   `gorm:"primaryKey;autoIncrement:false"`
+	Name        string `gorm:"type:text"`
+	Specialties string `gorm:"type:text"`
+	Procedures  string `gorm:"type:text"`
+	// Details holds the languages, practices, cities and about text
+	Details string `gorm:"type:text"`
+	// MinFee and MaxFee span the fees of the enabled consultation types,
+	// unset when none is enabled
+	MinFee    *float64 `gorm:"index"`
+	MaxFee    *float64 `gorm:"index"`
+	UpdatedAt time.Time
+}
+
+// DoctorSearchFacet is one facet value of an indexed doctor. Value is the
+// label lowercased, filters match it and counts group on it.
+type DoctorSearchFacet struct {
+	DoctorID uint   `gorm:"primaryKey;autoIncrement:false"`
+	Facet    string `gorm:"primaryKey;type:varchar(32)"`
+	Value    string `gorm:"primaryKey;type:varchar(191)"`
+	Label    string `gorm:"type:varchar(191)"`
+}
+
+// NewDoctorSearchEntry turns a profile, and the doctor's account name, into
+// the doctor's index entry and facet values
+func NewDoctorSearchEntry(profile *DoctorProfile, name string) (*DoctorSearchEntry, []DoctorSearchFacet) {
+	entry := &DoctorSearchEntry{DoctorID: profile.UserID}
+	facets := facetSet{doctorID: profile.UserID, seen: map[string]bool{}}
+
+	names := []string{name}
+	if fullName := strings.TrimSpace(profile.BasicInfo.FullName); fullName != "" && !strings.EqualFold(fullName, name) {
+		names = append(names, fullName)
+	}
+	entry.Name = strings.Join(names, " ")
+
+	var specialties, procedures []string
+	for _, spec := range profile.BasicInfo.Specializations {
+		specialties = append(specialties, spec)
+		facets.add(FacetSpecialization, spec)
+	}
+	for _, spec := range profile.Specializations.Specializations {
+		specialties = append(specialties, spec.Name, spec.Subspecialty)
+		facets.add(FacetSpecialization, spec.Name)
+		facets.add(FacetSubspecialty, spec.Subspecialty)
+		for _, procedure := range spec.Procedures {
+			procedures = append(procedures, procedure.Name)
+			facets.add(FacetProcedure, procedure.Name)
+		}
+	}
+	entry.Specialties = strings.Join(specialties, " ")
+	entry.Procedures = strings.Join(procedures, " ")
+
+	details := []string{}
+	for _, language := range profile.BasicInfo.Languages {
+		details = append(details, language)
+		facets.add(FacetLanguage, language)
+	}
+	for _, affiliation := range profile.PracticeDetails.Affiliations {
+		details = append(details, affiliation.Name, affiliation.City)
+		facets.add(FacetCity, affiliation.City)
+	}
+	details = append(details, profile.BasicInfo.About)
+	entry.Details = strings.Join(details, " ")
+
+	consultations := map[string]ConsultationType{
+		ConsultationOnline:   profile.PracticeDetails.ConsultationTypes.Online,
+		ConsultationInPerson: profile.PracticeDetails.ConsultationTypes.InPerson,
+	}
+	for kind, consultation := range consultations {
+		if !consultation.Enabled {
+			continue
+		}
+		facets.add(FacetConsultationType, kind)
+		facets.add(FacetFeeRange, feeRangeOf(consultation.Fee))
+
+		fee := consultation.Fee
+		if entry.MinFee == nil || fee < *entry.MinFee {
+			entry.MinFee = &fee
+		}
+		if entry.MaxFee == nil || fee > *entry.MaxFee {
+			entry.MaxFee = &fee
+		}
+	}
+
+	return entry, facets.values
+}
+
+type facetSet struct {
+	doctorID uint
+	seen     map[string]bool
+	values   []DoctorSearchFacet
+}
+
+func (s *facetSet) add(facet, label string) {
+	label = strings.TrimSpace(label)
+	if len(label) > 191 {
+		label = label[:191]
+	}
+	value := strings.ToLower(label)
+	if value == "" || s.seen[facet+"\x00"+value] {
+		return
+	}
+	s.seen[facet+"\x00"+value] = true
+	s.values = append(s.values, DoctorSearchFacet{DoctorID: s.doctorID, Facet: facet, Value: value, Label: label})
+}
+
+// DoctorSearchQuery searches doctors by free text, ranked by relevance, and
+// narrows them down by facet values and a fee range
+type DoctorSearchQuery struct {
+	Text string
+	// Name is matched against the doctor's name only
+	Name string
+	// Filters maps a facet to the value doctors must have
+	Filters map[string]string
+	// FeeMin and FeeMax keep the doctors with a consultation fee in range
+	FeeMin *float64
+	FeeMax *float64
+	Page   int
+	Limit  int
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// DoctorSearchResult is a page of doctors, most relevant first, with the
+// facet counts over every doctor matching the query
+type DoctorSearchResult struct {
+	Doctors []DoctorProfile
+	Total   int64
+	Facets  map[string][]FacetCount
+}
@@ -0,0 +1,94 @@
+package models
+
+import "time"
+
+// WalkInEmailDomain is the domain of the placeholder addresses given to
+// walk-in patients registered without an email. Nothing is ever sent there.
+const WalkInEmailDomain = "walk-in.healthhub.invalid"
+
+// FrontDeskAssignment lets a receptionist work the front desk of a doctor:
+// booking for their patients, registering walk-ins and checking them in
+type FrontDeskAssignment struct {
+	DoctorID       uint      `json:"doctor_id" gorm:"primaryKey;autoIncrement:false"`
+	ReceptionistID uint      `json:"receptionist_id" gorm:"primaryKey;autoIncrement:false;index"`
+	Receptionist   User      `json:"receptionist" gorm:"foreignKey:ReceptionistID"`
+	Doctor         User      `json:"doctor" gorm:"foreignKey:DoctorID"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type FrontDeskStaffRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// FrontDeskBookingRequest books an appointment for an existing patient
+type FrontDeskBookingRequest struct {
+	PatientID uint `json:"patient_id" validate:"required"`
+	AppointmentRequest
+}
+
+// WalkInRequest registers a patient who turned up without an appointment. A
+// patient with the same email or phone is reused, otherwise a record with
+// just the name and contact details is created.
+type WalkInRequest struct {
+	DoctorID    uint   `json:"doctor_id" validate:"required"`
+	PatientID   uint   `json:"patient_id,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Phone       int64  `json:"phone,omitempty"`
+	Email       string `json:"email,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// QueueEntry is one patient in a doctor's queue for the day
+type QueueEntry struct {
+	Position      int               `json:"position,omitempty"`
+	AppointmentID uint              `json:"appointment_id"`
+	PatientID     uint              `json:"patient_id"`
+	PatientName   string            `json:"patient_name"`
+	Status        AppointmentStatus `json:"status"`
+	WalkIn        bool              `json:"walk_in,omitempty"`
+	ScheduledAt   time.Time         `json:"scheduled_at"`
+	CheckedInAt   *time.Time        `json:"checked_in_at,omitempty"`
+	StartedAt     *time.Time        `json:"started_at,omitempty"`
+	// EstimatedStart and EstimatedWaitMinutes are set for the patients
+	// waiting, from how long the doctor's consultations actually take
+	EstimatedStart       *time.Time `json:"estimated_start,omitempty"`
+	EstimatedWaitMinutes *int       `json:"estimated_wait_minutes,omitempty"`
+}
+
+func (q QueueEntry) In(loc *time.Location) QueueEntry {
+	q.ScheduledAt = q.ScheduledAt.In(loc)
+	for _, at := range []**time.Time{&q.CheckedInAt, &q.StartedAt, &q.EstimatedStart} {
+		if *at != nil {
+			local := (*at).In(loc)
+			*at = &local
+		}
+	}
+	return q
+}
+
+// DoctorQueue is the live state of a doctor's waiting room: who is with the
+// doctor, who has checked in and is waiting, and who is still expected today
+type DoctorQueue struct {
+	DoctorID   uint      `json:"doctor_id"`
+	DoctorName string    `json:"doctor_name"`
+	Date       time.Time `json:"date"`
+	// AverageConsultationMinutes is measured over the doctor's recent
+	// consultations, zero until there are any
+	AverageConsultationMinutes int          `json:"average_consultation_minutes"`
+	InConsultation             []QueueEntry `json:"in_consultation"`
+	Waiting                    []QueueEntry `json:"waiting"`
+	Expected                   []QueueEntry `json:"expected"`
+	UpdatedAt                  time.Time    `json:"updated_at"`
+}
+
+func (q DoctorQueue) In(loc *time.Location) DoctorQueue {
+	for _, entries := range []*[]QueueEntry{&q.InConsultation, &q.Waiting, &q.Expected} {
+		local := make([]QueueEntry, len(*entries))
+		for i, entry := range *entries {
+			local[i] = entry.In(loc)
+		}
+		*entries = local
+	}
+	q.UpdatedAt = q.UpdatedAt.In(loc)
+	return q
+}
@@ -1,10 +1,28 @@
 package models
 
+import "math"
+
 type Location struct {
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
 }
 
+// DistanceKm is the great-circle distance between two points
+func (l Location) DistanceKm(other Location) float64 {
+	const earthRadius = 6371
+	lat1Rad := l.Latitude * math.Pi / 180
+	lat2Rad := other.Latitude * math.Pi / 180
+	deltaLat := (other.Latitude - l.Latitude) * math.Pi / 180
+	deltaLon := (other.Longitude - l.Longitude) * math.Pi / 180
+
+	a := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
+		math.Cos(lat1Rad)*math.Cos(lat2Rad)*
+			math.Sin(deltaLon/2)*math.Sin(deltaLon/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+
+	return earthRadius * c
+}
+
 type Speciality struct {
 	ID   uint   `json:"id" gorm:"primaryKey"`
 	Name string `json:"name"`
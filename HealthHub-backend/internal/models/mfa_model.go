@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// UserMFA holds a user's TOTP factor. The secret is written at enrollment and
+// only counts once ConfirmedAt is set by a first valid code.
+type UserMFA struct {
+	Base
+	UserID       uint       `json:"user_id" gorm:"uniqueIndex;not null"`
+	Secret       string     `json:"-" gorm:"not null"`
+	Enabled      bool       `json:"enabled" gorm:"default:false"`
+	ConfirmedAt  *time.Time `json:"confirmed_at,omitempty"`
+	LastUsedStep int64      `json:"-"`
+}
+
+type MFARecoveryCode struct {
+	Base
+	UserID   uint       `json:"user_id" gorm:"index;not null"`
+	CodeHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	UsedAt   *time.Time `json:"used_at,omitempty"`
+}
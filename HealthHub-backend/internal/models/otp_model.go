@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+type OTPPurpose string
+
+const (
+	OTPPurposeEmailVerify   OTPPurpose = "email_verify"
+	OTPPurposePasswordReset OTPPurpose = "password_reset"
+	OTPPurposeLoginMFA      OTPPurpose = "login_mfa"
+	OTPPurposePhoneVerify   OTPPurpose = "phone_verify"
+)
+
+// OneTimeCode is a single issued code. Only its HMAC is stored; at most one
+// code per user and purpose is live, issuing a new one consumes the previous.
+type OneTimeCode struct {
+	Base
+	UserID      uint       `json:"user_id" gorm:"not null;index:idx_otp_user_purpose"`
+	Purpose     OTPPurpose `json:"purpose" gorm:"size:32;not null;index:idx_otp_user_purpose"`
+	CodeHash    string     `json:"-" gorm:"not null"`
+	Attempts    int        `json:"attempts"`
+	MaxAttempts int        `json:"max_attempts"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	ConsumedAt  *time.Time `json:"consumed_at,omitempty"`
+}
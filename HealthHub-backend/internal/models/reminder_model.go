@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+type ReminderStatus string
+
+const (
+	ReminderSending ReminderStatus = "SENDING"
+	ReminderSent    ReminderStatus = "SENT"
+	ReminderFailed  ReminderStatus = "FAILED"
+)
+
+// AppointmentReminder records the reminder sent for an appointment at one
+// offset. The row is claimed before the email goes out and the unique index
+// keeps a restarted scheduler from sending it a second time. Moving the
+// appointment drops its rows, the new time gets its own reminders.
+type AppointmentReminder struct {
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	AppointmentID uint           `json:"appointment_id" gorm:"not null;uniqueIndex:idx_reminder_offset"`
+	OffsetMinutes int            `json:"offset_minutes" gorm:"not null;uniqueIndex:idx_reminder_offset"`
+	Recipient     string         `json:"recipient"`
+	Status        ReminderStatus `json:"status" gorm:"type:varchar(20);not null"`
+	Error         string         `json:"error,omitempty" gorm:"type:text"`
+	SentAt        *time.Time     `json:"sent_at,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
+
+// NotificationPreference holds what a user wants to be notified about, users
+// without a row get everything
+type NotificationPreference struct {
+	ID                   uint      `json:"-" gorm:"primaryKey"`
+	UserID               uint      `json:"user_id" gorm:"not null;uniqueIndex"`
+	AppointmentReminders bool      `json:"appointment_reminders"`
+	UpdatedAt            time.Time `json:"updated_at"`
+}
+
+type NotificationPreferenceRequest struct {
+	AppointmentReminders *bool `json:"appointment_reminders" validate:"required"`
+}
@@ -6,11 +6,20 @@ import (
 	"gorm.io/gorm"
 )
 
+// PracticeLocation says where a block of the schedule takes place, one of
+// the doctor's affiliations by name or a hospital by ID
+type PracticeLocation struct {
+	Affiliation string `json:"affiliation,omitempty"`
+	HospitalID  uint   `json:"hospitalId,omitempty"`
+}
+
 type ScheduleTimeSlot struct {
 	Start    string `json:"start"`
 	End      string `json:"end"`
 	Duration int    `json:"duration"`
 	Capacity int    `json:"capacity"`
+	// Location overrides the day's location for this slot
+	Location *PracticeLocation `json:"location,omitempty"`
 }
 
 type Break struct {
@@ -28,6 +37,9 @@ type DaySchedule struct {
 	} `json:"workingHours"`
 	Slots  []ScheduleTimeSlot `json:"slots"`
 	Breaks []Break            `json:"breaks"`
+	// Location is where the day's hours take place, unset for a doctor who
+	// only consults online or has a single practice
+	Location *PracticeLocation `json:"location,omitempty"`
 }
 
 type Schedule struct {
@@ -41,6 +53,7 @@ type DoctorSchedule struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
 	DoctorID  uint      `json:"doctor_id" gorm:"not null"`
 	Schedule  string    `json:"schedule" gorm:"type:text"`
+	Policies  string    `json:"policies" gorm:"type:text"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -48,6 +61,9 @@ type DoctorSchedule struct {
 type ScheduleRequest struct {
 	Schedule Schedule       `json:"schedule"`
 	Policies DoctorPolicies `json:"policies"`
+	// AllowOrphans saves the schedule even though booked appointments fall
+	// outside it, see ScheduleTemplateRequest
+	AllowOrphans bool `json:"allow_orphans,omitempty"`
 }
 
 type DoctorPolicies struct {
@@ -72,11 +88,12 @@ type InsuranceProvider struct {
 }
 
 type ScheduleResponse struct {
-	ID        uint      `json:"id"`
-	DoctorID  uint      `json:"doctor_id"`
-	Schedule  Schedule  `json:"schedule"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        uint           `json:"id"`
+	DoctorID  uint           `json:"doctor_id"`
+	Schedule  Schedule       `json:"schedule"`
+	Policies  DoctorPolicies `json:"policies"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
 }
 
 // type BlockSlotRequest struct {
@@ -90,7 +107,7 @@ type ScheduleResponse struct {
 
 type BlockedSlot struct {
 	gorm.Model
-	DoctorID     uint      `json:"doctor_id" gorm:"not null"`
+	DoctorID     uint      `json:"doctor_id" gorm:"not null;index"`
 	Date         time.Time `json:"date" gorm:"not null"`
 	StartTime    time.Time `json:"start_time" gorm:"not null"`
 	EndTime      time.Time `json:"end_time" gorm:"not null"`
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultScheduleName is the name the doctor's weekly schedule is versioned
+// under. It applies on every day no named template covers.
+const DefaultScheduleName = "default"
+
+// ScheduleVersion is one saved version of a doctor's weekly schedule or of a
+// named template such as "summer hours". Versions are never changed, saving
+// a template again adds the next version and the latest one is in force
+// between its effective dates.
+type ScheduleVersion struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	DoctorID uint   `json:"doctor_id" gorm:"not null;uniqueIndex:idx_schedule_version,priority:1"`
+	Name     string `json:"name" gorm:"not null;uniqueIndex:idx_schedule_version,priority:2"`
+	Version  int    `json:"version" gorm:"not null;uniqueIndex:idx_schedule_version,priority:3"`
+	// EffectiveFrom and EffectiveTo are days of the doctor's calendar,
+	// inclusive, EffectiveTo is unset for a template without an end
+	EffectiveFrom time.Time  `json:"effective_from" gorm:"not null"`
+	EffectiveTo   *time.Time `json:"effective_to,omitempty"`
+	Content       string     `json:"-" gorm:"type:text;not null"`
+	Schedule      *Schedule  `json:"schedule,omitempty" gorm:"-"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Covers tells whether the version applies on the calendar day of date
+func (v *ScheduleVersion) Covers(date time.Time) bool {
+	day := CalendarDate(date)
+	if day.Before(v.EffectiveFrom) {
+		return false
+	}
+	return v.EffectiveTo == nil || !day.After(*v.EffectiveTo)
+}
+
+// ScheduleTemplateRequest saves, or previews, a version of a named template.
+// Without a name it stands for the weekly schedule, which takes effect today.
+type ScheduleTemplateRequest struct {
+	Name          string   `json:"name"`
+	EffectiveFrom string   `json:"effective_from,omitempty"` // Format: "2006-01-02"
+	EffectiveTo   string   `json:"effective_to,omitempty"`   // Format: "2006-01-02"
+	Schedule      Schedule `json:"schedule"`
+	// AllowOrphans saves the version even though booked appointments fall
+	// outside it. They are kept as booked for the doctor to move.
+	AllowOrphans bool `json:"allow_orphans,omitempty"`
+}
+
+// ToVersion checks the dates and turns the request into an unsaved version.
+// The dates are days of the doctor's calendar, loc is the doctor's zone.
+func (r *ScheduleTemplateRequest) ToVersion(doctorID uint, loc *time.Location) (*ScheduleVersion, error) {
+	content, err := json.Marshal(r.Schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	today := CalendarDate(time.Now().In(loc))
+	version := &ScheduleVersion{
+		DoctorID:      doctorID,
+		Name:          strings.TrimSpace(r.Name),
+		EffectiveFrom: today,
+		Content:       string(content),
+		Schedule:      &r.Schedule,
+	}
+
+	if version.Name == "" || strings.EqualFold(version.Name, DefaultScheduleName) {
+		if r.EffectiveFrom != "" || r.EffectiveTo != "" {
+			return nil, fmt.Errorf("the weekly schedule takes effect today, give the template a name to schedule it")
+		}
+		version.Name = DefaultScheduleName
+		return version, nil
+	}
+	if len(version.Name) > 100 {
+		return nil, fmt.Errorf("name must be at most 100 characters")
+	}
+
+	from, err := time.Parse("2006-01-02", r.EffectiveFrom)
+	if err != nil {
+		return nil, fmt.Errorf("invalid effective_from format: use YYYY-MM-DD")
+	}
+	version.EffectiveFrom = from
+
+	if r.EffectiveTo != "" {
+		to, err := time.Parse("2006-01-02", r.EffectiveTo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid effective_to format: use YYYY-MM-DD")
+		}
+		if to.Before(from) {
+			return nil, fmt.Errorf("effective_to must not be before effective_from")
+		}
+		if to.Before(today) {
+			return nil, fmt.Errorf("effective_to is in the past")
+		}
+		version.EffectiveTo = &to
+	}
+	return version, nil
+}
+
+// ScheduleImpact is what saving a version changes: the weekdays that differ
+// from the schedule in force on its first day, and the booked appointments
+// that fit a slot today but no longer would
+type ScheduleImpact struct {
+	Version     ScheduleVersion `json:"version"`
+	ChangedDays []string        `json:"changed_days"`
+	Orphaned    []Appointment   `json:"orphaned"`
+}
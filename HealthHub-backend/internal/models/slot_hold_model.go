@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SlotHoldStatus string
+
+const (
+	HoldActive    SlotHoldStatus = "ACTIVE"
+	HoldConverted SlotHoldStatus = "CONVERTED"
+	HoldReleased  SlotHoldStatus = "RELEASED"
+	HoldExpired   SlotHoldStatus = "EXPIRED"
+
+	DefaultHoldDuration = 10 * time.Minute
+	MaxHoldDuration     = 30 * time.Minute
+)
+
+// SlotClaim takes one seat of a doctor's slot for an appointment or an active
+// hold. Claims are counted against a slot's capacity wherever they overlap it,
+// the unique index on doctor, slot and seat backs that up for claims of the
+// same slot.
+type SlotClaim struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	DoctorID      uint       `json:"doctor_id" gorm:"not null;uniqueIndex:idx_slot_claims_seat"`
+	SlotStart     time.Time  `json:"slot_start" gorm:"not null;uniqueIndex:idx_slot_claims_seat"`
+	Seat          int        `json:"seat" gorm:"not null;uniqueIndex:idx_slot_claims_seat"`
+	SlotEnd       time.Time  `json:"slot_end" gorm:"not null"`
+	AppointmentID *uint      `json:"appointment_id,omitempty" gorm:"uniqueIndex"`
+	HoldID        *uint      `json:"hold_id,omitempty" gorm:"uniqueIndex"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty" gorm:"index"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// SlotHold reserves a slot for a patient while they finish checking out. It
+// either converts into an appointment or expires at ExpiresAt.
+type SlotHold struct {
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	PatientID     uint           `json:"patient_id" gorm:"not null;index"`
+	DoctorID      uint           `json:"doctor_id" gorm:"not null;index"`
+	StartTime     time.Time      `json:"start_time" gorm:"not null"`
+	EndTime       time.Time      `json:"end_time" gorm:"not null"`
+	Status        SlotHoldStatus `json:"status" gorm:"type:varchar(20);not null;index"`
+	ExpiresAt     time.Time      `json:"expires_at" gorm:"not null;index"`
+	AppointmentID *uint          `json:"appointment_id,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
+
+func (h *SlotHold) IsActive(now time.Time) bool {
+	return h.Status == HoldActive && h.ExpiresAt.After(now)
+}
+
+// BeforeSave stores the held range in UTC like appointments
+func (h *SlotHold) BeforeSave(tx *gorm.DB) error {
+	h.StartTime = h.StartTime.UTC()
+	h.EndTime = h.EndTime.UTC()
+	h.ExpiresAt = h.ExpiresAt.UTC()
+	return nil
+}
+
+// In returns a copy of the hold with its times shown in loc
+func (h SlotHold) In(loc *time.Location) SlotHold {
+	h.StartTime = h.StartTime.In(loc)
+	h.EndTime = h.EndTime.In(loc)
+	h.ExpiresAt = h.ExpiresAt.In(loc)
+	h.CreatedAt = h.CreatedAt.In(loc)
+	h.UpdatedAt = h.UpdatedAt.In(loc)
+	return h
+}
+
+type SlotHoldRequest struct {
+	DoctorID  uint   `json:"doctor_id" validate:"required"`
+	Date      string `json:"date" validate:"required"`       // Format: "2006-01-02"
+	StartTime string `json:"start_time" validate:"required"` // Format: "15:04:05"
+	EndTime   string `json:"end_time" validate:"required"`   // Format: "15:04:05"
+	Minutes   int    `json:"minutes,omitempty"`
+}
+
+// ConfirmHoldRequest carries the appointment details collected at checkout
+type ConfirmHoldRequest struct {
+	Type        AppointmentType `json:"type" validate:"required,oneof=ONLINE OFFLINE"`
+	Description string          `json:"description"`
+	Address     string          `json:"address,omitempty"`
+	Latitude    float64         `json:"latitude,omitempty"`
+	Longitude   float64         `json:"longitude,omitempty"`
+}
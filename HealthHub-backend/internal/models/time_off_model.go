@@ -0,0 +1,233 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type TimeOffType string
+type TimeOffAction string
+
+const (
+	TimeOffVacation   TimeOffType = "VACATION"
+	TimeOffConference TimeOffType = "CONFERENCE"
+	TimeOffSickLeave  TimeOffType = "SICK_LEAVE"
+	TimeOffOther      TimeOffType = "OTHER"
+
+	// TimeOffCancel cancels the appointment, free of charge and refunded in
+	// full as for any cancellation by the practice
+	TimeOffCancel TimeOffAction = "CANCEL"
+	// TimeOffReschedule moves the appointment to the doctor's next free slot
+	// after the leave
+	TimeOffReschedule TimeOffAction = "RESCHEDULE"
+	// TimeOffReassign keeps the time and hands the appointment to a covering
+	// doctor
+	TimeOffReassign TimeOffAction = "REASSIGN"
+)
+
+func IsTimeOffType(t TimeOffType) bool {
+	switch t {
+	case TimeOffVacation, TimeOffConference, TimeOffSickLeave, TimeOffOther:
+		return true
+	}
+	return false
+}
+
+// DoctorTimeOff is a stretch of time the doctor is away. No slots are offered
+// in it, appointments already booked in it are listed so the doctor can deal
+// with them.
+type DoctorTimeOff struct {
+	ID        uint        `json:"id" gorm:"primaryKey"`
+	DoctorID  uint        `json:"doctor_id" gorm:"not null;index:idx_time_off_doctor_range"`
+	Type      TimeOffType `json:"type" gorm:"type:varchar(20);not null"`
+	StartTime time.Time   `json:"start_time" gorm:"not null;index:idx_time_off_doctor_range"`
+	EndTime   time.Time   `json:"end_time" gorm:"not null;index:idx_time_off_doctor_range"`
+	Reason    string      `json:"reason" gorm:"type:text"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+func (DoctorTimeOff) TableName() string {
+	return "doctor_time_off"
+}
+
+// BeforeSave stores the leave in UTC like appointments
+func (t *DoctorTimeOff) BeforeSave(tx *gorm.DB) error {
+	t.StartTime = t.StartTime.UTC()
+	t.EndTime = t.EndTime.UTC()
+	return nil
+}
+
+// In returns a copy of the leave with its times shown in loc
+func (t DoctorTimeOff) In(loc *time.Location) DoctorTimeOff {
+	t.StartTime = t.StartTime.In(loc)
+	t.EndTime = t.EndTime.In(loc)
+	t.CreatedAt = t.CreatedAt.In(loc)
+	t.UpdatedAt = t.UpdatedAt.In(loc)
+	return t
+}
+
+// TimeOffRequest covers whole days from StartDate to EndDate. StartTime and
+// EndTime, as "15:04", narrow the first and last day.
+type TimeOffRequest struct {
+	Type      TimeOffType `json:"type" validate:"required"`
+	StartDate string      `json:"start_date" validate:"required"` // Format: "2006-01-02"
+	EndDate   string      `json:"end_date" validate:"required"`   // Format: "2006-01-02"
+	StartTime string      `json:"start_time,omitempty"`
+	EndTime   string      `json:"end_time,omitempty"`
+	Reason    string      `json:"reason,omitempty"`
+}
+
+// ToTimeOff reads the request in loc, the doctor's zone
+func (r *TimeOffRequest) ToTimeOff(doctorID uint, loc *time.Location) (*DoctorTimeOff, error) {
+	if !IsTimeOffType(r.Type) {
+		return nil, fmt.Errorf("type must be one of VACATION, CONFERENCE, SICK_LEAVE or OTHER")
+	}
+
+	startClock := "00:00"
+	if r.StartTime != "" {
+		startClock = r.StartTime
+	}
+	start, err := parseWallTime(r.StartDate, startClock+":00", loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start: use a YYYY-MM-DD date and an HH:mm time")
+	}
+
+	var end time.Time
+	if r.EndTime != "" {
+		end, err = parseWallTime(r.EndDate, r.EndTime+":00", loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end: use a YYYY-MM-DD date and an HH:mm time")
+		}
+	} else {
+		day, err := time.ParseInLocation("2006-01-02", r.EndDate, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end_date format: use YYYY-MM-DD")
+		}
+		end = day.AddDate(0, 0, 1)
+	}
+
+	if !end.After(start) {
+		return nil, fmt.Errorf("time off must end after it starts")
+	}
+	if !end.After(time.Now()) {
+		return nil, fmt.Errorf("time off is already over")
+	}
+
+	return &DoctorTimeOff{
+		DoctorID:  doctorID,
+		Type:      r.Type,
+		StartTime: start,
+		EndTime:   end,
+		Reason:    r.Reason,
+	}, nil
+}
+
+// TimeOffResult is a leave together with the open appointments that fall in
+// it
+type TimeOffResult struct {
+	TimeOff  DoctorTimeOff `json:"time_off"`
+	Affected []Appointment `json:"affected_appointments"`
+}
+
+func (r TimeOffResult) In(loc *time.Location) TimeOffResult {
+	r.TimeOff = r.TimeOff.In(loc)
+	r.Affected = AppointmentsIn(r.Affected, loc)
+	return r
+}
+
+// TimeOffActionRequest applies one action to the appointments affected by a
+// leave or holiday, or to the listed ones among them
+type TimeOffActionRequest struct {
+	Action           TimeOffAction `json:"action" validate:"required"`
+	AppointmentIDs   []uint        `json:"appointment_ids,omitempty"`
+	CoveringDoctorID uint          `json:"covering_doctor_id,omitempty"`
+	Reason           string        `json:"reason,omitempty"`
+}
+
+// TimeOffConflict is an affected appointment the action couldn't be applied
+// to, it is left as it was
+type TimeOffConflict struct {
+	AppointmentID uint                `json:"appointment_id"`
+	StartTime     time.Time           `json:"start_time"`
+	EndTime       time.Time           `json:"end_time"`
+	Reason        SlotRejectionReason `json:"reason,omitempty"`
+	Message       string              `json:"message"`
+}
+
+type TimeOffActionResult struct {
+	Action       TimeOffAction       `json:"action"`
+	Appointments []Appointment       `json:"appointments"`
+	Charges      []AppointmentCharge `json:"charges,omitempty"`
+	Conflicts    []TimeOffConflict   `json:"conflicts"`
+}
+
+func (r TimeOffActionResult) In(loc *time.Location) TimeOffActionResult {
+	r.Appointments = AppointmentsIn(r.Appointments, loc)
+	conflicts := make([]TimeOffConflict, len(r.Conflicts))
+	for i, conflict := range r.Conflicts {
+		conflict.StartTime = conflict.StartTime.In(loc)
+		conflict.EndTime = conflict.EndTime.In(loc)
+		conflicts[i] = conflict
+	}
+	r.Conflicts = conflicts
+	return r
+}
+
+// HolidayCalendar is a list of public or clinic holidays kept by the admins.
+// Doctors follow the calendars that apply to them and are closed on their
+// holidays.
+type HolidayCalendar struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"size:100;not null;uniqueIndex"`
+	Description string    `json:"description" gorm:"type:text"`
+	Holidays    []Holiday `json:"holidays,omitempty" gorm:"foreignKey:CalendarID"`
+	Following   bool      `json:"following,omitempty" gorm:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Holiday closes the whole calendar day Date, in each doctor's own zone
+type Holiday struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	CalendarID uint      `json:"calendar_id" gorm:"not null;uniqueIndex:idx_holiday_calendar_date"`
+	Date       time.Time `json:"date" gorm:"not null;uniqueIndex:idx_holiday_calendar_date"`
+	Name       string    `json:"name" gorm:"size:100;not null"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (h *Holiday) BeforeSave(tx *gorm.DB) error {
+	h.Date = CalendarDate(h.Date)
+	return nil
+}
+
+// DoctorHolidayCalendar records that a doctor follows a holiday calendar
+type DoctorHolidayCalendar struct {
+	DoctorID   uint      `json:"doctor_id" gorm:"primaryKey;autoIncrement:false"`
+	CalendarID uint      `json:"calendar_id" gorm:"primaryKey;autoIncrement:false;index"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type HolidayCalendarRequest struct {
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description,omitempty"`
+}
+
+type HolidayRequest struct {
+	Date string `json:"date" validate:"required"` // Format: "2006-01-02"
+	Name string `json:"name" validate:"required"`
+}
+
+// HolidayImpact is an upcoming holiday of the doctor with the open
+// appointments booked on it
+type HolidayImpact struct {
+	Holiday  Holiday       `json:"holiday"`
+	Affected []Appointment `json:"affected_appointments"`
+}
+
+func (h HolidayImpact) In(loc *time.Location) HolidayImpact {
+	h.Affected = AppointmentsIn(h.Affected, loc)
+	return h
+}
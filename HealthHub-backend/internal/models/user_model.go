@@ -17,21 +17,26 @@ const (
 
 type User struct {
 	Base
-	Email            string         `json:"email" gorm:"uniqueIndex;not null" validate:"required,email"`
-	PasswordHash     string         `json:"-"`
-	Name             string         `json:"name"`
-	ProfilePicture   string         `json:"profile_picture"`
-	IsActive         bool           `json:"is_active" gorm:"default:true"`
-	EmailVerified    bool           `json:"email_verified" gorm:"default:false"`
-	Phone            int64          `json:"phone"`
-	Role             UserRole       `json:"role" gorm:"default:'patient'" validate:"required,oneof=admin doctor nurse patient receptionist pharmacist"`
-	LastLogin        time.Time      `json:"last_login"`
-	ResetToken       string         `json:"-"`
-	ResetTokenExpiry time.Time      `json:"-"`
-	AuthProvider     string         `json:"auth_provider" gorm:"default:'local'"`
-	HealthProfile    *HealthProfile `json:"health_profile" gorm:"foreignKey:UserID"`
-	Location         *UserLocation  `json:"location" gorm:"foreignKey:UserID"`
-	IsNewUser        bool           `json:"is_new_user" gorm:"-"`
+	Email          string         `json:"email" gorm:"uniqueIndex;not null" validate:"required,email"`
+	PasswordHash   string         `json:"-"`
+	Name           string         `json:"name"`
+	ProfilePicture string         `json:"profile_picture"`
+	IsActive       bool           `json:"is_active" gorm:"default:true"`
+	EmailVerified  bool           `json:"email_verified" gorm:"default:false"`
+	Phone          int64          `json:"phone"`
+	Role           UserRole       `json:"role" gorm:"default:'patient'" validate:"required,oneof=admin doctor nurse patient receptionist pharmacist"`
+	LastLogin      time.Time      `json:"last_login"`
+	AuthProvider   string         `json:"auth_provider" gorm:"default:'local'"`
+	Timezone       string         `json:"timezone" gorm:"type:varchar(64)"`
+	HealthProfile  *HealthProfile `json:"health_profile" gorm:"foreignKey:UserID"`
+	Location       *UserLocation  `json:"location" gorm:"foreignKey:UserID"`
+	IsNewUser      bool           `json:"is_new_user" gorm:"-"`
+}
+
+// TimezoneSetting is the IANA zone, e.g. "Asia/Kolkata", a user's times are
+// shown in. Empty means UTC.
+type TimezoneSetting struct {
+	Timezone string `json:"timezone"`
 }
 
 type LoginAttempt struct {
@@ -43,3 +48,26 @@ type LoginAttempt struct {
 	Successful bool      `json:"successful"`
 	Timestamp  time.Time `json:"timestamp"`
 }
+
+type LockoutScope string
+
+const (
+	LockoutScopeAccount LockoutScope = "account"
+	LockoutScopeIP      LockoutScope = "ip"
+)
+
+// LoginLockout tracks throttling state for one account or one IP. Level is the
+// number of consecutive lockouts and doubles the next lockout's duration;
+// failures before CountSince no longer count toward the next one.
+type LoginLockout struct {
+	Base
+	Scope       LockoutScope `json:"scope" gorm:"uniqueIndex:idx_lockout_key;size:16"`
+	Key         string       `json:"key" gorm:"column:lock_key;uniqueIndex:idx_lockout_key"`
+	Level       int          `json:"level"`
+	LockedUntil *time.Time   `json:"locked_until,omitempty"`
+	CountSince  time.Time    `json:"count_since"`
+}
+
+func (l *LoginLockout) IsLocked(now time.Time) bool {
+	return l.LockedUntil != nil && now.Before(*l.LockedUntil)
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type WaitlistStatus string
+type WaitlistOfferStatus string
+
+const (
+	WaitlistWaiting   WaitlistStatus = "WAITING"
+	WaitlistOffered   WaitlistStatus = "OFFERED"
+	WaitlistBooked    WaitlistStatus = "BOOKED"
+	WaitlistCancelled WaitlistStatus = "CANCELLED"
+	WaitlistExpired   WaitlistStatus = "EXPIRED"
+
+	OfferPending   WaitlistOfferStatus = "PENDING"
+	OfferClaimed   WaitlistOfferStatus = "CLAIMED"
+	OfferDeclined  WaitlistOfferStatus = "DECLINED"
+	OfferExpired   WaitlistOfferStatus = "EXPIRED"
+	OfferWithdrawn WaitlistOfferStatus = "WITHDRAWN"
+
+	// WaitlistClaimWindow is how long a patient has to claim an offered slot
+	// before it is offered to the next patient on the waitlist
+	WaitlistClaimWindow = 30 * time.Minute
+)
+
+// WaitlistEntry puts a patient in line for any slot of the doctor that frees
+// up between FromDate and ToDate. Entries are served oldest first.
+type WaitlistEntry struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	PatientID uint           `json:"patient_id" gorm:"not null;index"`
+	DoctorID  uint           `json:"doctor_id" gorm:"not null;index:idx_waitlist_doctor_dates"`
+	FromDate  time.Time      `json:"from_date" gorm:"not null;index:idx_waitlist_doctor_dates"`
+	ToDate    time.Time      `json:"to_date" gorm:"not null;index:idx_waitlist_doctor_dates"`
+	Status    WaitlistStatus `json:"status" gorm:"type:varchar(20);not null;index"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// IsOpen tells whether the entry can still be offered a slot or is waiting
+// on one
+func (w *WaitlistEntry) IsOpen() bool {
+	return w.Status == WaitlistWaiting || w.Status == WaitlistOffered
+}
+
+// WaitlistOffer is a freed slot offered to a waitlisted patient. The slot is
+// kept for them by a hold until ExpiresAt, Token is what the claim link
+// carries.
+type WaitlistOffer struct {
+	ID            uint                `json:"id" gorm:"primaryKey"`
+	EntryID       uint                `json:"entry_id" gorm:"not null;index"`
+	PatientID     uint                `json:"patient_id" gorm:"not null;index"`
+	DoctorID      uint                `json:"doctor_id" gorm:"not null;index:idx_waitlist_offers_slot"`
+	StartTime     time.Time           `json:"start_time" gorm:"not null;index:idx_waitlist_offers_slot"`
+	EndTime       time.Time           `json:"end_time" gorm:"not null"`
+	HoldID        uint                `json:"hold_id" gorm:"not null"`
+	Token         string              `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	Status        WaitlistOfferStatus `json:"status" gorm:"type:varchar(20);not null;index"`
+	ExpiresAt     time.Time           `json:"expires_at" gorm:"not null;index"`
+	AppointmentID *uint               `json:"appointment_id,omitempty"`
+	CreatedAt     time.Time           `json:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at"`
+}
+
+func (o *WaitlistOffer) IsClaimable(now time.Time) bool {
+	return o.Status == OfferPending && o.ExpiresAt.After(now)
+}
+
+// BeforeSave stores the offered slot in UTC like appointments
+func (o *WaitlistOffer) BeforeSave(tx *gorm.DB) error {
+	o.StartTime = o.StartTime.UTC()
+	o.EndTime = o.EndTime.UTC()
+	o.ExpiresAt = o.ExpiresAt.UTC()
+	return nil
+}
+
+// In returns a copy of the offer with its times shown in loc
+func (o WaitlistOffer) In(loc *time.Location) WaitlistOffer {
+	o.StartTime = o.StartTime.In(loc)
+	o.EndTime = o.EndTime.In(loc)
+	o.ExpiresAt = o.ExpiresAt.In(loc)
+	o.CreatedAt = o.CreatedAt.In(loc)
+	o.UpdatedAt = o.UpdatedAt.In(loc)
+	return o
+}
+
+type WaitlistRequest struct {
+	DoctorID uint   `json:"doctor_id" validate:"required"`
+	FromDate string `json:"from_date" validate:"required"` // Format: "2006-01-02"
+	ToDate   string `json:"to_date" validate:"required"`   // Format: "2006-01-02"
+}
+
+// ToEntry checks the date range and turns the request into a waiting entry.
+// The dates are days of the doctor's calendar, loc is the doctor's zone.
+func (r *WaitlistRequest) ToEntry(patientID uint, loc *time.Location) (*WaitlistEntry, error) {
+	from, err := time.Parse("2006-01-02", r.FromDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from_date format: use YYYY-MM-DD")
+	}
+	to, err := time.Parse("2006-01-02", r.ToDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to_date format: use YYYY-MM-DD")
+	}
+	if to.Before(from) {
+		return nil, fmt.Errorf("to_date must not be before from_date")
+	}
+
+	today := CalendarDate(time.Now().In(loc))
+	if to.Before(today) {
+		return nil, fmt.Errorf("to_date is in the past")
+	}
+	if to.After(today.Add(MaxAdvanceBooking)) {
+		return nil, fmt.Errorf("to_date cannot be more than %d days ahead", int(MaxAdvanceBooking.Hours()/24))
+	}
+
+	return &WaitlistEntry{
+		PatientID: patientID,
+		DoctorID:  r.DoctorID,
+		FromDate:  from,
+		ToDate:    to,
+		Status:    WaitlistWaiting,
+	}, nil
+}
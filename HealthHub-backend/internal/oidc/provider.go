@@ -0,0 +1,314 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"HealthHubConnect/config"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/oauth2"
+)
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+	discoveryTTL  = time.Hour
+	httpTimeout   = 10 * time.Second
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	ErrInvalidIDToken  = errors.New("invalid id token")
+
+	providerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+	// asymmetric algorithms only, an HMAC signed ID token would be keyed with our client secret
+	signingAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+)
+
+// Discovery is the subset of the provider's discovery document we rely on
+type Discovery struct {
+	Issuer                        string   `json:"issuer"`
+	AuthorizationEndpoint         string   `json:"authorization_endpoint"`
+	TokenEndpoint                 string   `json:"token_endpoint"`
+	UserinfoEndpoint              string   `json:"userinfo_endpoint"`
+	JWKSURI                       string   `json:"jwks_uri"`
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
+}
+
+// IDToken holds the verified claims of an ID token
+type IDToken struct {
+	jwt.RegisteredClaims
+	Nonce           string       `json:"nonce"`
+	AuthorizedParty string       `json:"azp"`
+	Email           string       `json:"email"`
+	EmailVerified   flexibleBool `json:"email_verified"`
+	Name            string       `json:"name"`
+	Picture         string       `json:"picture"`
+}
+
+// flexibleBool accepts both true and "true", some providers send claims as strings
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	case "false", "null", "":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean claim: %s", data)
+	}
+	return nil
+}
+
+// Provider is one configured identity provider. Its discovery document and
+// signing keys are fetched on first use and cached.
+type Provider struct {
+	config config.OIDCProviderConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *Discovery
+	fetchedAt time.Time
+	keys      *keySet
+}
+
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+func (p *Provider) DisplayName() string {
+	if p.config.DisplayName != "" {
+		return p.config.DisplayName
+	}
+	return p.config.Name
+}
+
+// LinkByEmail reports whether a verified email from this provider may sign in
+// the existing account with the same address
+func (p *Provider) LinkByEmail() bool {
+	return p.config.LinkByEmail
+}
+
+// Registry holds the identity providers hospitals have configured
+type Registry struct {
+	providers map[string]*Provider
+	order     []string
+}
+
+// NewRegistry builds the registry from configuration. Invalid entries are
+// skipped and logged. A nil client uses a default one with a timeout.
+func NewRegistry(configs []config.OIDCProviderConfig, client *http.Client) *Registry {
+	if client == nil {
+		client = &http.Client{Timeout: httpTimeout}
+	}
+
+	registry := &Registry{providers: make(map[string]*Provider)}
+	for _, cfg := range configs {
+		if !providerNamePattern.MatchString(cfg.Name) || cfg.IssuerURL == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+			log.Printf("Skipping invalid OIDC provider config %q", cfg.Name)
+			continue
+		}
+		if _, exists := registry.providers[cfg.Name]; exists {
+			log.Printf("Skipping duplicate OIDC provider %q", cfg.Name)
+			continue
+		}
+		registry.providers[cfg.Name] = &Provider{config: cfg, client: client}
+		registry.order = append(registry.order, cfg.Name)
+	}
+	return registry
+}
+
+func (r *Registry) Get(name string) (*Provider, error) {
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+// List returns the providers in configuration order
+func (r *Registry) List() []*Provider {
+	providers := make([]*Provider, 0, len(r.order))
+	for _, name := range r.order {
+		providers = append(providers, r.providers[name])
+	}
+	return providers
+}
+
+// Discover returns the cached discovery document, refreshing it once it is
+// older than discoveryTTL. A stale copy is kept if the refresh fails.
+func (p *Provider) Discover(ctx context.Context) (*Discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil && time.Since(p.fetchedAt) < discoveryTTL {
+		return p.discovery, nil
+	}
+
+	discovery, err := p.fetchDiscovery(ctx)
+	if err != nil {
+		if p.discovery != nil {
+			log.Printf("Failed to refresh discovery document of %s, using cached copy: %v", p.config.Name, err)
+			return p.discovery, nil
+		}
+		return nil, err
+	}
+
+	if p.keys == nil || p.keys.uri != discovery.JWKSURI {
+		p.keys = newKeySet(discovery.JWKSURI, p.client)
+	}
+	p.discovery = discovery
+	p.fetchedAt = time.Now()
+	return discovery, nil
+}
+
+func (p *Provider) fetchDiscovery(ctx context.Context) (*Discovery, error) {
+	issuer := strings.TrimSuffix(p.config.IssuerURL, "/")
+
+	var discovery Discovery
+	if err := getJSON(ctx, p.client, issuer+discoveryPath, &discovery); err != nil {
+		return nil, fmt.Errorf("fetching discovery document: %w", err)
+	}
+
+	// the document must be about the issuer we were configured with
+	if strings.TrimSuffix(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match configured issuer %q", discovery.Issuer, p.config.IssuerURL)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing required endpoints")
+	}
+	return &discovery, nil
+}
+
+func (p *Provider) oauth2Config(discovery *Discovery) *oauth2.Config {
+	scopes := p.config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"email", "profile"}
+	}
+	hasOpenID := false
+	for _, scope := range scopes {
+		if scope == "openid" {
+			hasOpenID = true
+		}
+	}
+	if !hasOpenID {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+
+	return &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		RedirectURL:  p.config.RedirectURL,
+		Scopes:       scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  discovery.AuthorizationEndpoint,
+			TokenURL: discovery.TokenEndpoint,
+		},
+	}
+}
+
+// AuthCodeURL builds the authorization request. The verifier stays with us,
+// only its S256 challenge is sent.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return p.oauth2Config(discovery).AuthCodeURL(state,
+		oauth2.S256ChallengeOption(verifier),
+		oauth2.SetAuthURLParam("nonce", nonce),
+	), nil
+}
+
+// Exchange redeems the authorization code and returns the raw ID token
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := p.oauth2Config(discovery).Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return "", fmt.Errorf("exchanging authorization code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return "", errors.New("token response did not contain an id_token")
+	}
+	return rawIDToken, nil
+}
+
+// VerifyIDToken checks the token's signature against the provider's published
+// keys, its issuer, audience and lifetime, and that it echoes our nonce.
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*IDToken, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	keys := p.keys
+	p.mu.Unlock()
+
+	var claims IDToken
+	parser := jwt.NewParser(jwt.WithValidMethods(signingAlgorithms))
+	_, err = parser.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return keys.lookup(ctx, kid, token.Method.Alg())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+	if claims.ExpiresAt == nil || claims.IssuedAt == nil {
+		return nil, fmt.Errorf("%w: missing exp or iat", ErrInvalidIDToken)
+	}
+	if claims.Issuer != discovery.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, claims.Issuer)
+	}
+	if !claims.VerifyAudience(p.config.ClientID, true) {
+		return nil, fmt.Errorf("%w: token was not issued for this client", ErrInvalidIDToken)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID {
+		return nil, fmt.Errorf("%w: unexpected authorized party", ErrInvalidIDToken)
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	return &claims, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,253 @@
+package repositories
+
+import (
+	"HealthHubConnect/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AccountRepository struct {
+	db *gorm.DB
+}
+
+func NewAccountRepository(db *gorm.DB) *AccountRepository {
+	return &AccountRepository{db: db}
+}
+
+func (r *AccountRepository) CreateDeletionRequest(ctx context.Context, request *models.AccountDeletionRequest) error {
+	return r.db.WithContext(ctx).Create(request).Error
+}
+
+func (r *AccountRepository) FindPendingDeletion(ctx context.Context, userID uint) (*models.AccountDeletionRequest, error) {
+	var request models.AccountDeletionRequest
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND status = ?", userID, models.DeletionPending).
+		First(&request).Error
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (r *AccountRepository) CancelDeletion(ctx context.Context, id uint) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.AccountDeletionRequest{}).
+		Where("id = ? AND status = ?", id, models.DeletionPending).
+		Updates(map[string]interface{}{"status": models.DeletionCancelled, "cancelled_at": time.Now()})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *AccountRepository) CompleteDeletion(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Model(&models.AccountDeletionRequest{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"status": models.DeletionCompleted, "completed_at": time.Now()}).Error
+}
+
+// FindNotificationPreference returns the user's preferences, everything
+// enabled when they never changed them
+func (r *AccountRepository) FindNotificationPreference(ctx context.Context, userID uint) (*models.NotificationPreference, error) {
+	preference := models.NotificationPreference{UserID: userID, AppointmentReminders: true}
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&preference).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return &preference, nil
+}
+
+func (r *AccountRepository) SaveNotificationPreference(ctx context.Context, preference *models.NotificationPreference) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"appointment_reminders", "updated_at"}),
+	}).Create(preference).Error
+}
+
+// FindDueDeletions returns the pending requests whose grace period is over
+func (r *AccountRepository) FindDueDeletions(ctx context.Context, now time.Time, limit int) ([]models.AccountDeletionRequest, error) {
+	var requests []models.AccountDeletionRequest
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND scheduled_for <= ?", models.DeletionPending, now).
+		Order("scheduled_for asc").
+		Limit(limit).
+		Find(&requests).Error
+	return requests, err
+}
+
+// CollectAccountData loads every record that belongs to the user
+func (r *AccountRepository) CollectAccountData(ctx context.Context, userID uint) (*models.AccountData, error) {
+	db := r.db.WithContext(ctx)
+	data := &models.AccountData{}
+
+	if err := db.First(&data.User, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var profile models.HealthProfile
+	err := db.Where("user_id = ?", userID).First(&profile).Error
+	switch {
+	case err == nil:
+		data.HealthProfile = &profile
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	queries := []struct {
+		dest  interface{}
+		query string
+	}{
+		{&data.EmergencyContacts, "user_id = ?"},
+		{&data.Allergies, "user_id = ?"},
+		{&data.Medications, "user_id = ?"},
+		{&data.VitalSigns, "user_id = ?"},
+		{&data.Appointments, "patient_id = ?"},
+		{&data.AppointmentSeries, "patient_id = ?"},
+		{&data.WaitlistEntries, "patient_id = ?"},
+		{&data.Prescriptions, "patient_id = ?"},
+	}
+	for _, q := range queries {
+		if err := db.Where(q.query, userID).Order("id asc").Find(q.dest).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// Bill.AfterFind reads a payment_details column the table doesn't have,
+	// the export only needs the stored fields
+	if err := db.Session(&gorm.Session{SkipHooks: true}).Where("patient_id = ?", userID).Order("id asc").Find(&data.Bills).Error; err != nil {
+		return nil, err
+	}
+
+	if err := db.Where("sender_id = ? OR receiver_id = ?", userID, userID).Order("created_at asc").Find(&data.ChatMessages).Error; err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// EraseAccount removes the user's personal and health data in one
+// transaction. Bills are kept for the retention period accounting requires,
+// together with the appointments they were issued for, both stripped of
+// anything but what the invoice needs. The user row stays as an anonymous
+// tombstone so those bills still point somewhere.
+func (r *AccountRepository) EraseAccount(ctx context.Context, userID uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		byUser := []interface{}{userID}
+		purges := []struct {
+			model interface{}
+			query string
+			args  []interface{}
+		}{
+			{&models.HealthProfile{}, "user_id = ?", byUser},
+			{&models.EmergencyContact{}, "user_id = ?", byUser},
+			{&models.Allergy{}, "user_id = ?", byUser},
+			{&models.Medication{}, "user_id = ?", byUser},
+			{&models.VitalSign{}, "user_id = ?", byUser},
+			{&models.Prescription{}, "patient_id = ?", byUser},
+			{&models.WaitlistOffer{}, "patient_id = ?", byUser},
+			{&models.WaitlistEntry{}, "patient_id = ?", byUser},
+			{&models.NotificationPreference{}, "user_id = ?", byUser},
+			{&models.CalendarFeed{}, "user_id = ?", byUser},
+			{&models.OAuthAccount{}, "user_id = ?", byUser},
+			{&models.OIDCLoginState{}, "link_user_id = ?", byUser},
+			{&models.RefreshSession{}, "user_id = ?", byUser},
+			{&models.UserMFA{}, "user_id = ?", byUser},
+			{&models.MFARecoveryCode{}, "user_id = ?", byUser},
+			{&models.OneTimeCode{}, "user_id = ?", byUser},
+			{&models.LoginAttempt{}, "user_id = ?", byUser},
+			{&models.LoginLockout{}, "scope = ? AND lock_key = ?", []interface{}{models.LockoutScopeAccount, strconv.FormatUint(uint64(userID), 10)}},
+			{&models.Delegation{}, "patient_id = ? OR delegate_id = ?", []interface{}{userID, userID}},
+			{&models.ChatMessage{}, "sender_id = ? OR receiver_id = ?", []interface{}{userID, userID}},
+		}
+		for _, p := range purges {
+			if err := tx.Where(p.query, p.args...).Delete(p.model).Error; err != nil {
+				return fmt.Errorf("purging %T: %w", p.model, err)
+			}
+		}
+
+		billed := tx.Model(&models.Bill{}).Select("appointment_id").Where("patient_id = ?", userID)
+		unbilled := tx.Model(&models.Appointment{}).Select("id").Where("patient_id = ? AND id NOT IN (?)", userID, billed)
+		holds := tx.Model(&models.SlotHold{}).Select("id").Where("patient_id = ?", userID)
+		if err := tx.Where("appointment_id IN (?) OR hold_id IN (?)", unbilled, holds).Delete(&models.SlotClaim{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("appointment_id IN (?)", unbilled).Delete(&models.AppointmentEvent{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("appointment_id IN (?)", unbilled).Delete(&models.AppointmentReminder{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.AppointmentReminder{}).
+			Where("appointment_id IN (?)", tx.Model(&models.Appointment{}).Select("id").Where("patient_id = ?", userID)).
+			Update("recipient", "").Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.AppointmentEvent{}).
+			Where("appointment_id IN (?)", tx.Model(&models.Appointment{}).Select("id").Where("patient_id = ?", userID)).
+			Update("reason", "").Error; err != nil {
+			return err
+		}
+		if err := tx.Where("patient_id = ?", userID).Delete(&models.SlotHold{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("patient_id = ? AND id NOT IN (?)", userID, billed).Delete(&models.Appointment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Appointment{}).Where("patient_id = ?", userID).
+			Updates(map[string]interface{}{
+				"description": "",
+				"reason":      "",
+				"notes":       "",
+				"address":     "",
+				"latitude":    0,
+				"longitude":   0,
+				"meet_link":   "",
+			}).Error; err != nil {
+			return err
+		}
+		series := tx.Model(&models.Appointment{}).Select("series_id").Where("patient_id = ? AND series_id IS NOT NULL", userID)
+		if err := tx.Where("patient_id = ? AND id NOT IN (?)", userID, series).Delete(&models.AppointmentSeries{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.AppointmentSeries{}).Where("patient_id = ?", userID).
+			Updates(map[string]interface{}{
+				"description": "",
+				"address":     "",
+				"latitude":    0,
+				"longitude":   0,
+			}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Bill{}).Where("patient_id = ?", userID).
+			Updates(map[string]interface{}{
+				"prescription_id": nil,
+				"billing_address": nil,
+				"notes":           "",
+			}).Error; err != nil {
+			return err
+		}
+
+		// an erased doctor is no longer found by name
+		if err := unindexDoctor(tx, userID); err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{
+				"email":           fmt.Sprintf("deleted-user-%d@deleted.invalid", userID),
+				"name":            "Deleted user",
+				"password_hash":   "",
+				"profile_picture": "",
+				"phone":           0,
+				"is_active":       false,
+				"email_verified":  false,
+				"auth_provider":   "deleted",
+			}).Error
+	})
+}
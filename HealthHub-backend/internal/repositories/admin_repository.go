@@ -88,6 +88,7 @@ func (r *AdminRepository) GetSystemSettings(ctx context.Context) (*models.AdminS
 			EmailNotifications: true,
 			MaxLoginAttempts:   5,
 			SessionTimeout:     60,
+			MFARequiredRoles:   []models.UserRole{models.RoleAdmin, models.RoleDoctor},
 		}
 		err = r.db.WithContext(ctx).Create(&settings).Error
 	}
@@ -2,9 +2,19 @@ package repositories
 
 import (
 	"HealthHubConnect/internal/models"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrSlotFull       = errors.New("slot has no free seats")
+	ErrHoldExpired    = errors.New("slot hold has expired")
+	ErrStatusConflict = errors.New("appointment status changed concurrently")
 )
 
 type AppointmentRepository interface {
@@ -17,12 +27,29 @@ type AppointmentRepository interface {
 	GetDoctorAvailability(doctorID uint) ([]models.DoctorAvailability, error)
 	GetConflictingAppointments(doctorID uint, date time.Time, start time.Time, end time.Time) ([]models.Appointment, error)
 	IsDoctorAvailable(doctorID uint, date time.Time, start time.Time, end time.Time) (bool, error)
-	GetAppointmentsByDoctorAndDate(doctorID uint, date time.Time) ([]models.Appointment, error)
 	GetUpcomingAppointments(doctorID uint) ([]models.Appointment, error)
 	GetPastAppointments(doctorID uint) ([]models.Appointment, error)
 	GetAppointmentsByDoctorAndDateRange(doctorID uint, start time.Time, end time.Time) ([]models.Appointment, error)
-	GetPatientUpcomingAppointments(patientID uint) ([]models.Appointment, error)
-	GetDoctorUpcomingAppointments(doctorID uint) ([]models.Appointment, error)
+	GetPatientUpcomingAppointments(patientID uint, from time.Time) ([]models.Appointment, error)
+	GetDoctorUpcomingAppointments(doctorID uint, from time.Time) ([]models.Appointment, error)
+	BookAppointment(appointment *models.Appointment, slot models.TimeSlot, events ...*models.AppointmentEvent) error
+	RegisterWalkIn(appointment *models.Appointment, event *models.AppointmentEvent) error
+	GetRecentConsultations(doctorID uint, limit int) ([]models.Appointment, error)
+	RebookAppointment(appointment *models.Appointment, slot models.TimeSlot, event *models.AppointmentEvent) error
+	TransitionAppointment(appointment *models.Appointment, from models.AppointmentStatus, event *models.AppointmentEvent, charge *models.AppointmentCharge) error
+	GetAppointmentBill(appointmentID uint) (*models.Bill, error)
+	CreateSeries(series *models.AppointmentSeries) error
+	GetSeriesByID(id uint) (*models.AppointmentSeries, error)
+	UpdateSeriesStatus(id uint, status models.SeriesStatus) error
+	DeleteSeries(id uint) error
+	GetAppointmentEvents(appointmentID uint) ([]models.AppointmentEvent, error)
+	ReleaseAppointmentSlot(appointmentID uint) error
+	CreateHold(hold *models.SlotHold, slot models.TimeSlot) error
+	GetHoldByID(id uint) (*models.SlotHold, error)
+	GetActiveHoldsByDoctorAndDateRange(doctorID uint, start time.Time, end time.Time) ([]models.SlotHold, error)
+	ConvertHold(hold *models.SlotHold, appointment *models.Appointment, event *models.AppointmentEvent) error
+	ReleaseHold(hold *models.SlotHold) error
+	ExpireHolds(now time.Time) (int64, error)
 }
 
 type appointmentRepository struct {
@@ -97,12 +124,6 @@ func (r *appointmentRepository) IsDoctorAvailable(doctorID uint, date time.Time,
 	return count > 0, err
 }
 
-func (r *appointmentRepository) GetAppointmentsByDoctorAndDate(doctorID uint, date time.Time) ([]models.Appointment, error) {
-	var appointments []models.Appointment
-	err := r.db.Where("doctor_id = ? AND DATE(date) = DATE(?)", doctorID, date).Find(&appointments).Error
-	return appointments, err
-}
-
 func (r *appointmentRepository) GetUpcomingAppointments(doctorID uint) ([]models.Appointment, error) {
 	var appointments []models.Appointment
 	err := r.db.Preload("Patient").
@@ -123,34 +144,35 @@ func (r *appointmentRepository) GetPastAppointments(doctorID uint) ([]models.App
 	return appointments, err
 }
 
+// GetAppointmentsByDoctorAndDateRange returns the doctor's appointments that
+// overlap [start, end). The bounds are instants, callers work out where a day
+// begins in the zone that matters to them.
 func (r *appointmentRepository) GetAppointmentsByDoctorAndDateRange(doctorID uint, start time.Time, end time.Time) ([]models.Appointment, error) {
 	var appointments []models.Appointment
 	err := r.db.Preload("Patient").
-		Where("doctor_id = ? AND date >= ? AND date < ?", doctorID, start, end).
-		Order("date asc, start_time asc").
+		Where("doctor_id = ? AND start_time < ? AND end_time > ?", doctorID, end.UTC(), start.UTC()).
+		Order("start_time asc").
 		Find(&appointments).Error
 	return appointments, err
 }
 
-func (r *appointmentRepository) GetPatientUpcomingAppointments(patientID uint) ([]models.Appointment, error) {
+// GetPatientUpcomingAppointments returns the patient's open appointments starting
+// from the given instant, usually the start of today in the patient's zone
+func (r *appointmentRepository) GetPatientUpcomingAppointments(patientID uint, from time.Time) ([]models.Appointment, error) {
 	var appointments []models.Appointment
-	now := time.Now()
 
-	result := r.db.Debug().
+	result := r.db.
 		Preload("Doctor").
 		Preload("Patient").
 		Where("patient_id = ?", patientID).
-		Where("date >= ? OR (date = ? AND start_time > ?)",
-			now.Format("2006-01-02"),
-			now.Format("2006-01-02"),
-			now.Format("15:04:05")).
+		Where("start_time >= ?", from.UTC()).
 		Where("status NOT IN ?",
 			[]models.AppointmentStatus{
 				models.StatusCancelled,
 				models.StatusCompleted,
 				models.StatusNoShow,
 			}).
-		Order("date ASC, start_time ASC").
+		Order("start_time ASC").
 		Find(&appointments)
 
 	if result.Error != nil {
@@ -160,25 +182,23 @@ func (r *appointmentRepository) GetPatientUpcomingAppointments(patientID uint) (
 	return appointments, nil
 }
 
-func (r *appointmentRepository) GetDoctorUpcomingAppointments(doctorID uint) ([]models.Appointment, error) {
+// GetDoctorUpcomingAppointments returns the doctor's open appointments starting
+// from the given instant, usually the start of today in the doctor's zone
+func (r *appointmentRepository) GetDoctorUpcomingAppointments(doctorID uint, from time.Time) ([]models.Appointment, error) {
 	var appointments []models.Appointment
-	now := time.Now()
 
-	result := r.db.Debug().
+	result := r.db.
 		Preload("Doctor").
 		Preload("Patient").
 		Where("doctor_id = ?", doctorID).
-		Where("date >= ? OR (date = ? AND start_time > ?)",
-			now.Format("2006-01-02"),
-			now.Format("2006-01-02"),
-			now.Format("15:04:05")).
+		Where("start_time >= ?", from.UTC()).
 		Where("status NOT IN ?",
 			[]models.AppointmentStatus{
 				models.StatusCancelled,
 				models.StatusCompleted,
 				models.StatusNoShow,
 			}).
-		Order("date ASC, start_time ASC").
+		Order("start_time ASC").
 		Find(&appointments)
 
 	if result.Error != nil {
@@ -187,3 +207,383 @@ func (r *appointmentRepository) GetDoctorUpcomingAppointments(doctorID uint) ([]
 
 	return appointments, nil
 }
+
+// claimSeat takes a free seat of the slot. Every live claim overlapping the
+// slot counts against its capacity, whatever slot it was made for, so slots
+// cut differently since a booking was made still can't be overbooked. The
+// doctor is locked first for concurrent claims to count one after the other.
+// Seats of holds that have run out are freed so they can be taken again.
+func claimSeat(tx *gorm.DB, claim *models.SlotClaim, capacity int) error {
+	now := time.Now().UTC()
+	var locked []uint
+	if err := tx.Model(&models.User{}).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", claim.DoctorID).
+		Pluck("id", &locked).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("doctor_id = ? AND expires_at <= ?", claim.DoctorID, now).
+		Delete(&models.SlotClaim{}).Error; err != nil {
+		return err
+	}
+
+	var taken int64
+	if err := tx.Model(&models.SlotClaim{}).
+		Where("doctor_id = ? AND slot_start < ? AND slot_end > ?", claim.DoctorID, claim.SlotEnd, claim.SlotStart).
+		Where("(expires_at IS NULL OR expires_at > ?)", now).
+		Count(&taken).Error; err != nil {
+		return err
+	}
+	if taken >= int64(capacity) {
+		return ErrSlotFull
+	}
+
+	for seat := 0; seat < capacity; seat++ {
+		claim.ID = 0
+		claim.Seat = seat
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(claim)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			return nil
+		}
+	}
+	return ErrSlotFull
+}
+
+func slotClaim(doctorID uint, slot models.TimeSlot) *models.SlotClaim {
+	return &models.SlotClaim{
+		DoctorID:  doctorID,
+		SlotStart: slot.StartTime.UTC(),
+		SlotEnd:   slot.EndTime.UTC(),
+	}
+}
+
+// BookAppointment creates the appointment and claims a seat of its slot in
+// one transaction, with the history events of its booking in order. It fails
+// with ErrSlotFull when every seat is taken
+func (r *appointmentRepository) BookAppointment(appointment *models.Appointment, slot models.TimeSlot, events ...*models.AppointmentEvent) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(appointment).Error; err != nil {
+			return err
+		}
+
+		claim := slotClaim(appointment.DoctorID, slot)
+		claim.AppointmentID = &appointment.ID
+		if err := claimSeat(tx, claim, slot.Capacity); err != nil {
+			return err
+		}
+		for _, event := range events {
+			if err := recordEvent(tx, appointment.ID, event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RegisterWalkIn creates an appointment for a patient who turned up without
+// one. It takes no slot seat, the patient waits in the queue instead.
+func (r *appointmentRepository) RegisterWalkIn(appointment *models.Appointment, event *models.AppointmentEvent) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(appointment).Error; err != nil {
+			return err
+		}
+		return recordEvent(tx, appointment.ID, event)
+	})
+}
+
+// GetRecentConsultations returns the doctor's last completed appointments
+// whose consultation was timed from start to finish
+func (r *appointmentRepository) GetRecentConsultations(doctorID uint, limit int) ([]models.Appointment, error) {
+	var appointments []models.Appointment
+	err := r.db.
+		Where("doctor_id = ? AND status = ?", doctorID, models.StatusCompleted).
+		Where("started_at IS NOT NULL AND completed_at IS NOT NULL").
+		Order("completed_at desc").
+		Limit(limit).
+		Find(&appointments).Error
+	return appointments, err
+}
+
+// RebookAppointment moves the appointment's seat to a new slot. The reminders
+// already sent were about the old time, the new one is reminded afresh.
+func (r *appointmentRepository) RebookAppointment(appointment *models.Appointment, slot models.TimeSlot, event *models.AppointmentEvent) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("appointment_id = ?", appointment.ID).Delete(&models.SlotClaim{}).Error; err != nil {
+			return err
+		}
+
+		claim := slotClaim(appointment.DoctorID, slot)
+		claim.AppointmentID = &appointment.ID
+		if err := claimSeat(tx, claim, slot.Capacity); err != nil {
+			return err
+		}
+		if err := tx.Omit("Patient", "Doctor", "Prescription", "Bill").Save(appointment).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("appointment_id = ?", appointment.ID).Delete(&models.AppointmentReminder{}).Error; err != nil {
+			return err
+		}
+		return recordEvent(tx, appointment.ID, event)
+	})
+}
+
+// TransitionAppointment saves the appointment's new status together with its
+// history event and settles the charge, if any. It fails with
+// ErrStatusConflict when the stored status is no longer from, and frees the
+// slot seat of cancelled appointments
+func (r *appointmentRepository) TransitionAppointment(appointment *models.Appointment, from models.AppointmentStatus, event *models.AppointmentEvent, charge *models.AppointmentCharge) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Appointment{}).
+			Where("id = ? AND status = ?", appointment.ID, from).
+			Update("status", appointment.Status)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrStatusConflict
+		}
+
+		if err := tx.Omit("Patient", "Doctor", "Prescription", "Bill").Save(appointment).Error; err != nil {
+			return err
+		}
+
+		if appointment.Status == models.StatusCancelled {
+			if err := tx.Where("appointment_id = ?", appointment.ID).Delete(&models.SlotClaim{}).Error; err != nil {
+				return err
+			}
+		}
+		if err := settleCharge(tx, appointment, charge); err != nil {
+			return err
+		}
+		return recordEvent(tx, appointment.ID, event)
+	})
+}
+
+// settleCharge applies a cancellation or no-show charge: the appointment's
+// bill is refunded what the policy gives back, or cancelled when nothing was
+// paid, and any fee is billed separately
+func settleCharge(tx *gorm.DB, appointment *models.Appointment, charge *models.AppointmentCharge) error {
+	if charge == nil {
+		return nil
+	}
+	now := time.Now()
+	reason := fmt.Sprintf("appointment %s", strings.ToLower(strings.ReplaceAll(string(charge.Status), "_", "-")))
+
+	if charge.BillID != nil {
+		bills := tx.Model(&models.Bill{}).Where("id = ?", *charge.BillID)
+		switch {
+		case charge.RefundAmount > 0:
+			if err := bills.Updates(map[string]interface{}{
+				"refund_status": models.RefundStatusPending,
+				"refund_amount": charge.RefundAmount,
+				"refund_reason": reason,
+				"refund_date":   now,
+			}).Error; err != nil {
+				return err
+			}
+		case charge.RetainedAmount == 0:
+			if err := bills.Where("status IN ?", []models.BillStatus{models.BillStatusPending, models.BillStatusOverdue}).
+				Updates(map[string]interface{}{
+					"status":       models.BillStatusCancelled,
+					"cancelled_at": now,
+					"cancelled_by": appointment.CancelledBy,
+				}).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	if charge.Fee <= 0 {
+		return nil
+	}
+
+	description := "Late cancellation fee"
+	if charge.Status == models.StatusNoShow {
+		description = "No-show fee"
+	}
+	fee := &models.Bill{
+		BillNumber:    fmt.Sprintf("FEE-%d-%s", appointment.ID, now.Format("20060102150405")),
+		AppointmentID: appointment.ID,
+		PatientID:     appointment.PatientID,
+		DoctorID:      appointment.DoctorID,
+		Items: []models.BillItem{{
+			Description: description,
+			Category:    "Other",
+			Quantity:    1,
+			UnitPrice:   charge.Fee,
+			TotalPrice:  charge.Fee,
+		}},
+		SubTotal:    charge.Fee,
+		TotalAmount: charge.Fee,
+		DueAmount:   charge.Fee,
+		Currency:    charge.Currency,
+		Status:      models.BillStatusPending,
+		DueDate:     now.AddDate(0, 0, 7),
+		Notes:       fmt.Sprintf("%s for appointment %d", description, appointment.ID),
+	}
+	if err := insertBill(tx, fee); err != nil {
+		return err
+	}
+	charge.FeeBillID = &fee.ID
+	return nil
+}
+
+// GetAppointmentBill returns the consultation bill of the appointment, the
+// first one raised for it
+func (r *appointmentRepository) GetAppointmentBill(appointmentID uint) (*models.Bill, error) {
+	var bill models.Bill
+	// Bill.AfterFind reads a payment_details column the table doesn't have
+	err := r.db.Session(&gorm.Session{SkipHooks: true}).
+		Where("appointment_id = ?", appointmentID).
+		Order("id asc").
+		First(&bill).Error
+	return &bill, err
+}
+
+func (r *appointmentRepository) GetAppointmentEvents(appointmentID uint) ([]models.AppointmentEvent, error) {
+	var events []models.AppointmentEvent
+	err := r.db.Where("appointment_id = ?", appointmentID).
+		Order("created_at asc, id asc").
+		Find(&events).Error
+	return events, err
+}
+
+func recordEvent(tx *gorm.DB, appointmentID uint, event *models.AppointmentEvent) error {
+	if event == nil {
+		return nil
+	}
+	event.AppointmentID = appointmentID
+	return tx.Create(event).Error
+}
+
+func (r *appointmentRepository) CreateSeries(series *models.AppointmentSeries) error {
+	return r.db.Omit("Appointments").Create(series).Error
+}
+
+// GetSeriesByID returns the series with its occurrences in time order
+func (r *appointmentRepository) GetSeriesByID(id uint) (*models.AppointmentSeries, error) {
+	var series models.AppointmentSeries
+	err := r.db.Preload("Appointments", func(db *gorm.DB) *gorm.DB {
+		return db.Order("start_time asc, id asc")
+	}).First(&series, id).Error
+	return &series, err
+}
+
+func (r *appointmentRepository) UpdateSeriesStatus(id uint, status models.SeriesStatus) error {
+	return r.db.Model(&models.AppointmentSeries{}).Where("id = ?", id).Update("status", status).Error
+}
+
+func (r *appointmentRepository) DeleteSeries(id uint) error {
+	return r.db.Delete(&models.AppointmentSeries{}, id).Error
+}
+
+func (r *appointmentRepository) ReleaseAppointmentSlot(appointmentID uint) error {
+	return r.db.Where("appointment_id = ?", appointmentID).Delete(&models.SlotClaim{}).Error
+}
+
+// CreateHold claims a seat for the hold. Any other active hold the patient
+// has with the same doctor is released, a patient holds one slot at a time
+func (r *appointmentRepository) CreateHold(hold *models.SlotHold, slot models.TimeSlot) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		previous := tx.Model(&models.SlotHold{}).Select("id").
+			Where("patient_id = ? AND doctor_id = ? AND status = ?", hold.PatientID, hold.DoctorID, models.HoldActive)
+		if err := tx.Where("hold_id IN (?)", previous).Delete(&models.SlotClaim{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.SlotHold{}).
+			Where("patient_id = ? AND doctor_id = ? AND status = ?", hold.PatientID, hold.DoctorID, models.HoldActive).
+			Update("status", models.HoldReleased).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Create(hold).Error; err != nil {
+			return err
+		}
+
+		claim := slotClaim(hold.DoctorID, slot)
+		claim.HoldID = &hold.ID
+		claim.ExpiresAt = &hold.ExpiresAt
+		return claimSeat(tx, claim, slot.Capacity)
+	})
+}
+
+func (r *appointmentRepository) GetHoldByID(id uint) (*models.SlotHold, error) {
+	var hold models.SlotHold
+	err := r.db.First(&hold, id).Error
+	return &hold, err
+}
+
+// GetActiveHoldsByDoctorAndDateRange returns the doctor's live holds that
+// overlap [start, end)
+func (r *appointmentRepository) GetActiveHoldsByDoctorAndDateRange(doctorID uint, start time.Time, end time.Time) ([]models.SlotHold, error) {
+	var holds []models.SlotHold
+	err := r.db.Where("doctor_id = ? AND start_time < ? AND end_time > ? AND status = ? AND expires_at > ?",
+		doctorID, end.UTC(), start.UTC(), models.HoldActive, time.Now().UTC()).
+		Find(&holds).Error
+	return holds, err
+}
+
+// ConvertHold turns the hold's seat into the appointment's, it fails with
+// ErrHoldExpired when the seat was already given up
+func (r *appointmentRepository) ConvertHold(hold *models.SlotHold, appointment *models.Appointment, event *models.AppointmentEvent) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var claim models.SlotClaim
+		err := tx.Where("hold_id = ? AND expires_at > ?", hold.ID, time.Now().UTC()).First(&claim).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrHoldExpired
+			}
+			return err
+		}
+
+		if err := tx.Create(appointment).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&claim).Updates(map[string]interface{}{
+			"appointment_id": appointment.ID,
+			"hold_id":        nil,
+			"expires_at":     nil,
+		}).Error; err != nil {
+			return err
+		}
+
+		hold.Status = models.HoldConverted
+		hold.AppointmentID = &appointment.ID
+		if err := tx.Save(hold).Error; err != nil {
+			return err
+		}
+		return recordEvent(tx, appointment.ID, event)
+	})
+}
+
+func (r *appointmentRepository) ReleaseHold(hold *models.SlotHold) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("hold_id = ?", hold.ID).Delete(&models.SlotClaim{}).Error; err != nil {
+			return err
+		}
+
+		hold.Status = models.HoldReleased
+		return tx.Save(hold).Error
+	})
+}
+
+// ExpireHolds marks the holds that ran out as expired and frees their seats
+func (r *appointmentRepository) ExpireHolds(now time.Time) (int64, error) {
+	now = now.UTC()
+	var expired int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at <= ?", now).Delete(&models.SlotClaim{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.SlotHold{}).
+			Where("status = ? AND expires_at <= ?", models.HoldActive, now).
+			Update("status", models.HoldExpired)
+		expired = result.RowsAffected
+		return result.Error
+	})
+	return expired, err
+}
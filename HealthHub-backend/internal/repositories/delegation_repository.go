@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"HealthHubConnect/internal/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type DelegationRepository struct {
+	db *gorm.DB
+}
+
+func NewDelegationRepository(db *gorm.DB) *DelegationRepository {
+	return &DelegationRepository{db: db}
+}
+
+func (r *DelegationRepository) Create(ctx context.Context, delegation *models.Delegation) error {
+	return r.db.WithContext(ctx).Create(delegation).Error
+}
+
+func (r *DelegationRepository) FindByID(ctx context.Context, id uint) (*models.Delegation, error) {
+	var delegation models.Delegation
+	if err := r.db.WithContext(ctx).First(&delegation, id).Error; err != nil {
+		return nil, err
+	}
+	return &delegation, nil
+}
+
+// FindActive returns the grant currently letting the delegate act for the patient
+func (r *DelegationRepository) FindActive(ctx context.Context, patientID, delegateID uint, now time.Time) (*models.Delegation, error) {
+	var delegation models.Delegation
+	err := r.db.WithContext(ctx).
+		Where("patient_id = ? AND delegate_id = ? AND revoked_at IS NULL AND starts_at <= ? AND expires_at > ?", patientID, delegateID, now, now).
+		Order("created_at desc").
+		First(&delegation).Error
+	if err != nil {
+		return nil, err
+	}
+	return &delegation, nil
+}
+
+// HasOverlapping tells whether an unrevoked grant between the two users
+// overlaps the given window
+func (r *DelegationRepository) HasOverlapping(ctx context.Context, patientID, delegateID uint, startsAt, expiresAt time.Time) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.Delegation{}).
+		Where("patient_id = ? AND delegate_id = ? AND revoked_at IS NULL AND starts_at < ? AND expires_at > ?", patientID, delegateID, expiresAt, startsAt).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *DelegationRepository) ListByPatient(ctx context.Context, patientID uint) ([]models.Delegation, error) {
+	var delegations []models.Delegation
+	err := r.db.WithContext(ctx).
+		Where("patient_id = ?", patientID).
+		Order("created_at desc").
+		Find(&delegations).Error
+	return delegations, err
+}
+
+func (r *DelegationRepository) ListByDelegate(ctx context.Context, delegateID uint) ([]models.Delegation, error) {
+	var delegations []models.Delegation
+	err := r.db.WithContext(ctx).
+		Where("delegate_id = ?", delegateID).
+		Order("created_at desc").
+		Find(&delegations).Error
+	return delegations, err
+}
+
+func (r *DelegationRepository) Revoke(ctx context.Context, id, revokedBy uint) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.Delegation{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_by": revokedBy})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
@@ -5,9 +5,11 @@ import (
 	"HealthHubConnect/internal/models"
 
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -44,15 +46,18 @@ func (r *DoctorRepository) SaveProfile(ctx context.Context, profile *models.Doct
 		var existing models.DoctorProfile
 		err := tx.Where("user_id = ?", profile.UserID).First(&existing).Error
 
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			err = tx.Create(profile).Error
+		case err == nil:
+			profile.ID = existing.ID
+			err = tx.Save(profile).Error
+		}
 		if err != nil {
-			if err == gorm.ErrRecordNotFound {
-				return tx.Create(profile).Error
-			}
 			return err
 		}
 
-		profile.ID = existing.ID
-		return tx.Save(profile).Error
+		return indexDoctor(tx, profile)
 	})
 }
 
@@ -149,7 +154,12 @@ func (r *DoctorRepository) UpdateProfile(ctx context.Context, profile *models.Do
 	}
 
 	profile.ID = existingProfile.ID
-	return r.db.WithContext(ctx).Save(profile).Error
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(profile).Error; err != nil {
+			return err
+		}
+		return indexDoctor(tx, profile)
+	})
 }
 
 func (r *DoctorRepository) DeleteProfile(ctx context.Context, userID uint) error {
@@ -157,23 +167,111 @@ func (r *DoctorRepository) DeleteProfile(ctx context.Context, userID uint) error
 		return err
 	}
 
-	return r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.DoctorProfile{}).Error
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.DoctorProfile{}).Error; err != nil {
+			return err
+		}
+		return unindexDoctor(tx, userID)
+	})
 }
 
-func (r *DoctorRepository) SaveSchedule(ctx context.Context, schedule *models.DoctorSchedule) error {
+// SaveSchedule replaces the doctor's weekly schedule and records it as the
+// next version of the default schedule
+func (r *DoctorRepository) SaveSchedule(ctx context.Context, schedule *models.DoctorSchedule, version *models.ScheduleVersion) error {
 	if err := r.ValidateDoctorAccess(ctx, schedule.DoctorID); err != nil {
 		return err
 	}
 
-	var existing models.DoctorSchedule
-	err := r.db.WithContext(ctx).Where("doctor_id = ?", schedule.DoctorID).First(&existing).Error
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing models.DoctorSchedule
+		err := tx.Where("doctor_id = ?", schedule.DoctorID).First(&existing).Error
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			err = tx.Create(schedule).Error
+		case err == nil:
+			schedule.ID = existing.ID
+			err = tx.Save(schedule).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		return createScheduleVersion(tx, version)
+	})
+}
+
+// CreateScheduleVersion saves the next version of a named template
+func (r *DoctorRepository) CreateScheduleVersion(ctx context.Context, version *models.ScheduleVersion) error {
+	if err := r.ValidateDoctorAccess(ctx, version.DoctorID); err != nil {
+		return err
+	}
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return createScheduleVersion(tx, version)
+	})
+}
+
+// createScheduleVersion numbers the version after the template's latest, the
+// unique index turns a concurrent save of the same template into an error
+func createScheduleVersion(tx *gorm.DB, version *models.ScheduleVersion) error {
+	latest, err := latestScheduleVersion(tx, version.DoctorID, version.Name)
+	if err != nil {
+		return err
+	}
+	version.Version = latest + 1
+	return tx.Create(version).Error
+}
+
+func latestScheduleVersion(db *gorm.DB, doctorID uint, name string) (int, error) {
+	var latest sql.NullInt64
+	err := db.Model(&models.ScheduleVersion{}).
+		Select("MAX(version)").
+		Where("doctor_id = ? AND name = ?", doctorID, name).
+		Row().Scan(&latest)
+	return int(latest.Int64), err
+}
+
+// NextScheduleVersion returns the number the template's next version would
+// get
+func (r *DoctorRepository) NextScheduleVersion(ctx context.Context, doctorID uint, name string) (int, error) {
+	latest, err := latestScheduleVersion(r.db.WithContext(ctx), doctorID, name)
+	return latest + 1, err
+}
 
-	if err == gorm.ErrRecordNotFound {
-		return r.db.WithContext(ctx).Create(schedule).Error
+// FindCurrentScheduleVersions returns the latest version of each of the
+// doctor's named templates, the ones in force between their dates
+func (r *DoctorRepository) FindCurrentScheduleVersions(ctx context.Context, doctorID uint) ([]models.ScheduleVersion, error) {
+	var versions []models.ScheduleVersion
+	err := r.db.WithContext(ctx).
+		Where("doctor_id = ? AND name <> ?", doctorID, models.DefaultScheduleName).
+		Where(`version = (SELECT MAX(v.version) FROM schedule_versions v
+			WHERE v.doctor_id = schedule_versions.doctor_id AND v.name = schedule_versions.name)`).
+		Order("effective_from asc, id asc").
+		Find(&versions).Error
+	return versions, err
+}
+
+// FindScheduleVersions returns the version history of the doctor's schedule
+// and templates, or of the named one, newest first
+func (r *DoctorRepository) FindScheduleVersions(ctx context.Context, doctorID uint, name string) ([]models.ScheduleVersion, error) {
+	var versions []models.ScheduleVersion
+	query := r.db.WithContext(ctx).Where("doctor_id = ?", doctorID)
+	if name != "" {
+		query = query.Where("name = ?", name)
 	}
+	err := query.Order("created_at desc, id desc").Find(&versions).Error
+	return versions, err
+}
 
-	schedule.ID = existing.ID
-	return r.db.WithContext(ctx).Save(schedule).Error
+func (r *DoctorRepository) FindScheduleVersion(ctx context.Context, id uint) (*models.ScheduleVersion, error) {
+	var version models.ScheduleVersion
+	if err := r.db.WithContext(ctx).First(&version, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError("schedule version not found")
+		}
+		return nil, err
+	}
+	return &version, nil
 }
 
 func (r *DoctorRepository) GetSchedule(ctx context.Context, doctorID uint) (*models.DoctorSchedule, error) {
@@ -199,16 +297,18 @@ func (r *DoctorRepository) GetScheduleWithoutValidation(ctx context.Context, doc
 	return &schedule, err
 }
 
-func (r *DoctorRepository) SaveBulkAvailability(ctx context.Context, availabilities []models.DoctorAvailability) error {
-
+// SaveBulkAvailability replaces the doctor's availability from the given
+// calendar day on, in one transaction so a failed save keeps the old one
+func (r *DoctorRepository) SaveBulkAvailability(ctx context.Context, doctorID uint, from time.Time, availabilities []models.DoctorAvailability) error {
 	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("doctor_id = ? AND date >= ?",
-			availabilities[0].DoctorID,
-			time.Now().Format("2006-01-02")).
+		if err := tx.Where("doctor_id = ? AND date >= ?", doctorID, models.CalendarDate(from)).
 			Delete(&models.DoctorAvailability{}).Error; err != nil {
 			return err
 		}
 
+		if len(availabilities) == 0 {
+			return nil
+		}
 		return tx.CreateInBatches(availabilities, 100).Error
 	})
 }
@@ -224,41 +324,54 @@ func (r *DoctorRepository) AddBulkAvailability(ctx context.Context, availabiliti
 	return r.db.WithContext(ctx).CreateInBatches(availabilities, 100).Error
 }
 
-func (r *DoctorRepository) ListDoctors(ctx context.Context, filters map[string]interface{}, page, limit int) ([]models.DoctorProfile, int64, error) {
-	var profiles []models.DoctorProfile
-	var total int64
+// GetTimezone returns the zone the doctor's schedule is kept in, the one set
+// on their profile or else their own
+func (r *DoctorRepository) GetTimezone(ctx context.Context, doctorID uint) (string, error) {
+	var timezone string
+	err := r.db.WithContext(ctx).
+		Table("users").
+		Select("COALESCE(NULLIF(doctor_profiles.timezone, ''), users.timezone, '')").
+		Joins("LEFT JOIN doctor_profiles ON doctor_profiles.user_id = users.id").
+		Where("users.id = ?", doctorID).
+		Limit(1).
+		Row().Scan(&timezone)
+	if err == sql.ErrNoRows {
+		return "", errors.NewNotFoundError("doctor not found")
+	}
+	return timezone, err
+}
 
-	query := r.db.WithContext(ctx).
+// GetAffiliations returns the practices listed in the doctor's profile, none
+// when the doctor has no profile yet
+func (r *DoctorRepository) GetAffiliations(ctx context.Context, doctorID uint) ([]models.Affiliation, error) {
+	var practiceJSON sql.NullString
+	err := r.db.WithContext(ctx).
 		Model(&models.DoctorProfile{}).
-		Joins("JOIN users ON users.id = doctor_profiles.user_id").
-		Where("users.role = ?", models.RoleDoctor).
-		Preload("User", func(db *gorm.DB) *gorm.DB {
-			return db.Select("id, name, profile_picture")
-		})
-	fmt.Print(query)
-	if specialization, ok := filters["specialization"].(string); ok && specialization != "" {
-		query = query.Where("basic_info_json->>'specializations' @> ?", fmt.Sprintf("[\"%s\"]", specialization))
+		Select("practice_json").
+		Where("user_id = ?", doctorID).
+		Limit(1).
+		Row().Scan(&practiceJSON)
+	if err == sql.ErrNoRows || (err == nil && practiceJSON.String == "") {
+		return nil, nil
 	}
-	if name, ok := filters["name"].(string); ok && name != "" {
-		query = query.Where("users.name ILIKE ?", "%"+name+"%")
+	if err != nil {
+		return nil, err
 	}
 
-	if err := query.Count(&total).Error; err != nil {
-		return nil, 0, err
+	var practice models.PracticeDetails
+	if err := json.Unmarshal([]byte(practiceJSON.String), &practice); err != nil {
+		return nil, err
 	}
+	return practice.Affiliations, nil
+}
 
-	err := query.
-		Offset((page - 1) * limit).
-		Limit(limit).
-		Find(&profiles).Error
-
-	if err != nil {
-		log.Printf("Error fetching doctors: %v", err)
-		return nil, 0, err
+func (r *DoctorRepository) FindHospitals(ctx context.Context, ids []uint) ([]models.Hospital, error) {
+	var hospitals []models.Hospital
+	if len(ids) == 0 {
+		return hospitals, nil
 	}
-
-	log.Printf("Found %d doctors", len(profiles))
-	return profiles, total, nil
+	err := r.db.WithContext(ctx).Where("id IN ?", ids).Find(&hospitals).Error
+	return hospitals, err
 }
 
 func (r *DoctorRepository) DeleteAvailabilitySlots(ctx context.Context, doctorID uint, date time.Time, startTime time.Time, endTime time.Time) error {
@@ -268,6 +381,38 @@ func (r *DoctorRepository) DeleteAvailabilitySlots(ctx context.Context, doctorID
 		Delete(&models.DoctorAvailability{}).Error
 }
 
+func (r *DoctorRepository) CreateBlockedSlot(ctx context.Context, slot *models.BlockedSlot) error {
+	return r.db.WithContext(ctx).Create(slot).Error
+}
+
+func (r *DoctorRepository) GetBlockedSlotByID(ctx context.Context, id uint) (*models.BlockedSlot, error) {
+	var slot models.BlockedSlot
+	if err := r.db.WithContext(ctx).First(&slot, id).Error; err != nil {
+		return nil, err
+	}
+	return &slot, nil
+}
+
+func (r *DoctorRepository) DeleteBlockedSlot(ctx context.Context, slot *models.BlockedSlot) error {
+	return r.db.WithContext(ctx).Delete(slot).Error
+}
+
+// GetBlockedSlots returns the one-off blocks on the given date together with
+// the recurring blocks for that weekday that started on or before it
+func (r *DoctorRepository) GetBlockedSlots(ctx context.Context, doctorID uint, date time.Time) ([]models.BlockedSlot, error) {
+	var slots []models.BlockedSlot
+	day := date.Format("2006-01-02")
+	weekday := strings.ToLower(date.Weekday().String())
+
+	err := r.db.WithContext(ctx).
+		Where("doctor_id = ?", doctorID).
+		Where("(is_recurring = ? AND DATE(date) = ?) OR (is_recurring = ? AND recurring_day = ? AND DATE(date) <= ?)",
+			false, day, true, weekday, day).
+		Order("start_time asc").
+		Find(&slots).Error
+	return slots, err
+}
+
 func (r *DoctorRepository) GetDoctorPatients(ctx context.Context, doctorID uint, page, limit int) ([]models.PatientInfo, int64, error) {
 	var patients []models.PatientInfo
 	var total int64
@@ -332,8 +477,13 @@ func (r *DoctorRepository) IsPatientOfDoctor(ctx context.Context, doctorID, pati
 }
 
 func (r *DoctorRepository) CreateBill(ctx context.Context, bill *models.Bill) error {
-	billNumber := fmt.Sprintf("BILL-%d-%s", bill.DoctorID, time.Now().Format("20060102150405"))
-	bill.BillNumber = billNumber
+	bill.BillNumber = fmt.Sprintf("BILL-%d-%s", bill.DoctorID, time.Now().Format("20060102150405"))
+	return insertBill(r.db.WithContext(ctx), bill)
+}
+
+// insertBill writes the bill column by column, the address and tax structs
+// have no column mapping of their own
+func insertBill(db *gorm.DB, bill *models.Bill) error {
 	bill.IssuedAt = time.Now()
 
 	itemsJSON, err := json.Marshal(bill.Items)
@@ -350,6 +500,8 @@ func (r *DoctorRepository) CreateBill(ctx context.Context, bill *models.Bill) er
 		"tax_amount":      bill.TaxAmount,
 		"discount_amount": bill.DiscountAmount,
 		"total_amount":    bill.TotalAmount,
+		"due_amount":      bill.DueAmount,
+		"currency":        bill.Currency,
 		"status":          bill.Status,
 		"due_date":        bill.DueDate,
 		"notes":           bill.Notes,
@@ -357,8 +509,18 @@ func (r *DoctorRepository) CreateBill(ctx context.Context, bill *models.Bill) er
 		"items":           string(itemsJSON),
 		"issued_at":       bill.IssuedAt,
 	}
+	if bill.Currency == "" {
+		delete(billData, "currency")
+	}
 
-	return r.db.WithContext(ctx).Model(&models.Bill{}).Create(billData).Error
+	if err := db.Model(&models.Bill{}).Create(billData).Error; err != nil {
+		return err
+	}
+	if id, ok := billData["id"].(int64); ok {
+		bill.ID = uint(id)
+		return nil
+	}
+	return db.Model(&models.Bill{}).Select("id").Where("bill_number = ?", bill.BillNumber).Scan(&bill.ID).Error
 }
 
 func (r *DoctorRepository) GetBillByAppointmentID(ctx context.Context, appointmentID uint) (*models.Bill, error) {
@@ -453,6 +615,26 @@ func (r *DoctorRepository) UpdatePatientHealthProfile(ctx context.Context, healt
 	})
 }
 
+// GetBillingSettings returns the doctor's billing settings, empty when they
+// have no profile or haven't set them up
+func (r *DoctorRepository) GetBillingSettings(ctx context.Context, doctorID uint) (*models.BillingSettings, error) {
+	var settings models.BillingSettings
+	var raw []string
+	if err := r.db.WithContext(ctx).Model(&models.DoctorProfile{}).
+		Where("user_id = ?", doctorID).
+		Limit(1).
+		Pluck("billing_settings", &raw).Error; err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 || raw[0] == "" {
+		return &settings, nil
+	}
+	if err := json.Unmarshal([]byte(raw[0]), &settings); err != nil {
+		return nil, fmt.Errorf("invalid billing settings: %w", err)
+	}
+	return &settings, nil
+}
+
 func (r *DoctorRepository) SaveBillingSettings(ctx context.Context, doctorID uint, settings json.RawMessage) error {
 	return r.db.WithContext(ctx).
 		Model(&models.DoctorProfile{}).
@@ -0,0 +1,348 @@
+package repositories
+
+import (
+	"HealthHubConnect/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// doctorSearchFTS is the SQLite FTS5 table over doctor_search_entries, its
+// rowid is the doctor's ID
+const doctorSearchFTS = "doctor_search_fts"
+
+// at most maxSearchTerms words of a query are matched, and maxFacetValues
+// values of each facet counted
+const (
+	maxSearchTerms = 10
+	maxFacetValues = 20
+)
+
+type searchBackend int
+
+const (
+	searchFTS5 searchBackend = iota
+	searchTSVector
+)
+
+// errSearchNotSetUp is returned when the full-text index SetupDoctorSearch
+// creates is missing
+var errSearchNotSetUp = errors.New("doctor search index is not set up")
+
+// SetupDoctorSearch creates the full-text index over the doctor search
+// entries, an FTS5 table on SQLite and a weighted tsvector column on
+// Postgres, then indexes every doctor profile. Both tokenize words the same
+// way, without stemming, and match query words as prefixes. It fails on a
+// SQLite driver built without FTS5, search would not rank there.
+func SetupDoctorSearch(ctx context.Context, db *gorm.DB) error {
+	switch name := db.Dialector.Name(); name {
+	case "sqlite":
+		err := db.WithContext(ctx).Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS ` + doctorSearchFTS +
+			` USING fts5(name, specialties, procedures, details, tokenize = 'unicode61')`).Error
+		if err != nil {
+			if strings.Contains(err.Error(), "no such module") {
+				return fmt.Errorf("SQLite is built without FTS5, build with -tags sqlite_fts5 for doctor search: %w", err)
+			}
+			return err
+		}
+	case "postgres":
+		if err := db.WithContext(ctx).Exec(`ALTER TABLE doctor_search_entries ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (
+				setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+				setweight(to_tsvector('simple', coalesce(specialties, '')), 'B') ||
+				setweight(to_tsvector('simple', coalesce(procedures, '')), 'C') ||
+				setweight(to_tsvector('simple', coalesce(details, '')), 'D')
+			) STORED`).Error; err != nil {
+			return err
+		}
+		if err := db.WithContext(ctx).Exec(`CREATE INDEX IF NOT EXISTS idx_doctor_search_vector
+			ON doctor_search_entries USING GIN (search_vector)`).Error; err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("doctor search does not support %s", name)
+	}
+
+	return NewDoctorRepository(db).RebuildSearchIndex(ctx)
+}
+
+func searchBackendOf(db *gorm.DB) (searchBackend, error) {
+	switch db.Dialector.Name() {
+	case "postgres":
+		if db.Migrator().HasColumn(&models.DoctorSearchEntry{}, "search_vector") {
+			return searchTSVector, nil
+		}
+	case "sqlite":
+		if db.Migrator().HasTable(doctorSearchFTS) {
+			return searchFTS5, nil
+		}
+	}
+	return 0, errSearchNotSetUp
+}
+
+// RebuildSearchIndex indexes every doctor profile afresh
+func (r *DoctorRepository) RebuildSearchIndex(ctx context.Context) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		backend, err := searchBackendOf(tx)
+		if err != nil {
+			return err
+		}
+
+		all := tx.Session(&gorm.Session{AllowGlobalUpdate: true})
+		if err := all.Delete(&models.DoctorSearchFacet{}).Error; err != nil {
+			return err
+		}
+		if err := all.Delete(&models.DoctorSearchEntry{}).Error; err != nil {
+			return err
+		}
+		if backend == searchFTS5 {
+			if err := tx.Exec("DELETE FROM " + doctorSearchFTS).Error; err != nil {
+				return err
+			}
+		}
+
+		var profiles []models.DoctorProfile
+		return tx.Omit("billing_settings").FindInBatches(&profiles, 100, func(batch *gorm.DB, _ int) error {
+			for i := range profiles {
+				if err := indexDoctor(tx, &profiles[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+	})
+}
+
+// indexDoctor replaces the doctor's search entry with one built from the
+// profile
+func indexDoctor(tx *gorm.DB, profile *models.DoctorProfile) error {
+	if err := unindexDoctor(tx, profile.UserID); err != nil {
+		return err
+	}
+
+	var name string
+	if err := tx.Model(&models.User{}).Select("name").Where("id = ?", profile.UserID).Limit(1).Scan(&name).Error; err != nil {
+		return err
+	}
+
+	entry, facets := models.NewDoctorSearchEntry(profile, name)
+	if err := tx.Create(entry).Error; err != nil {
+		return err
+	}
+	if len(facets) > 0 {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&facets).Error; err != nil {
+			return err
+		}
+	}
+
+	if backend, err := searchBackendOf(tx); err != nil || backend != searchFTS5 {
+		return err
+	}
+	return tx.Exec("INSERT INTO "+doctorSearchFTS+"(rowid, name, specialties, procedures, details) VALUES (?, ?, ?, ?, ?)",
+		entry.DoctorID, entry.Name, entry.Specialties, entry.Procedures, entry.Details).Error
+}
+
+// reindexUser refreshes the search entry of a doctor whose account changed,
+// the entry carries the account's name
+func reindexUser(tx *gorm.DB, user *models.User) error {
+	if user.Role != models.RoleDoctor {
+		return nil
+	}
+
+	var profile models.DoctorProfile
+	err := tx.Omit("billing_settings").Where("user_id = ?", user.ID).Take(&profile).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return indexDoctor(tx, &profile)
+}
+
+func unindexDoctor(tx *gorm.DB, doctorID uint) error {
+	if err := tx.Where("doctor_id = ?", doctorID).Delete(&models.DoctorSearchFacet{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("doctor_id = ?", doctorID).Delete(&models.DoctorSearchEntry{}).Error; err != nil {
+		return err
+	}
+	if backend, err := searchBackendOf(tx); err != nil || backend != searchFTS5 {
+		return err
+	}
+	return tx.Exec("DELETE FROM "+doctorSearchFTS+" WHERE rowid = ?", doctorID).Error
+}
+
+// searchTerms splits text into lowercase words the way both full-text
+// indexes tokenize it. Only letters and digits are kept, so the terms are
+// safe to place in a match expression.
+func searchTerms(text string) []string {
+	terms := strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsNumber(c)
+	})
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+	return terms
+}
+
+// fts5Match builds an FTS5 query matching every term as a prefix, the name
+// terms in the name column only
+func fts5Match(terms, nameTerms []string) string {
+	var parts []string
+	for _, term := range terms {
+		parts = append(parts, fmt.Sprintf(`"%s"*`, term))
+	}
+	for _, term := range nameTerms {
+		parts = append(parts, fmt.Sprintf(`name : "%s"*`, term))
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// tsQuery builds a Postgres tsquery matching every term as a prefix, the
+// name terms in the name weight only
+func tsQuery(terms, nameTerms []string) string {
+	var parts []string
+	for _, term := range terms {
+		parts = append(parts, term+":*")
+	}
+	for _, term := range nameTerms {
+		parts = append(parts, term+":*A")
+	}
+	return strings.Join(parts, " & ")
+}
+
+// searchQuery selects from the entries of the doctors matching the query,
+// as "e"
+func (r *DoctorRepository) searchQuery(ctx context.Context, backend searchBackend, query *models.DoctorSearchQuery) *gorm.DB {
+	db := r.db.WithContext(ctx).
+		Table("doctor_search_entries AS e").
+		Joins("JOIN users ON users.id = e.doctor_id AND users.role = ?", models.RoleDoctor)
+
+	terms, nameTerms := searchTerms(query.Text), searchTerms(query.Name)
+	if len(terms)+len(nameTerms) > 0 {
+		switch backend {
+		case searchFTS5:
+			db = db.Joins("JOIN "+doctorSearchFTS+" ON "+doctorSearchFTS+".rowid = e.doctor_id").
+				Where(doctorSearchFTS+" MATCH ?", fts5Match(terms, nameTerms))
+		case searchTSVector:
+			db = db.Where("e.search_vector @@ to_tsquery('simple', ?)", tsQuery(terms, nameTerms))
+		}
+	}
+
+	for _, facet := range models.SearchFacets {
+		if value := strings.ToLower(strings.TrimSpace(query.Filters[facet])); value != "" {
+			db = db.Where(`EXISTS (SELECT 1 FROM doctor_search_facets f
+				WHERE f.doctor_id = e.doctor_id AND f.facet = ? AND f.value = ?)`, facet, value)
+		}
+	}
+	if query.FeeMin != nil {
+		db = db.Where("e.max_fee >= ?", *query.FeeMin)
+	}
+	if query.FeeMax != nil {
+		db = db.Where("e.min_fee <= ?", *query.FeeMax)
+	}
+	return db
+}
+
+// SearchDoctors returns a page of the doctors matching the query, the most
+// relevant first and by name among equals, with the facet counts over all
+// of them
+func (r *DoctorRepository) SearchDoctors(ctx context.Context, query *models.DoctorSearchQuery) (*models.DoctorSearchResult, error) {
+	backend, err := searchBackendOf(r.db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	result := &models.DoctorSearchResult{
+		Doctors: []models.DoctorProfile{},
+		Facets:  map[string][]models.FacetCount{},
+	}
+
+	if err := r.searchQuery(ctx, backend, query).Count(&result.Total).Error; err != nil {
+		return nil, err
+	}
+
+	page := r.searchQuery(ctx, backend, query)
+	terms, nameTerms := searchTerms(query.Text), searchTerms(query.Name)
+	switch {
+	case len(terms)+len(nameTerms) == 0:
+		page = page.Select("e.doctor_id, 0 AS relevance")
+	case backend == searchFTS5:
+		// bm25 is lower for better matches, the column weights follow
+		// the Postgres defaults for weights A to D
+		page = page.Select("e.doctor_id, -bm25(" + doctorSearchFTS + ", 1.0, 0.4, 0.2, 0.1) AS relevance")
+	default:
+		page = page.Select("e.doctor_id, ts_rank(e.search_vector, to_tsquery('simple', ?)) AS relevance", tsQuery(terms, nameTerms))
+	}
+
+	var hits []struct {
+		DoctorID  uint
+		Relevance float64
+	}
+	if err := page.
+		Order("relevance DESC, e.name ASC, e.doctor_id ASC").
+		Offset((query.Page - 1) * query.Limit).
+		Limit(query.Limit).
+		Scan(&hits).Error; err != nil {
+		return nil, err
+	}
+
+	if len(hits) > 0 {
+		ids := make([]uint, len(hits))
+		for i, hit := range hits {
+			ids[i] = hit.DoctorID
+		}
+
+		// the listing is public, it leaves the billing settings out
+		var profiles []models.DoctorProfile
+		if err := r.db.WithContext(ctx).
+			Omit("billing_settings").
+			Preload("User", func(db *gorm.DB) *gorm.DB {
+				return db.Select("id, name, profile_picture")
+			}).
+			Where("user_id IN ?", ids).
+			Find(&profiles).Error; err != nil {
+			return nil, err
+		}
+
+		byDoctor := make(map[uint]models.DoctorProfile, len(profiles))
+		for _, profile := range profiles {
+			byDoctor[profile.UserID] = profile
+		}
+		for _, id := range ids {
+			if profile, ok := byDoctor[id]; ok {
+				result.Doctors = append(result.Doctors, profile)
+			}
+		}
+	}
+
+	var counts []struct {
+		Facet string
+		Label string
+		Count int64
+	}
+	if err := r.db.WithContext(ctx).
+		Table("doctor_search_facets AS f").
+		Select("f.facet, MIN(f.label) AS label, COUNT(*) AS count").
+		Where("f.doctor_id IN (?)", r.searchQuery(ctx, backend, query).Select("e.doctor_id")).
+		Group("f.facet, f.value").
+		Order("count DESC, label ASC").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	for _, facet := range models.SearchFacets {
+		result.Facets[facet] = []models.FacetCount{}
+	}
+	for _, count := range counts {
+		if len(result.Facets[count.Facet]) < maxFacetValues {
+			result.Facets[count.Facet] = append(result.Facets[count.Facet], models.FacetCount{Value: count.Label, Count: count.Count})
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"HealthHubConnect/internal/models"
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type FrontDeskRepository struct {
+	db *gorm.DB
+}
+
+func NewFrontDeskRepository(db *gorm.DB) *FrontDeskRepository {
+	return &FrontDeskRepository{db: db}
+}
+
+func (r *FrontDeskRepository) AddReceptionist(ctx context.Context, assignment *models.FrontDeskAssignment) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(assignment).Error
+}
+
+func (r *FrontDeskRepository) RemoveReceptionist(ctx context.Context, doctorID, receptionistID uint) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Where("doctor_id = ? AND receptionist_id = ?", doctorID, receptionistID).
+		Delete(&models.FrontDeskAssignment{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *FrontDeskRepository) IsAssigned(ctx context.Context, doctorID, receptionistID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&models.FrontDeskAssignment{}).
+		Where("doctor_id = ? AND receptionist_id = ?", doctorID, receptionistID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// FindReceptionists lists the front desk staff of a doctor
+func (r *FrontDeskRepository) FindReceptionists(ctx context.Context, doctorID uint) ([]models.FrontDeskAssignment, error) {
+	var assignments []models.FrontDeskAssignment
+	err := r.db.WithContext(ctx).
+		Preload("Receptionist").
+		Where("doctor_id = ?", doctorID).
+		Order("created_at asc").
+		Find(&assignments).Error
+	return assignments, err
+}
+
+// FindDoctors lists the doctors a receptionist works the front desk of
+func (r *FrontDeskRepository) FindDoctors(ctx context.Context, receptionistID uint) ([]models.FrontDeskAssignment, error) {
+	var assignments []models.FrontDeskAssignment
+	err := r.db.WithContext(ctx).
+		Preload("Doctor").
+		Where("receptionist_id = ?", receptionistID).
+		Order("doctor_id asc").
+		Find(&assignments).Error
+	return assignments, err
+}
+
+// FindPatients looks patients up by exact email or phone, as given at the
+// desk
+func (r *FrontDeskRepository) FindPatients(ctx context.Context, email string, phone int64) ([]models.User, error) {
+	var patients []models.User
+	if email == "" && phone == 0 {
+		return patients, nil
+	}
+
+	query := r.db.WithContext(ctx).Where("role = ?", models.RolePatient)
+	switch {
+	case email != "" && phone != 0:
+		query = query.Where("LOWER(email) = LOWER(?) OR phone = ?", email, phone)
+	case email != "":
+		query = query.Where("LOWER(email) = LOWER(?)", email)
+	default:
+		query = query.Where("phone = ?", phone)
+	}
+	err := query.Order("id asc").Limit(20).Find(&patients).Error
+	return patients, err
+}
@@ -5,7 +5,6 @@ import (
 	"HealthHubConnect/internal/types"
 	"context"
 	"errors"
-	"math"
 	"sort"
 
 	"googlemaps.github.io/maps"
@@ -164,16 +163,5 @@ func (r *HospitalRepository) passesFilters(hospital models.Hospital, filters typ
 }
 
 func (r *HospitalRepository) calculateDistance(lat1, lon1, lat2, lon2 float64) float64 {
-	const earthRadius = 6371
-	lat1Rad := lat1 * math.Pi / 180
-	lat2Rad := lat2 * math.Pi / 180
-	deltaLat := (lat2 - lat1) * math.Pi / 180
-	deltaLon := (lon2 - lon1) * math.Pi / 180
-
-	a := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
-		math.Cos(lat1Rad)*math.Cos(lat2Rad)*
-			math.Sin(deltaLon/2)*math.Sin(deltaLon/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-
-	return earthRadius * c
+	return models.Location{Latitude: lat1, Longitude: lon1}.DistanceKm(models.Location{Latitude: lat2, Longitude: lon2})
 }
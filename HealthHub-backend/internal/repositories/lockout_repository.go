@@ -0,0 +1,52 @@
+package repositories
+
+import (
+	"HealthHubConnect/internal/models"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type LockoutRepository struct {
+	db *gorm.DB
+}
+
+func NewLockoutRepository(db *gorm.DB) *LockoutRepository {
+	return &LockoutRepository{db: db}
+}
+
+// FindLockout returns the stored state, or a fresh unsaved one when the key
+// has never failed a login
+func (r *LockoutRepository) FindLockout(ctx context.Context, scope models.LockoutScope, key string) (*models.LoginLockout, error) {
+	var lockout models.LoginLockout
+	err := r.db.WithContext(ctx).Where("scope = ? AND lock_key = ?", scope, key).First(&lockout).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.LoginLockout{Scope: scope, Key: key}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lockout, nil
+}
+
+func (r *LockoutRepository) SaveLockout(ctx context.Context, lockout *models.LoginLockout) error {
+	return r.db.WithContext(ctx).Save(lockout).Error
+}
+
+func (r *LockoutRepository) CountFailedByUser(ctx context.Context, userID uint, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.LoginAttempt{}).
+		Where("user_id = ? AND successful = ? AND timestamp > ?", userID, false, since).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *LockoutRepository) CountFailedByIP(ctx context.Context, ip string, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.LoginAttempt{}).
+		Where("ip_address = ? AND successful = ? AND timestamp > ?", ip, false, since).
+		Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,98 @@
+package repositories
+
+import (
+	"HealthHubConnect/internal/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type OAuthRepository struct {
+	db *gorm.DB
+}
+
+func NewOAuthRepository(db *gorm.DB) *OAuthRepository {
+	return &OAuthRepository{db: db}
+}
+
+func (r *OAuthRepository) FindAccount(ctx context.Context, provider, providerID string) (*models.OAuthAccount, error) {
+	var account models.OAuthAccount
+	err := r.db.WithContext(ctx).
+		Where("provider = ? AND provider_id = ?", provider, providerID).
+		First(&account).Error
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *OAuthRepository) FindUserAccount(ctx context.Context, userID uint, provider string) (*models.OAuthAccount, error) {
+	var account models.OAuthAccount
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND provider = ?", userID, provider).
+		First(&account).Error
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *OAuthRepository) FindAccountsByUser(ctx context.Context, userID uint) ([]models.OAuthAccount, error) {
+	var accounts []models.OAuthAccount
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at asc").
+		Find(&accounts).Error
+	return accounts, err
+}
+
+func (r *OAuthRepository) CreateAccount(ctx context.Context, account *models.OAuthAccount) error {
+	return r.db.WithContext(ctx).Create(account).Error
+}
+
+func (r *OAuthRepository) DeleteAccount(ctx context.Context, userID uint, provider string) error {
+	return r.db.WithContext(ctx).
+		Where("user_id = ? AND provider = ?", userID, provider).
+		Delete(&models.OAuthAccount{}).Error
+}
+
+func (r *OAuthRepository) CountAccountsByUser(ctx context.Context, userID uint) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.OAuthAccount{}).
+		Where("user_id = ?", userID).
+		Count(&count).Error
+	return count, err
+}
+
+// CreateLoginState stores a pending authorization request and clears out
+// the ones that expired without a callback
+func (r *OAuthRepository) CreateLoginState(ctx context.Context, state *models.OIDCLoginState) error {
+	if err := r.db.WithContext(ctx).Where("expires_at < ?", time.Now()).Delete(&models.OIDCLoginState{}).Error; err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Create(state).Error
+}
+
+// ConsumeLoginState returns the live pending request for the state and deletes
+// it, so a callback can only ever be completed once
+func (r *OAuthRepository) ConsumeLoginState(ctx context.Context, state string) (*models.OIDCLoginState, error) {
+	var loginState models.OIDCLoginState
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("state = ? AND expires_at > ?", state, time.Now()).First(&loginState).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id = ?", loginState.ID).Delete(&models.OIDCLoginState{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &loginState, nil
+}
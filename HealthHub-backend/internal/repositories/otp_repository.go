@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"HealthHubConnect/internal/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type OTPRepository struct {
+	db *gorm.DB
+}
+
+func NewOTPRepository(db *gorm.DB) *OTPRepository {
+	return &OTPRepository{db: db}
+}
+
+// FindLatest returns the most recently issued code for the purpose, consumed or not
+func (r *OTPRepository) FindLatest(ctx context.Context, userID uint, purpose models.OTPPurpose) (*models.OneTimeCode, error) {
+	var code models.OneTimeCode
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND purpose = ?", userID, purpose).
+		Order("created_at desc").
+		First(&code).Error
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+// Replace consumes any live code for the same user and purpose and stores the new one
+func (r *OTPRepository) Replace(ctx context.Context, code *models.OneTimeCode) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.OneTimeCode{}).
+			Where("user_id = ? AND purpose = ? AND consumed_at IS NULL", code.UserID, code.Purpose).
+			Update("consumed_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(code).Error
+	})
+}
+
+func (r *OTPRepository) CountIssuedSince(ctx context.Context, userID uint, purpose models.OTPPurpose, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.OneTimeCode{}).
+		Where("user_id = ? AND purpose = ? AND created_at > ?", userID, purpose, since).
+		Count(&count).Error
+	return count, err
+}
+
+// RegisterAttempt counts one verification try against the code. It reports
+// false once the attempt budget is used up, so parallel guesses can't exceed it.
+func (r *OTPRepository) RegisterAttempt(ctx context.Context, codeID uint) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.OneTimeCode{}).
+		Where("id = ? AND consumed_at IS NULL AND attempts < max_attempts", codeID).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *OTPRepository) Consume(ctx context.Context, codeID uint) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.OneTimeCode{}).
+		Where("id = ? AND consumed_at IS NULL", codeID).
+		Update("consumed_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
@@ -0,0 +1,54 @@
+package repositories
+
+import (
+	"HealthHubConnect/internal/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ReminderRepository struct {
+	db *gorm.DB
+}
+
+func NewReminderRepository(db *gorm.DB) *ReminderRepository {
+	return &ReminderRepository{db: db}
+}
+
+// FindDue returns the confirmed appointments starting in (from, to] that
+// still want a reminder at offsetMinutes, with their patient and doctor.
+// Patients who opted out of reminders are left out.
+func (r *ReminderRepository) FindDue(ctx context.Context, from, to time.Time, offsetMinutes int) ([]models.Appointment, error) {
+	sent := r.db.Model(&models.AppointmentReminder{}).Select("appointment_id").
+		Where("offset_minutes = ?", offsetMinutes)
+	optedOut := r.db.Model(&models.NotificationPreference{}).Select("user_id").
+		Where("appointment_reminders = ?", false)
+
+	var appointments []models.Appointment
+	err := r.db.WithContext(ctx).
+		Preload("Patient").
+		Preload("Doctor").
+		Where("status = ? AND reminder = ?", models.StatusConfirmed, true).
+		Where("start_time > ? AND start_time <= ?", from.UTC(), to.UTC()).
+		Where("id NOT IN (?)", sent).
+		Where("patient_id NOT IN (?)", optedOut).
+		Order("start_time asc").
+		Find(&appointments).Error
+	return appointments, err
+}
+
+// Claim records that the reminder is about to be sent. It reports false when
+// another run already claimed it.
+func (r *ReminderRepository) Claim(ctx context.Context, reminder *models.AppointmentReminder) (bool, error) {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(reminder)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *ReminderRepository) Update(ctx context.Context, reminder *models.AppointmentReminder) error {
+	return r.db.WithContext(ctx).Save(reminder).Error
+}
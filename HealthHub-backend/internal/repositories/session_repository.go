@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"HealthHubConnect/internal/models"
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+func (r *SessionRepository) CreateSession(ctx context.Context, session *models.RefreshSession) error {
+	if err := r.db.WithContext(ctx).Create(session).Error; err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+func (r *SessionRepository) FindByTokenID(ctx context.Context, tokenID string) (*models.RefreshSession, error) {
+	var session models.RefreshSession
+	if err := r.db.WithContext(ctx).Where("token_id = ?", tokenID).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// MarkUsed consumes a refresh token. It only succeeds for the first caller, so
+// two concurrent refreshes with the same token can't both get a new pair.
+func (r *SessionRepository) MarkUsed(ctx context.Context, tokenID string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.RefreshSession{}).
+		Where("token_id = ? AND used_at IS NULL AND revoked_at IS NULL", tokenID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *SessionRepository) RevokeFamily(ctx context.Context, familyID, reason string) error {
+	return r.db.WithContext(ctx).Model(&models.RefreshSession{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Updates(map[string]interface{}{
+			"revoked_at":     time.Now(),
+			"revoked_reason": reason,
+		}).Error
+}
+
+func (r *SessionRepository) RevokeAllForUser(ctx context.Context, userID uint, reason string) error {
+	return r.db.WithContext(ctx).Model(&models.RefreshSession{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{
+			"revoked_at":     time.Now(),
+			"revoked_reason": reason,
+		}).Error
+}
+
+// IsFamilyActive reports whether the family still holds an unexpired,
+// unrevoked refresh token, i.e. whether access tokens issued for it are live.
+func (r *SessionRepository) IsFamilyActive(ctx context.Context, familyID string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.RefreshSession{}).
+		Where("family_id = ? AND revoked_at IS NULL AND expires_at > ?", familyID, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
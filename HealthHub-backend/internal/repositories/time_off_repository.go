@@ -0,0 +1,174 @@
+package repositories
+
+import (
+	"HealthHubConnect/internal/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TimeOffRepository struct {
+	db *gorm.DB
+}
+
+func NewTimeOffRepository(db *gorm.DB) *TimeOffRepository {
+	return &TimeOffRepository{db: db}
+}
+
+func (r *TimeOffRepository) CreateTimeOff(ctx context.Context, timeOff *models.DoctorTimeOff) error {
+	return r.db.WithContext(ctx).Create(timeOff).Error
+}
+
+func (r *TimeOffRepository) FindTimeOffByID(ctx context.Context, id uint) (*models.DoctorTimeOff, error) {
+	var timeOff models.DoctorTimeOff
+	if err := r.db.WithContext(ctx).First(&timeOff, id).Error; err != nil {
+		return nil, err
+	}
+	return &timeOff, nil
+}
+
+// FindDoctorTimeOff lists the doctor's leave that hasn't ended by from
+func (r *TimeOffRepository) FindDoctorTimeOff(ctx context.Context, doctorID uint, from time.Time) ([]models.DoctorTimeOff, error) {
+	var timeOff []models.DoctorTimeOff
+	err := r.db.WithContext(ctx).
+		Where("doctor_id = ? AND end_time > ?", doctorID, from.UTC()).
+		Order("start_time asc, id asc").
+		Find(&timeOff).Error
+	return timeOff, err
+}
+
+// FindOverlapping returns the doctor's leave that overlaps start-end
+func (r *TimeOffRepository) FindOverlapping(ctx context.Context, doctorID uint, start, end time.Time) ([]models.DoctorTimeOff, error) {
+	var timeOff []models.DoctorTimeOff
+	err := r.db.WithContext(ctx).
+		Where("doctor_id = ? AND start_time < ? AND end_time > ?", doctorID, end.UTC(), start.UTC()).
+		Order("start_time asc").
+		Find(&timeOff).Error
+	return timeOff, err
+}
+
+func (r *TimeOffRepository) DeleteTimeOff(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.DoctorTimeOff{}, id).Error
+}
+
+func (r *TimeOffRepository) CreateCalendar(ctx context.Context, calendar *models.HolidayCalendar) error {
+	return r.db.WithContext(ctx).Create(calendar).Error
+}
+
+func (r *TimeOffRepository) FindCalendarByID(ctx context.Context, id uint) (*models.HolidayCalendar, error) {
+	var calendar models.HolidayCalendar
+	err := r.db.WithContext(ctx).
+		Preload("Holidays", func(db *gorm.DB) *gorm.DB { return db.Order("date asc") }).
+		First(&calendar, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &calendar, nil
+}
+
+func (r *TimeOffRepository) CalendarNameExists(ctx context.Context, name string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.HolidayCalendar{}).
+		Where("LOWER(name) = LOWER(?)", name).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *TimeOffRepository) FindCalendars(ctx context.Context) ([]models.HolidayCalendar, error) {
+	var calendars []models.HolidayCalendar
+	err := r.db.WithContext(ctx).
+		Preload("Holidays", func(db *gorm.DB) *gorm.DB { return db.Order("date asc") }).
+		Order("name asc").
+		Find(&calendars).Error
+	return calendars, err
+}
+
+// DeleteCalendar removes the calendar with its holidays and the doctors'
+// subscriptions to it
+func (r *TimeOffRepository) DeleteCalendar(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("calendar_id = ?", id).Delete(&models.Holiday{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("calendar_id = ?", id).Delete(&models.DoctorHolidayCalendar{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.HolidayCalendar{}, id).Error
+	})
+}
+
+func (r *TimeOffRepository) HolidayExists(ctx context.Context, calendarID uint, date time.Time) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.Holiday{}).
+		Where("calendar_id = ? AND DATE(date) = DATE(?)", calendarID, models.CalendarDate(date)).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *TimeOffRepository) CreateHoliday(ctx context.Context, holiday *models.Holiday) error {
+	return r.db.WithContext(ctx).Create(holiday).Error
+}
+
+func (r *TimeOffRepository) FindHolidayByID(ctx context.Context, id uint) (*models.Holiday, error) {
+	var holiday models.Holiday
+	if err := r.db.WithContext(ctx).First(&holiday, id).Error; err != nil {
+		return nil, err
+	}
+	return &holiday, nil
+}
+
+func (r *TimeOffRepository) DeleteHoliday(ctx context.Context, calendarID, id uint) (bool, error) {
+	result := r.db.WithContext(ctx).Where("calendar_id = ?", calendarID).Delete(&models.Holiday{}, id)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *TimeOffRepository) FollowCalendar(ctx context.Context, doctorID, calendarID uint) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.DoctorHolidayCalendar{DoctorID: doctorID, CalendarID: calendarID}).Error
+}
+
+func (r *TimeOffRepository) UnfollowCalendar(ctx context.Context, doctorID, calendarID uint) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Where("doctor_id = ? AND calendar_id = ?", doctorID, calendarID).
+		Delete(&models.DoctorHolidayCalendar{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// FollowedCalendarIDs lists the calendars the doctor follows
+func (r *TimeOffRepository) FollowedCalendarIDs(ctx context.Context, doctorID uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.WithContext(ctx).Model(&models.DoctorHolidayCalendar{}).
+		Where("doctor_id = ?", doctorID).
+		Pluck("calendar_id", &ids).Error
+	return ids, err
+}
+
+func (r *TimeOffRepository) followedHolidays(ctx context.Context, doctorID uint) *gorm.DB {
+	return r.db.WithContext(ctx).Model(&models.Holiday{}).
+		Joins("JOIN doctor_holiday_calendars ON doctor_holiday_calendars.calendar_id = holidays.calendar_id").
+		Where("doctor_holiday_calendars.doctor_id = ?", doctorID)
+}
+
+// FindHolidaysOn returns the holidays of the doctor's calendars falling on
+// the calendar day labelled by day
+func (r *TimeOffRepository) FindHolidaysOn(ctx context.Context, doctorID uint, day time.Time) ([]models.Holiday, error) {
+	var holidays []models.Holiday
+	err := r.followedHolidays(ctx, doctorID).
+		Where("DATE(holidays.date) = DATE(?)", models.CalendarDate(day)).
+		Order("holidays.id asc").
+		Find(&holidays).Error
+	return holidays, err
+}
+
+// FindUpcomingHolidays lists the holidays of the doctor's calendars from the
+// calendar day labelled by from onwards
+func (r *TimeOffRepository) FindUpcomingHolidays(ctx context.Context, doctorID uint, from time.Time) ([]models.Holiday, error) {
+	var holidays []models.Holiday
+	err := r.followedHolidays(ctx, doctorID).
+		Where("DATE(holidays.date) >= DATE(?)", models.CalendarDate(from)).
+		Order("holidays.date asc, holidays.id asc").
+		Find(&holidays).Error
+	return holidays, err
+}
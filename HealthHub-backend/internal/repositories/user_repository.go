@@ -41,21 +41,30 @@ func (ur *UserRepository) FindByEmail(ctx context.Context, email string) (*model
 	return &user, nil
 }
 
+// UpdateUser saves the user, refreshing a doctor's search entry along with
+// their name
 func (ur *UserRepository) UpdateUser(user *models.User, ctx context.Context) error {
-	result := ur.db.WithContext(ctx).Save(user)
-	if result.Error != nil {
-		return fmt.Errorf("failed to update user: %w", result.Error)
+	err := ur.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(user).Error; err != nil {
+			return err
+		}
+		return reindexUser(tx, user)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
 	}
 	return nil
 }
 
-func (ur *UserRepository) FindByResetToken(ctx context.Context, token string) (*models.User, error) {
-	var user models.User
-	err := ur.db.WithContext(ctx).Where("reset_token = ?", token).First(&user).Error
-	if err != nil {
-		return nil, err
+func (ur *UserRepository) UpdateTimezone(ctx context.Context, userID uint, timezone string) error {
+	result := ur.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Update("timezone", timezone)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update timezone: %w", result.Error)
 	}
-	return &user, nil
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
 }
 
 func (ur *UserRepository) FindByID(ctx context.Context, id uint) (*models.User, error) {
@@ -0,0 +1,156 @@
+package repositories
+
+import (
+	"HealthHubConnect/internal/models"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrOfferClosed = errors.New("waitlist offer is no longer pending")
+
+type WaitlistRepository struct {
+	db *gorm.DB
+}
+
+func NewWaitlistRepository(db *gorm.DB) *WaitlistRepository {
+	return &WaitlistRepository{db: db}
+}
+
+func (r *WaitlistRepository) CreateEntry(ctx context.Context, entry *models.WaitlistEntry) error {
+	return r.db.WithContext(ctx).Create(entry).Error
+}
+
+func (r *WaitlistRepository) FindEntryByID(ctx context.Context, id uint) (*models.WaitlistEntry, error) {
+	var entry models.WaitlistEntry
+	if err := r.db.WithContext(ctx).First(&entry, id).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (r *WaitlistRepository) FindPatientEntries(ctx context.Context, patientID uint) ([]models.WaitlistEntry, error) {
+	var entries []models.WaitlistEntry
+	err := r.db.WithContext(ctx).
+		Where("patient_id = ?", patientID).
+		Order("created_at desc, id desc").
+		Find(&entries).Error
+	return entries, err
+}
+
+// HasOpenEntry tells whether the patient already waits for the doctor on a
+// range overlapping from-to
+func (r *WaitlistRepository) HasOpenEntry(ctx context.Context, patientID, doctorID uint, from, to time.Time) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.WaitlistEntry{}).
+		Where("patient_id = ? AND doctor_id = ? AND status IN ?", patientID, doctorID,
+			[]models.WaitlistStatus{models.WaitlistWaiting, models.WaitlistOffered}).
+		Where("DATE(from_date) <= DATE(?) AND DATE(to_date) >= DATE(?)", to, from).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// NextWaiting returns the oldest waiting entry whose range covers the slot
+// and that hasn't been offered this slot before. slotStart is read in the
+// doctor's zone to pick the calendar day.
+func (r *WaitlistRepository) NextWaiting(ctx context.Context, doctorID uint, slotStart time.Time) (*models.WaitlistEntry, error) {
+	offered := r.db.Model(&models.WaitlistOffer{}).Select("entry_id").
+		Where("doctor_id = ? AND start_time = ?", doctorID, slotStart.UTC())
+	day := models.CalendarDate(slotStart)
+
+	var entry models.WaitlistEntry
+	err := r.db.WithContext(ctx).
+		Where("doctor_id = ? AND status = ?", doctorID, models.WaitlistWaiting).
+		Where("DATE(from_date) <= DATE(?) AND DATE(to_date) >= DATE(?)", day, day).
+		Where("id NOT IN (?)", offered).
+		Order("created_at asc, id asc").
+		First(&entry).Error
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// CreateOffer records the offer and marks its entry as offered
+func (r *WaitlistRepository) CreateOffer(ctx context.Context, offer *models.WaitlistOffer) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(offer).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.WaitlistEntry{}).
+			Where("id = ?", offer.EntryID).
+			Update("status", models.WaitlistOffered).Error
+	})
+}
+
+func (r *WaitlistRepository) FindOfferByToken(ctx context.Context, token string) (*models.WaitlistOffer, error) {
+	var offer models.WaitlistOffer
+	if err := r.db.WithContext(ctx).Where("token = ?", token).First(&offer).Error; err != nil {
+		return nil, err
+	}
+	return &offer, nil
+}
+
+// FindPendingOffer returns the offer the entry is currently waiting on
+func (r *WaitlistRepository) FindPendingOffer(ctx context.Context, entryID uint) (*models.WaitlistOffer, error) {
+	var offer models.WaitlistOffer
+	err := r.db.WithContext(ctx).
+		Where("entry_id = ? AND status = ?", entryID, models.OfferPending).
+		First(&offer).Error
+	if err != nil {
+		return nil, err
+	}
+	return &offer, nil
+}
+
+// FindExpiredOffers returns the pending offers whose claim window is over,
+// oldest first
+func (r *WaitlistRepository) FindExpiredOffers(ctx context.Context, now time.Time) ([]models.WaitlistOffer, error) {
+	var offers []models.WaitlistOffer
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND expires_at <= ?", models.OfferPending, now).
+		Order("expires_at asc, id asc").
+		Find(&offers).Error
+	return offers, err
+}
+
+// CloseOffer moves a pending offer to status and its entry, if it is still
+// waiting on the offer, to entryStatus. It fails with ErrOfferClosed when the
+// offer was closed in the meantime.
+func (r *WaitlistRepository) CloseOffer(ctx context.Context, offer *models.WaitlistOffer, status models.WaitlistOfferStatus, entryStatus models.WaitlistStatus) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.WaitlistOffer{}).
+			Where("id = ? AND status = ?", offer.ID, models.OfferPending).
+			Updates(map[string]interface{}{
+				"status":         status,
+				"appointment_id": offer.AppointmentID,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOfferClosed
+		}
+		offer.Status = status
+
+		return tx.Model(&models.WaitlistEntry{}).
+			Where("id = ? AND status = ?", offer.EntryID, models.WaitlistOffered).
+			Update("status", entryStatus).Error
+	})
+}
+
+func (r *WaitlistRepository) UpdateEntryStatus(ctx context.Context, id uint, status models.WaitlistStatus) error {
+	return r.db.WithContext(ctx).Model(&models.WaitlistEntry{}).
+		Where("id = ?", id).
+		Update("status", status).Error
+}
+
+// ExpireEntries closes the waiting entries whose date range is over
+func (r *WaitlistRepository) ExpireEntries(ctx context.Context, today time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&models.WaitlistEntry{}).
+		Where("status = ? AND DATE(to_date) < DATE(?)", models.WaitlistWaiting, today).
+		Update("status", models.WaitlistExpired)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	accountDeletionGracePeriod = 30 * 24 * time.Hour
+	accountErasureBatchSize    = 50
+)
+
+type exportFile struct {
+	name    string
+	content interface{}
+}
+
+type DeletionRequestInput struct {
+	Password string `json:"password"`
+	Reason   string `json:"reason"`
+}
+
+// AccountService lets users take their data with them and have their
+// account erased after a grace period.
+type AccountService struct {
+	accountRepo *repositories.AccountRepository
+	userRepo    *repositories.UserRepository
+}
+
+func NewAccountService(accountRepo *repositories.AccountRepository, userRepo *repositories.UserRepository) *AccountService {
+	return &AccountService{
+		accountRepo: accountRepo,
+		userRepo:    userRepo,
+	}
+}
+
+// Export builds a zip archive with one JSON file per kind of record held about the user
+func (s *AccountService) Export(ctx context.Context, userID uint) ([]byte, string, error) {
+	data, err := s.accountRepo.CollectAccountData(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", e.NewNotFoundError("user not found")
+		}
+		log.Printf("Failed to collect data export for user %d: %v", userID, err)
+		return nil, "", e.NewInternalError()
+	}
+
+	generatedAt := time.Now().UTC()
+	files := []exportFile{
+		{"user.json", data.User},
+		{"health_profile.json", data.HealthProfile},
+		{"emergency_contacts.json", data.EmergencyContacts},
+		{"allergies.json", data.Allergies},
+		{"medications.json", data.Medications},
+		{"vital_signs.json", data.VitalSigns},
+		{"appointments.json", data.Appointments},
+		{"prescriptions.json", data.Prescriptions},
+		{"bills.json", data.Bills},
+		{"chat_messages.json", data.ChatMessages},
+	}
+
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, f.name)
+	}
+	manifest := map[string]interface{}{
+		"user_id":      userID,
+		"generated_at": generatedAt,
+		"files":        names,
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, f := range append([]exportFile{{"manifest.json", manifest}}, files...) {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: generatedAt})
+		if err != nil {
+			return nil, "", e.NewInternalError()
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.content); err != nil {
+			log.Printf("Failed to write %s for user %d: %v", f.name, userID, err)
+			return nil, "", e.NewInternalError()
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, "", e.NewInternalError()
+	}
+
+	filename := fmt.Sprintf("healthhub-export-%d-%s.zip", userID, generatedAt.Format("20060102"))
+	return buf.Bytes(), filename, nil
+}
+
+// RequestDeletion schedules the account for erasure once the grace period is over
+func (s *AccountService) RequestDeletion(ctx context.Context, userID uint, input DeletionRequestInput) (*models.AccountDeletionRequest, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, e.NewNotFoundError("user not found")
+	}
+	if user.Role != models.RolePatient {
+		return nil, e.NewForbiddenError("staff accounts have to be removed by an administrator")
+	}
+	if user.PasswordHash != "" {
+		if input.Password == "" {
+			return nil, e.NewValidationError("password is required to delete your account")
+		}
+		if err := utils.ComparePassword(input.Password, user.PasswordHash); err != nil {
+			return nil, e.NewNotAuthorizedError("incorrect password")
+		}
+	}
+
+	if _, err := s.accountRepo.FindPendingDeletion(ctx, userID); err == nil {
+		return nil, e.NewConflictError("account deletion has already been requested")
+	}
+
+	request := &models.AccountDeletionRequest{
+		UserID:       userID,
+		Status:       models.DeletionPending,
+		Reason:       input.Reason,
+		ScheduledFor: time.Now().Add(accountDeletionGracePeriod),
+	}
+	if err := s.accountRepo.CreateDeletionRequest(ctx, request); err != nil {
+		return nil, e.NewInternalError()
+	}
+
+	go s.sendDeletionScheduledEmail(*user, request.ScheduledFor)
+	return request, nil
+}
+
+func (s *AccountService) GetDeletionRequest(ctx context.Context, userID uint) (*models.AccountDeletionRequest, error) {
+	request, err := s.accountRepo.FindPendingDeletion(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, e.NewNotFoundError("no pending deletion request")
+		}
+		return nil, e.NewInternalError()
+	}
+	return request, nil
+}
+
+func (s *AccountService) CancelDeletion(ctx context.Context, userID uint) error {
+	request, err := s.GetDeletionRequest(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	cancelled, err := s.accountRepo.CancelDeletion(ctx, request.ID)
+	if err != nil {
+		return e.NewInternalError()
+	}
+	if !cancelled {
+		return e.NewNotFoundError("no pending deletion request")
+	}
+	return nil
+}
+
+func (s *AccountService) GetNotificationPreference(ctx context.Context, userID uint) (*models.NotificationPreference, error) {
+	preference, err := s.accountRepo.FindNotificationPreference(ctx, userID)
+	if err != nil {
+		return nil, e.NewInternalError()
+	}
+	return preference, nil
+}
+
+// UpdateNotificationPreference lets the user opt out of, or back into,
+// appointment reminders
+func (s *AccountService) UpdateNotificationPreference(ctx context.Context, userID uint, req *models.NotificationPreferenceRequest) (*models.NotificationPreference, error) {
+	if req.AppointmentReminders == nil {
+		return nil, e.NewValidationError("appointment_reminders is required")
+	}
+
+	preference := &models.NotificationPreference{
+		UserID:               userID,
+		AppointmentReminders: *req.AppointmentReminders,
+		UpdatedAt:            time.Now(),
+	}
+	if err := s.accountRepo.SaveNotificationPreference(ctx, preference); err != nil {
+		return nil, e.NewInternalError()
+	}
+	return preference, nil
+}
+
+func (s *AccountService) GetTimezone(ctx context.Context, userID uint) (*models.TimezoneSetting, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, e.NewNotFoundError("user not found")
+	}
+	return &models.TimezoneSetting{Timezone: user.Timezone}, nil
+}
+
+// UpdateTimezone sets the IANA zone the user's times are read and shown in,
+// an empty zone goes back to UTC
+func (s *AccountService) UpdateTimezone(ctx context.Context, userID uint, req *models.TimezoneSetting) (*models.TimezoneSetting, error) {
+	timezone := strings.TrimSpace(req.Timezone)
+	if _, err := utils.LoadTimezone(timezone); err != nil {
+		return nil, e.NewValidationError(fmt.Sprintf("unknown timezone %q, use an IANA name such as Europe/London", timezone))
+	}
+
+	if err := s.userRepo.UpdateTimezone(ctx, userID, timezone); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, e.NewNotFoundError("user not found")
+		}
+		return nil, e.NewInternalError()
+	}
+	return &models.TimezoneSetting{Timezone: timezone}, nil
+}
+
+// ProcessDueDeletions erases the accounts whose grace period has run out and
+// returns how many were erased
+func (s *AccountService) ProcessDueDeletions(ctx context.Context) (int, error) {
+	requests, err := s.accountRepo.FindDueDeletions(ctx, time.Now(), accountErasureBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	erased := 0
+	for _, request := range requests {
+		if err := s.accountRepo.EraseAccount(ctx, request.UserID); err != nil {
+			log.Printf("Failed to erase account of user %d: %v", request.UserID, err)
+			continue
+		}
+		if err := s.accountRepo.CompleteDeletion(ctx, request.ID); err != nil {
+			log.Printf("Failed to complete deletion request %d: %v", request.ID, err)
+			continue
+		}
+		erased++
+	}
+	return erased, nil
+}
+
+func (s *AccountService) sendDeletionScheduledEmail(user models.User, scheduledFor time.Time) {
+	subject := "Account Deletion Scheduled - HealthHub"
+	body := fmt.Sprintf(`Dear %s,
+
+We received a request to delete your HealthHub account.
+
+Your account and health records will be permanently erased on %s.
+Until then you can sign in and cancel the request from your account settings.
+Billing records are kept for as long as the law requires, without your personal details.
+
+If you did not make this request, sign in, cancel it and change your password.
+
+Best regards,
+HealthHub Team`, user.Name, scheduledFor.In(utils.TimezoneOrUTC(user.Timezone)).Format("02 Jan 2006 15:04 MST"))
+
+	if err := utils.SendEmail(user.Email, subject, body); err != nil {
+		log.Printf("Failed to send deletion email to user %d: %v", user.ID, err)
+	}
+}
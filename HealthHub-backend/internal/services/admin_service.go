@@ -17,13 +17,21 @@ type AdminService struct {
 	userRepo   *repositories.UserRepository
 	doctorRepo *repositories.DoctorRepository
 	adminRepo  *repositories.AdminRepository
+	sessions   *SessionService
+	mfa        *MFAService
+	lockout    *LockoutService
+	apiKeys    *APIKeyService
 }
 
-func NewAdminService(userRepo *repositories.UserRepository, doctorRepo *repositories.DoctorRepository, adminRepo *repositories.AdminRepository) *AdminService {
+func NewAdminService(userRepo *repositories.UserRepository, doctorRepo *repositories.DoctorRepository, adminRepo *repositories.AdminRepository, sessionRepo *repositories.SessionRepository, mfaRepo *repositories.MFARepository, lockoutRepo *repositories.LockoutRepository, apiKeyRepo *repositories.APIKeyRepository) *AdminService {
 	return &AdminService{
 		userRepo:   userRepo,
 		doctorRepo: doctorRepo,
 		adminRepo:  adminRepo,
+		sessions:   NewSessionService(sessionRepo, userRepo),
+		mfa:        NewMFAService(mfaRepo, userRepo, adminRepo),
+		lockout:    NewLockoutService(lockoutRepo, userRepo, adminRepo),
+		apiKeys:    NewAPIKeyService(apiKeyRepo, userRepo),
 	}
 }
 
@@ -134,16 +142,83 @@ func (s *AdminService) ManageUser(ctx context.Context, adminID, userID uint, act
 		return err
 	}
 
+	if action == "suspend" {
+		if err := s.sessions.RevokeUserSessions(ctx, userID, RevokeReasonSuspended); err != nil {
+			return err
+		}
+	}
+
 	s.createAuditLog(ctx, adminID, action, "USER", userID, nil)
 	return nil
 }
 
+func (s *AdminService) UnlockUser(ctx context.Context, adminID, userID uint) error {
+	if _, err := s.userRepo.FindByID(ctx, userID); err != nil {
+		return e.NewNotFoundError("user not found")
+	}
+
+	if err := s.lockout.UnlockAccount(ctx, userID); err != nil {
+		return err
+	}
+
+	s.createAuditLog(ctx, adminID, "unlock", "USER", userID, nil)
+	return nil
+}
+
+func (s *AdminService) CreateAPIKey(ctx context.Context, adminID uint, input CreateAPIKeyInput) (*models.APIKey, string, error) {
+	key, plaintext, err := s.apiKeys.Create(ctx, adminID, input)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.createAuditLog(ctx, adminID, "create", "API_KEY", key.ID, map[string]interface{}{
+		"name":         key.Name,
+		"scopes":       key.Scopes,
+		"organization": key.Organization,
+		"expires_at":   key.ExpiresAt,
+	})
+	return key, plaintext, nil
+}
+
+func (s *AdminService) ListAPIKeys(ctx context.Context, includeRevoked bool) ([]models.APIKey, error) {
+	return s.apiKeys.List(ctx, includeRevoked)
+}
+
+func (s *AdminService) RevokeAPIKey(ctx context.Context, adminID, keyID uint) error {
+	if err := s.apiKeys.Revoke(ctx, keyID); err != nil {
+		return err
+	}
+
+	s.createAuditLog(ctx, adminID, "revoke", "API_KEY", keyID, nil)
+	return nil
+}
+
 func (s *AdminService) UpdateSystemSettings(ctx context.Context, adminID uint, settings *models.AdminSettings) error {
 	isAdmin, err := s.userRepo.CheckUserRole(ctx, adminID, models.RoleAdmin)
 	if err != nil || !isAdmin {
 		return e.NewForbiddenError("unauthorized access")
 	}
 
+	current, err := s.adminRepo.GetSystemSettings(ctx)
+	if err != nil {
+		return e.NewInternalError()
+	}
+
+	for _, role := range settings.MFARequiredRoles {
+		if !isKnownRole(role) {
+			return e.NewValidationError(fmt.Sprintf("unknown role in mfa_required_roles: %s", role))
+		}
+	}
+
+	for _, minutes := range settings.ReminderOffsets {
+		if minutes <= 0 || time.Duration(minutes)*time.Minute > models.MaxAdvanceBooking {
+			return e.NewValidationError(fmt.Sprintf("reminder offsets must be between 1 and %d minutes", int(models.MaxAdvanceBooking.Minutes())))
+		}
+	}
+
+	// there is a single settings row, update it instead of inserting a new one
+	settings.ID = current.ID
+	settings.CreatedAt = current.CreatedAt
 	settings.AdminID = adminID
 	return s.adminRepo.UpdateSystemSettings(ctx, settings)
 }
@@ -183,41 +258,65 @@ func (s *AdminService) ListUsers(ctx context.Context, page, pageSize int) ([]mod
 	return s.adminRepo.ListUsers(ctx, pageSize, offset)
 }
 
-func (s *AdminService) LoginAdmin(ctx context.Context, email, password string) (*models.User, utils.TokenPair, error) {
-	user, err := s.userRepo.FindByEmail(ctx, email)
-	if err != nil {
-		return nil, utils.TokenPair{}, e.NewValidationError("invalid credentials")
+func (s *AdminService) LoginAdmin(ctx context.Context, email, password string) (*models.User, utils.TokenPair, *MFAChallenge, error) {
+	user, _ := s.userRepo.FindByEmail(ctx, email)
+	if err := s.lockout.Check(ctx, user); err != nil {
+		return nil, utils.TokenPair{}, nil, err
+	}
+
+	if user == nil {
+		if lockErr := s.lockout.RecordFailure(ctx, nil, email); lockErr != nil {
+			return nil, utils.TokenPair{}, nil, lockErr
+		}
+		return nil, utils.TokenPair{}, nil, e.NewValidationError("invalid credentials")
 	}
 
 	if user.Role != models.RoleAdmin {
-		return nil, utils.TokenPair{}, e.NewForbiddenError("unauthorized access")
+		return nil, utils.TokenPair{}, nil, e.NewForbiddenError("unauthorized access")
 	}
 
 	if err := utils.ComparePassword(password, user.PasswordHash); err != nil {
-		return nil, utils.TokenPair{}, e.NewValidationError("invalid credentials")
+		if lockErr := s.lockout.RecordFailure(ctx, user, email); lockErr != nil {
+			return nil, utils.TokenPair{}, nil, lockErr
+		}
+		return nil, utils.TokenPair{}, nil, e.NewValidationError("invalid credentials")
 	}
 
-	tokenPair, err := utils.GenerateTokenPair(user.ID)
+	if !user.IsActive {
+		return nil, utils.TokenPair{}, nil, e.NewForbiddenError("account is suspended")
+	}
+
+	challenge, err := s.mfa.Challenge(ctx, user)
+	if err != nil {
+		return nil, utils.TokenPair{}, nil, err
+	}
+	if challenge != nil {
+		return nil, utils.TokenPair{}, challenge, nil
+	}
+
+	tokenPair, err := s.sessions.StartSession(ctx, user)
 	if err != nil {
-		return nil, utils.TokenPair{}, e.NewInternalError()
+		return nil, utils.TokenPair{}, nil, err
 	}
+	s.lockout.RecordSuccess(ctx, user)
 
 	user.PasswordHash = ""
-	return user, tokenPair, nil
+	return user, tokenPair, nil, nil
 }
 
 func (s *AdminService) RefreshAdminToken(ctx context.Context, refreshToken string) (utils.TokenPair, error) {
-	userID, err := utils.ExtractUserIDFromToken(refreshToken, env.Jwt.RefreshTokenSecret)
+	claims, err := utils.ValidateToken(refreshToken, env.Jwt.RefreshTokenSecret, utils.RefreshToken)
 	if err != nil {
 		return utils.TokenPair{}, e.NewValidationError("invalid token")
 	}
 
-	isAdmin, err := s.userRepo.CheckUserRole(ctx, userID, models.RoleAdmin)
+	isAdmin, err := s.userRepo.CheckUserRole(ctx, claims.UserID, models.RoleAdmin)
 	if err != nil || !isAdmin {
 		return utils.TokenPair{}, e.NewForbiddenError("unauthorized access")
 	}
 
-	return utils.RefreshAccessTokens(refreshToken)
+	_, tokenPair, err := s.sessions.Rotate(ctx, refreshToken)
+	return tokenPair, err
 }
 
 func (s *AdminService) ChangeAdminPassword(ctx context.Context, adminID uint, oldPassword, newPassword string) error {
@@ -261,7 +360,10 @@ func (s *AdminService) DeleteUser(ctx context.Context, adminID, userID uint) err
 	if err != nil || !isAdmin {
 		return e.NewForbiddenError("unauthorized access")
 	}
-	return s.adminRepo.DeleteUser(ctx, userID)
+	if err := s.adminRepo.DeleteUser(ctx, userID); err != nil {
+		return err
+	}
+	return s.sessions.RevokeUserSessions(ctx, userID, RevokeReasonDeleted)
 }
 
 func (s *AdminService) CreateUserWithRole(ctx context.Context, name, email, password string, phone int64, role models.UserRole) (*models.User, error) {
@@ -517,3 +619,11 @@ HealthHub Team`, user.Name, ticketID, response, status)
 
 	return utils.SendEmail(user.Email, subject, body)
 }
+
+func isKnownRole(role models.UserRole) bool {
+	switch role {
+	case models.RoleAdmin, models.RoleDoctor, models.RoleNurse, models.RolePatient, models.RoleReceptionist, models.RolePharmacist:
+		return true
+	}
+	return false
+}
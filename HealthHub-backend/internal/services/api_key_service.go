@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	apiKeyDefaultTTL    = 90 * 24 * time.Hour
+	apiKeyMaxTTL        = 365 * 24 * time.Hour
+	apiKeyTouchInterval = time.Minute
+)
+
+var errInvalidAPIKey = e.NewNotAuthorizedError("invalid api key")
+
+type CreateAPIKeyInput struct {
+	Name          string   `json:"name" validate:"required"`
+	Scopes        []string `json:"scopes" validate:"required"`
+	Organization  string   `json:"organization"` // leave empty for a key owned by the creating admin
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// APIKeyService issues and checks the API keys partner systems use instead of
+// a user login. A key is "hh_<prefix>_<secret>", the prefix finds the record
+// and the whole key is compared against its stored HMAC.
+type APIKeyService struct {
+	apiKeyRepo *repositories.APIKeyRepository
+	userRepo   *repositories.UserRepository
+}
+
+func NewAPIKeyService(apiKeyRepo *repositories.APIKeyRepository, userRepo *repositories.UserRepository) *APIKeyService {
+	return &APIKeyService{
+		apiKeyRepo: apiKeyRepo,
+		userRepo:   userRepo,
+	}
+}
+
+func isKnownScope(scope string) bool {
+	for _, known := range models.APIScopes {
+		if known == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Create stores a new key and returns it with the plaintext, which is never shown again
+func (s *APIKeyService) Create(ctx context.Context, adminID uint, input CreateAPIKeyInput) (*models.APIKey, string, error) {
+	if strings.TrimSpace(input.Name) == "" {
+		return nil, "", e.NewValidationError("name is required")
+	}
+	if len(input.Scopes) == 0 {
+		return nil, "", e.NewValidationError("at least one scope is required")
+	}
+	for _, scope := range input.Scopes {
+		if !isKnownScope(scope) {
+			return nil, "", e.NewValidationError(fmt.Sprintf("unknown scope: %s", scope))
+		}
+	}
+
+	ttl := apiKeyDefaultTTL
+	if input.ExpiresInDays < 0 {
+		return nil, "", e.NewValidationError("expires_in_days must be positive")
+	}
+	if input.ExpiresInDays > 0 {
+		ttl = time.Duration(input.ExpiresInDays) * 24 * time.Hour
+	}
+	if ttl > apiKeyMaxTTL {
+		return nil, "", e.NewValidationError(fmt.Sprintf("api keys can be valid for at most %d days", int(apiKeyMaxTTL.Hours()/24)))
+	}
+
+	prefixID, err := utils.NewRandomID()
+	if err != nil {
+		return nil, "", e.NewInternalError()
+	}
+	secret, err := utils.NewRandomID()
+	if err != nil {
+		return nil, "", e.NewInternalError()
+	}
+	prefix := "hh_" + prefixID[:12]
+	plaintext := prefix + "_" + secret
+
+	hash, err := utils.CreateHMAC(plaintext)
+	if err != nil {
+		log.Printf("Failed to hash api key: %v", err)
+		return nil, "", e.NewInternalError()
+	}
+
+	key := &models.APIKey{
+		Name:      strings.TrimSpace(input.Name),
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    input.Scopes,
+		CreatedBy: adminID,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if input.Organization != "" {
+		key.OwnerType = models.APIKeyOwnerOrganization
+		key.Organization = strings.TrimSpace(input.Organization)
+	} else {
+		key.OwnerType = models.APIKeyOwnerAdmin
+		key.OwnerID = adminID
+	}
+
+	if err := s.apiKeyRepo.Create(ctx, key); err != nil {
+		return nil, "", e.NewInternalError()
+	}
+	return key, plaintext, nil
+}
+
+func (s *APIKeyService) List(ctx context.Context, includeRevoked bool) ([]models.APIKey, error) {
+	keys, err := s.apiKeyRepo.List(ctx, includeRevoked)
+	if err != nil {
+		return nil, e.NewInternalError()
+	}
+	return keys, nil
+}
+
+func (s *APIKeyService) Revoke(ctx context.Context, id uint) error {
+	revoked, err := s.apiKeyRepo.Revoke(ctx, id)
+	if err != nil {
+		return e.NewInternalError()
+	}
+	if !revoked {
+		return e.NewNotFoundError("api key not found or already revoked")
+	}
+	return nil
+}
+
+// Authenticate resolves a presented key to the principal it acts as. A key
+// owned by an admin acts as that admin and stops working with the account.
+func (s *APIKeyService) Authenticate(ctx context.Context, rawKey string) (*models.Principal, error) {
+	parts := strings.Split(rawKey, "_")
+	if len(parts) != 3 || parts[0] != "hh" {
+		return nil, errInvalidAPIKey
+	}
+
+	key, err := s.apiKeyRepo.FindByPrefix(ctx, parts[0]+"_"+parts[1])
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errInvalidAPIKey
+		}
+		return nil, e.NewInternalError()
+	}
+
+	hash, err := utils.CreateHMAC(rawKey)
+	if err != nil || !hmac.Equal([]byte(hash), []byte(key.KeyHash)) {
+		return nil, errInvalidAPIKey
+	}
+	if !key.IsUsable(time.Now()) {
+		return nil, e.NewNotAuthorizedError("api key has expired or was revoked")
+	}
+
+	principal := &models.Principal{
+		Type:         models.PrincipalAPIKey,
+		APIKeyID:     key.ID,
+		Organization: key.Organization,
+		Scopes:       key.Scopes,
+	}
+	if key.OwnerType == models.APIKeyOwnerAdmin {
+		owner, err := s.userRepo.FindByID(ctx, key.OwnerID)
+		if err != nil || !owner.IsActive {
+			return nil, e.NewNotAuthorizedError("api key owner is no longer active")
+		}
+		principal.UserID = owner.ID
+		principal.Role = owner.Role
+	}
+
+	if err := s.apiKeyRepo.TouchLastUsed(ctx, key.ID, clientIPFromContext(ctx), apiKeyTouchInterval); err != nil {
+		log.Printf("Failed to record use of api key %d: %v", key.ID, err)
+	}
+	return principal, nil
+}
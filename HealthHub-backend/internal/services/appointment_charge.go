@@ -0,0 +1,209 @@
+package services
+
+import (
+	"HealthHubConnect/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const defaultChargeCurrency = "INR"
+
+// chargePolicy is what a doctor has configured about cancellations and
+// no-shows, from the schedule policies and the billing settings
+type chargePolicy struct {
+	policies models.DoctorPolicies
+	fees     models.ConsultationFee
+}
+
+func (s *appointmentService) loadChargePolicy(ctx context.Context, doctorID uint) (*chargePolicy, error) {
+	policy := &chargePolicy{}
+
+	schedule, err := s.doctorRepo.GetScheduleWithoutValidation(ctx, doctorID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err == nil && schedule.Policies != "" {
+		if err := json.Unmarshal([]byte(schedule.Policies), &policy.policies); err != nil {
+			return nil, fmt.Errorf("invalid doctor policies: %w", err)
+		}
+	}
+
+	settings, err := s.doctorRepo.GetBillingSettings(ctx, doctorID)
+	if err != nil {
+		return nil, err
+	}
+	policy.fees = settings.ConsultationFees
+	return policy, nil
+}
+
+// minNotice is how long before the start a patient can cancel without
+// penalty. The billing settings win over the free-form schedule policy.
+func (p *chargePolicy) minNotice() time.Duration {
+	if hours := p.fees.CancellationPolicy.MinCancelHours; hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return parseTimeframe(p.policies.CancellationTimeframe)
+}
+
+func (p *chargePolicy) currency(appointmentType models.AppointmentType) string {
+	currency := p.fees.InPerson.Currency
+	if appointmentType == models.TypeOnline {
+		currency = p.fees.Online.Currency
+	}
+	if currency == "" {
+		return defaultChargeCurrency
+	}
+	return currency
+}
+
+// retained is how much of a paid amount the doctor keeps on a late
+// cancellation: the refund percentage when one is configured, otherwise the
+// flat cancellation fee
+func (p *chargePolicy) retained(paid float64) float64 {
+	refund := p.fees.CancellationPolicy
+	if refund.RefundPercent > 0 || refund.MinCancelHours > 0 {
+		return paid - roundAmount(paid*float64(refund.RefundPercent)/100)
+	}
+	return math.Min(p.policies.CancellationFee, paid)
+}
+
+// parseTimeframe reads durations such as "24h", "24 hours", "2 days" or a
+// bare number of hours, returning 0 when it can't make sense of them
+func parseTimeframe(timeframe string) time.Duration {
+	timeframe = strings.ToLower(strings.TrimSpace(timeframe))
+	if timeframe == "" {
+		return 0
+	}
+	if d, err := time.ParseDuration(timeframe); err == nil {
+		return d
+	}
+
+	fields := strings.Fields(timeframe)
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || value < 0 || len(fields) > 2 {
+		return 0
+	}
+
+	unit := time.Hour
+	if len(fields) == 2 {
+		switch strings.TrimSuffix(fields[1], "s") {
+		case "minute", "min":
+			unit = time.Minute
+		case "hour", "hr":
+			unit = time.Hour
+		case "day":
+			unit = 24 * time.Hour
+		case "week":
+			unit = 7 * 24 * time.Hour
+		default:
+			return 0
+		}
+	}
+	return time.Duration(value * float64(unit))
+}
+
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// paidAmount is what the patient has paid on the bill and not yet had back
+func paidAmount(bill *models.Bill) float64 {
+	if bill == nil || bill.RefundStatus != "" {
+		return 0
+	}
+	if bill.PaidAmount > 0 {
+		return bill.PaidAmount
+	}
+	if bill.Status == models.BillStatusPaid {
+		return bill.TotalAmount
+	}
+	return 0
+}
+
+// quoteCharge works out what moving the appointment to CANCELLED or NO_SHOW
+// at now costs the patient. Cancellations made by the practice are free and
+// refund in full.
+func (s *appointmentService) quoteCharge(ctx context.Context, appointment *models.Appointment, role models.UserRole, to models.AppointmentStatus, now time.Time) (*models.AppointmentCharge, error) {
+	policy, err := s.loadChargePolicy(ctx, appointment.DoctorID)
+	if err != nil {
+		return nil, err
+	}
+
+	bill, err := s.appointmentRepo.GetAppointmentBill(appointment.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		bill = nil
+	}
+
+	charge := &models.AppointmentCharge{
+		AppointmentID: appointment.ID,
+		Status:        to,
+		Currency:      policy.currency(appointment.Type),
+		HoursNotice:   math.Max(0, math.Round(appointment.StartTime.Sub(now).Hours()*100)/100),
+	}
+	if bill != nil {
+		charge.BillID = &bill.ID
+		if bill.Currency != "" {
+			charge.Currency = bill.Currency
+		}
+	}
+	paid := paidAmount(bill)
+
+	switch to {
+	case models.StatusCancelled:
+		notice := policy.minNotice()
+		charge.MinNoticeHours = notice.Hours()
+		charge.Policy = policy.policies.CancellationPolicy
+		charge.LateCancellation = role == models.RolePatient && appointment.StartTime.Sub(now) < notice
+
+		if paid > 0 {
+			if charge.LateCancellation {
+				charge.RetainedAmount = roundAmount(policy.retained(paid))
+			}
+			charge.RefundAmount = roundAmount(paid - charge.RetainedAmount)
+		} else if charge.LateCancellation {
+			charge.Fee = policy.policies.CancellationFee
+		}
+	case models.StatusNoShow:
+		charge.Policy = policy.policies.NoShowPolicy
+		if paid > 0 {
+			charge.RetainedAmount = paid
+		} else {
+			charge.Fee = policy.policies.NoShowFee
+		}
+	}
+	return charge, nil
+}
+
+// GetCancellationCharge tells the caller what cancelling the appointment now
+// would cost, without cancelling it
+func (s *appointmentService) GetCancellationCharge(ctx context.Context, appointmentID uint, userID uint) (*models.AppointmentCharge, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsRead); err != nil {
+		return nil, err
+	}
+
+	appointment, err := s.loadAppointment(appointmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.callerRole(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkTransition(ctx, appointment, userID, role, models.StatusCancelled); err != nil {
+		return nil, err
+	}
+
+	return s.quoteCharge(ctx, appointment, role, models.StatusCancelled, time.Now())
+}
@@ -0,0 +1,455 @@
+package services
+
+import (
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// queueConsultationSample is how many of the doctor's last timed
+// consultations the queue's wait estimates are averaged over
+const queueConsultationSample = 20
+
+// queueNotice is what the waiting room displays subscribed to a doctor's
+// queue get whenever it changes
+type queueNotice struct {
+	Type    string              `json:"type"`
+	Payload *models.DoctorQueue `json:"payload"`
+}
+
+// QueueTopic is the websocket topic a doctor's queue is pushed on
+func QueueTopic(doctorID uint) string {
+	return fmt.Sprintf("queue:%d", doctorID)
+}
+
+func (s *appointmentService) ListFrontDeskStaff(ctx context.Context, doctorID uint) ([]models.FrontDeskAssignment, error) {
+	return s.frontDeskRepo.FindReceptionists(ctx, doctorID)
+}
+
+// AddFrontDeskStaff gives the receptionist with the given email the doctor's
+// front desk
+func (s *appointmentService) AddFrontDeskStaff(ctx context.Context, doctorID uint, req *models.FrontDeskStaffRequest) (*models.FrontDeskAssignment, error) {
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		return nil, e.NewValidationError("email is required")
+	}
+
+	receptionist, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, e.NewNotFoundError("no user with this email")
+		}
+		return nil, err
+	}
+	if receptionist.Role != models.RoleReceptionist {
+		return nil, e.NewValidationError("only receptionists can be given a front desk")
+	}
+
+	assignment := &models.FrontDeskAssignment{
+		DoctorID:       doctorID,
+		ReceptionistID: receptionist.ID,
+	}
+	if err := s.frontDeskRepo.AddReceptionist(ctx, assignment); err != nil {
+		return nil, err
+	}
+	assignment.Receptionist = *receptionist
+	return assignment, nil
+}
+
+func (s *appointmentService) RemoveFrontDeskStaff(ctx context.Context, doctorID uint, receptionistID uint) error {
+	removed, err := s.frontDeskRepo.RemoveReceptionist(ctx, doctorID, receptionistID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return e.NewNotFoundError("receptionist is not on your front desk")
+	}
+	return nil
+}
+
+// FrontDeskDoctors lists the doctors whose front desk the receptionist works
+func (s *appointmentService) FrontDeskDoctors(ctx context.Context, receptionistID uint) ([]models.FrontDeskAssignment, error) {
+	return s.frontDeskRepo.FindDoctors(ctx, receptionistID)
+}
+
+// authorizeFrontDesk lets the doctor and the receptionists on their front
+// desk through
+func (s *appointmentService) authorizeFrontDesk(ctx context.Context, doctorID uint, userID uint) (models.UserRole, error) {
+	role, err := s.callerRole(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	switch role {
+	case models.RoleDoctor:
+		if doctorID == userID {
+			return role, nil
+		}
+	case models.RoleReceptionist:
+		assigned, err := s.frontDeskRepo.IsAssigned(ctx, doctorID, userID)
+		if err != nil {
+			return "", err
+		}
+		if assigned {
+			return role, nil
+		}
+	}
+	return "", e.NewForbiddenError("not on the front desk of this doctor")
+}
+
+// FindFrontDeskPatients looks up patients by the email or phone they give at
+// the desk, for receptionists working at least one front desk
+func (s *appointmentService) FindFrontDeskPatients(ctx context.Context, receptionistID uint, email string, phone int64) ([]models.User, error) {
+	email = strings.TrimSpace(email)
+	if email == "" && phone == 0 {
+		return nil, e.NewValidationError("give an email or a phone number to look up")
+	}
+
+	doctors, err := s.frontDeskRepo.FindDoctors(ctx, receptionistID)
+	if err != nil {
+		return nil, err
+	}
+	if len(doctors) == 0 {
+		return nil, e.NewForbiddenError("you are not on any doctor's front desk")
+	}
+
+	return s.frontDeskRepo.FindPatients(ctx, email, phone)
+}
+
+// BookAtFrontDesk books the appointment for its patient. The desk books on
+// behalf of the practice, so the appointment is confirmed straight away, its
+// history showing the booking and the confirmation.
+func (s *appointmentService) BookAtFrontDesk(ctx context.Context, receptionistID uint, appointment *models.Appointment) error {
+	role, err := s.authorizeFrontDesk(ctx, appointment.DoctorID, receptionistID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.findPatient(ctx, appointment.PatientID); err != nil {
+		return err
+	}
+
+	appointment.Status = models.StatusPending
+	if err := s.checkTransition(ctx, appointment, receptionistID, role, models.StatusConfirmed); err != nil {
+		return err
+	}
+
+	slot, err := s.bookableSlot(ctx, appointment)
+	if err != nil {
+		return err
+	}
+
+	if appointment.Type == models.TypeOnline {
+		meetLink, err := s.meetService.CreateMeetLink(ctx, appointment)
+		if err != nil {
+			return fmt.Errorf("failed to create meet link: %v", err)
+		}
+		appointment.MeetLink = meetLink
+	}
+
+	booked := newAppointmentEvent(ctx, receptionistID, role, "", models.StatusPending, "booked at the front desk")
+	confirmed := newAppointmentEvent(ctx, receptionistID, role, models.StatusPending, models.StatusConfirmed, "confirmed at the front desk")
+	appointment.Status = models.StatusConfirmed
+	if err := s.appointmentRepo.BookAppointment(appointment, *slot, booked, confirmed); err != nil {
+		return s.bookingError(ctx, appointment, err)
+	}
+
+	go s.sendCalendarUpdate(*appointment, utils.ICalMethodRequest)
+	s.publishQueue(appointment.DoctorID)
+	return nil
+}
+
+// RegisterWalkIn checks in a patient who came without an appointment. The
+// walk-in takes no slot, so the doctor needn't have a schedule, it joins the
+// queue and is expected to take as long as the doctor's consultations
+// usually do.
+func (s *appointmentService) RegisterWalkIn(ctx context.Context, receptionistID uint, req *models.WalkInRequest) (*models.Appointment, error) {
+	role, err := s.authorizeFrontDesk(ctx, req.DoctorID, receptionistID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	loc := s.slots.location(ctx, req.DoctorID)
+	holidays, err := s.timeOffRepo.FindHolidaysOn(ctx, req.DoctorID, utils.StartOfDay(now, loc))
+	if err != nil {
+		return nil, err
+	}
+	if len(holidays) > 0 {
+		return nil, e.NewConflictError(fmt.Sprintf("the doctor is off today for %s", holidays[0].Name))
+	}
+	average, _ := s.averageConsultation(req.DoctorID)
+	if average <= 0 {
+		average = models.MinAppointmentDuration
+	}
+	visit := timeRange{start: now, end: now.Add(average)}
+	leave, err := s.timeOffRepo.FindOverlapping(ctx, req.DoctorID, visit.start, visit.end)
+	if err != nil {
+		return nil, err
+	}
+	if len(leave) > 0 {
+		return nil, e.NewConflictError("the doctor is on leave")
+	}
+
+	patient, err := s.walkInPatient(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	appointment := &models.Appointment{
+		PatientID:   patient.ID,
+		DoctorID:    req.DoctorID,
+		Type:        models.TypeOffline,
+		Date:        models.CalendarDate(now.In(loc)),
+		StartTime:   visit.start,
+		EndTime:     visit.end,
+		Description: req.Description,
+		Status:      models.StatusCheckedIn,
+		CheckedInAt: &now,
+		WalkIn:      true,
+	}
+	stampLocation(appointment, s.slots.locationOf(ctx, req.DoctorID, visit.start, visit.end))
+
+	event := newAppointmentEvent(ctx, receptionistID, role, "", models.StatusCheckedIn, "walk-in")
+	if err := s.appointmentRepo.RegisterWalkIn(appointment, event); err != nil {
+		return nil, err
+	}
+	appointment.Patient = *patient
+
+	s.publishQueue(appointment.DoctorID)
+	return appointment, nil
+}
+
+func (s *appointmentService) findPatient(ctx context.Context, patientID uint) (*models.User, error) {
+	patient, err := s.userRepo.FindByID(ctx, patientID)
+	if err != nil || patient.Role != models.RolePatient {
+		return nil, e.NewNotFoundError("patient not found")
+	}
+	return patient, nil
+}
+
+// walkInPatient finds the walk-in's patient record by ID, email or phone, or
+// creates one with just their name and contact details. A walk-in without an
+// email gets a placeholder address so the record can be claimed later.
+func (s *appointmentService) walkInPatient(ctx context.Context, req *models.WalkInRequest) (*models.User, error) {
+	if req.PatientID != 0 {
+		return s.findPatient(ctx, req.PatientID)
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if email != "" {
+		if err := utils.ValidateEmail(email); err != nil {
+			return nil, e.NewValidationError(err.Error())
+		}
+	}
+	if email == "" && req.Phone == 0 {
+		return nil, e.NewValidationError("give the patient's ID, email or phone number")
+	}
+
+	matches, err := s.frontDeskRepo.FindPatients(ctx, email, req.Phone)
+	if err != nil {
+		return nil, err
+	}
+	switch len(matches) {
+	case 0:
+	case 1:
+		return &matches[0], nil
+	default:
+		return nil, e.NewConflictError("several patients match, pick one by patient_id")
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, e.NewValidationError("name is required to register a new patient")
+	}
+	if email == "" {
+		email = fmt.Sprintf("walk-in-%d@%s", req.Phone, models.WalkInEmailDomain)
+	}
+
+	patient := &models.User{
+		Email:    email,
+		Name:     name,
+		Phone:    req.Phone,
+		Role:     models.RolePatient,
+		IsActive: true,
+	}
+	if err := s.userRepo.CreateUser(patient, ctx); err != nil {
+		return nil, err
+	}
+	return patient, nil
+}
+
+// UpdateFrontDeskStatus moves an appointment of a doctor whose front desk the
+// user works, checking a patient in or marking them a no-show
+func (s *appointmentService) UpdateFrontDeskStatus(ctx context.Context, appointmentID uint, userID uint, status models.AppointmentStatus, reason string) (*models.Appointment, *models.AppointmentCharge, error) {
+	appointment, err := s.loadAppointment(appointmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := s.authorizeFrontDesk(ctx, appointment.DoctorID, userID); err != nil {
+		return nil, nil, err
+	}
+
+	charge, err := s.transition(ctx, appointment, userID, status, reason)
+	if err != nil {
+		return nil, nil, err
+	}
+	return appointment, charge, nil
+}
+
+// GetQueue returns the doctor's queue for today to the doctor and their front
+// desk
+func (s *appointmentService) GetQueue(ctx context.Context, doctorID uint, userID uint) (*models.DoctorQueue, error) {
+	if _, err := s.authorizeFrontDesk(ctx, doctorID, userID); err != nil {
+		return nil, err
+	}
+	return s.buildQueue(ctx, doctorID, time.Now())
+}
+
+// buildQueue lays out the doctor's day as of now, in the doctor's zone.
+// Patients who checked in wait in the order of their appointment times, a
+// walk-in counts from when they arrived. Each is expected to start once the
+// ones before them have had an average consultation.
+func (s *appointmentService) buildQueue(ctx context.Context, doctorID uint, now time.Time) (*models.DoctorQueue, error) {
+	doctor, err := s.userRepo.FindByID(ctx, doctorID)
+	if err != nil || doctor.Role != models.RoleDoctor {
+		return nil, e.NewNotFoundError("doctor not found")
+	}
+
+	loc := s.slots.location(ctx, doctorID)
+	dayStart := utils.StartOfDay(now, loc)
+	appointments, err := s.appointmentRepo.GetAppointmentsByDoctorAndDateRange(doctorID, dayStart, utils.AddDays(dayStart, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	average, measured := s.averageConsultation(doctorID)
+	length := func(appointment models.Appointment) time.Duration {
+		if measured > 0 {
+			return average
+		}
+		return appointment.EndTime.Sub(appointment.StartTime)
+	}
+
+	queue := &models.DoctorQueue{
+		DoctorID:       doctorID,
+		DoctorName:     doctor.Name,
+		Date:           models.CalendarDate(dayStart),
+		InConsultation: []models.QueueEntry{},
+		Waiting:        []models.QueueEntry{},
+		Expected:       []models.QueueEntry{},
+		UpdatedAt:      now,
+	}
+	if measured > 0 {
+		queue.AverageConsultationMinutes = int(math.Round(average.Minutes()))
+	}
+
+	// the doctor is free once every consultation under way has run its
+	// expected length
+	free := now
+	var waiting []models.Appointment
+	for _, appointment := range appointments {
+		switch appointment.Status {
+		case models.StatusInProgress:
+			queue.InConsultation = append(queue.InConsultation, queueEntry(appointment))
+			started := appointment.StartTime
+			if appointment.StartedAt != nil {
+				started = *appointment.StartedAt
+			}
+			if end := started.Add(length(appointment)); end.After(free) {
+				free = end
+			}
+		case models.StatusCheckedIn:
+			waiting = append(waiting, appointment)
+		case models.StatusPending, models.StatusConfirmed:
+			queue.Expected = append(queue.Expected, queueEntry(appointment))
+		}
+	}
+
+	for i, appointment := range waiting {
+		entry := queueEntry(appointment)
+		start := free
+		wait := int(math.Ceil(start.Sub(now).Minutes()))
+		entry.Position = i + 1
+		entry.EstimatedStart = &start
+		entry.EstimatedWaitMinutes = &wait
+		queue.Waiting = append(queue.Waiting, entry)
+		free = free.Add(length(appointment))
+	}
+
+	local := queue.In(loc)
+	return &local, nil
+}
+
+func queueEntry(appointment models.Appointment) models.QueueEntry {
+	return models.QueueEntry{
+		AppointmentID: appointment.ID,
+		PatientID:     appointment.PatientID,
+		PatientName:   appointment.Patient.Name,
+		Status:        appointment.Status,
+		WalkIn:        appointment.WalkIn,
+		ScheduledAt:   appointment.StartTime,
+		CheckedInAt:   appointment.CheckedInAt,
+		StartedAt:     appointment.StartedAt,
+	}
+}
+
+// averageConsultation is how long the doctor's recent consultations actually
+// took, with the number it was measured over
+func (s *appointmentService) averageConsultation(doctorID uint) (time.Duration, int) {
+	consultations, err := s.appointmentRepo.GetRecentConsultations(doctorID, queueConsultationSample)
+	if err != nil {
+		log.Printf("Failed to load recent consultations of doctor %d: %v", doctorID, err)
+		return 0, 0
+	}
+
+	var total time.Duration
+	measured := 0
+	for _, consultation := range consultations {
+		if took := consultation.CompletedAt.Sub(*consultation.StartedAt); took > 0 {
+			total += took
+			measured++
+		}
+	}
+	if measured == 0 {
+		return 0, 0
+	}
+	return total / time.Duration(measured), measured
+}
+
+// publishQueue pushes the doctor's queue to the displays subscribed to it, if
+// any. It runs in the background so the change that prompted it isn't held
+// up.
+func (s *appointmentService) publishQueue(doctorID uint) {
+	if s.wsManager == nil || len(s.wsManager.GetClientsByTopic(QueueTopic(doctorID))) == 0 {
+		return
+	}
+
+	go func() {
+		queue, err := s.buildQueue(context.Background(), doctorID, time.Now())
+		if err != nil {
+			log.Printf("Failed to build the queue of doctor %d: %v", doctorID, err)
+			return
+		}
+		message, err := json.Marshal(queueNotice{Type: "queue", Payload: queue})
+		if err != nil {
+			log.Printf("Failed to encode the queue of doctor %d: %v", doctorID, err)
+			return
+		}
+		for _, client := range s.wsManager.GetClientsByTopic(QueueTopic(doctorID)) {
+			select {
+			case client.Send <- message:
+			default:
+			}
+		}
+	}()
+}
@@ -0,0 +1,435 @@
+package services
+
+import (
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// seriesOccurrence is an appointment of a series with its 1-based position
+type seriesOccurrence struct {
+	number      int
+	appointment *models.Appointment
+}
+
+// CreateSeries books every occurrence of the recurrence, the first one being
+// first. Occurrences the doctor can't take are reported as conflicts and the
+// rest are booked; the series is only refused when none of them fit.
+func (s *appointmentService) CreateSeries(ctx context.Context, first *models.Appointment, recurrence models.Recurrence) (*models.SeriesBookingResult, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsWrite); err != nil {
+		return nil, err
+	}
+
+	starts := recurrence.Occurrences(first.StartTime)
+	if len(starts) < 2 {
+		return nil, e.NewValidationError("a series needs at least two occurrences")
+	}
+
+	series := &models.AppointmentSeries{
+		PatientID:   first.PatientID,
+		DoctorID:    first.DoctorID,
+		Type:        first.Type,
+		Description: first.Description,
+		Address:     first.Address,
+		Latitude:    first.Latitude,
+		Longitude:   first.Longitude,
+		StartTime:   first.StartTime,
+		EndTime:     first.EndTime,
+		Recurrence:  recurrence,
+		Rule:        recurrence.RRule(),
+		Timezone:    first.StartTime.Location().String(),
+		Status:      models.SeriesActive,
+	}
+	if err := s.appointmentRepo.CreateSeries(series); err != nil {
+		return nil, err
+	}
+
+	slots := s.slots.within(models.MaxSeriesAdvanceBooking)
+	length := first.EndTime.Sub(first.StartTime)
+	result := &models.SeriesBookingResult{Series: series, Conflicts: []models.SeriesConflict{}}
+
+	for i, start := range starts {
+		occurrence := *first
+		occurrence.StartTime = start
+		occurrence.EndTime = start.Add(length)
+		occurrence.SeriesID = &series.ID
+
+		if err := s.bookOccurrence(ctx, slots, &occurrence, fmt.Sprintf("occurrence %d of series %d", i+1, series.ID)); err != nil {
+			conflict, ok := seriesConflict(i+1, &occurrence, err)
+			if !ok {
+				return nil, err
+			}
+			result.Conflicts = append(result.Conflicts, conflict)
+			continue
+		}
+		series.Appointments = append(series.Appointments, occurrence)
+	}
+
+	if len(series.Appointments) == 0 {
+		if err := s.appointmentRepo.DeleteSeries(series.ID); err != nil {
+			return nil, err
+		}
+		return nil, e.NewSlotUnavailableError("none of the series' occurrences could be booked", result.Conflicts)
+	}
+	return result, nil
+}
+
+func (s *appointmentService) bookOccurrence(ctx context.Context, slots *slotEngine, appointment *models.Appointment, reason string) error {
+	slot, err := bookableIn(ctx, slots, appointment)
+	if err != nil {
+		return err
+	}
+
+	if appointment.Type == models.TypeOnline {
+		meetLink, err := s.meetService.CreateMeetLink(ctx, appointment)
+		if err != nil {
+			return fmt.Errorf("failed to create meet link: %v", err)
+		}
+		appointment.MeetLink = meetLink
+	}
+
+	appointment.Status = models.StatusPending
+	event, err := s.creationEvent(ctx, appointment.PatientID, reason)
+	if err != nil {
+		return err
+	}
+	if err := s.appointmentRepo.BookAppointment(appointment, *slot, event); err != nil {
+		if errors.Is(err, repositories.ErrSlotFull) {
+			return slots.reject(ctx, appointment, models.SlotFull, "time slot already booked")
+		}
+		return err
+	}
+	return nil
+}
+
+// GetSeries returns the series and its occurrences to its patient and doctor
+func (s *appointmentService) GetSeries(ctx context.Context, seriesID uint, userID uint) (*models.AppointmentSeries, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsRead); err != nil {
+		return nil, err
+	}
+
+	series, err := s.loadSeries(seriesID)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.callerRole(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role != models.RoleAdmin && series.PatientID != userID && series.DoctorID != userID {
+		return nil, e.NewForbiddenError("not authorized to view this series")
+	}
+	return series, nil
+}
+
+// CancelSeries cancels one occurrence, it and the following ones, or every
+// upcoming one. Each cancellation is charged like a single appointment's.
+func (s *appointmentService) CancelSeries(ctx context.Context, seriesID uint, userID uint, req *models.SeriesChangeRequest) (*models.SeriesChangeResult, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsWrite); err != nil {
+		return nil, err
+	}
+
+	series, err := s.loadSeries(seriesID)
+	if err != nil {
+		return nil, err
+	}
+	if series.PatientID != userID && series.DoctorID != userID {
+		return nil, e.NewForbiddenError("not authorized to change this series")
+	}
+
+	targets, err := seriesTargets(series, req, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	result := newSeriesChangeResult(series.ID)
+	for _, target := range targets {
+		charge, err := s.transition(ctx, target.appointment, userID, models.StatusCancelled, req.Reason)
+		if err != nil {
+			if req.Scope == models.SeriesScopeThis {
+				return nil, err
+			}
+			conflict, ok := seriesConflict(target.number, target.appointment, err)
+			if !ok {
+				return nil, err
+			}
+			result.Conflicts = append(result.Conflicts, conflict)
+			continue
+		}
+		result.Appointments = append(result.Appointments, *target.appointment)
+		if charge != nil {
+			result.Charges = append(result.Charges, *charge)
+		}
+	}
+
+	if !hasUpcomingOccurrence(series) {
+		if err := s.appointmentRepo.UpdateSeriesStatus(series.ID, models.SeriesCancelled); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// RescheduleSeries moves the chosen occurrence to the requested time and, for
+// FOLLOWING, shifts every later occurrence by the same number of days and
+// the same change of wall clock time in the series' zone. Occurrences that
+// can't be moved keep their time and are reported as conflicts.
+func (s *appointmentService) RescheduleSeries(ctx context.Context, seriesID uint, userID uint, req *models.SeriesChangeRequest) (*models.SeriesChangeResult, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsWrite); err != nil {
+		return nil, err
+	}
+	if req.Scope == models.SeriesScopeAll {
+		return nil, e.NewValidationError("reschedule the first occurrence with scope FOLLOWING to move the whole series")
+	}
+	if req.Date == "" || req.StartTime == "" || req.EndTime == "" {
+		return nil, e.NewValidationError("date, start_time and end_time are required to reschedule")
+	}
+
+	series, err := s.loadSeries(seriesID)
+	if err != nil {
+		return nil, err
+	}
+	if series.PatientID != userID && series.DoctorID != userID {
+		return nil, e.NewForbiddenError("not authorized to change this series")
+	}
+
+	targets, err := seriesTargets(series, req, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, e.NewConflictError("no upcoming occurrences left to reschedule")
+	}
+
+	selected := targets[0].appointment
+	moved, err := (&models.AppointmentRequest{
+		DoctorID:  series.DoctorID,
+		Type:      selected.Type,
+		Date:      req.Date,
+		StartTime: req.StartTime,
+		EndTime:   req.EndTime,
+	}).ToAppointment(series.PatientID, s.userLocation(ctx, userID))
+	if err != nil {
+		return nil, e.NewValidationError(err.Error())
+	}
+	shift := newSeriesShift(selected.StartTime, moved.StartTime, utils.TimezoneOrUTC(series.Timezone))
+	length := moved.EndTime.Sub(moved.StartTime)
+
+	role, err := s.callerRole(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Moving later frees the later seats first so that occurrences can take
+	// the time their successor is leaving
+	if moved.StartTime.After(selected.StartTime) {
+		for i, j := 0, len(targets)-1; i < j; i, j = i+1, j-1 {
+			targets[i], targets[j] = targets[j], targets[i]
+		}
+	}
+
+	slots := s.slots.within(models.MaxSeriesAdvanceBooking)
+	result := newSeriesChangeResult(series.ID)
+	for _, target := range targets {
+		err := s.moveOccurrence(ctx, slots, target.appointment, userID, role, shift, length)
+		if err != nil {
+			if req.Scope == models.SeriesScopeThis {
+				return nil, err
+			}
+			conflict, ok := seriesConflict(target.number, target.appointment, err)
+			if !ok {
+				return nil, err
+			}
+			result.Conflicts = append(result.Conflicts, conflict)
+			continue
+		}
+		result.Appointments = append(result.Appointments, *target.appointment)
+	}
+
+	sort.Slice(result.Appointments, func(i, j int) bool {
+		return result.Appointments[i].StartTime.Before(result.Appointments[j].StartTime)
+	})
+	sort.Slice(result.Conflicts, func(i, j int) bool {
+		return result.Conflicts[i].Occurrence < result.Conflicts[j].Occurrence
+	})
+	return result, nil
+}
+
+// moveOccurrence rebooks the appointment by shift, lasting length, and
+// updates it in place once the move is saved
+func (s *appointmentService) moveOccurrence(ctx context.Context, slots *slotEngine, appointment *models.Appointment, userID uint, role models.UserRole, shift seriesShift, length time.Duration) error {
+	if !isReschedulable(appointment.Status) {
+		return e.NewConflictError(fmt.Sprintf("a %s appointment can no longer be rescheduled", appointment.Status))
+	}
+
+	next := *appointment
+	next.StartTime = shift.apply(appointment.StartTime)
+	next.EndTime = next.StartTime.Add(length)
+	next.Status = models.StatusPending
+
+	slot, err := bookableIn(ctx, slots, &next)
+	if err != nil {
+		return err
+	}
+
+	event := newAppointmentEvent(ctx, userID, role, appointment.Status, models.StatusPending,
+		fmt.Sprintf("rescheduled with series %d from %s to %s", *appointment.SeriesID,
+			appointment.StartTime.Format(time.RFC3339), next.StartTime.Format(time.RFC3339)))
+	if err := s.appointmentRepo.RebookAppointment(&next, *slot, event); err != nil {
+		if errors.Is(err, repositories.ErrSlotFull) {
+			return slots.reject(ctx, &next, models.SlotFull, "time slot already booked")
+		}
+		return err
+	}
+
+	*appointment = next
+	go s.sendCalendarUpdate(next, utils.ICalMethodRequest)
+	return nil
+}
+
+func (s *appointmentService) loadSeries(id uint) (*models.AppointmentSeries, error) {
+	series, err := s.appointmentRepo.GetSeriesByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, e.NewNotFoundError("appointment series not found")
+		}
+		return nil, err
+	}
+	return series, nil
+}
+
+// seriesTargets picks the occurrences a change applies to. FOLLOWING and ALL
+// leave out occurrences that are already over or cancelled, THIS returns the
+// chosen one whatever its status so the change reports why it can't be made.
+func seriesTargets(series *models.AppointmentSeries, req *models.SeriesChangeRequest, now time.Time) ([]seriesOccurrence, error) {
+	var targets []seriesOccurrence
+
+	if req.Scope == models.SeriesScopeAll {
+		for i := range series.Appointments {
+			apt := &series.Appointments[i]
+			if isReschedulable(apt.Status) && apt.StartTime.After(now) {
+				targets = append(targets, seriesOccurrence{number: i + 1, appointment: apt})
+			}
+		}
+		return targets, nil
+	}
+
+	if req.AppointmentID == 0 {
+		return nil, e.NewValidationError("appointment_id is required for scope THIS or FOLLOWING")
+	}
+	chosen := -1
+	for i := range series.Appointments {
+		if series.Appointments[i].ID == req.AppointmentID {
+			chosen = i
+			break
+		}
+	}
+	if chosen < 0 {
+		return nil, e.NewNotFoundError("appointment is not part of this series")
+	}
+
+	targets = append(targets, seriesOccurrence{number: chosen + 1, appointment: &series.Appointments[chosen]})
+	if req.Scope == models.SeriesScopeFollowing {
+		for i := chosen + 1; i < len(series.Appointments); i++ {
+			apt := &series.Appointments[i]
+			if isReschedulable(apt.Status) {
+				targets = append(targets, seriesOccurrence{number: i + 1, appointment: apt})
+			}
+		}
+	}
+	return targets, nil
+}
+
+// seriesConflict reports a rejected occurrence. Only refusals about the
+// occurrence itself count as conflicts, anything else stops the whole change.
+func seriesConflict(number int, appointment *models.Appointment, err error) (models.SeriesConflict, bool) {
+	custom, ok := appointmentRefusal(err)
+	if !ok {
+		return models.SeriesConflict{}, false
+	}
+
+	conflict := models.SeriesConflict{
+		Occurrence:    number,
+		AppointmentID: appointment.ID,
+		StartTime:     appointment.StartTime,
+		EndTime:       appointment.EndTime,
+		Message:       custom.Message,
+	}
+	if rejection, ok := custom.Details.(models.SlotRejection); ok {
+		conflict.Reason = rejection.Reason
+		conflict.Suggestions = rejection.Suggestions
+	}
+	return conflict, true
+}
+
+// appointmentRefusal tells whether err refuses the change of one appointment,
+// as opposed to a failure that should stop a change of many
+func appointmentRefusal(err error) (*e.CustomError, bool) {
+	var custom *e.CustomError
+	if !errors.As(err, &custom) {
+		return nil, false
+	}
+	switch custom.StatusCode {
+	case http.StatusConflict, http.StatusUnprocessableEntity, http.StatusBadRequest:
+		return custom, true
+	}
+	return nil, false
+}
+
+func newSeriesChangeResult(seriesID uint) *models.SeriesChangeResult {
+	return &models.SeriesChangeResult{
+		SeriesID:     seriesID,
+		Appointments: []models.Appointment{},
+		Conflicts:    []models.SeriesConflict{},
+	}
+}
+
+func hasUpcomingOccurrence(series *models.AppointmentSeries) bool {
+	for _, apt := range series.Appointments {
+		if isReschedulable(apt.Status) {
+			return true
+		}
+	}
+	return false
+}
+
+// seriesShift moves occurrences by whole days and a change of wall clock
+// time, so a series that moves from 9:00 to 10:00 stays at 10:00 on both
+// sides of a DST change
+type seriesShift struct {
+	days  int
+	clock time.Duration
+	loc   *time.Location
+}
+
+func newSeriesShift(from, to time.Time, loc *time.Location) seriesShift {
+	from, to = from.In(loc), to.In(loc)
+	fromDay := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toDay := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return seriesShift{
+		days:  int(toDay.Sub(fromDay) / (24 * time.Hour)),
+		clock: wallClock(to) - wallClock(from),
+		loc:   loc,
+	}
+}
+
+func (s seriesShift) apply(t time.Time) time.Time {
+	local := t.In(s.loc)
+	return time.Date(local.Year(), local.Month(), local.Day()+s.days, 0, 0, 0, int(wallClock(local)+s.clock), s.loc)
+}
+
+// wallClock is how far t's clock reads past midnight
+func wallClock(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+}
@@ -4,47 +4,93 @@ import (
 	e "HealthHubConnect/internal/errors"
 	"HealthHubConnect/internal/models"
 	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/utils"
+	"HealthHubConnect/internal/websocket"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"strings"
 	"time"
 
 	"gorm.io/gorm"
 )
 
 type AppointmentService interface {
-	CreateAppointment(appointment *models.Appointment) error
-	UpdateAppointmentStatus(id uint, status models.AppointmentStatus) error
-	GetAppointmentByID(id uint) (*models.Appointment, error)
-	GetPatientAppointments(patientID uint) ([]models.Appointment, error)
+	CreateAppointment(ctx context.Context, appointment *models.Appointment) error
+	UpdateAppointmentStatus(ctx context.Context, id uint, userID uint, status models.AppointmentStatus, reason string) (*models.AppointmentCharge, error)
+	GetAppointmentHistory(ctx context.Context, id uint, userID uint) ([]models.AppointmentEvent, error)
+	GetAppointmentByID(ctx context.Context, id uint) (*models.Appointment, error)
+	GetPatientAppointments(ctx context.Context, patientID uint) ([]models.Appointment, error)
 	GetDoctorAppointments(doctorID uint) ([]models.Appointment, error)
 	SetDoctorAvailability(availability *models.DoctorAvailability) error
 	GetDoctorAvailability(doctorID uint) ([]models.DoctorAvailability, error)
-	GetAvailableSlots(doctorID uint, date time.Time) ([]models.TimeSlot, error)
-	ValidateAppointmentTime(doctorID uint, date time.Time, startTime time.Time) error
+	GetAvailableSlots(doctorID uint, date time.Time, filter models.SlotFilter) ([]models.TimeSlot, error)
+	ValidateAppointmentTime(ctx context.Context, appointment *models.Appointment) error
 	GetDoctorUpcomingAppointments(doctorID uint) ([]models.Appointment, error)
 	GetDoctorPastAppointments(doctorID uint) ([]models.Appointment, error)
-	GetPatientUpcomingAppointments(patientID uint) ([]models.Appointment, error)
-	GetPatientPastAppointments(patientID uint) ([]models.Appointment, error)
-	CancelAppointment(appointmentID uint, userID uint) error
+	GetPatientUpcomingAppointments(ctx context.Context, patientID uint) ([]models.Appointment, error)
+	GetPatientPastAppointments(ctx context.Context, patientID uint) ([]models.Appointment, error)
+	CancelAppointment(ctx context.Context, appointmentID uint, userID uint) (*models.AppointmentCharge, error)
+	GetCancellationCharge(ctx context.Context, appointmentID uint, userID uint) (*models.AppointmentCharge, error)
 	GetDoctorTodayAppointments(doctorID uint) ([]models.Appointment, error)
 	GetDoctorWeekAppointments(doctorID uint) ([]models.Appointment, error)
-	RescheduleAppointment(appointmentID uint, userID uint, req *models.AppointmentRequest) error
+	RescheduleAppointment(ctx context.Context, appointmentID uint, userID uint, req *models.AppointmentRequest) error
+	CreateHold(ctx context.Context, patientID uint, req *models.SlotHoldRequest) (*models.SlotHold, error)
+	GetHold(ctx context.Context, holdID uint, patientID uint) (*models.SlotHold, error)
+	ReleaseHold(ctx context.Context, holdID uint, patientID uint) error
+	ConfirmHold(ctx context.Context, holdID uint, patientID uint, req *models.ConfirmHoldRequest) (*models.Appointment, error)
+	CreateSeries(ctx context.Context, first *models.Appointment, recurrence models.Recurrence) (*models.SeriesBookingResult, error)
+	GetSeries(ctx context.Context, seriesID uint, userID uint) (*models.AppointmentSeries, error)
+	CancelSeries(ctx context.Context, seriesID uint, userID uint, req *models.SeriesChangeRequest) (*models.SeriesChangeResult, error)
+	RescheduleSeries(ctx context.Context, seriesID uint, userID uint, req *models.SeriesChangeRequest) (*models.SeriesChangeResult, error)
+	JoinWaitlist(ctx context.Context, patientID uint, req *models.WaitlistRequest) (*models.WaitlistEntry, error)
+	GetWaitlist(ctx context.Context, patientID uint) ([]models.WaitlistEntry, error)
+	LeaveWaitlist(ctx context.Context, entryID uint, patientID uint) error
+	GetWaitlistOffer(ctx context.Context, token string, patientID uint) (*models.WaitlistOffer, error)
+	ClaimWaitlistOffer(ctx context.Context, token string, patientID uint, req *models.ConfirmHoldRequest) (*models.Appointment, error)
+	DeclineWaitlistOffer(ctx context.Context, token string, patientID uint) error
+	ExpireWaitlistOffers(ctx context.Context, now time.Time) (int, error)
+	OfferFreedSlots(ctx context.Context, doctorID uint, start, end time.Time)
+	CreateTimeOff(ctx context.Context, doctorID uint, req *models.TimeOffRequest) (*models.TimeOffResult, error)
+	ListTimeOff(ctx context.Context, doctorID uint) ([]models.DoctorTimeOff, error)
+	GetTimeOff(ctx context.Context, timeOffID uint, doctorID uint) (*models.TimeOffResult, error)
+	DeleteTimeOff(ctx context.Context, timeOffID uint, doctorID uint) error
+	ResolveTimeOff(ctx context.Context, timeOffID uint, doctorID uint, req *models.TimeOffActionRequest) (*models.TimeOffActionResult, error)
+	GetHolidays(ctx context.Context, doctorID uint) ([]models.HolidayImpact, error)
+	ResolveHoliday(ctx context.Context, holidayID uint, doctorID uint, req *models.TimeOffActionRequest) (*models.TimeOffActionResult, error)
+
+	// Front desk
+	ListFrontDeskStaff(ctx context.Context, doctorID uint) ([]models.FrontDeskAssignment, error)
+	AddFrontDeskStaff(ctx context.Context, doctorID uint, req *models.FrontDeskStaffRequest) (*models.FrontDeskAssignment, error)
+	RemoveFrontDeskStaff(ctx context.Context, doctorID uint, receptionistID uint) error
+	FrontDeskDoctors(ctx context.Context, receptionistID uint) ([]models.FrontDeskAssignment, error)
+	FindFrontDeskPatients(ctx context.Context, receptionistID uint, email string, phone int64) ([]models.User, error)
+	BookAtFrontDesk(ctx context.Context, receptionistID uint, appointment *models.Appointment) error
+	RegisterWalkIn(ctx context.Context, receptionistID uint, req *models.WalkInRequest) (*models.Appointment, error)
+	UpdateFrontDeskStatus(ctx context.Context, appointmentID uint, userID uint, status models.AppointmentStatus, reason string) (*models.Appointment, *models.AppointmentCharge, error)
+	GetQueue(ctx context.Context, doctorID uint, userID uint) (*models.DoctorQueue, error)
 }
 
 type appointmentService struct {
 	appointmentRepo repositories.AppointmentRepository
 	userRepo        repositories.UserRepository
 	doctorRepo      *repositories.DoctorRepository
+	waitlistRepo    *repositories.WaitlistRepository
+	timeOffRepo     *repositories.TimeOffRepository
+	frontDeskRepo   *repositories.FrontDeskRepository
+	wsManager       *websocket.Manager
 	meetService     *MeetService
+	slots           *slotEngine
 }
 
 func NewAppointmentService(
 	appointmentRepo repositories.AppointmentRepository,
 	userRepo repositories.UserRepository,
 	doctorRepo *repositories.DoctorRepository,
+	waitlistRepo *repositories.WaitlistRepository,
+	timeOffRepo *repositories.TimeOffRepository,
+	frontDeskRepo *repositories.FrontDeskRepository,
+	wsManager *websocket.Manager,
 ) (AppointmentService, error) {
 	meetService, err := NewMeetService(&userRepo)
 	if err != nil {
@@ -55,53 +101,28 @@ func NewAppointmentService(
 		appointmentRepo: appointmentRepo,
 		userRepo:        userRepo,
 		doctorRepo:      doctorRepo,
+		waitlistRepo:    waitlistRepo,
+		timeOffRepo:     timeOffRepo,
+		frontDeskRepo:   frontDeskRepo,
+		wsManager:       wsManager,
 		meetService:     meetService,
+		slots:           newSlotEngine(doctorRepo, appointmentRepo, timeOffRepo),
 	}, nil
 }
 
-func (s *appointmentService) CreateAppointment(appointment *models.Appointment) error {
-	// Get current date without time component for comparison
-	now := time.Now().Truncate(24 * time.Hour)
-	appointmentDate := appointment.Date.Truncate(24 * time.Hour)
-
-	if appointmentDate.Before(now) {
-		return e.NewBadRequestError("cannot schedule appointments in the past")
-	}
-
-	if appointmentDate.Equal(now) {
-		// If same day, check if appointment time is in the past
-		currentTime := time.Now()
-		if appointment.StartTime.Before(currentTime) {
-			return e.NewBadRequestError("cannot schedule appointments in the past")
-		}
-	}
-
-	if appointment.EndTime.Before(appointment.StartTime) {
-		return e.NewBadRequestError("end time must be after start time")
-	}
-
-	duration := appointment.EndTime.Sub(appointment.StartTime)
-	if duration < models.MinAppointmentDuration || duration > models.MaxAppointmentDuration {
-		return e.NewBadRequestError("appointment duration must be between 15 and 120 minutes")
+func (s *appointmentService) CreateAppointment(ctx context.Context, appointment *models.Appointment) error {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsWrite); err != nil {
+		return err
 	}
 
-	// Check for conflicting appointments
-	existing, err := s.appointmentRepo.GetConflictingAppointments(
-		appointment.DoctorID,
-		appointment.Date,
-		appointment.StartTime,
-		appointment.EndTime,
-	)
+	slot, err := s.bookableSlot(ctx, appointment)
 	if err != nil {
 		return err
 	}
-	if len(existing) > 0 {
-		return e.NewDuplicateResourceError("time slot already booked")
-	}
 
 	// Generate Meet link for online appointments
 	if appointment.Type == models.TypeOnline {
-		meetLink, err := s.meetService.CreateMeetLink(context.Background(), appointment)
+		meetLink, err := s.meetService.CreateMeetLink(ctx, appointment)
 		if err != nil {
 			return fmt.Errorf("failed to create meet link: %v", err)
 		}
@@ -109,24 +130,62 @@ func (s *appointmentService) CreateAppointment(appointment *models.Appointment)
 	}
 
 	appointment.Status = models.StatusPending
-	return s.appointmentRepo.CreateAppointment(appointment)
+	event, err := s.creationEvent(ctx, appointment.PatientID, "")
+	if err != nil {
+		return err
+	}
+	if err := s.appointmentRepo.BookAppointment(appointment, *slot, event); err != nil {
+		return s.bookingError(ctx, appointment, err)
+	}
+	s.publishQueue(appointment.DoctorID)
+	return nil
 }
 
-func (s *appointmentService) UpdateAppointmentStatus(id uint, status models.AppointmentStatus) error {
-	appointment, err := s.appointmentRepo.GetAppointmentByID(id)
+// UpdateAppointmentStatus moves the appointment through the state machine on
+// behalf of userID and records the change in its history. Cancellations and
+// no-shows return what they cost the patient.
+func (s *appointmentService) UpdateAppointmentStatus(ctx context.Context, id uint, userID uint, status models.AppointmentStatus, reason string) (*models.AppointmentCharge, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsWrite); err != nil {
+		return nil, err
+	}
+
+	appointment, err := s.loadAppointment(id)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return s.transition(ctx, appointment, userID, status, reason)
+}
 
-	appointment.Status = status
-	return s.appointmentRepo.UpdateAppointment(appointment)
+func (s *appointmentService) creationEvent(ctx context.Context, userID uint, reason string) (*models.AppointmentEvent, error) {
+	role, err := s.callerRole(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return newAppointmentEvent(ctx, userID, role, "", models.StatusPending, reason), nil
 }
 
-func (s *appointmentService) GetAppointmentByID(id uint) (*models.Appointment, error) {
-	return s.appointmentRepo.GetAppointmentByID(id)
+// GetAppointmentByID returns the appointment, a caregiver acting for a patient
+// only gets to see that patient's appointments
+func (s *appointmentService) GetAppointmentByID(ctx context.Context, id uint) (*models.Appointment, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsRead); err != nil {
+		return nil, err
+	}
+
+	appointment, err := s.appointmentRepo.GetAppointmentByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if principal, err := utils.GetPrincipalFromContext(ctx); err == nil && principal.IsDelegated() && appointment.PatientID != principal.UserID {
+		return nil, e.NewNotFoundError("appointment not found")
+	}
+	return appointment, nil
 }
 
-func (s *appointmentService) GetPatientAppointments(patientID uint) ([]models.Appointment, error) {
+func (s *appointmentService) GetPatientAppointments(ctx context.Context, patientID uint) ([]models.Appointment, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsRead); err != nil {
+		return nil, err
+	}
+
 	appointments, err := s.appointmentRepo.GetAppointmentsByPatientID(patientID)
 	if err != nil {
 		return nil, e.NewInternalError()
@@ -146,88 +205,92 @@ func (s *appointmentService) GetDoctorAvailability(doctorID uint) ([]models.Doct
 	return s.appointmentRepo.GetDoctorAvailability(doctorID)
 }
 
-func (s *appointmentService) GetAvailableSlots(doctorID uint, date time.Time) ([]models.TimeSlot, error) {
-	schedule, err := s.doctorRepo.GetScheduleWithoutValidation(context.Background(), doctorID)
+// GetAvailableSlots returns the slots that can still be booked on the given
+// day of the doctor's calendar, narrowed to a practice location or a distance
+// by filter
+func (s *appointmentService) GetAvailableSlots(doctorID uint, date time.Time, filter models.SlotFilter) ([]models.TimeSlot, error) {
+	plan, err := s.slots.Plan(context.Background(), doctorID, date)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return []models.TimeSlot{}, e.NewNotFoundError("doctor schedule not found")
-		}
-		return nil, fmt.Errorf("error getting doctor schedule: %v", err)
-	}
-
-	var parsedSchedule models.Schedule
-	if err := json.Unmarshal([]byte(schedule.Schedule), &parsedSchedule); err != nil {
-		var rawSchedule string
-		if err := json.Unmarshal([]byte(schedule.Schedule), &rawSchedule); err != nil {
-			return nil, err
-		}
-		if err := json.Unmarshal([]byte(rawSchedule), &parsedSchedule); err != nil {
-			return nil, err
-		}
+		return nil, err
 	}
-
-	dayOfWeek := strings.ToLower(date.Weekday().String())
-	daySchedule, exists := parsedSchedule.Days[dayOfWeek]
-	if !exists || !daySchedule.Enabled {
+	if !plan.Open {
 		return []models.TimeSlot{}, e.NewNotFoundError("no slots available for this day")
 	}
 
-	existingAppointments, err := s.appointmentRepo.GetAppointmentsByDoctorAndDate(doctorID, date)
-	if err != nil {
-		return nil, err
-	}
+	return filterSlots(plan.available(), filter), nil
+}
 
-	var availableSlots []models.TimeSlot
-	for _, scheduleSlot := range daySchedule.Slots {
-		startTime, _ := time.Parse("15:04", scheduleSlot.Start)
-		endTime, _ := time.Parse("15:04", scheduleSlot.End)
+// ValidateAppointmentTime checks the requested range against the booking
+// window and the doctor's generated slots. Rejections carry the reason and
+// the nearest free slots
+func (s *appointmentService) ValidateAppointmentTime(ctx context.Context, appointment *models.Appointment) error {
+	_, err := s.bookableSlot(ctx, appointment)
+	return err
+}
 
-		slot := models.TimeSlot{
-			StartTime: startTime,
-			EndTime:   endTime,
-			Available: true,
-		}
+// bookableSlot runs the checks of ValidateAppointmentTime and returns the
+// slot the appointment takes a seat in
+func (s *appointmentService) bookableSlot(ctx context.Context, appointment *models.Appointment) (*models.TimeSlot, error) {
+	return bookableIn(ctx, s.slots, appointment)
+}
 
-		if isSlotAvailable(slot, existingAppointments) {
-			availableSlots = append(availableSlots, slot)
-		}
+func bookableIn(ctx context.Context, slots *slotEngine, appointment *models.Appointment) (*models.TimeSlot, error) {
+	if !appointment.EndTime.After(appointment.StartTime) {
+		return nil, e.NewBadRequestError("end time must be after start time")
 	}
 
-	return availableSlots, nil
-}
+	duration := appointment.EndTime.Sub(appointment.StartTime)
+	if duration < models.MinAppointmentDuration || duration > models.MaxAppointmentDuration {
+		return nil, e.NewBadRequestError("appointment duration must be between 15 and 120 minutes")
+	}
 
-func isSlotAvailable(slot models.TimeSlot, appointments []models.Appointment) bool {
-	for _, apt := range appointments {
-		if (slot.StartTime.Before(apt.EndTime) || slot.StartTime.Equal(apt.EndTime)) &&
-			(slot.EndTime.After(apt.StartTime) || slot.EndTime.Equal(apt.StartTime)) {
-			return false
-		}
+	slot, err := slots.Validate(ctx, appointment)
+	if err != nil {
+		return nil, err
 	}
-	return true
+	// the slot is laid out in the doctor's zone, so its day is the day the
+	// appointment is filed under whatever zone it was booked from
+	appointment.Date = models.CalendarDate(slot.StartTime)
+	stampLocation(appointment, slot.Location)
+	return slot, nil
 }
 
-func (s *appointmentService) ValidateAppointmentTime(doctorID uint, date time.Time, startTime time.Time) error {
-	_, err := s.doctorRepo.GetSchedule(context.Background(), doctorID)
+// userLocation returns the zone the user reads and writes times in
+func (s *appointmentService) userLocation(ctx context.Context, userID uint) *time.Location {
+	user, err := s.userRepo.FindByID(ctx, userID)
 	if err != nil {
-		return err
+		return time.UTC
 	}
+	return utils.TimezoneOrUTC(user.Timezone)
+}
 
-	// Parse and validate against doctor's schedule
-	// will do when i get time not important for now
-
-	return nil
+// bookingError reports a seat lost to a concurrent booking the same way as a
+// slot that was already full
+func (s *appointmentService) bookingError(ctx context.Context, appointment *models.Appointment, err error) error {
+	if errors.Is(err, repositories.ErrSlotFull) {
+		return s.slots.reject(ctx, appointment, models.SlotFull, "time slot already booked")
+	}
+	return err
 }
 
+// GetDoctorUpcomingAppointments returns the doctor's appointments from the
+// start of their today on
 func (s *appointmentService) GetDoctorUpcomingAppointments(doctorID uint) ([]models.Appointment, error) {
-	return s.appointmentRepo.GetDoctorUpcomingAppointments(doctorID)
+	today := utils.StartOfDay(time.Now(), s.slots.location(context.Background(), doctorID))
+	return s.appointmentRepo.GetDoctorUpcomingAppointments(doctorID, today)
 }
 
 func (s *appointmentService) GetDoctorPastAppointments(doctorID uint) ([]models.Appointment, error) {
 	return s.appointmentRepo.GetPastAppointments(doctorID)
 }
 
-func (s *appointmentService) GetPatientUpcomingAppointments(patientID uint) ([]models.Appointment, error) {
-	appointments, err := s.appointmentRepo.GetPatientUpcomingAppointments(patientID)
+func (s *appointmentService) GetPatientUpcomingAppointments(ctx context.Context, patientID uint) ([]models.Appointment, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsRead); err != nil {
+		return nil, err
+	}
+
+	today := utils.StartOfDay(time.Now(), s.userLocation(ctx, patientID))
+	appointments, err := s.appointmentRepo.GetPatientUpcomingAppointments(patientID, today)
 	if err != nil {
 		log.Printf("Error in service layer: %v", err)
 		return nil, e.NewInternalError()
@@ -235,32 +298,36 @@ func (s *appointmentService) GetPatientUpcomingAppointments(patientID uint) ([]m
 	return appointments, nil
 }
 
-func (s *appointmentService) GetPatientPastAppointments(patientID uint) ([]models.Appointment, error) {
+func (s *appointmentService) GetPatientPastAppointments(ctx context.Context, patientID uint) ([]models.Appointment, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsRead); err != nil {
+		return nil, err
+	}
+
 	return s.appointmentRepo.GetPastAppointments(patientID)
 }
 
-func (s *appointmentService) CancelAppointment(appointmentID uint, userID uint) error {
-	appointment, err := s.appointmentRepo.GetAppointmentByID(appointmentID)
+func (s *appointmentService) CancelAppointment(ctx context.Context, appointmentID uint, userID uint) (*models.AppointmentCharge, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsWrite); err != nil {
+		return nil, err
+	}
+
+	appointment, err := s.loadAppointment(appointmentID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if appointment.PatientID != userID && appointment.DoctorID != userID {
-		return e.NewForbiddenError("not authorized to cancel this appointment")
+		return nil, e.NewForbiddenError("not authorized to cancel this appointment")
 	}
 
-	now := time.Now()
-	appointment.Status = models.StatusCancelled
-	appointment.IsCancelled = true
-	appointment.CancelledAt = &now
-	appointment.CancelledBy = &userID
-
-	return s.appointmentRepo.UpdateAppointment(appointment)
+	return s.transition(ctx, appointment, userID, models.StatusCancelled, "")
 }
 
+// GetDoctorTodayAppointments returns the appointments of the current day in
+// the doctor's zone
 func (s *appointmentService) GetDoctorTodayAppointments(doctorID uint) ([]models.Appointment, error) {
-	today := time.Now().Truncate(24 * time.Hour)
-	tomorrow := today.Add(24 * time.Hour)
+	today := utils.StartOfDay(time.Now(), s.slots.location(context.Background(), doctorID))
+	tomorrow := utils.AddDays(today, 1)
 
 	appointments, err := s.appointmentRepo.GetAppointmentsByDoctorAndDateRange(
 		doctorID,
@@ -274,10 +341,11 @@ func (s *appointmentService) GetDoctorTodayAppointments(doctorID uint) ([]models
 	return appointments, nil
 }
 
+// GetDoctorWeekAppointments returns the appointments of the seven days
+// starting today in the doctor's zone
 func (s *appointmentService) GetDoctorWeekAppointments(doctorID uint) ([]models.Appointment, error) {
-	now := time.Now()
-	weekStart := now.Truncate(24 * time.Hour)
-	weekEnd := weekStart.Add(7 * 24 * time.Hour)
+	weekStart := utils.StartOfDay(time.Now(), s.slots.location(context.Background(), doctorID))
+	weekEnd := utils.AddDays(weekStart, 7)
 
 	appointments, err := s.appointmentRepo.GetAppointmentsByDoctorAndDateRange(
 		doctorID,
@@ -291,8 +359,12 @@ func (s *appointmentService) GetDoctorWeekAppointments(doctorID uint) ([]models.
 	return appointments, nil
 }
 
-func (s *appointmentService) RescheduleAppointment(appointmentID uint, userID uint, req *models.AppointmentRequest) error {
-	appointment, err := s.appointmentRepo.GetAppointmentByID(appointmentID)
+func (s *appointmentService) RescheduleAppointment(ctx context.Context, appointmentID uint, userID uint, req *models.AppointmentRequest) error {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsWrite); err != nil {
+		return err
+	}
+
+	appointment, err := s.loadAppointment(appointmentID)
 	if err != nil {
 		return err
 	}
@@ -300,14 +372,205 @@ func (s *appointmentService) RescheduleAppointment(appointmentID uint, userID ui
 	if appointment.PatientID != userID && appointment.DoctorID != userID {
 		return e.NewForbiddenError("not authorized to reschedule this appointment")
 	}
+	if !isReschedulable(appointment.Status) {
+		return e.NewConflictError(fmt.Sprintf("a %s appointment can no longer be rescheduled", appointment.Status))
+	}
+
+	// moving the booking to another doctor would bypass that doctor, it
+	// takes a new booking
+	if req.DoctorID != 0 && req.DoctorID != appointment.DoctorID {
+		return e.NewValidationError("an appointment can only be rescheduled with the same doctor, book a new one instead")
+	}
 
-	newAppointment, err := req.ToAppointment(appointment.PatientID)
+	role, err := s.callerRole(ctx, userID)
 	if err != nil {
 		return err
 	}
 
-	newAppointment.ID = appointmentID
-	newAppointment.Status = models.StatusPending
+	requested, err := req.ToAppointment(appointment.PatientID, s.userLocation(ctx, userID))
+	if err != nil {
+		return err
+	}
+
+	// the request only carries the new time and details, everything else
+	// such as the meet link and reminder setting stays as booked
+	next := *appointment
+	next.Type = requested.Type
+	next.Date = requested.Date
+	next.StartTime = requested.StartTime
+	next.EndTime = requested.EndTime
+	next.Description = requested.Description
+	next.Address = requested.Address
+	next.Latitude = requested.Latitude
+	next.Longitude = requested.Longitude
+	next.Status = models.StatusPending
+
+	slot, err := s.bookableSlot(ctx, &next)
+	if err != nil {
+		return err
+	}
+
+	event := newAppointmentEvent(ctx, userID, role, appointment.Status, models.StatusPending,
+		fmt.Sprintf("rescheduled from %s to %s", appointment.StartTime.Format(time.RFC3339), next.StartTime.Format(time.RFC3339)))
+	if err := s.appointmentRepo.RebookAppointment(&next, *slot, event); err != nil {
+		return s.bookingError(ctx, &next, err)
+	}
+
+	go s.sendCalendarUpdate(next, utils.ICalMethodRequest)
+	s.OfferFreedSlots(ctx, appointment.DoctorID, appointment.StartTime, appointment.EndTime)
+	return nil
+}
+
+// CreateHold reserves a slot for the patient for req.Minutes, or
+// DefaultHoldDuration, while they finish booking
+func (s *appointmentService) CreateHold(ctx context.Context, patientID uint, req *models.SlotHoldRequest) (*models.SlotHold, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsWrite); err != nil {
+		return nil, err
+	}
+
+	patient, err := s.userRepo.FindByID(ctx, patientID)
+	if err != nil {
+		return nil, e.NewNotFoundError("user not found")
+	}
+	if patient.Role != models.RolePatient {
+		return nil, e.NewForbiddenError("only patients can hold appointment slots")
+	}
+
+	holdFor := models.DefaultHoldDuration
+	if req.Minutes != 0 {
+		holdFor = time.Duration(req.Minutes) * time.Minute
+	}
+	if holdFor <= 0 || holdFor > models.MaxHoldDuration {
+		return nil, e.NewValidationError(fmt.Sprintf("a hold can last between 1 and %d minutes", int(models.MaxHoldDuration/time.Minute)))
+	}
+
+	apptReq := models.AppointmentRequest{
+		DoctorID:  req.DoctorID,
+		Date:      req.Date,
+		StartTime: req.StartTime,
+		EndTime:   req.EndTime,
+	}
+	candidate, err := apptReq.ToAppointment(patientID, utils.TimezoneOrUTC(patient.Timezone))
+	if err != nil {
+		return nil, e.NewValidationError(err.Error())
+	}
 
-	return s.appointmentRepo.UpdateAppointment(newAppointment)
+	slot, err := s.bookableSlot(ctx, candidate)
+	if err != nil {
+		return nil, err
+	}
+
+	hold := &models.SlotHold{
+		PatientID: patientID,
+		DoctorID:  candidate.DoctorID,
+		StartTime: candidate.StartTime,
+		EndTime:   candidate.EndTime,
+		Status:    models.HoldActive,
+		ExpiresAt: time.Now().Add(holdFor),
+	}
+	if err := s.appointmentRepo.CreateHold(hold, *slot); err != nil {
+		return nil, s.bookingError(ctx, candidate, err)
+	}
+	return hold, nil
+}
+
+// GetHold returns one of the patient's holds, an active hold past its expiry
+// is reported as expired even before the cleanup job gets to it
+func (s *appointmentService) GetHold(ctx context.Context, holdID uint, patientID uint) (*models.SlotHold, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsRead); err != nil {
+		return nil, err
+	}
+
+	hold, err := s.findHold(holdID, patientID)
+	if err != nil {
+		return nil, err
+	}
+	if hold.Status == models.HoldActive && !hold.IsActive(time.Now()) {
+		hold.Status = models.HoldExpired
+	}
+	return hold, nil
+}
+
+func (s *appointmentService) ReleaseHold(ctx context.Context, holdID uint, patientID uint) error {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsWrite); err != nil {
+		return err
+	}
+
+	hold, err := s.findHold(holdID, patientID)
+	if err != nil {
+		return err
+	}
+	if !hold.IsActive(time.Now()) {
+		return e.NewConflictError("hold has expired or is no longer active")
+	}
+	return s.appointmentRepo.ReleaseHold(hold)
+}
+
+// ConfirmHold books the held slot with the details given at checkout
+func (s *appointmentService) ConfirmHold(ctx context.Context, holdID uint, patientID uint, req *models.ConfirmHoldRequest) (*models.Appointment, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsWrite); err != nil {
+		return nil, err
+	}
+
+	if req.Type != models.TypeOnline && req.Type != models.TypeOffline {
+		return nil, e.NewValidationError("type must be ONLINE or OFFLINE")
+	}
+
+	hold, err := s.findHold(holdID, patientID)
+	if err != nil {
+		return nil, err
+	}
+	if !hold.IsActive(time.Now()) {
+		return nil, e.NewConflictError("hold has expired or is no longer active")
+	}
+
+	start := hold.StartTime.In(s.slots.location(ctx, hold.DoctorID))
+	appointment := &models.Appointment{
+		PatientID:   hold.PatientID,
+		DoctorID:    hold.DoctorID,
+		Type:        req.Type,
+		Date:        models.CalendarDate(start),
+		StartTime:   hold.StartTime,
+		EndTime:     hold.EndTime,
+		Description: req.Description,
+		Address:     req.Address,
+		Latitude:    req.Latitude,
+		Longitude:   req.Longitude,
+		Status:      models.StatusPending,
+	}
+	stampLocation(appointment, s.slots.locationOf(ctx, hold.DoctorID, hold.StartTime, hold.EndTime))
+
+	if appointment.Type == models.TypeOnline {
+		meetLink, err := s.meetService.CreateMeetLink(ctx, appointment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create meet link: %v", err)
+		}
+		appointment.MeetLink = meetLink
+	}
+
+	event, err := s.creationEvent(ctx, patientID, fmt.Sprintf("booked from slot hold %d", hold.ID))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.appointmentRepo.ConvertHold(hold, appointment, event); err != nil {
+		if errors.Is(err, repositories.ErrHoldExpired) {
+			return nil, e.NewConflictError("hold has expired or is no longer active")
+		}
+		return nil, err
+	}
+	return appointment, nil
+}
+
+func (s *appointmentService) findHold(holdID uint, patientID uint) (*models.SlotHold, error) {
+	hold, err := s.appointmentRepo.GetHoldByID(holdID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, e.NewNotFoundError("hold not found")
+		}
+		return nil, err
+	}
+	if hold.PatientID != patientID {
+		return nil, e.NewNotFoundError("hold not found")
+	}
+	return hold, nil
 }
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/utils"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDoctorDayAndWeekAppointments(t *testing.T) {
+	// far from UTC, the local day rarely matches the UTC one
+	for _, timezone := range []string{"Pacific/Kiritimati", "Pacific/Pago_Pago", "America/New_York"} {
+		t.Run(timezone, func(t *testing.T) {
+			db := newTestDB(t)
+			doctor := createTestUser(t, db, models.RoleDoctor, timezone)
+			patient := createTestUser(t, db, models.RolePatient, "")
+			appointmentRepo := repositories.NewAppointmentRepository(db)
+			s := &appointmentService{
+				appointmentRepo: appointmentRepo,
+				slots:           newSlotEngine(repositories.NewDoctorRepository(db), appointmentRepo, repositories.NewTimeOffRepository(db)),
+			}
+
+			loc, err := utils.LoadTimezone(timezone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			today := utils.StartOfDay(time.Now(), loc)
+			tomorrow := utils.AddDays(today, 1)
+			weekEnd := utils.AddDays(today, 7)
+
+			for _, apt := range []struct {
+				start       time.Time
+				description string
+			}{
+				{today.Add(-30 * time.Minute), "yesterday"},
+				{today, "first today"},
+				{tomorrow.Add(-30 * time.Minute), "last today"},
+				{tomorrow, "tomorrow"},
+				{weekEnd.Add(-30 * time.Minute), "last this week"},
+				{weekEnd, "next week"},
+			} {
+				createTestAppointment(t, db, doctor.ID, patient.ID, apt.start, apt.description)
+			}
+
+			tests := []struct {
+				name  string
+				query func(uint) ([]models.Appointment, error)
+				want  []string
+			}{
+				{"today", s.GetDoctorTodayAppointments, []string{"first today", "last today"}},
+				{"week", s.GetDoctorWeekAppointments, []string{"first today", "last today", "tomorrow", "last this week"}},
+			}
+			for _, tt := range tests {
+				appointments, err := tt.query(doctor.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := []string{}
+				for _, apt := range appointments {
+					got = append(got, apt.Description)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s = %q, want %q", tt.name, got, tt.want)
+				}
+			}
+		})
+	}
+}
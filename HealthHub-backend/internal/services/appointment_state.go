@@ -0,0 +1,235 @@
+package services
+
+import (
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// appointmentTransitions lists for every status the statuses it may move to
+// and the roles allowed to make that move. COMPLETED, CANCELLED and NO_SHOW
+// are final. Receptionists act only for the doctors whose front desk they
+// work.
+var appointmentTransitions = map[models.AppointmentStatus]map[models.AppointmentStatus][]models.UserRole{
+	models.StatusPending: {
+		models.StatusConfirmed: {models.RoleDoctor, models.RoleReceptionist},
+		models.StatusCancelled: {models.RolePatient, models.RoleDoctor},
+	},
+	models.StatusConfirmed: {
+		models.StatusCheckedIn:  {models.RoleDoctor, models.RoleReceptionist},
+		models.StatusInProgress: {models.RoleDoctor},
+		models.StatusCompleted:  {models.RoleDoctor},
+		models.StatusCancelled:  {models.RolePatient, models.RoleDoctor},
+		models.StatusNoShow:     {models.RoleDoctor, models.RoleReceptionist},
+	},
+	models.StatusCheckedIn: {
+		models.StatusInProgress: {models.RoleDoctor},
+		models.StatusCompleted:  {models.RoleDoctor},
+		models.StatusCancelled:  {models.RoleDoctor, models.RoleReceptionist},
+	},
+	models.StatusInProgress: {
+		models.StatusCompleted: {models.RoleDoctor},
+	},
+}
+
+func isAppointmentStatus(status models.AppointmentStatus) bool {
+	switch status {
+	case models.StatusPending, models.StatusConfirmed, models.StatusCheckedIn, models.StatusInProgress,
+		models.StatusCompleted, models.StatusCancelled, models.StatusNoShow:
+		return true
+	}
+	return false
+}
+
+// isReschedulable tells whether the appointment can still be moved, which
+// puts it back to PENDING for the doctor to confirm again
+func isReschedulable(status models.AppointmentStatus) bool {
+	return status == models.StatusPending || status == models.StatusConfirmed
+}
+
+// callerRole is the role of the request's principal, looked up from the user
+// when the call didn't come through the HTTP middleware
+func (s *appointmentService) callerRole(ctx context.Context, userID uint) (models.UserRole, error) {
+	if principal, err := utils.GetPrincipalFromContext(ctx); err == nil {
+		return principal.Role, nil
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return "", e.NewNotFoundError("user not found")
+	}
+	return user.Role, nil
+}
+
+// newAppointmentEvent builds the history entry for a change made by the
+// caller, noting the caregiver when they act on behalf of the patient
+func newAppointmentEvent(ctx context.Context, userID uint, role models.UserRole, from, to models.AppointmentStatus, reason string) *models.AppointmentEvent {
+	event := &models.AppointmentEvent{
+		FromStatus: from,
+		ToStatus:   to,
+		ActorID:    userID,
+		ActorRole:  role,
+		Reason:     reason,
+	}
+	if principal, err := utils.GetPrincipalFromContext(ctx); err == nil && principal.IsDelegated() {
+		onBehalfOf := principal.UserID
+		event.ActorID = principal.ActorID
+		event.OnBehalfOfID = &onBehalfOf
+	}
+	return event
+}
+
+func (s *appointmentService) loadAppointment(id uint) (*models.Appointment, error) {
+	appointment, err := s.appointmentRepo.GetAppointmentByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, e.NewNotFoundError("appointment not found")
+		}
+		return nil, err
+	}
+	return appointment, nil
+}
+
+// checkTransition tells whether the state machine lets the caller's role move
+// the appointment to the given status and the caller is party to it. Roles
+// with no tie to the appointment are turned away.
+func (s *appointmentService) checkTransition(ctx context.Context, appointment *models.Appointment, userID uint, role models.UserRole, to models.AppointmentStatus) error {
+	from := appointment.Status
+	if from == to {
+		return e.NewConflictError(fmt.Sprintf("appointment is already %s", to))
+	}
+	allowed, ok := appointmentTransitions[from][to]
+	if !ok {
+		return e.NewConflictError(fmt.Sprintf("cannot move an appointment from %s to %s", from, to))
+	}
+	if !hasRole(allowed, role) {
+		return e.NewForbiddenError(fmt.Sprintf("role '%s' cannot move an appointment from %s to %s", role, from, to))
+	}
+
+	switch role {
+	case models.RolePatient:
+		if appointment.PatientID == userID {
+			return nil
+		}
+	case models.RoleDoctor:
+		if appointment.DoctorID == userID {
+			return nil
+		}
+	case models.RoleReceptionist:
+		assigned, err := s.frontDeskRepo.IsAssigned(ctx, appointment.DoctorID, userID)
+		if err != nil {
+			return err
+		}
+		if assigned {
+			return nil
+		}
+	}
+	return e.NewForbiddenError("not authorized to update this appointment")
+}
+
+// transition moves the appointment to the given status if the state machine
+// allows it. Cancellations and no-shows are charged under the doctor's
+// policies in the same step, and the charge is returned. A cancelled slot is
+// offered to the doctor's waitlist. Confirmations and cancellations send the
+// patient and doctor a calendar invite. Check-in, start and completion are
+// timed for the doctor's queue.
+func (s *appointmentService) transition(ctx context.Context, appointment *models.Appointment, userID uint, to models.AppointmentStatus, reason string) (*models.AppointmentCharge, error) {
+	if !isAppointmentStatus(to) {
+		return nil, e.NewValidationError(fmt.Sprintf("unknown appointment status %q", to))
+	}
+
+	role, err := s.callerRole(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	from := appointment.Status
+	if err := s.checkTransition(ctx, appointment, userID, role, to); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if to == models.StatusNoShow && now.Before(appointment.StartTime) {
+		return nil, e.NewConflictError("an appointment can only be marked as a no-show once it has started")
+	}
+
+	var charge *models.AppointmentCharge
+	if to == models.StatusCancelled || to == models.StatusNoShow {
+		if charge, err = s.quoteCharge(ctx, appointment, role, to, now); err != nil {
+			return nil, err
+		}
+	}
+
+	if to == models.StatusCancelled {
+		cancelledBy := actingUserID(ctx, userID)
+		appointment.IsCancelled = true
+		appointment.CancelledAt = &now
+		appointment.CancelledBy = &cancelledBy
+	}
+	appointment.Status = to
+	switch to {
+	case models.StatusCheckedIn:
+		appointment.CheckedInAt = &now
+	case models.StatusInProgress:
+		appointment.StartedAt = &now
+	case models.StatusCompleted:
+		appointment.CompletedAt = &now
+	}
+
+	event := newAppointmentEvent(ctx, userID, role, from, to, reason)
+	if err := s.appointmentRepo.TransitionAppointment(appointment, from, event, charge); err != nil {
+		if errors.Is(err, repositories.ErrStatusConflict) {
+			return nil, e.NewConflictError("appointment was updated by someone else, reload it and try again")
+		}
+		return nil, err
+	}
+
+	switch to {
+	case models.StatusConfirmed:
+		go s.sendCalendarUpdate(*appointment, utils.ICalMethodRequest)
+	case models.StatusCancelled:
+		go s.sendCalendarUpdate(*appointment, utils.ICalMethodCancel)
+		s.OfferFreedSlots(ctx, appointment.DoctorID, appointment.StartTime, appointment.EndTime)
+	}
+	s.publishQueue(appointment.DoctorID)
+	return charge, nil
+}
+
+// GetAppointmentHistory returns the status changes of an appointment, oldest
+// first, to its patient and doctor
+func (s *appointmentService) GetAppointmentHistory(ctx context.Context, appointmentID uint, userID uint) ([]models.AppointmentEvent, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsRead); err != nil {
+		return nil, err
+	}
+
+	appointment, err := s.loadAppointment(appointmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.callerRole(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role != models.RoleAdmin && appointment.PatientID != userID && appointment.DoctorID != userID {
+		return nil, e.NewForbiddenError("not authorized to view this appointment")
+	}
+
+	return s.appointmentRepo.GetAppointmentEvents(appointmentID)
+}
+
+func hasRole(roles []models.UserRole, role models.UserRole) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
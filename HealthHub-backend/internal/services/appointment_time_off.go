@@ -0,0 +1,443 @@
+package services
+
+import (
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// a leave's appointments are moved to the first free slot found within
+// timeOffRescheduleDays after it ends
+const timeOffRescheduleDays = 30
+
+// CreateTimeOff records the doctor's leave and returns the open appointments
+// booked in it, which the doctor then resolves with ResolveTimeOff
+func (s *appointmentService) CreateTimeOff(ctx context.Context, doctorID uint, req *models.TimeOffRequest) (*models.TimeOffResult, error) {
+	timeOff, err := req.ToTimeOff(doctorID, s.slots.location(ctx, doctorID))
+	if err != nil {
+		return nil, e.NewValidationError(err.Error())
+	}
+
+	overlapping, err := s.timeOffRepo.FindOverlapping(ctx, doctorID, timeOff.StartTime, timeOff.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	if len(overlapping) > 0 {
+		return nil, e.NewConflictError(fmt.Sprintf("overlaps time off %d from %s to %s", overlapping[0].ID,
+			overlapping[0].StartTime.Format(time.RFC3339), overlapping[0].EndTime.Format(time.RFC3339)))
+	}
+
+	if err := s.timeOffRepo.CreateTimeOff(ctx, timeOff); err != nil {
+		return nil, err
+	}
+
+	affected, err := s.affectedAppointments(doctorID, timeOff.StartTime, timeOff.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TimeOffResult{TimeOff: *timeOff, Affected: affected}, nil
+}
+
+// ListTimeOff returns the doctor's leave that hasn't ended yet
+func (s *appointmentService) ListTimeOff(ctx context.Context, doctorID uint) ([]models.DoctorTimeOff, error) {
+	return s.timeOffRepo.FindDoctorTimeOff(ctx, doctorID, time.Now())
+}
+
+func (s *appointmentService) GetTimeOff(ctx context.Context, timeOffID uint, doctorID uint) (*models.TimeOffResult, error) {
+	timeOff, err := s.findTimeOff(ctx, timeOffID, doctorID)
+	if err != nil {
+		return nil, err
+	}
+
+	affected, err := s.affectedAppointments(doctorID, timeOff.StartTime, timeOff.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TimeOffResult{TimeOff: *timeOff, Affected: affected}, nil
+}
+
+// DeleteTimeOff ends the leave early or calls it off. Its slots are bookable
+// again and offered to the doctor's waitlist.
+func (s *appointmentService) DeleteTimeOff(ctx context.Context, timeOffID uint, doctorID uint) error {
+	timeOff, err := s.findTimeOff(ctx, timeOffID, doctorID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.timeOffRepo.DeleteTimeOff(ctx, timeOff.ID); err != nil {
+		return err
+	}
+
+	start := timeOff.StartTime
+	if now := time.Now(); start.Before(now) {
+		start = now
+	}
+	loc := s.slots.location(ctx, doctorID)
+	for day := utils.StartOfDay(start, loc); day.Before(timeOff.EndTime); day = utils.AddDays(day, 1) {
+		s.OfferFreedSlots(ctx, doctorID, day, utils.AddDays(day, 1))
+	}
+	return nil
+}
+
+// ResolveTimeOff applies the action to the appointments booked in the leave
+func (s *appointmentService) ResolveTimeOff(ctx context.Context, timeOffID uint, doctorID uint, req *models.TimeOffActionRequest) (*models.TimeOffActionResult, error) {
+	timeOff, err := s.findTimeOff(ctx, timeOffID, doctorID)
+	if err != nil {
+		return nil, err
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		reason = "doctor is on leave"
+	}
+	return s.resolveLeave(ctx, doctorID, timeRange{start: timeOff.StartTime, end: timeOff.EndTime}, req, reason)
+}
+
+// GetHolidays lists the upcoming holidays of the calendars the doctor
+// follows, each with the appointments still booked on it
+func (s *appointmentService) GetHolidays(ctx context.Context, doctorID uint) ([]models.HolidayImpact, error) {
+	loc := s.slots.location(ctx, doctorID)
+	holidays, err := s.timeOffRepo.FindUpcomingHolidays(ctx, doctorID, time.Now().In(loc))
+	if err != nil {
+		return nil, err
+	}
+
+	impacts := make([]models.HolidayImpact, 0, len(holidays))
+	for _, holiday := range holidays {
+		day := holidayRange(holiday, loc)
+		affected, err := s.affectedAppointments(doctorID, day.start, day.end)
+		if err != nil {
+			return nil, err
+		}
+		impacts = append(impacts, models.HolidayImpact{Holiday: holiday, Affected: affected})
+	}
+	return impacts, nil
+}
+
+// ResolveHoliday applies the action to the appointments booked on one of the
+// doctor's holidays
+func (s *appointmentService) ResolveHoliday(ctx context.Context, holidayID uint, doctorID uint, req *models.TimeOffActionRequest) (*models.TimeOffActionResult, error) {
+	loc := s.slots.location(ctx, doctorID)
+	holidays, err := s.timeOffRepo.FindUpcomingHolidays(ctx, doctorID, time.Now().In(loc))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, holiday := range holidays {
+		if holiday.ID != holidayID {
+			continue
+		}
+		reason := req.Reason
+		if reason == "" {
+			reason = fmt.Sprintf("clinic is closed for %s", holiday.Name)
+		}
+		return s.resolveLeave(ctx, doctorID, holidayRange(holiday, loc), req, reason)
+	}
+	return nil, e.NewNotFoundError("no upcoming holiday with this ID in the calendars you follow")
+}
+
+// holidayRange is the holiday's calendar day in the doctor's zone
+func holidayRange(holiday models.Holiday, loc *time.Location) timeRange {
+	start := utils.WallTime(holiday.Date.Year(), holiday.Date.Month(), holiday.Date.Day(), 0, 0, loc)
+	return timeRange{start: start, end: utils.AddDays(start, 1)}
+}
+
+func (s *appointmentService) findTimeOff(ctx context.Context, timeOffID uint, doctorID uint) (*models.DoctorTimeOff, error) {
+	timeOff, err := s.timeOffRepo.FindTimeOffByID(ctx, timeOffID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, e.NewNotFoundError("time off not found")
+		}
+		return nil, err
+	}
+	if timeOff.DoctorID != doctorID {
+		return nil, e.NewForbiddenError("not authorized to access this time off")
+	}
+	return timeOff, nil
+}
+
+// affectedAppointments returns the doctor's appointments between start and
+// end that haven't started yet and can still be moved
+func (s *appointmentService) affectedAppointments(doctorID uint, start, end time.Time) ([]models.Appointment, error) {
+	return upcomingBookings(s.appointmentRepo, doctorID, start, end)
+}
+
+// upcomingBookings returns the doctor's pending and confirmed appointments
+// between start and end that haven't started yet
+func upcomingBookings(appointmentRepo repositories.AppointmentRepository, doctorID uint, start, end time.Time) ([]models.Appointment, error) {
+	appointments, err := appointmentRepo.GetAppointmentsByDoctorAndDateRange(doctorID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	upcoming := []models.Appointment{}
+	for _, apt := range appointments {
+		if isReschedulable(apt.Status) && apt.StartTime.After(now) {
+			upcoming = append(upcoming, apt)
+		}
+	}
+	return upcoming, nil
+}
+
+// resolveLeave cancels, moves or hands over the appointments booked while the
+// doctor is away, all of them or those listed in the request. An appointment
+// the action can't be applied to is reported as a conflict and left alone.
+func (s *appointmentService) resolveLeave(ctx context.Context, doctorID uint, leave timeRange, req *models.TimeOffActionRequest, reason string) (*models.TimeOffActionResult, error) {
+	var covering *models.User
+	switch req.Action {
+	case models.TimeOffCancel, models.TimeOffReschedule:
+	case models.TimeOffReassign:
+		if req.CoveringDoctorID == 0 {
+			return nil, e.NewValidationError("covering_doctor_id is required to reassign appointments")
+		}
+		if req.CoveringDoctorID == doctorID {
+			return nil, e.NewValidationError("the covering doctor must be someone else")
+		}
+		doctor, err := s.userRepo.FindByID(ctx, req.CoveringDoctorID)
+		if err != nil || doctor.Role != models.RoleDoctor || !doctor.IsActive {
+			return nil, e.NewValidationError("covering doctor not found")
+		}
+		covering = doctor
+	default:
+		return nil, e.NewValidationError("action must be one of CANCEL, RESCHEDULE or REASSIGN")
+	}
+
+	affected, err := s.affectedAppointments(doctorID, leave.start, leave.end)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := leaveTargets(affected, req.AppointmentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.callerRole(ctx, doctorID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.TimeOffActionResult{
+		Action:       req.Action,
+		Appointments: []models.Appointment{},
+		Conflicts:    []models.TimeOffConflict{},
+	}
+	for i := range targets {
+		appointment := targets[i]
+		before := appointment
+
+		var charge *models.AppointmentCharge
+		switch req.Action {
+		case models.TimeOffCancel:
+			charge, err = s.transition(ctx, &appointment, doctorID, models.StatusCancelled, reason)
+		case models.TimeOffReschedule:
+			err = s.moveOutOfLeave(ctx, &appointment, doctorID, role, leave.end, reason)
+		case models.TimeOffReassign:
+			err = s.reassignAppointment(ctx, &appointment, covering, doctorID, role, reason)
+		}
+		if err != nil {
+			custom, ok := appointmentRefusal(err)
+			if !ok {
+				return nil, err
+			}
+			conflict := models.TimeOffConflict{
+				AppointmentID: before.ID,
+				StartTime:     before.StartTime,
+				EndTime:       before.EndTime,
+				Message:       custom.Message,
+			}
+			if rejection, ok := custom.Details.(models.SlotRejection); ok {
+				conflict.Reason = rejection.Reason
+			}
+			result.Conflicts = append(result.Conflicts, conflict)
+			continue
+		}
+
+		result.Appointments = append(result.Appointments, appointment)
+		if charge != nil {
+			result.Charges = append(result.Charges, *charge)
+		}
+		go s.notifyLeaveChange(before, appointment, req.Action, charge)
+	}
+	return result, nil
+}
+
+// leaveTargets picks the listed appointments out of the affected ones, or
+// all of them when none are listed
+func leaveTargets(affected []models.Appointment, ids []uint) ([]models.Appointment, error) {
+	if len(ids) == 0 {
+		return affected, nil
+	}
+
+	byID := make(map[uint]models.Appointment, len(affected))
+	for _, apt := range affected {
+		byID[apt.ID] = apt
+	}
+	targets := make([]models.Appointment, 0, len(ids))
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		apt, ok := byID[id]
+		if !ok {
+			return nil, e.NewValidationError(fmt.Sprintf("appointment %d is not an open appointment in this time off", id))
+		}
+		if !seen[id] {
+			seen[id] = true
+			targets = append(targets, apt)
+		}
+	}
+	return targets, nil
+}
+
+// moveOutOfLeave rebooks the appointment, at its current length, in the
+// doctor's first free slot after the leave
+func (s *appointmentService) moveOutOfLeave(ctx context.Context, appointment *models.Appointment, doctorID uint, role models.UserRole, after time.Time, reason string) error {
+	length := appointment.EndTime.Sub(appointment.StartTime)
+	slot, err := s.nextFreeSlot(ctx, doctorID, after, length)
+	if err != nil {
+		return err
+	}
+	if slot == nil {
+		return e.NewConflictError(fmt.Sprintf("no free slot within %d days after the time off", timeOffRescheduleDays))
+	}
+
+	next := *appointment
+	next.StartTime = slot.StartTime
+	next.EndTime = slot.StartTime.Add(length)
+	next.Status = models.StatusPending
+
+	booked, err := bookableIn(ctx, s.slots, &next)
+	if err != nil {
+		return err
+	}
+
+	event := newAppointmentEvent(ctx, doctorID, role, appointment.Status, models.StatusPending,
+		fmt.Sprintf("%s, rescheduled from %s to %s", reason,
+			appointment.StartTime.Format(time.RFC3339), next.StartTime.Format(time.RFC3339)))
+	if err := s.appointmentRepo.RebookAppointment(&next, *booked, event); err != nil {
+		return s.bookingError(ctx, &next, err)
+	}
+
+	*appointment = next
+	go s.sendCalendarUpdate(next, utils.ICalMethodRequest)
+	return nil
+}
+
+// nextFreeSlot returns the doctor's first available slot starting after
+// after that is long enough, nil when there is none within
+// timeOffRescheduleDays or the booking window
+func (s *appointmentService) nextFreeSlot(ctx context.Context, doctorID uint, after time.Time, length time.Duration) (*models.TimeSlot, error) {
+	schedules, err := s.slots.loadSchedule(ctx, doctorID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if earliest := now.Add(models.MinAdvanceBooking); after.Before(earliest) {
+		after = earliest
+	}
+	latest := now.Add(s.slots.maxAdvance())
+
+	first := utils.StartOfDay(after, s.slots.location(ctx, doctorID))
+	for i := 0; i <= timeOffRescheduleDays; i++ {
+		day := utils.AddDays(first, i)
+		if day.After(latest) {
+			break
+		}
+		plan, err := s.slots.plan(ctx, doctorID, schedules.on(day), day)
+		if err != nil {
+			return nil, err
+		}
+		for _, slot := range plan.available() {
+			if slot.StartTime.Before(after) || slot.StartTime.Add(length).After(slot.EndTime) {
+				continue
+			}
+			if slot.StartTime.After(latest) {
+				return nil, nil
+			}
+			return &slot, nil
+		}
+	}
+	return nil, nil
+}
+
+// reassignAppointment hands the appointment to the covering doctor at the
+// same time, for them to confirm
+func (s *appointmentService) reassignAppointment(ctx context.Context, appointment *models.Appointment, covering *models.User, doctorID uint, role models.UserRole, reason string) error {
+	next := *appointment
+	next.DoctorID = covering.ID
+	next.Doctor = *covering
+	next.Status = models.StatusPending
+
+	slot, err := bookableIn(ctx, s.slots, &next)
+	if err != nil {
+		return err
+	}
+
+	event := newAppointmentEvent(ctx, doctorID, role, appointment.Status, models.StatusPending,
+		fmt.Sprintf("%s, reassigned from doctor %d to doctor %d", reason, doctorID, covering.ID))
+	if err := s.appointmentRepo.RebookAppointment(&next, *slot, event); err != nil {
+		return s.bookingError(ctx, &next, err)
+	}
+
+	*appointment = next
+	go s.sendCalendarUpdate(next, utils.ICalMethodRequest)
+	return nil
+}
+
+// notifyLeaveChange tells the patient what happened to their appointment
+// because the doctor is away
+func (s *appointmentService) notifyLeaveChange(before, after models.Appointment, action models.TimeOffAction, charge *models.AppointmentCharge) {
+	ctx := context.Background()
+	patient, err := s.userRepo.FindByID(ctx, before.PatientID)
+	if err != nil {
+		log.Printf("Failed to load patient %d for the leave notice of appointment %d: %v", before.PatientID, before.ID, err)
+		return
+	}
+	if before.Doctor.ID == 0 {
+		if doctor, err := s.userRepo.FindByID(ctx, before.DoctorID); err == nil {
+			before.Doctor = *doctor
+		}
+	}
+
+	loc := utils.TimezoneOrUTC(patient.Timezone)
+	when := before.StartTime.In(loc).Format("02 Jan 2006 15:04 MST")
+	var subject, change string
+	switch action {
+	case models.TimeOffCancel:
+		subject = "Appointment Cancelled - HealthHub"
+		change = "It has been cancelled at no charge to you."
+		if charge != nil && charge.RefundAmount > 0 {
+			change = fmt.Sprintf("It has been cancelled at no charge to you, %.2f %s will be refunded.", charge.RefundAmount, charge.Currency)
+		}
+	case models.TimeOffReschedule:
+		subject = "Appointment Rescheduled - HealthHub"
+		change = fmt.Sprintf("It has been moved to %s, the first free slot after their return. If that time doesn't suit you, you can reschedule or cancel it.",
+			after.StartTime.In(loc).Format("02 Jan 2006 15:04 MST"))
+	case models.TimeOffReassign:
+		subject = "Appointment Reassigned - HealthHub"
+		change = fmt.Sprintf("%s will see you instead at the same time. If you would rather not, you can reschedule or cancel it.", doctorName(after.Doctor))
+	}
+
+	body := fmt.Sprintf(`Dear %s,
+
+Your appointment with %s on %s can't go ahead as planned, the doctor is away.
+
+%s
+
+We apologise for the inconvenience.
+
+Best regards,
+HealthHub Team`, patient.Name, doctorName(before.Doctor), when, change)
+
+	if err := utils.SendEmail(patient.Email, subject, body); err != nil {
+		log.Printf("Failed to send leave notice for appointment %d to user %d: %v", before.ID, patient.ID, err)
+	}
+}
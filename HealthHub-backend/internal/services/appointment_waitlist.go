@@ -0,0 +1,389 @@
+package services
+
+import (
+	"HealthHubConnect/env"
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// waitlistDayLag is how far UTC-12, the westernmost zone, trails UTC
+const waitlistDayLag = 12 * time.Hour
+
+// waitlistOfferNotice is what the patient's open websocket connections get
+// when a slot is offered to them
+type waitlistOfferNotice struct {
+	Type    string               `json:"type"`
+	Payload waitlistOfferPayload `json:"payload"`
+}
+
+type waitlistOfferPayload struct {
+	Offer    *models.WaitlistOffer `json:"offer"`
+	ClaimURL string                `json:"claim_url"`
+}
+
+// JoinWaitlist puts the patient in line for the doctor's slots between the
+// request's dates
+func (s *appointmentService) JoinWaitlist(ctx context.Context, patientID uint, req *models.WaitlistRequest) (*models.WaitlistEntry, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsWrite); err != nil {
+		return nil, err
+	}
+
+	patient, err := s.userRepo.FindByID(ctx, patientID)
+	if err != nil {
+		return nil, e.NewNotFoundError("user not found")
+	}
+	if patient.Role != models.RolePatient {
+		return nil, e.NewForbiddenError("only patients can join a waitlist")
+	}
+
+	doctor, err := s.userRepo.FindByID(ctx, req.DoctorID)
+	if err != nil || doctor.Role != models.RoleDoctor {
+		return nil, e.NewNotFoundError("doctor not found")
+	}
+
+	entry, err := req.ToEntry(patientID, s.slots.location(ctx, doctor.ID))
+	if err != nil {
+		return nil, e.NewValidationError(err.Error())
+	}
+
+	waiting, err := s.waitlistRepo.HasOpenEntry(ctx, patientID, entry.DoctorID, entry.FromDate, entry.ToDate)
+	if err != nil {
+		return nil, err
+	}
+	if waiting {
+		return nil, e.NewConflictError("already on this doctor's waitlist for these dates")
+	}
+
+	if err := s.waitlistRepo.CreateEntry(ctx, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (s *appointmentService) GetWaitlist(ctx context.Context, patientID uint) ([]models.WaitlistEntry, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsRead); err != nil {
+		return nil, err
+	}
+	return s.waitlistRepo.FindPatientEntries(ctx, patientID)
+}
+
+// LeaveWaitlist takes the patient off the waitlist. A slot they were offered
+// and haven't claimed goes to the next patient.
+func (s *appointmentService) LeaveWaitlist(ctx context.Context, entryID uint, patientID uint) error {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsWrite); err != nil {
+		return err
+	}
+
+	entry, err := s.waitlistRepo.FindEntryByID(ctx, entryID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return e.NewNotFoundError("waitlist entry not found")
+		}
+		return err
+	}
+	if entry.PatientID != patientID {
+		return e.NewNotFoundError("waitlist entry not found")
+	}
+	if !entry.IsOpen() {
+		return e.NewConflictError(fmt.Sprintf("waitlist entry is already %s", entry.Status))
+	}
+
+	if entry.Status == models.WaitlistOffered {
+		offer, err := s.waitlistRepo.FindPendingOffer(ctx, entry.ID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil {
+			if err := s.closeOffer(ctx, offer, models.OfferWithdrawn, models.WaitlistCancelled); err != nil {
+				return err
+			}
+		}
+	}
+	return s.waitlistRepo.UpdateEntryStatus(ctx, entry.ID, models.WaitlistCancelled)
+}
+
+// GetWaitlistOffer returns the offer behind a claim link
+func (s *appointmentService) GetWaitlistOffer(ctx context.Context, token string, patientID uint) (*models.WaitlistOffer, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsRead); err != nil {
+		return nil, err
+	}
+
+	offer, err := s.findOffer(ctx, token, patientID)
+	if err != nil {
+		return nil, err
+	}
+	if offer.Status == models.OfferPending && !offer.IsClaimable(time.Now()) {
+		offer.Status = models.OfferExpired
+	}
+	return offer, nil
+}
+
+// ClaimWaitlistOffer books the offered slot, held for the patient since the
+// offer was made, with the details given when claiming
+func (s *appointmentService) ClaimWaitlistOffer(ctx context.Context, token string, patientID uint, req *models.ConfirmHoldRequest) (*models.Appointment, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsWrite); err != nil {
+		return nil, err
+	}
+
+	offer, err := s.findOffer(ctx, token, patientID)
+	if err != nil {
+		return nil, err
+	}
+	if !offer.IsClaimable(time.Now()) {
+		return nil, e.NewConflictError("offer has expired or is no longer available")
+	}
+
+	appointment, err := s.ConfirmHold(ctx, offer.HoldID, patientID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	offer.AppointmentID = &appointment.ID
+	if err := s.waitlistRepo.CloseOffer(ctx, offer, models.OfferClaimed, models.WaitlistBooked); err != nil {
+		log.Printf("Failed to close waitlist offer %d after booking appointment %d: %v", offer.ID, appointment.ID, err)
+	}
+	return appointment, nil
+}
+
+// DeclineWaitlistOffer turns the offer down, the patient stays on the
+// waitlist and the slot goes to the next patient straight away
+func (s *appointmentService) DeclineWaitlistOffer(ctx context.Context, token string, patientID uint) error {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsWrite); err != nil {
+		return err
+	}
+
+	offer, err := s.findOffer(ctx, token, patientID)
+	if err != nil {
+		return err
+	}
+	if !offer.IsClaimable(time.Now()) {
+		return e.NewConflictError("offer has expired or is no longer available")
+	}
+	return s.closeOffer(ctx, offer, models.OfferDeclined, models.WaitlistWaiting)
+}
+
+// ExpireWaitlistOffers escalates the offers nobody claimed in time to the
+// next patient in line and closes the entries whose dates are over. It
+// returns how many offers expired.
+func (s *appointmentService) ExpireWaitlistOffers(ctx context.Context, now time.Time) (int, error) {
+	offers, err := s.waitlistRepo.FindExpiredOffers(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for i := range offers {
+		if err := s.closeOffer(ctx, &offers[i], models.OfferExpired, models.WaitlistWaiting); err != nil {
+			if errors.Is(err, repositories.ErrOfferClosed) {
+				continue
+			}
+			return expired, err
+		}
+		expired++
+	}
+
+	// entry dates are days of the doctor's calendar, a day is over in every
+	// zone once it is over in the westernmost one
+	if _, err := s.waitlistRepo.ExpireEntries(ctx, now.UTC().Add(-waitlistDayLag)); err != nil {
+		return expired, err
+	}
+	return expired, nil
+}
+
+// OfferFreedSlots offers every seat that became free between start and end
+// to the doctor's waitlist. Failures are logged, whatever freed the slots
+// has already happened.
+func (s *appointmentService) OfferFreedSlots(ctx context.Context, doctorID uint, start, end time.Time) {
+	plan, err := s.slots.Plan(ctx, doctorID, start.In(s.slots.location(ctx, doctorID)))
+	if err != nil {
+		log.Printf("Failed to plan slots of doctor %d for the waitlist: %v", doctorID, err)
+		return
+	}
+
+	freed := timeRange{start: start, end: end}
+	for _, slot := range plan.available() {
+		if !freed.overlaps(timeRange{start: slot.StartTime, end: slot.EndTime}) {
+			continue
+		}
+		for seat := 0; seat < slot.Remaining; seat++ {
+			offered, err := s.offerSlot(ctx, doctorID, slot)
+			if err != nil {
+				log.Printf("Failed to offer slot %s of doctor %d to the waitlist: %v", slot.StartTime.Format(time.RFC3339), doctorID, err)
+				break
+			}
+			if !offered {
+				break
+			}
+		}
+	}
+}
+
+// offerSlot holds one seat of the slot for the next patient in line and lets
+// them know. It reports false when nobody is waiting for it or it can no
+// longer be booked.
+func (s *appointmentService) offerSlot(ctx context.Context, doctorID uint, slot models.TimeSlot) (bool, error) {
+	entry, err := s.waitlistRepo.NextWaiting(ctx, doctorID, slot.StartTime)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	candidate := &models.Appointment{
+		PatientID: entry.PatientID,
+		DoctorID:  doctorID,
+		StartTime: slot.StartTime,
+		EndTime:   slot.EndTime,
+	}
+	seat, err := s.bookableSlot(ctx, candidate)
+	if err != nil {
+		var customErr *e.CustomError
+		if errors.As(err, &customErr) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	token, err := utils.NewRandomID()
+	if err != nil {
+		return false, err
+	}
+
+	expiresAt := time.Now().Add(models.WaitlistClaimWindow)
+	hold := &models.SlotHold{
+		PatientID: entry.PatientID,
+		DoctorID:  doctorID,
+		StartTime: slot.StartTime,
+		EndTime:   slot.EndTime,
+		Status:    models.HoldActive,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.appointmentRepo.CreateHold(hold, *seat); err != nil {
+		if errors.Is(err, repositories.ErrSlotFull) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	offer := &models.WaitlistOffer{
+		EntryID:   entry.ID,
+		PatientID: entry.PatientID,
+		DoctorID:  doctorID,
+		StartTime: slot.StartTime,
+		EndTime:   slot.EndTime,
+		HoldID:    hold.ID,
+		Token:     token,
+		Status:    models.OfferPending,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.waitlistRepo.CreateOffer(ctx, offer); err != nil {
+		if releaseErr := s.appointmentRepo.ReleaseHold(hold); releaseErr != nil {
+			log.Printf("Failed to release hold %d of a failed waitlist offer: %v", hold.ID, releaseErr)
+		}
+		return false, err
+	}
+
+	s.notifyWaitlistOffer(ctx, offer)
+	return true, nil
+}
+
+// closeOffer gives up the offer's hold and passes the slot on to the next
+// patient in line
+func (s *appointmentService) closeOffer(ctx context.Context, offer *models.WaitlistOffer, status models.WaitlistOfferStatus, entryStatus models.WaitlistStatus) error {
+	if err := s.waitlistRepo.CloseOffer(ctx, offer, status, entryStatus); err != nil {
+		return err
+	}
+
+	hold, err := s.appointmentRepo.GetHoldByID(offer.HoldID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err == nil && hold.Status == models.HoldActive {
+		if err := s.appointmentRepo.ReleaseHold(hold); err != nil {
+			return err
+		}
+	}
+
+	s.OfferFreedSlots(ctx, offer.DoctorID, offer.StartTime, offer.EndTime)
+	return nil
+}
+
+func (s *appointmentService) findOffer(ctx context.Context, token string, patientID uint) (*models.WaitlistOffer, error) {
+	offer, err := s.waitlistRepo.FindOfferByToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, e.NewNotFoundError("offer not found")
+		}
+		return nil, err
+	}
+	if offer.PatientID != patientID {
+		return nil, e.NewNotFoundError("offer not found")
+	}
+	return offer, nil
+}
+
+func waitlistClaimURL(token string) string {
+	return fmt.Sprintf("%s/waitlist/offers/%s", env.FrontendConfig.BaseURL, token)
+}
+
+// notifyWaitlistOffer sends the claim link by email and to any websocket
+// connection the patient has open
+func (s *appointmentService) notifyWaitlistOffer(ctx context.Context, offer *models.WaitlistOffer) {
+	claimURL := waitlistClaimURL(offer.Token)
+
+	if s.wsManager != nil {
+		message, err := json.Marshal(waitlistOfferNotice{
+			Type:    "waitlist_offer",
+			Payload: waitlistOfferPayload{Offer: offer, ClaimURL: claimURL},
+		})
+		if err != nil {
+			log.Printf("Failed to encode waitlist offer %d: %v", offer.ID, err)
+		} else {
+			for _, client := range s.wsManager.GetClientsByUserID(offer.PatientID) {
+				select {
+				case client.Send <- message:
+				default:
+				}
+			}
+		}
+	}
+
+	patient, err := s.userRepo.FindByID(ctx, offer.PatientID)
+	if err != nil {
+		log.Printf("Failed to load patient %d for waitlist offer %d: %v", offer.PatientID, offer.ID, err)
+		return
+	}
+
+	loc := utils.TimezoneOrUTC(patient.Timezone)
+	subject := "An appointment slot opened up - HealthHub"
+	body := fmt.Sprintf(`Dear %s,
+
+A slot you are waiting for has opened up: %s to %s.
+
+We are keeping it for you until %s. To book it, open:
+%s
+
+If you don't claim it by then, it will be offered to the next patient on the waitlist and you will stay on the waitlist.
+
+Best regards,
+HealthHub Team`, patient.Name,
+		offer.StartTime.In(loc).Format("02 Jan 2006 15:04"),
+		offer.EndTime.In(loc).Format("15:04 MST"),
+		offer.ExpiresAt.In(loc).Format("02 Jan 2006 15:04 MST"),
+		claimURL)
+
+	if err := utils.SendEmail(patient.Email, subject, body); err != nil {
+		log.Printf("Failed to send waitlist offer email to user %d: %v", patient.ID, err)
+	}
+}
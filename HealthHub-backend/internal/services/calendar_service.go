@@ -0,0 +1,266 @@
+package services
+
+import (
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CalendarService serves each patient's and doctor's upcoming appointments
+// as an iCalendar feed behind a secret token
+type CalendarService struct {
+	calendarRepo    *repositories.CalendarRepository
+	appointmentRepo repositories.AppointmentRepository
+	userRepo        *repositories.UserRepository
+}
+
+func NewCalendarService(calendarRepo *repositories.CalendarRepository, appointmentRepo repositories.AppointmentRepository, userRepo *repositories.UserRepository) *CalendarService {
+	return &CalendarService{
+		calendarRepo:    calendarRepo,
+		appointmentRepo: appointmentRepo,
+		userRepo:        userRepo,
+	}
+}
+
+func (s *CalendarService) GetFeed(ctx context.Context, userID uint) (*models.CalendarFeed, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsRead); err != nil {
+		return nil, err
+	}
+
+	feed, err := s.calendarRepo.FindFeedByUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, e.NewNotFoundError("no calendar feed, create one first")
+		}
+		return nil, err
+	}
+	return feed, nil
+}
+
+// RotateFeed gives the user a feed with a fresh token, the old token stops
+// working straight away
+func (s *CalendarService) RotateFeed(ctx context.Context, userID uint) (*models.CalendarFeed, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsWrite); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, e.NewNotFoundError("user not found")
+	}
+	if user.Role != models.RolePatient && user.Role != models.RoleDoctor {
+		return nil, e.NewForbiddenError("only patients and doctors have a calendar feed")
+	}
+
+	token, err := utils.NewRandomID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	feed := &models.CalendarFeed{UserID: userID, Token: token, CreatedAt: now, UpdatedAt: now}
+	if err := s.calendarRepo.SaveFeed(ctx, feed); err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
+
+func (s *CalendarService) RevokeFeed(ctx context.Context, userID uint) error {
+	if err := requireDelegatedScope(ctx, models.ScopeAppointmentsWrite); err != nil {
+		return err
+	}
+
+	deleted, err := s.calendarRepo.DeleteFeed(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return e.NewNotFoundError("no calendar feed")
+	}
+	return nil
+}
+
+// Feed renders the upcoming appointments of the token's owner. Doctors get
+// what GetDoctorUpcomingAppointments lists, patients their own upcoming
+// appointments.
+func (s *CalendarService) Feed(ctx context.Context, token string) ([]byte, error) {
+	feed, err := s.calendarRepo.FindFeedByToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, e.NewNotFoundError("calendar feed not found")
+		}
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(ctx, feed.UserID)
+	if err != nil {
+		return nil, e.NewNotFoundError("calendar feed not found")
+	}
+
+	today := utils.StartOfDay(time.Now(), utils.TimezoneOrUTC(user.Timezone))
+	var appointments []models.Appointment
+	switch user.Role {
+	case models.RoleDoctor:
+		appointments, err = s.appointmentRepo.GetDoctorUpcomingAppointments(user.ID, today)
+	case models.RolePatient:
+		appointments, err = s.appointmentRepo.GetPatientUpcomingAppointments(user.ID, today)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]utils.ICalEvent, 0, len(appointments))
+	for i := range appointments {
+		sequence, err := appointmentSequence(s.appointmentRepo, appointments[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, appointmentICalEvent(&appointments[i], user.Role, sequence))
+	}
+
+	return utils.BuildICalendar("HealthHub appointments", "", events, time.Now()), nil
+}
+
+// appointmentSequence numbers the versions of an appointment's calendar
+// entry by the changes in its history
+func appointmentSequence(appointmentRepo repositories.AppointmentRepository, appointmentID uint) (int, error) {
+	events, err := appointmentRepo.GetAppointmentEvents(appointmentID)
+	if err != nil {
+		return 0, err
+	}
+	return len(events), nil
+}
+
+// appointmentICalEvent describes the appointment as seen by the patient or
+// by the doctor. The UID stays the same for the life of the appointment.
+func appointmentICalEvent(appointment *models.Appointment, viewer models.UserRole, sequence int) utils.ICalEvent {
+	summary := "Appointment with " + doctorName(appointment.Doctor)
+	if viewer == models.RoleDoctor {
+		summary = "Appointment with " + strings.TrimSpace(appointment.Patient.Name)
+	}
+
+	var details []string
+	if appointment.Description != "" {
+		details = append(details, appointment.Description)
+	}
+	event := utils.ICalEvent{
+		UID:      fmt.Sprintf("appointment-%d@healthhub", appointment.ID),
+		Sequence: sequence,
+		Start:    appointment.StartTime,
+		End:      appointment.EndTime,
+		Summary:  summary,
+		Status:   appointmentICalStatus(appointment.Status),
+	}
+	if appointment.Type == models.TypeOnline {
+		event.Location = "Online consultation"
+		if appointment.MeetLink != "" {
+			event.URL = appointment.MeetLink
+			details = append(details, "Join the call at: "+appointment.MeetLink)
+		}
+	} else {
+		event.Location = appointment.Address
+	}
+	event.Description = strings.Join(details, "\n\n")
+
+	if appointment.Doctor.Email != "" {
+		event.Organizer = &utils.ICalPerson{Name: doctorName(appointment.Doctor), Email: appointment.Doctor.Email}
+	}
+	if appointment.Patient.Email != "" {
+		event.Attendees = []utils.ICalPerson{{Name: appointment.Patient.Name, Email: appointment.Patient.Email}}
+	}
+	return event
+}
+
+func appointmentICalStatus(status models.AppointmentStatus) string {
+	switch status {
+	case models.StatusPending:
+		return "TENTATIVE"
+	case models.StatusCancelled, models.StatusNoShow:
+		return "CANCELLED"
+	}
+	return "CONFIRMED"
+}
+
+func doctorName(doctor models.User) string {
+	name := strings.TrimSpace(doctor.Name)
+	if name == "" {
+		return "your doctor"
+	}
+	return "Dr. " + name
+}
+
+// sendCalendarUpdate emails the patient and the doctor an .ics invite for
+// the appointment, METHOD:REQUEST adds or updates the entry in their calendar
+// and METHOD:CANCEL removes it
+func (s *appointmentService) sendCalendarUpdate(appointment models.Appointment, method string) {
+	ctx := context.Background()
+	if appointment.Patient.Email == "" {
+		if patient, err := s.userRepo.FindByID(ctx, appointment.PatientID); err == nil {
+			appointment.Patient = *patient
+		}
+	}
+	if appointment.Doctor.Email == "" {
+		if doctor, err := s.userRepo.FindByID(ctx, appointment.DoctorID); err == nil {
+			appointment.Doctor = *doctor
+		}
+	}
+
+	sequence, err := appointmentSequence(s.appointmentRepo, appointment.ID)
+	if err != nil {
+		log.Printf("Failed to load history of appointment %d for its invite: %v", appointment.ID, err)
+		return
+	}
+
+	for _, recipient := range []struct {
+		user models.User
+		role models.UserRole
+	}{
+		{appointment.Patient, models.RolePatient},
+		{appointment.Doctor, models.RoleDoctor},
+	} {
+		if recipient.user.Email == "" {
+			continue
+		}
+
+		event := appointmentICalEvent(&appointment, recipient.role, sequence)
+		when := appointment.StartTime.In(utils.TimezoneOrUTC(recipient.user.Timezone)).Format("02 Jan 2006 15:04 MST")
+		subject := "Appointment Updated - HealthHub"
+		intro := fmt.Sprintf("Your appointment on %s has been updated.", when)
+		switch {
+		case method == utils.ICalMethodCancel:
+			subject = "Appointment Cancelled - HealthHub"
+			intro = fmt.Sprintf("Your appointment on %s has been cancelled.", when)
+		case appointment.Status == models.StatusConfirmed:
+			subject = "Appointment Confirmed - HealthHub"
+			intro = fmt.Sprintf("Your appointment on %s is confirmed.", when)
+		}
+
+		body := fmt.Sprintf(`Dear %s,
+
+%s
+%s
+
+The attached invite keeps your calendar up to date.
+
+Best regards,
+HealthHub Team`, recipient.user.Name, intro, event.Summary)
+
+		invite := utils.EmailAttachment{
+			Filename:    "invite.ics",
+			ContentType: fmt.Sprintf("text/calendar; charset=\"utf-8\"; method=%s", method),
+			Content:     utils.BuildICalendar("", method, []utils.ICalEvent{event}, time.Now()),
+		}
+		if err := utils.SendEmailWithAttachment(recipient.user.Email, subject, body, invite); err != nil {
+			log.Printf("Failed to send calendar invite for appointment %d to user %d: %v", appointment.ID, recipient.user.ID, err)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	delegationMaxTTL = 365 * 24 * time.Hour
+	adultAge         = 18
+)
+
+type GrantDelegationInput struct {
+	DelegateEmail string     `json:"delegate_email" validate:"required,email"`
+	Relationship  string     `json:"relationship"`
+	Scopes        []string   `json:"scopes" validate:"required"`
+	StartsAt      *time.Time `json:"starts_at"` // defaults to now
+	ExpiresAt     time.Time  `json:"expires_at" validate:"required"`
+}
+
+// DelegationService manages the grants that let caregivers act on behalf of
+// a patient and resolves the X-Act-As header against them.
+type DelegationService struct {
+	delegationRepo *repositories.DelegationRepository
+	userRepo       *repositories.UserRepository
+	healthRepo     *repositories.HealthRepository
+	adminRepo      *repositories.AdminRepository
+}
+
+func NewDelegationService(delegationRepo *repositories.DelegationRepository, userRepo *repositories.UserRepository, healthRepo *repositories.HealthRepository, adminRepo *repositories.AdminRepository) *DelegationService {
+	return &DelegationService{
+		delegationRepo: delegationRepo,
+		userRepo:       userRepo,
+		healthRepo:     healthRepo,
+		adminRepo:      adminRepo,
+	}
+}
+
+// requireDelegatedScope passes unless the request is made on behalf of
+// another user by a caregiver whose grant does not include the scope
+func requireDelegatedScope(ctx context.Context, scope string) error {
+	principal, err := utils.GetPrincipalFromContext(ctx)
+	if err != nil || !principal.IsDelegated() {
+		return nil
+	}
+	if !principal.HasScope(scope) {
+		return e.NewForbiddenError(fmt.Sprintf("your delegated access does not include %s", scope))
+	}
+	return nil
+}
+
+// actingUserID is the user actually making the request, the caregiver when
+// acting on behalf of someone
+func actingUserID(ctx context.Context, userID uint) uint {
+	if principal, err := utils.GetPrincipalFromContext(ctx); err == nil && principal.IsDelegated() {
+		return principal.ActorID
+	}
+	return userID
+}
+
+func isDelegationScope(scope string) bool {
+	for _, known := range models.DelegationScopes {
+		if known == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// withImpliedScopes adds the read scope for every write scope granted, since
+// changing records through the API always reads them first
+func withImpliedScopes(scopes []string) []string {
+	implied := map[string]string{
+		models.ScopeAppointmentsWrite: models.ScopeAppointmentsRead,
+		models.ScopeHealthWrite:       models.ScopeHealthRead,
+	}
+
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		for _, s := range []string{scope, implied[scope]} {
+			if s != "" && !seen[s] {
+				seen[s] = true
+				result = append(result, s)
+			}
+		}
+	}
+	return result
+}
+
+// Grant lets the patient give a caregiver access to their own account
+func (s *DelegationService) Grant(ctx context.Context, patientID uint, input GrantDelegationInput) (*models.Delegation, error) {
+	patient, err := s.userRepo.FindByID(ctx, patientID)
+	if err != nil {
+		return nil, e.NewNotFoundError("user not found")
+	}
+	if patient.Role != models.RolePatient {
+		return nil, e.NewForbiddenError("only patients can grant delegated access")
+	}
+
+	delegation, err := s.grant(ctx, patient, patientID, input)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, &models.AuditLog{
+		ActorID:    patientID,
+		Action:     "grant",
+		EntityType: "DELEGATION",
+		EntityID:   delegation.ID,
+	}, delegation)
+	return delegation, nil
+}
+
+// GrantForMinor lets an admin set up a guardian's access to a minor's account
+func (s *DelegationService) GrantForMinor(ctx context.Context, adminID, patientID uint, input GrantDelegationInput) (*models.Delegation, error) {
+	patient, err := s.userRepo.FindByID(ctx, patientID)
+	if err != nil {
+		return nil, e.NewNotFoundError("patient not found")
+	}
+	if patient.Role != models.RolePatient {
+		return nil, e.NewValidationError("delegated access can only be granted to a patient's account")
+	}
+
+	minor, err := s.isMinor(ctx, patientID)
+	if err != nil {
+		return nil, err
+	}
+	if !minor {
+		return nil, e.NewForbiddenError("adult patients have to grant delegated access themselves")
+	}
+
+	delegation, err := s.grant(ctx, patient, adminID, input)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, &models.AuditLog{
+		AdminID:    adminID,
+		Action:     "grant",
+		EntityType: "DELEGATION",
+		EntityID:   delegation.ID,
+	}, delegation)
+	return delegation, nil
+}
+
+func (s *DelegationService) isMinor(ctx context.Context, patientID uint) (bool, error) {
+	profile, err := s.healthRepo.GetHealthProfile(ctx, patientID)
+	if err != nil || profile.DateOfBirth.IsZero() {
+		return false, e.NewValidationError("the patient's date of birth is not on record")
+	}
+	return profile.DateOfBirth.AddDate(adultAge, 0, 0).After(time.Now()), nil
+}
+
+func (s *DelegationService) grant(ctx context.Context, patient *models.User, grantedBy uint, input GrantDelegationInput) (*models.Delegation, error) {
+	if len(input.Scopes) == 0 {
+		return nil, e.NewValidationError("at least one scope is required")
+	}
+	for _, scope := range input.Scopes {
+		if !isDelegationScope(scope) {
+			return nil, e.NewValidationError(fmt.Sprintf("unknown scope: %s", scope))
+		}
+	}
+
+	delegate, err := s.userRepo.FindByEmail(ctx, strings.TrimSpace(input.DelegateEmail))
+	if err != nil || delegate == nil {
+		return nil, e.NewNotFoundError("no user with that email")
+	}
+	if delegate.ID == patient.ID {
+		return nil, e.NewValidationError("you cannot delegate access to yourself")
+	}
+	if !delegate.IsActive {
+		return nil, e.NewValidationError("the delegate's account is not active")
+	}
+
+	now := time.Now()
+	startsAt := now
+	if input.StartsAt != nil && input.StartsAt.After(now) {
+		startsAt = *input.StartsAt
+	}
+	if !input.ExpiresAt.After(startsAt) {
+		return nil, e.NewValidationError("expires_at must be after the start of the grant")
+	}
+	if input.ExpiresAt.Sub(startsAt) > delegationMaxTTL {
+		return nil, e.NewValidationError(fmt.Sprintf("delegated access can last at most %d days", int(delegationMaxTTL.Hours()/24)))
+	}
+
+	overlapping, err := s.delegationRepo.HasOverlapping(ctx, patient.ID, delegate.ID, startsAt, input.ExpiresAt)
+	if err != nil {
+		return nil, e.NewInternalError()
+	}
+	if overlapping {
+		return nil, e.NewConflictError("this user already has delegated access for that period, revoke it first")
+	}
+
+	delegation := &models.Delegation{
+		PatientID:    patient.ID,
+		DelegateID:   delegate.ID,
+		Relationship: strings.TrimSpace(input.Relationship),
+		Scopes:       withImpliedScopes(input.Scopes),
+		GrantedBy:    grantedBy,
+		StartsAt:     startsAt,
+		ExpiresAt:    input.ExpiresAt,
+	}
+	if err := s.delegationRepo.Create(ctx, delegation); err != nil {
+		return nil, e.NewInternalError()
+	}
+	return delegation, nil
+}
+
+// ListGranted returns the grants on the patient's account
+func (s *DelegationService) ListGranted(ctx context.Context, patientID uint) ([]models.Delegation, error) {
+	delegations, err := s.delegationRepo.ListByPatient(ctx, patientID)
+	if err != nil {
+		return nil, e.NewInternalError()
+	}
+	return delegations, nil
+}
+
+// ListReceived returns the grants that let the user act for others
+func (s *DelegationService) ListReceived(ctx context.Context, delegateID uint) ([]models.Delegation, error) {
+	delegations, err := s.delegationRepo.ListByDelegate(ctx, delegateID)
+	if err != nil {
+		return nil, e.NewInternalError()
+	}
+	return delegations, nil
+}
+
+// Revoke ends a grant, either the patient or the caregiver may do so
+func (s *DelegationService) Revoke(ctx context.Context, userID, delegationID uint) error {
+	delegation, err := s.delegationRepo.FindByID(ctx, delegationID)
+	if err != nil || (delegation.PatientID != userID && delegation.DelegateID != userID) {
+		return e.NewNotFoundError("delegation not found")
+	}
+	if err := s.revoke(ctx, delegationID, userID); err != nil {
+		return err
+	}
+
+	s.audit(ctx, &models.AuditLog{
+		ActorID:    userID,
+		Action:     "revoke",
+		EntityType: "DELEGATION",
+		EntityID:   delegationID,
+	}, nil)
+	return nil
+}
+
+func (s *DelegationService) RevokeAsAdmin(ctx context.Context, adminID, delegationID uint) error {
+	if _, err := s.delegationRepo.FindByID(ctx, delegationID); err != nil {
+		return e.NewNotFoundError("delegation not found")
+	}
+	if err := s.revoke(ctx, delegationID, adminID); err != nil {
+		return err
+	}
+
+	s.audit(ctx, &models.AuditLog{
+		AdminID:    adminID,
+		Action:     "revoke",
+		EntityType: "DELEGATION",
+		EntityID:   delegationID,
+	}, nil)
+	return nil
+}
+
+func (s *DelegationService) revoke(ctx context.Context, delegationID, revokedBy uint) error {
+	revoked, err := s.delegationRepo.Revoke(ctx, delegationID, revokedBy)
+	if err != nil {
+		return e.NewInternalError()
+	}
+	if !revoked {
+		return e.NewConflictError("delegation was already revoked")
+	}
+	return nil
+}
+
+// ResolveActAs checks that the caller holds a live grant for the subject and
+// returns the principal the request then runs as
+func (s *DelegationService) ResolveActAs(ctx context.Context, caller *models.Principal, subjectID uint) (*models.Principal, error) {
+	if subjectID == caller.UserID {
+		return nil, e.NewValidationError("you cannot act on behalf of yourself")
+	}
+
+	delegation, err := s.delegationRepo.FindActive(ctx, subjectID, caller.UserID, time.Now())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, e.NewForbiddenError("you have no active delegated access to this user")
+		}
+		return nil, e.NewInternalError()
+	}
+
+	subject, err := s.userRepo.FindByID(ctx, subjectID)
+	if err != nil || !subject.IsActive {
+		return nil, e.NewForbiddenError("you have no active delegated access to this user")
+	}
+
+	return &models.Principal{
+		Type:         models.PrincipalUser,
+		UserID:       subject.ID,
+		Role:         subject.Role,
+		Scopes:       delegation.Scopes,
+		ActorID:      caller.UserID,
+		DelegationID: delegation.ID,
+	}, nil
+}
+
+// RecordActAs writes the audit entry for a request made on behalf of someone
+func (s *DelegationService) RecordActAs(ctx context.Context, principal *models.Principal, method, path string) {
+	s.audit(ctx, &models.AuditLog{
+		ActorID:      principal.ActorID,
+		OnBehalfOfID: principal.UserID,
+		Action:       "act_as",
+		EntityType:   "DELEGATION",
+		EntityID:     principal.DelegationID,
+	}, map[string]string{"method": method, "path": path})
+}
+
+func (s *DelegationService) audit(ctx context.Context, entry *models.AuditLog, changes interface{}) {
+	if changes != nil {
+		changesJSON, _ := json.Marshal(changes)
+		entry.Changes = string(changesJSON)
+	}
+	entry.IPAddress = clientIPFromContext(ctx)
+	entry.Timestamp = time.Now()
+	entry.Status = models.AuditSuccess
+
+	if err := s.adminRepo.CreateAuditLog(ctx, entry); err != nil {
+		log.Printf("Failed to create audit log: %v", err)
+	}
+}
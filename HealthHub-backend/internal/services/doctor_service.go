@@ -4,6 +4,7 @@ import (
 	e "HealthHubConnect/internal/errors"
 	"HealthHubConnect/internal/models"
 	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/utils"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -11,29 +12,45 @@ import (
 	"math"
 	"strings"
 	"time"
-
-	"gorm.io/gorm"
 )
 
+// slotOfferer hands slots that became free to the doctor's waitlist
+type slotOfferer interface {
+	OfferFreedSlots(ctx context.Context, doctorID uint, start, end time.Time)
+}
+
 type DoctorService struct {
 	doctorRepo       *repositories.DoctorRepository
 	appointmentRepo  repositories.AppointmentRepository
 	prescriptionRepo *repositories.PrescriptionRepository
+	timeOffRepo      *repositories.TimeOffRepository
+	waitlist         slotOfferer
+	slots            *slotEngine
 }
 
+// NewDoctorService builds the service, waitlist may be nil where freed slots
+// don't need offering
 func NewDoctorService(
 	doctorRepo *repositories.DoctorRepository,
 	appointmentRepo repositories.AppointmentRepository,
 	prescriptionRepo *repositories.PrescriptionRepository,
+	timeOffRepo *repositories.TimeOffRepository,
+	waitlist slotOfferer,
 ) *DoctorService {
 	return &DoctorService{
 		doctorRepo:       doctorRepo,
 		appointmentRepo:  appointmentRepo,
 		prescriptionRepo: prescriptionRepo,
+		timeOffRepo:      timeOffRepo,
+		waitlist:         waitlist,
+		slots:            newSlotEngine(doctorRepo, appointmentRepo, timeOffRepo),
 	}
 }
 
 func (s *DoctorService) SaveProfile(ctx context.Context, profile *models.DoctorProfile) error {
+	if err := validateTimezone(profile.Timezone); err != nil {
+		return err
+	}
 	return s.doctorRepo.SaveProfile(ctx, profile)
 }
 
@@ -42,76 +59,105 @@ func (s *DoctorService) GetProfile(ctx context.Context, userID uint) (*models.Do
 }
 
 func (s *DoctorService) UpdateProfile(ctx context.Context, profile *models.DoctorProfile) error {
+	if err := validateTimezone(profile.Timezone); err != nil {
+		return err
+	}
 	return s.doctorRepo.UpdateProfile(ctx, profile)
 }
 
+// validateTimezone accepts an IANA zone name, or none to use the doctor's
+// account timezone
+func validateTimezone(name string) error {
+	if _, err := utils.LoadTimezone(name); err != nil {
+		return e.NewValidationError(fmt.Sprintf("unknown timezone %q, use an IANA name such as Europe/London", name))
+	}
+	return nil
+}
+
 func (s *DoctorService) DeleteProfile(ctx context.Context, userID uint) error {
 	return s.doctorRepo.DeleteProfile(ctx, userID)
 }
 
-func (s *DoctorService) generateAvailabilitySlots(doctorID uint, schedule models.Schedule, startDate time.Time, weeks int) ([]models.DoctorAvailability, error) {
+// generateAvailabilitySlots lays the slots of the schedule in force each day
+// out over the weeks from startDate
+func (s *DoctorService) generateAvailabilitySlots(doctorID uint, schedules *scheduleSet, startDate time.Time, weeks int) ([]models.DoctorAvailability, error) {
 	var availabilities []models.DoctorAvailability
 
-	for week := 0; week < weeks; week++ {
-		for dayName, daySchedule := range schedule.Days {
-			if !daySchedule.Enabled {
-				continue
-			}
-
-			nextDate := startDate
-			for nextDate.Weekday().String() != strings.Title(dayName) {
-				nextDate = nextDate.AddDate(0, 0, 1)
-			}
+	for i := 0; i < 7*weeks; i++ {
+		nextDate := startDate.AddDate(0, 0, i)
+		daySchedule, exists := schedules.on(nextDate).Days[strings.ToLower(nextDate.Weekday().String())]
+		if !exists || !daySchedule.Enabled {
+			continue
+		}
 
-			nextDate = nextDate.AddDate(0, 0, 7*week)
-
-			for _, slot := range daySchedule.Slots {
-				startTime, _ := time.Parse("15:04", slot.Start)
-				endTime, _ := time.Parse("15:04", slot.End)
-
-				availability := models.DoctorAvailability{
-					DoctorID: doctorID,
-					Date:     nextDate,
-					StartTime: time.Date(nextDate.Year(), nextDate.Month(), nextDate.Day(),
-						startTime.Hour(), startTime.Minute(), 0, 0, nextDate.Location()),
-					EndTime: time.Date(nextDate.Year(), nextDate.Month(), nextDate.Day(),
-						endTime.Hour(), endTime.Minute(), 0, 0, nextDate.Location()),
-				}
-				availabilities = append(availabilities, availability)
+		for _, slot := range daySchedule.Slots {
+			startTime, _ := time.Parse("15:04", slot.Start)
+			endTime, _ := time.Parse("15:04", slot.End)
+
+			availability := models.DoctorAvailability{
+				DoctorID: doctorID,
+				Date:     nextDate,
+				StartTime: time.Date(nextDate.Year(), nextDate.Month(), nextDate.Day(),
+					startTime.Hour(), startTime.Minute(), 0, 0, nextDate.Location()),
+				EndTime: time.Date(nextDate.Year(), nextDate.Month(), nextDate.Day(),
+					endTime.Hour(), endTime.Minute(), 0, 0, nextDate.Location()),
 			}
+			availabilities = append(availabilities, availability)
 		}
 	}
 
 	return availabilities, nil
 }
 
-func (s *DoctorService) SaveSchedule(ctx context.Context, doctorID uint, req *models.ScheduleRequest) error {
+// SaveSchedule replaces the weekly schedule from today on and records it in
+// the version history. Like a template it is refused when it would orphan
+// booked appointments, unless the request allows it.
+func (s *DoctorService) SaveSchedule(ctx context.Context, doctorID uint, req *models.ScheduleRequest) (*models.ScheduleImpact, error) {
 	scheduleJSON, err := json.Marshal(req.Schedule)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	scheduleJSONString, err := json.Marshal(string(scheduleJSON))
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if req.Policies.CancellationFee < 0 || req.Policies.NoShowFee < 0 {
+		return nil, e.NewValidationError("cancellation and no-show fees cannot be negative")
+	}
+	if req.Policies.CancellationTimeframe != "" && parseTimeframe(req.Policies.CancellationTimeframe) <= 0 {
+		return nil, e.NewValidationError("cancellation timeframe must be a duration such as \"24 hours\" or \"2 days\"")
+	}
+	policiesJSON, err := json.Marshal(req.Policies)
+	if err != nil {
+		return nil, err
+	}
+
+	set, impact, err := s.previewVersion(ctx, doctorID, &models.ScheduleTemplateRequest{Schedule: req.Schedule})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOrphans(impact, req.AllowOrphans); err != nil {
+		return nil, err
 	}
 
 	schedule := &models.DoctorSchedule{
 		DoctorID: doctorID,
 		Schedule: string(scheduleJSONString),
+		Policies: string(policiesJSON),
 	}
 
-	if err := s.doctorRepo.SaveSchedule(ctx, schedule); err != nil {
-		return err
+	version := impact.Version
+	if err := s.doctorRepo.SaveSchedule(ctx, schedule, &version); err != nil {
+		return nil, err
 	}
+	impact.Version = version
 
-	startDate := time.Now().Truncate(24 * time.Hour)
-	availabilities, err := s.generateAvailabilitySlots(doctorID, req.Schedule, startDate, 12)
-	if err != nil {
-		return err
+	if err := s.regenerateAvailability(ctx, doctorID, set.with(&version)); err != nil {
+		return nil, err
 	}
-
-	return s.doctorRepo.SaveBulkAvailability(ctx, availabilities)
+	return impact, nil
 }
 
 func (s *DoctorService) GetSchedule(ctx context.Context, doctorID uint) (*models.ScheduleResponse, error) {
@@ -120,13 +166,14 @@ func (s *DoctorService) GetSchedule(ctx context.Context, doctorID uint) (*models
 		return nil, err
 	}
 
-	var parsedSchedule models.Schedule
-	if err := json.Unmarshal([]byte(schedule.Schedule), &parsedSchedule); err != nil {
-		var rawSchedule string
-		if err := json.Unmarshal([]byte(schedule.Schedule), &rawSchedule); err != nil {
-			return nil, err
-		}
-		if err := json.Unmarshal([]byte(rawSchedule), &parsedSchedule); err != nil {
+	parsedSchedule, err := parseSchedule(schedule.Schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	var policies models.DoctorPolicies
+	if schedule.Policies != "" {
+		if err := json.Unmarshal([]byte(schedule.Policies), &policies); err != nil {
 			return nil, err
 		}
 	}
@@ -134,14 +181,19 @@ func (s *DoctorService) GetSchedule(ctx context.Context, doctorID uint) (*models
 	return &models.ScheduleResponse{
 		ID:        schedule.ID,
 		DoctorID:  schedule.DoctorID,
-		Schedule:  parsedSchedule,
+		Schedule:  *parsedSchedule,
+		Policies:  policies,
 		CreatedAt: schedule.CreatedAt,
 		UpdatedAt: schedule.UpdatedAt,
 	}, nil
 }
 
 func (s *DoctorService) ExtendAvailability(ctx context.Context, doctorID uint, weeksToAdd int) error {
-	schedule, err := s.GetSchedule(ctx, doctorID)
+	if err := s.doctorRepo.ValidateDoctorAccess(ctx, doctorID); err != nil {
+		return err
+	}
+
+	schedules, err := s.slots.loadSchedule(ctx, doctorID)
 	if err != nil {
 		return err
 	}
@@ -152,8 +204,8 @@ func (s *DoctorService) ExtendAvailability(ctx context.Context, doctorID uint, w
 	}
 
 	startDate := lastAvailability.Date.AddDate(0, 0, 1)
-	availabilities, err := s.generateAvailabilitySlots(doctorID, schedule.Schedule, startDate, weeksToAdd)
-	if err != nil {
+	availabilities, err := s.generateAvailabilitySlots(doctorID, schedules, startDate, weeksToAdd)
+	if err != nil || len(availabilities) == 0 {
 		return err
 	}
 
@@ -176,91 +228,133 @@ func (s *DoctorService) BlockSlot(ctx context.Context, doctorID uint, req *model
 		return e.NewValidationError("invalid end time format")
 	}
 
-	slotStart := time.Date(date.Year(), date.Month(), date.Day(),
-		startTime.Hour(), startTime.Minute(), 0, 0, time.Local)
-	slotEnd := time.Date(date.Year(), date.Month(), date.Day(),
-		endTime.Hour(), endTime.Minute(), 0, 0, time.Local)
+	if !endTime.After(startTime) {
+		return e.NewValidationError("end time must be after start time")
+	}
+
+	recurringDay := ""
+	if req.IsRecurring {
+		recurringDay = strings.ToLower(strings.TrimSpace(req.RecurringDay))
+		if recurringDay == "" {
+			recurringDay = strings.ToLower(date.Weekday().String())
+		}
+		if !isWeekday(recurringDay) {
+			return e.NewValidationError("invalid recurring day")
+		}
+	}
+
+	// Blocks keep the doctor's calendar day and clock times as UTC labels,
+	// the slot engine places them on the day in the doctor's zone
+	slotStart := onDay(date, startTime)
+	slotEnd := onDay(date, endTime)
+	blocked := &models.BlockedSlot{
+		DoctorID:     doctorID,
+		Date:         date,
+		StartTime:    slotStart,
+		EndTime:      slotEnd,
+		Reason:       req.Reason,
+		IsRecurring:  req.IsRecurring,
+		RecurringDay: recurringDay,
+	}
+	if err := s.doctorRepo.CreateBlockedSlot(ctx, blocked); err != nil {
+		return err
+	}
 
 	return s.doctorRepo.DeleteAvailabilitySlots(ctx, doctorID, date, slotStart, slotEnd)
 }
 
-type DoctorListResponse struct {
-	Doctors     []models.DoctorProfile `json:"doctors"`
-	Total       int64                  `json:"total"`
-	CurrentPage int                    `json:"current_page"`
-	PerPage     int                    `json:"per_page"`
-	TotalPages  int                    `json:"total_pages"`
-}
+// UnblockSlot removes one of the doctor's blocks and offers the slots it
+// frees over the booking window to the waitlist
+func (s *DoctorService) UnblockSlot(ctx context.Context, doctorID uint, blockID uint) error {
+	blocked, err := s.doctorRepo.GetBlockedSlotByID(ctx, blockID)
+	if err != nil || blocked.DoctorID != doctorID {
+		return e.NewNotFoundError("blocked slot not found")
+	}
 
-func (s *DoctorService) ListDoctors(ctx context.Context, filters map[string]interface{}, page, limit int) (*DoctorListResponse, error) {
-	if page < 1 {
-		page = 1
+	if err := s.doctorRepo.DeleteBlockedSlot(ctx, blocked); err != nil {
+		return err
 	}
-	if limit < 1 || limit > 100 {
-		limit = 10
+	if s.waitlist == nil {
+		return nil
 	}
 
-	doctors, total, err := s.doctorRepo.ListDoctors(ctx, filters, page, limit)
-	if err != nil {
-		log.Printf("Error in service layer: %v", err)
-		return nil, err
+	loc := s.slots.location(ctx, doctorID)
+	today := models.CalendarDate(time.Now().In(loc))
+	if !blocked.IsRecurring {
+		if !blocked.Date.Before(today) {
+			local := utils.WallTime(blocked.Date.Year(), blocked.Date.Month(), blocked.Date.Day(), 0, 0, loc)
+			s.waitlist.OfferFreedSlots(ctx, doctorID, onDay(local, blocked.StartTime), onDay(local, blocked.EndTime))
+		}
+		return nil
 	}
 
-	log.Printf("Service layer: Found %d doctors, total: %d", len(doctors), total)
-
-	totalPages := int(math.Ceil(float64(total) / float64(limit)))
-
-	return &DoctorListResponse{
-		Doctors:     doctors,
-		Total:       total,
-		CurrentPage: page,
-		PerPage:     limit,
-		TotalPages:  totalPages,
-	}, nil
+	for day := today; !day.After(today.Add(models.MaxAdvanceBooking)); day = day.AddDate(0, 0, 1) {
+		if strings.ToLower(day.Weekday().String()) != blocked.RecurringDay || day.Before(blocked.Date) {
+			continue
+		}
+		local := utils.WallTime(day.Year(), day.Month(), day.Day(), 0, 0, loc)
+		s.waitlist.OfferFreedSlots(ctx, doctorID, onDay(local, blocked.StartTime), onDay(local, blocked.EndTime))
+	}
+	return nil
 }
 
-func (s *DoctorService) GetAvailableSlots(doctorID uint, date time.Time) ([]models.TimeSlot, error) {
-	schedule, err := s.doctorRepo.GetSchedule(context.Background(), doctorID)
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return []models.TimeSlot{}, e.NewNotFoundError("doctor schedule not found")
+func isWeekday(day string) bool {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.ToLower(d.String()) == day {
+			return true
 		}
-		return nil, fmt.Errorf("error getting doctor schedule: %v", err)
 	}
+	return false
+}
 
-	var parsedSchedule models.Schedule
-	if err := json.Unmarshal([]byte(schedule.Schedule), &parsedSchedule); err != nil {
+type DoctorListResponse struct {
+	Doctors     []models.DoctorProfile         `json:"doctors"`
+	Total       int64                          `json:"total"`
+	CurrentPage int                            `json:"current_page"`
+	PerPage     int                            `json:"per_page"`
+	TotalPages  int                            `json:"total_pages"`
+	Facets      map[string][]models.FacetCount `json:"facets"`
+}
 
+// ListDoctors searches the doctor index, most relevant first, and counts the
+// facet values of everyone matching
+func (s *DoctorService) ListDoctors(ctx context.Context, query *models.DoctorSearchQuery) (*DoctorListResponse, error) {
+	if query.Page < 1 {
+		query.Page = 1
 	}
-
-	dayOfWeek := strings.ToLower(date.Weekday().String())
-	daySchedule, exists := parsedSchedule.Days[dayOfWeek]
-	if !exists || !daySchedule.Enabled {
-		return []models.TimeSlot{}, e.NewNotFoundError("no slots available for this day")
+	if query.Limit < 1 || query.Limit > 100 {
+		query.Limit = 10
+	}
+	if query.FeeMin != nil && query.FeeMax != nil && *query.FeeMax < *query.FeeMin {
+		return nil, e.NewValidationError("fee_max must not be below fee_min")
 	}
 
-	existingAppointments, err := s.appointmentRepo.GetAppointmentsByDoctorAndDate(doctorID, date)
+	result, err := s.doctorRepo.SearchDoctors(ctx, query)
 	if err != nil {
+		log.Printf("Error searching doctors: %v", err)
 		return nil, err
 	}
 
-	var availableSlots []models.TimeSlot
-	for _, scheduleSlot := range daySchedule.Slots {
-		startTime, _ := time.Parse("15:04", scheduleSlot.Start)
-		endTime, _ := time.Parse("15:04", scheduleSlot.End)
-
-		slot := models.TimeSlot{
-			StartTime: startTime,
-			EndTime:   endTime,
-			Available: true,
-		}
+	return &DoctorListResponse{
+		Doctors:     result.Doctors,
+		Total:       result.Total,
+		CurrentPage: query.Page,
+		PerPage:     query.Limit,
+		TotalPages:  int(math.Ceil(float64(result.Total) / float64(query.Limit))),
+		Facets:      result.Facets,
+	}, nil
+}
 
-		if isSlotAvailable(slot, existingAppointments) {
-			availableSlots = append(availableSlots, slot)
-		}
+func (s *DoctorService) GetAvailableSlots(doctorID uint, date time.Time, filter models.SlotFilter) ([]models.TimeSlot, error) {
+	plan, err := s.slots.Plan(context.Background(), doctorID, date)
+	if err != nil {
+		return nil, err
+	}
+	if !plan.Open {
+		return []models.TimeSlot{}, e.NewNotFoundError("no slots available for this day")
 	}
 
-	return availableSlots, nil
+	return filterSlots(plan.available(), filter), nil
 }
 
 func (s *DoctorService) ListPatients(ctx context.Context, doctorID uint, page, limit int) (*models.PatientListResponse, error) {
@@ -19,6 +19,10 @@ func NewHealthService(healthRepo *repositories.HealthRepository) *HealthService
 }
 
 func (s *HealthService) CreateHealthProfile(ctx context.Context, profile *models.HealthProfile) error {
+	if err := requireDelegatedScope(ctx, models.ScopeHealthWrite); err != nil {
+		return err
+	}
+
 	if profile.UserID == 0 {
 		return e.NewValidationError("user ID is required")
 	}
@@ -27,6 +31,10 @@ func (s *HealthService) CreateHealthProfile(ctx context.Context, profile *models
 }
 
 func (s *HealthService) GetHealthProfile(ctx context.Context, userID uint) (*models.HealthProfile, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeHealthRead); err != nil {
+		return nil, err
+	}
+
 	profile, err := s.healthRepo.GetHealthProfile(ctx, userID)
 	if err != nil {
 		return nil, e.NewObjectNotFoundError("health profile")
@@ -35,6 +43,10 @@ func (s *HealthService) GetHealthProfile(ctx context.Context, userID uint) (*mod
 }
 
 func (s *HealthService) UpdateHealthProfile(ctx context.Context, profile *models.HealthProfile) error {
+	if err := requireDelegatedScope(ctx, models.ScopeHealthWrite); err != nil {
+		return err
+	}
+
 	if profile.UserID == 0 {
 		return e.NewInvalidParamError("user_id")
 	}
@@ -57,10 +69,18 @@ func (s *HealthService) UpdateHealthProfile(ctx context.Context, profile *models
 }
 
 func (s *HealthService) DeleteHealthProfile(ctx context.Context, userID uint) error {
+	if err := requireDelegatedScope(ctx, models.ScopeHealthWrite); err != nil {
+		return err
+	}
+
 	return s.healthRepo.DeleteHealthProfile(ctx, userID)
 }
 
 func (s *HealthService) CreateVitalSign(ctx context.Context, vitalSign *models.VitalSign) error {
+	if err := requireDelegatedScope(ctx, models.ScopeHealthWrite); err != nil {
+		return err
+	}
+
 	if vitalSign.UserID == 0 {
 		return e.NewValidationError("user ID is required")
 	}
@@ -69,6 +89,10 @@ func (s *HealthService) CreateVitalSign(ctx context.Context, vitalSign *models.V
 }
 
 func (s *HealthService) GetVitalSign(ctx context.Context, userID uint) ([]models.VitalSign, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeHealthRead); err != nil {
+		return nil, err
+	}
+
 	vitalSigns, err := s.healthRepo.GetVitalSigns(ctx, userID)
 	if err != nil {
 		return nil, e.NewObjectNotFoundError("vital signs")
@@ -77,6 +101,10 @@ func (s *HealthService) GetVitalSign(ctx context.Context, userID uint) ([]models
 }
 
 func (s *HealthService) CreateMedication(ctx context.Context, medication *models.Medication) error {
+	if err := requireDelegatedScope(ctx, models.ScopeHealthWrite); err != nil {
+		return err
+	}
+
 	if medication.UserID == 0 {
 		return e.NewValidationError("user ID is required")
 	}
@@ -85,6 +113,10 @@ func (s *HealthService) CreateMedication(ctx context.Context, medication *models
 }
 
 func (s *HealthService) GetMedications(ctx context.Context, userID uint) ([]models.Medication, error) {
+	if err := requireDelegatedScope(ctx, models.ScopeHealthRead); err != nil {
+		return nil, err
+	}
+
 	medications, err := s.healthRepo.GetMedications(ctx, userID)
 	if err != nil {
 		return nil, e.NewObjectNotFoundError("medications")
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/repositories"
+
+	"gorm.io/gorm"
+)
+
+// HolidayService keeps the holiday calendars admins publish and the doctors
+// who follow them. A doctor takes no bookings on the holidays of the
+// calendars they follow.
+type HolidayService struct {
+	timeOffRepo *repositories.TimeOffRepository
+}
+
+func NewHolidayService(timeOffRepo *repositories.TimeOffRepository) *HolidayService {
+	return &HolidayService{timeOffRepo: timeOffRepo}
+}
+
+func (s *HolidayService) CreateCalendar(ctx context.Context, req *models.HolidayCalendarRequest) (*models.HolidayCalendar, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, e.NewValidationError("name is required")
+	}
+
+	exists, err := s.timeOffRepo.CalendarNameExists(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, e.NewConflictError(fmt.Sprintf("a holiday calendar named %q already exists", name))
+	}
+
+	calendar := &models.HolidayCalendar{Name: name, Description: req.Description}
+	if err := s.timeOffRepo.CreateCalendar(ctx, calendar); err != nil {
+		return nil, err
+	}
+	calendar.Holidays = []models.Holiday{}
+	return calendar, nil
+}
+
+func (s *HolidayService) ListCalendars(ctx context.Context) ([]models.HolidayCalendar, error) {
+	return s.timeOffRepo.FindCalendars(ctx)
+}
+
+// DeleteCalendar removes the calendar, its holidays stop closing the doctors
+// who followed it
+func (s *HolidayService) DeleteCalendar(ctx context.Context, calendarID uint) error {
+	if _, err := s.findCalendar(ctx, calendarID); err != nil {
+		return err
+	}
+	return s.timeOffRepo.DeleteCalendar(ctx, calendarID)
+}
+
+func (s *HolidayService) AddHoliday(ctx context.Context, calendarID uint, req *models.HolidayRequest) (*models.Holiday, error) {
+	if _, err := s.findCalendar(ctx, calendarID); err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, e.NewValidationError("name is required")
+	}
+	date, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		return nil, e.NewValidationError("invalid date format: use YYYY-MM-DD")
+	}
+
+	exists, err := s.timeOffRepo.HolidayExists(ctx, calendarID, date)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, e.NewConflictError(fmt.Sprintf("the calendar already has a holiday on %s", req.Date))
+	}
+
+	holiday := &models.Holiday{CalendarID: calendarID, Date: date, Name: name}
+	if err := s.timeOffRepo.CreateHoliday(ctx, holiday); err != nil {
+		return nil, err
+	}
+	return holiday, nil
+}
+
+func (s *HolidayService) RemoveHoliday(ctx context.Context, calendarID uint, holidayID uint) error {
+	deleted, err := s.timeOffRepo.DeleteHoliday(ctx, calendarID, holidayID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return e.NewNotFoundError("holiday not found")
+	}
+	return nil
+}
+
+// DoctorCalendars lists every calendar, marking the ones the doctor follows
+func (s *HolidayService) DoctorCalendars(ctx context.Context, doctorID uint) ([]models.HolidayCalendar, error) {
+	calendars, err := s.timeOffRepo.FindCalendars(ctx)
+	if err != nil {
+		return nil, err
+	}
+	followed, err := s.timeOffRepo.FollowedCalendarIDs(ctx, doctorID)
+	if err != nil {
+		return nil, err
+	}
+
+	following := make(map[uint]bool, len(followed))
+	for _, id := range followed {
+		following[id] = true
+	}
+	for i := range calendars {
+		calendars[i].Following = following[calendars[i].ID]
+	}
+	return calendars, nil
+}
+
+func (s *HolidayService) FollowCalendar(ctx context.Context, doctorID uint, calendarID uint) (*models.HolidayCalendar, error) {
+	calendar, err := s.findCalendar(ctx, calendarID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.timeOffRepo.FollowCalendar(ctx, doctorID, calendarID); err != nil {
+		return nil, err
+	}
+	calendar.Following = true
+	return calendar, nil
+}
+
+func (s *HolidayService) UnfollowCalendar(ctx context.Context, doctorID uint, calendarID uint) error {
+	unfollowed, err := s.timeOffRepo.UnfollowCalendar(ctx, doctorID, calendarID)
+	if err != nil {
+		return err
+	}
+	if !unfollowed {
+		return e.NewNotFoundError("you don't follow this holiday calendar")
+	}
+	return nil
+}
+
+func (s *HolidayService) findCalendar(ctx context.Context, calendarID uint) (*models.HolidayCalendar, error) {
+	calendar, err := s.timeOffRepo.FindCalendarByID(ctx, calendarID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, e.NewNotFoundError("holiday calendar not found")
+		}
+		return nil, err
+	}
+	return calendar, nil
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/utils"
+)
+
+// LockoutService throttles password logins per account and per IP. Failures
+// are counted from the LoginAttempt log inside a sliding window; crossing the
+// limit locks the key, and every consecutive lockout doubles in length up to
+// the configured maximum.
+type LockoutService struct {
+	lockoutRepo *repositories.LockoutRepository
+	userRepo    *repositories.UserRepository
+	adminRepo   *repositories.AdminRepository
+}
+
+func NewLockoutService(lockoutRepo *repositories.LockoutRepository, userRepo *repositories.UserRepository, adminRepo *repositories.AdminRepository) *LockoutService {
+	return &LockoutService{
+		lockoutRepo: lockoutRepo,
+		userRepo:    userRepo,
+		adminRepo:   adminRepo,
+	}
+}
+
+func clientIPFromContext(ctx context.Context) string {
+	if ip, ok := ctx.Value("ipAddress").(string); ok && ip != "" {
+		return ip
+	}
+	return "unknown"
+}
+
+func accountKey(userID uint) string {
+	return strconv.FormatUint(uint64(userID), 10)
+}
+
+func (s *LockoutService) policy(ctx context.Context) models.LockoutPolicy {
+	settings, err := s.adminRepo.GetSystemSettings(ctx)
+	if err != nil {
+		log.Printf("Failed to load lockout settings, using defaults: %v", err)
+		return (&models.AdminSettings{}).LockoutPolicy()
+	}
+	return settings.LockoutPolicy()
+}
+
+// Check rejects the login early when the caller's IP or, if known, the
+// account is currently locked
+func (s *LockoutService) Check(ctx context.Context, user *models.User) error {
+	now := time.Now()
+
+	ipLock, err := s.lockoutRepo.FindLockout(ctx, models.LockoutScopeIP, clientIPFromContext(ctx))
+	if err != nil {
+		return e.NewInternalError()
+	}
+	if ipLock.IsLocked(now) {
+		return e.NewTooManyRequestsError(fmt.Sprintf("too many failed login attempts from this address, try again in %s", retryIn(now, *ipLock.LockedUntil)))
+	}
+
+	if user == nil {
+		return nil
+	}
+
+	accountLock, err := s.lockoutRepo.FindLockout(ctx, models.LockoutScopeAccount, accountKey(user.ID))
+	if err != nil {
+		return e.NewInternalError()
+	}
+	if accountLock.IsLocked(now) {
+		return e.NewAccountLockedError(fmt.Sprintf("account is temporarily locked after too many failed login attempts, try again in %s", retryIn(now, *accountLock.LockedUntil)))
+	}
+	return nil
+}
+
+// RecordFailure logs the failed attempt and locks the IP and account once
+// their limits are crossed. The returned error is non-nil only when this very
+// attempt caused a lockout.
+func (s *LockoutService) RecordFailure(ctx context.Context, user *models.User, email string) error {
+	ip := clientIPFromContext(ctx)
+	var userID uint
+	if user != nil {
+		userID = user.ID
+	}
+	s.recordAttempt(ctx, userID, email, ip, false)
+
+	policy := s.policy(ctx)
+	now := time.Now()
+
+	ipLock, err := s.lockoutRepo.FindLockout(ctx, models.LockoutScopeIP, ip)
+	if err != nil {
+		log.Printf("Failed to load IP lockout for %s: %v", ip, err)
+		return nil
+	}
+	ipCount, err := s.lockoutRepo.CountFailedByIP(ctx, ip, countFrom(ipLock, policy, now))
+	if err == nil && ipCount >= int64(policy.MaxIPAttempts) {
+		s.lock(ctx, ipLock, policy, now)
+		log.Printf("Login throttled for IP %s until %s", ip, ipLock.LockedUntil.Format(time.RFC3339))
+		return e.NewTooManyRequestsError(fmt.Sprintf("too many failed login attempts from this address, try again in %s", retryIn(now, *ipLock.LockedUntil)))
+	}
+
+	if user == nil {
+		return nil
+	}
+
+	accountLock, err := s.lockoutRepo.FindLockout(ctx, models.LockoutScopeAccount, accountKey(user.ID))
+	if err != nil {
+		log.Printf("Failed to load account lockout for user %d: %v", user.ID, err)
+		return nil
+	}
+	accountCount, err := s.lockoutRepo.CountFailedByUser(ctx, user.ID, countFrom(accountLock, policy, now))
+	if err == nil && accountCount >= int64(policy.MaxAccountAttempts) {
+		s.lock(ctx, accountLock, policy, now)
+		log.Printf("Account %d locked until %s", user.ID, accountLock.LockedUntil.Format(time.RFC3339))
+		go s.sendLockoutEmail(*user, *accountLock.LockedUntil, ip)
+		return e.NewAccountLockedError(fmt.Sprintf("account is temporarily locked after too many failed login attempts, try again in %s", retryIn(now, *accountLock.LockedUntil)))
+	}
+	return nil
+}
+
+// RecordSuccess logs the attempt and clears the account's lockout history
+func (s *LockoutService) RecordSuccess(ctx context.Context, user *models.User) {
+	s.recordAttempt(ctx, user.ID, user.Email, clientIPFromContext(ctx), true)
+
+	accountLock, err := s.lockoutRepo.FindLockout(ctx, models.LockoutScopeAccount, accountKey(user.ID))
+	if err != nil || accountLock.ID == 0 {
+		return
+	}
+	s.reset(ctx, accountLock)
+}
+
+func (s *LockoutService) UnlockAccount(ctx context.Context, userID uint) error {
+	accountLock, err := s.lockoutRepo.FindLockout(ctx, models.LockoutScopeAccount, accountKey(userID))
+	if err != nil {
+		return e.NewInternalError()
+	}
+	if accountLock.ID == 0 {
+		return nil
+	}
+	if err := s.reset(ctx, accountLock); err != nil {
+		return e.NewInternalError()
+	}
+	return nil
+}
+
+func (s *LockoutService) lock(ctx context.Context, lockout *models.LoginLockout, policy models.LockoutPolicy, now time.Time) {
+	// a key that stayed clean for a full max-duration period starts over
+	if lockout.LockedUntil != nil && now.Sub(*lockout.LockedUntil) > policy.MaxDuration {
+		lockout.Level = 0
+	}
+	lockout.Level++
+
+	duration := time.Duration(float64(policy.BaseDuration) * math.Pow(2, float64(lockout.Level-1)))
+	if duration > policy.MaxDuration || duration <= 0 {
+		duration = policy.MaxDuration
+	}
+
+	until := now.Add(duration)
+	lockout.LockedUntil = &until
+	lockout.CountSince = now
+	if err := s.lockoutRepo.SaveLockout(ctx, lockout); err != nil {
+		log.Printf("Failed to save %s lockout for %s: %v", lockout.Scope, lockout.Key, err)
+	}
+}
+
+func (s *LockoutService) reset(ctx context.Context, lockout *models.LoginLockout) error {
+	lockout.Level = 0
+	lockout.LockedUntil = nil
+	lockout.CountSince = time.Now()
+	return s.lockoutRepo.SaveLockout(ctx, lockout)
+}
+
+func (s *LockoutService) recordAttempt(ctx context.Context, userID uint, email, ip string, successful bool) {
+	loginAttempt := &models.LoginAttempt{
+		UserID:     userID,
+		IPAddress:  ip,
+		Email:      email,
+		Successful: successful,
+		Timestamp:  time.Now(),
+	}
+
+	if err := s.userRepo.CreateLoginAttempt(ctx, loginAttempt); err != nil {
+		log.Printf("Failed to record login attempt: %v", err)
+	}
+}
+
+func (s *LockoutService) sendLockoutEmail(user models.User, until time.Time, ip string) {
+	subject := "Account Locked - HealthHub"
+	body := fmt.Sprintf(`Dear %s,
+
+Your HealthHub account has been temporarily locked after several failed login attempts.
+
+Locked until: %s
+Last attempt from IP: %s
+
+If this was you, you can try again after the time above or reset your password.
+If it was not you, we recommend resetting your password and contacting support.
+
+Best regards,
+HealthHub Team`, user.Name, until.In(utils.TimezoneOrUTC(user.Timezone)).Format("02 Jan 2006 15:04 MST"), ip)
+
+	if err := utils.SendEmail(user.Email, subject, body); err != nil {
+		log.Printf("Failed to send lockout email to user %d: %v", user.ID, err)
+	}
+}
+
+// countFrom is where the failure count for the next lockout starts, failures
+// that already led to a lockout or are older than the window don't count
+func countFrom(lockout *models.LoginLockout, policy models.LockoutPolicy, now time.Time) time.Time {
+	since := now.Add(-policy.Window)
+	if lockout.CountSince.After(since) {
+		since = lockout.CountSince
+	}
+	return since
+}
+
+func retryIn(now, until time.Time) string {
+	minutes := int(math.Ceil(until.Sub(now).Minutes()))
+	if minutes <= 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
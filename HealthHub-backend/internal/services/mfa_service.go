@@ -0,0 +1,329 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"HealthHubConnect/env"
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	mfaIssuer         = "HealthHub"
+	recoveryCodeCount = 10
+)
+
+// MFAChallenge is returned by the password step instead of tokens when the
+// account has, or by policy must have, a second factor.
+type MFAChallenge struct {
+	MFAToken           string `json:"mfa_token"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+	ExpiresIn          int    `json:"expires_in"`
+}
+
+type MFAEnrollment struct {
+	Secret    string `json:"secret"`
+	QRPayload string `json:"qr_payload"` // otpauth:// URI, rendered as a QR code by the client
+}
+
+type MFAStatus struct {
+	Enabled                bool  `json:"enabled"`
+	Required               bool  `json:"required"`
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+type MFAService struct {
+	mfaRepo   *repositories.MFARepository
+	userRepo  *repositories.UserRepository
+	adminRepo *repositories.AdminRepository
+}
+
+func NewMFAService(mfaRepo *repositories.MFARepository, userRepo *repositories.UserRepository, adminRepo *repositories.AdminRepository) *MFAService {
+	return &MFAService{
+		mfaRepo:   mfaRepo,
+		userRepo:  userRepo,
+		adminRepo: adminRepo,
+	}
+}
+
+func (s *MFAService) isRequiredFor(ctx context.Context, role models.UserRole) (bool, error) {
+	settings, err := s.adminRepo.GetSystemSettings(ctx)
+	if err != nil {
+		return false, err
+	}
+	return settings.RequiresMFA(role), nil
+}
+
+func (s *MFAService) findEnabled(ctx context.Context, userID uint) (*models.UserMFA, error) {
+	mfa, err := s.mfaRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !mfa.Enabled {
+		return nil, nil
+	}
+	return mfa, nil
+}
+
+// Challenge decides whether a password-verified login needs a second step.
+// A nil challenge means the caller can issue tokens right away.
+func (s *MFAService) Challenge(ctx context.Context, user *models.User) (*MFAChallenge, error) {
+	mfa, err := s.findEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, e.NewInternalError()
+	}
+
+	enrollmentRequired := false
+	if mfa == nil {
+		required, err := s.isRequiredFor(ctx, user.Role)
+		if err != nil {
+			log.Printf("Failed to load MFA policy: %v", err)
+			return nil, e.NewInternalError()
+		}
+		if !required {
+			return nil, nil
+		}
+		enrollmentRequired = true
+	}
+
+	token, err := utils.GenerateMFAPendingToken(user.ID, user.Role)
+	if err != nil {
+		return nil, e.NewInternalError()
+	}
+
+	return &MFAChallenge{
+		MFAToken:           token,
+		EnrollmentRequired: enrollmentRequired,
+		ExpiresIn:          int(utils.MFAPendingTTL.Seconds()),
+	}, nil
+}
+
+// UserFromPendingToken resolves the account a login challenge was issued for
+func (s *MFAService) UserFromPendingToken(ctx context.Context, mfaToken string) (*models.User, error) {
+	claims, err := utils.ValidateToken(mfaToken, env.Jwt.MFATokenSecret, utils.MFAPendingToken)
+	if err != nil {
+		return nil, e.NewNotAuthorizedError("invalid or expired mfa token, please log in again")
+	}
+
+	user, err := s.userRepo.FindByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, e.NewNotAuthorizedError("invalid mfa token")
+	}
+	return user, nil
+}
+
+func (s *MFAService) BeginEnrollment(ctx context.Context, user *models.User) (*MFAEnrollment, error) {
+	mfa, err := s.mfaRepo.FindByUserID(ctx, user.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, e.NewInternalError()
+	}
+	if mfa != nil && mfa.Enabled {
+		return nil, e.NewConflictError("two-factor authentication is already enabled")
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, e.NewInternalError()
+	}
+
+	if mfa == nil {
+		mfa = &models.UserMFA{UserID: user.ID}
+	}
+	mfa.Secret = secret
+	mfa.LastUsedStep = 0
+	if err := s.mfaRepo.Save(ctx, mfa); err != nil {
+		return nil, e.NewInternalError()
+	}
+
+	return &MFAEnrollment{
+		Secret:    secret,
+		QRPayload: utils.TOTPAuthURL(mfaIssuer, user.Email, secret),
+	}, nil
+}
+
+func (s *MFAService) BeginEnrollmentForUser(ctx context.Context, userID uint) (*MFAEnrollment, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, e.NewNotFoundError("user not found")
+	}
+	return s.BeginEnrollment(ctx, user)
+}
+
+// BeginEnrollmentWithToken lets an account that is forced into MFA by policy
+// enroll during login, before it has ever held an access token.
+func (s *MFAService) BeginEnrollmentWithToken(ctx context.Context, mfaToken string) (*MFAEnrollment, error) {
+	user, err := s.UserFromPendingToken(ctx, mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	return s.BeginEnrollment(ctx, user)
+}
+
+// ConfirmEnrollment activates a pending secret with its first valid code and
+// returns the plaintext recovery codes. They are only ever shown this once.
+func (s *MFAService) ConfirmEnrollment(ctx context.Context, userID uint, code string) ([]string, error) {
+	mfa, err := s.mfaRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, e.NewValidationError("two-factor enrollment has not been started")
+	}
+	if mfa.Enabled {
+		return nil, e.NewConflictError("two-factor authentication is already enabled")
+	}
+
+	if err := s.verifyTOTP(ctx, mfa, code); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	mfa.Enabled = true
+	mfa.ConfirmedAt = &now
+	if err := s.mfaRepo.Save(ctx, mfa); err != nil {
+		return nil, e.NewInternalError()
+	}
+
+	return s.issueRecoveryCodes(ctx, userID)
+}
+
+// VerifyLogin checks the second factor for a pending login. For an account
+// enrolling during login the code also confirms the enrollment, in which case
+// the fresh recovery codes are returned.
+func (s *MFAService) VerifyLogin(ctx context.Context, user *models.User, code, recoveryCode string) ([]string, error) {
+	mfa, err := s.mfaRepo.FindByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, e.NewValidationError("two-factor authentication must be set up before logging in")
+	}
+
+	if !mfa.Enabled {
+		return s.ConfirmEnrollment(ctx, user.ID, code)
+	}
+
+	if recoveryCode != "" {
+		return nil, s.useRecoveryCode(ctx, user.ID, recoveryCode)
+	}
+	return nil, s.verifyTOTP(ctx, mfa, code)
+}
+
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) ([]string, error) {
+	mfa, err := s.findEnabled(ctx, userID)
+	if err != nil {
+		return nil, e.NewInternalError()
+	}
+	if mfa == nil {
+		return nil, e.NewValidationError("two-factor authentication is not enabled")
+	}
+
+	if err := s.verifyTOTP(ctx, mfa, code); err != nil {
+		return nil, err
+	}
+	return s.issueRecoveryCodes(ctx, userID)
+}
+
+func (s *MFAService) Disable(ctx context.Context, userID uint, code string) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return e.NewNotFoundError("user not found")
+	}
+
+	required, err := s.isRequiredFor(ctx, user.Role)
+	if err != nil {
+		return e.NewInternalError()
+	}
+	if required {
+		return e.NewForbiddenError("two-factor authentication is mandatory for your role")
+	}
+
+	mfa, err := s.findEnabled(ctx, userID)
+	if err != nil {
+		return e.NewInternalError()
+	}
+	if mfa == nil {
+		return e.NewValidationError("two-factor authentication is not enabled")
+	}
+
+	if err := s.verifyTOTP(ctx, mfa, code); err != nil {
+		return err
+	}
+	return s.mfaRepo.Delete(ctx, userID)
+}
+
+func (s *MFAService) GetStatus(ctx context.Context, userID uint, role models.UserRole) (*MFAStatus, error) {
+	mfa, err := s.findEnabled(ctx, userID)
+	if err != nil {
+		return nil, e.NewInternalError()
+	}
+	required, err := s.isRequiredFor(ctx, role)
+	if err != nil {
+		return nil, e.NewInternalError()
+	}
+
+	status := &MFAStatus{Enabled: mfa != nil, Required: required}
+	if mfa != nil {
+		status.RecoveryCodesRemaining, _ = s.mfaRepo.CountUnusedRecoveryCodes(ctx, userID)
+	}
+	return status, nil
+}
+
+func (s *MFAService) verifyTOTP(ctx context.Context, mfa *models.UserMFA, code string) error {
+	step, ok := utils.ValidateTOTP(mfa.Secret, code, time.Now())
+	if !ok {
+		return e.NewValidationError("invalid authentication code")
+	}
+
+	fresh, err := s.mfaRepo.ConsumeStep(ctx, mfa.UserID, step)
+	if err != nil {
+		return e.NewInternalError()
+	}
+	if !fresh {
+		return e.NewValidationError("authentication code already used, wait for the next one")
+	}
+	mfa.LastUsedStep = step
+	return nil
+}
+
+func (s *MFAService) issueRecoveryCodes(ctx context.Context, userID uint) ([]string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, e.NewInternalError()
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hash, err := utils.CreateHMAC(code)
+		if err != nil {
+			log.Printf("Failed to hash recovery code: %v", err)
+			return nil, e.NewInternalError()
+		}
+		hashes = append(hashes, hash)
+	}
+
+	if err := s.mfaRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, e.NewInternalError()
+	}
+	return codes, nil
+}
+
+func (s *MFAService) useRecoveryCode(ctx context.Context, userID uint, code string) error {
+	hash, err := utils.CreateHMAC(utils.NormalizeRecoveryCode(code))
+	if err != nil {
+		return e.NewValidationError("invalid recovery code")
+	}
+
+	used, err := s.mfaRepo.UseRecoveryCode(ctx, userID, hash)
+	if err != nil {
+		return e.NewInternalError()
+	}
+	if !used {
+		return e.NewValidationError("invalid recovery code")
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/oidc"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/utils"
+
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+// ExternalIdentity is a user as asserted by an external identity provider
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+type OAuthProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+// OIDCCallbackResult is the outcome of a provider callback. LinkedProvider is
+// set when the callback finished linking an account rather than a login.
+type OIDCCallbackResult struct {
+	User           *models.User
+	LinkedProvider string
+}
+
+// OAuthService runs the OpenID Connect authorization code flow against the
+// configured providers and maps external identities onto users.
+type OAuthService struct {
+	oauthRepo *repositories.OAuthRepository
+	userRepo  *repositories.UserRepository
+	providers *oidc.Registry
+}
+
+func NewOAuthService(oauthRepo *repositories.OAuthRepository, userRepo *repositories.UserRepository, providers *oidc.Registry) *OAuthService {
+	return &OAuthService{
+		oauthRepo: oauthRepo,
+		userRepo:  userRepo,
+		providers: providers,
+	}
+}
+
+func (s *OAuthService) Providers() []OAuthProviderInfo {
+	providers := s.providers.List()
+	infos := make([]OAuthProviderInfo, 0, len(providers))
+	for _, provider := range providers {
+		infos = append(infos, OAuthProviderInfo{Name: provider.Name(), DisplayName: provider.DisplayName()})
+	}
+	return infos
+}
+
+func (s *OAuthService) provider(name string) (*oidc.Provider, error) {
+	provider, err := s.providers.Get(name)
+	if err != nil {
+		return nil, e.NewNotFoundError(fmt.Sprintf("identity provider %s not found", name))
+	}
+	return provider, nil
+}
+
+// BeginLogin returns the provider's authorization URL for a new login
+func (s *OAuthService) BeginLogin(ctx context.Context, providerName string) (string, error) {
+	return s.begin(ctx, providerName, nil)
+}
+
+// BeginLink returns the authorization URL that links the provider to the signed-in user
+func (s *OAuthService) BeginLink(ctx context.Context, userID uint, providerName string) (string, error) {
+	if _, err := s.oauthRepo.FindUserAccount(ctx, userID, providerName); err == nil {
+		return "", e.NewConflictError(fmt.Sprintf("a %s account is already linked, unlink it first", providerName))
+	}
+	return s.begin(ctx, providerName, &userID)
+}
+
+func (s *OAuthService) begin(ctx context.Context, providerName string, linkUserID *uint) (string, error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := utils.NewRandomID()
+	if err != nil {
+		return "", e.NewInternalError()
+	}
+	nonce, err := utils.NewRandomID()
+	if err != nil {
+		return "", e.NewInternalError()
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		log.Printf("Failed to build authorization URL for %s: %v", providerName, err)
+		return "", e.NewInternalError()
+	}
+
+	loginState := &models.OIDCLoginState{
+		State:        state,
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	}
+	if err := s.oauthRepo.CreateLoginState(ctx, loginState); err != nil {
+		return "", e.NewInternalError()
+	}
+
+	return authURL, nil
+}
+
+// HandleCallback redeems the authorization code of a request started by
+// BeginLogin or BeginLink and resolves the verified identity to a user
+func (s *OAuthService) HandleCallback(ctx context.Context, providerName, code, state string) (*OIDCCallbackResult, error) {
+	loginState, err := s.oauthRepo.ConsumeLoginState(ctx, state)
+	if err != nil || loginState.Provider != providerName {
+		return nil, e.NewNotAuthorizedError("invalid or expired login state, please try again")
+	}
+
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, err := provider.Exchange(ctx, code, loginState.CodeVerifier)
+	if err != nil {
+		log.Printf("OIDC code exchange with %s failed: %v", providerName, err)
+		return nil, e.NewNotAuthorizedError(fmt.Sprintf("could not complete sign in with %s", provider.DisplayName()))
+	}
+
+	idToken, err := provider.VerifyIDToken(ctx, rawIDToken, loginState.Nonce)
+	if err != nil {
+		log.Printf("Rejected ID token from %s: %v", providerName, err)
+		return nil, e.NewNotAuthorizedError(fmt.Sprintf("could not complete sign in with %s", provider.DisplayName()))
+	}
+
+	identity := ExternalIdentity{
+		Provider:      providerName,
+		Subject:       idToken.Subject,
+		Email:         idToken.Email,
+		EmailVerified: bool(idToken.EmailVerified),
+		Name:          idToken.Name,
+		Picture:       idToken.Picture,
+	}
+
+	if loginState.LinkUserID != nil {
+		user, err := s.link(ctx, *loginState.LinkUserID, identity)
+		if err != nil {
+			return nil, err
+		}
+		return &OIDCCallbackResult{User: user, LinkedProvider: providerName}, nil
+	}
+
+	user, err := s.ResolveUser(ctx, identity, provider.LinkByEmail())
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCCallbackResult{User: user}, nil
+}
+
+// ResolveUser finds the user an external identity belongs to, creating a
+// patient account on first sign in. An existing account with the same email
+// is only taken over when the provider is trusted to and the email is verified,
+// otherwise its owner has to sign in and link the provider explicitly.
+func (s *OAuthService) ResolveUser(ctx context.Context, identity ExternalIdentity, linkByEmail bool) (*models.User, error) {
+	account, err := s.oauthRepo.FindAccount(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		user, err := s.userRepo.FindByID(ctx, account.UserID)
+		if err != nil {
+			return nil, e.NewNotAuthorizedError("linked account no longer exists")
+		}
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, e.NewInternalError()
+	}
+
+	if identity.Email == "" {
+		return nil, e.NewValidationError("identity provider did not share an email address")
+	}
+
+	existingUser, err := s.userRepo.FindByEmail(ctx, identity.Email)
+	if err == nil && existingUser != nil {
+		if !linkByEmail || !identity.EmailVerified {
+			return nil, e.NewConflictError(fmt.Sprintf("an account with this email already exists, sign in and link %s from your account settings", identity.Provider))
+		}
+		if err := s.createAccount(ctx, existingUser.ID, identity); err != nil {
+			return nil, err
+		}
+		return existingUser, nil
+	}
+
+	user := &models.User{
+		Email:          identity.Email,
+		Name:           identity.Name,
+		ProfilePicture: identity.Picture,
+		EmailVerified:  identity.EmailVerified,
+		Role:           models.RolePatient,
+		IsActive:       true,
+		AuthProvider:   identity.Provider,
+	}
+	if err := s.userRepo.CreateUser(user, ctx); err != nil {
+		return nil, e.NewInternalError()
+	}
+	if err := s.createAccount(ctx, user.ID, identity); err != nil {
+		return nil, err
+	}
+
+	user.IsNewUser = true
+	return user, nil
+}
+
+func (s *OAuthService) link(ctx context.Context, userID uint, identity ExternalIdentity) (*models.User, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, e.NewNotFoundError("user not found")
+	}
+
+	account, err := s.oauthRepo.FindAccount(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		if account.UserID != userID {
+			return nil, e.NewConflictError(fmt.Sprintf("this %s account is already linked to another user", identity.Provider))
+		}
+		return user, nil
+	}
+
+	if _, err := s.oauthRepo.FindUserAccount(ctx, userID, identity.Provider); err == nil {
+		return nil, e.NewConflictError(fmt.Sprintf("a different %s account is already linked, unlink it first", identity.Provider))
+	}
+
+	if err := s.createAccount(ctx, userID, identity); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *OAuthService) createAccount(ctx context.Context, userID uint, identity ExternalIdentity) error {
+	account := &models.OAuthAccount{
+		UserID:     userID,
+		Provider:   identity.Provider,
+		ProviderID: identity.Subject,
+		Email:      identity.Email,
+	}
+	if err := s.oauthRepo.CreateAccount(ctx, account); err != nil {
+		log.Printf("Failed to link %s account for user %d: %v", identity.Provider, userID, err)
+		return e.NewInternalError()
+	}
+	return nil
+}
+
+func (s *OAuthService) LinkedAccounts(ctx context.Context, userID uint) ([]models.OAuthAccount, error) {
+	accounts, err := s.oauthRepo.FindAccountsByUser(ctx, userID)
+	if err != nil {
+		return nil, e.NewInternalError()
+	}
+	return accounts, nil
+}
+
+// Unlink removes a linked provider, unless it is the account's only way to sign in
+func (s *OAuthService) Unlink(ctx context.Context, userID uint, providerName string) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return e.NewNotFoundError("user not found")
+	}
+
+	if _, err := s.oauthRepo.FindUserAccount(ctx, userID, providerName); err != nil {
+		return e.NewNotFoundError(fmt.Sprintf("no linked %s account", providerName))
+	}
+
+	if user.PasswordHash == "" {
+		count, err := s.oauthRepo.CountAccountsByUser(ctx, userID)
+		if err != nil {
+			return e.NewInternalError()
+		}
+		if count <= 1 {
+			return e.NewValidationError("set a password before unlinking your only sign-in method")
+		}
+	}
+
+	if err := s.oauthRepo.DeleteAccount(ctx, userID, providerName); err != nil {
+		return e.NewInternalError()
+	}
+	return nil
+}
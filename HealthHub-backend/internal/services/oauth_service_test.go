@@ -0,0 +1,378 @@
+package services
+
+import (
+	"HealthHubConnect/config"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/oidc"
+	"HealthHubConnect/internal/repositories"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/oauth2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	stubClientID     = "healthhub"
+	stubClientSecret = "secret"
+	stubRedirectURL  = "https://healthhub.example/v1/auth/oidc/hospital/callback"
+	stubSubject      = "employee-42"
+	stubEmail        = "jane@hospital.example"
+)
+
+// stubIdP is an identity provider serving discovery, keys, authorization and
+// token endpoints. The edit hooks let a test misbehave at one step.
+type stubIdP struct {
+	server     *httptest.Server
+	key        *rsa.PrivateKey
+	signingKey *rsa.PrivateKey
+
+	editAuthorize func(url.Values)
+	editClaims    func(jwt.MapClaims)
+	editToken     func(string) string
+
+	mu     sync.Mutex
+	grants map[string]url.Values
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &stubIdP{key: key, signingKey: key, grants: map[string]url.Values{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/jwks", idp.jwks)
+	mux.HandleFunc("/authorize", idp.authorize)
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *stubIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(oidc.Discovery{
+		Issuer:                        idp.server.URL,
+		AuthorizationEndpoint:         idp.server.URL + "/authorize",
+		TokenEndpoint:                 idp.server.URL + "/token",
+		JWKSURI:                       idp.server.URL + "/jwks",
+		CodeChallengeMethodsSupported: []string{"S256"},
+	})
+}
+
+func (idp *stubIdP) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize signs the user in at once and sends them back with a code
+func (idp *stubIdP) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if idp.editAuthorize != nil {
+		idp.editAuthorize(query)
+	}
+	if query.Get("client_id") != stubClientID || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	code := "code-" + query.Get("state")
+	idp.mu.Lock()
+	idp.grants[code] = query
+	idp.mu.Unlock()
+
+	redirect, _ := url.Parse(query.Get("redirect_uri"))
+	redirect.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (idp *stubIdP) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if clientID != stubClientID || clientSecret != stubClientSecret {
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	// codes are good for one exchange
+	idp.mu.Lock()
+	grant, ok := idp.grants[r.PostFormValue("code")]
+	delete(idp.grants, r.PostFormValue("code"))
+	idp.mu.Unlock()
+	if !ok || r.PostFormValue("redirect_uri") != grant.Get("redirect_uri") {
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != grant.Get("code_challenge") {
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"sub":            stubSubject,
+		"aud":            stubClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          grant.Get("nonce"),
+		"email":          stubEmail,
+		"email_verified": true,
+		"name":           "Jane Doe",
+	}
+	if idp.editClaims != nil {
+		idp.editClaims(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "k1"
+	idToken, err := token.SignedString(idp.signingKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if idp.editToken != nil {
+		idToken = idp.editToken(idToken)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func tokenError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+// signIn follows the authorization URL to the stub and returns the code and
+// state it redirected back with
+func (idp *stubIdP) signIn(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+	client := idp.server.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorization endpoint answered %d", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := location.Scheme + "://" + location.Host + location.Path; got != stubRedirectURL {
+		t.Fatalf("redirected to %s, want %s", got, stubRedirectURL)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func newTestOAuthService(t *testing.T, idp *stubIdP) *OAuthService {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection would get its own empty in-memory database
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&models.User{}, &models.OAuthAccount{}, &models.OIDCLoginState{}); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := oidc.NewRegistry([]config.OIDCProviderConfig{{
+		Name:         "hospital",
+		IssuerURL:    idp.server.URL,
+		ClientID:     stubClientID,
+		ClientSecret: stubClientSecret,
+		RedirectURL:  stubRedirectURL,
+	}}, idp.server.Client())
+	return NewOAuthService(repositories.NewOAuthRepository(db), repositories.NewUserRepository(db), registry)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		setup   func(*stubIdP)
+		wantErr bool
+	}{
+		{
+			name: "successful login",
+		},
+		{
+			name: "verifier does not match the challenge",
+			setup: func(idp *stubIdP) {
+				idp.editAuthorize = func(query url.Values) {
+					query.Set("code_challenge", oauth2.S256ChallengeFromVerifier(oauth2.GenerateVerifier()))
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "tampered payload",
+			setup: func(idp *stubIdP) {
+				idp.editToken = func(token string) string {
+					parts := strings.Split(token, ".")
+					payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+					payload = []byte(strings.Replace(string(payload), stubEmail, "admin@hospital.example", 1))
+					parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+					return strings.Join(parts, ".")
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name:    "signed with an unpublished key",
+			setup:   func(idp *stubIdP) { idp.signingKey = otherKey },
+			wantErr: true,
+		},
+		{
+			name: "issued for another client",
+			setup: func(idp *stubIdP) {
+				idp.editClaims = func(claims jwt.MapClaims) { claims["aud"] = "another-client" }
+			},
+			wantErr: true,
+		},
+		{
+			name: "issued by another issuer",
+			setup: func(idp *stubIdP) {
+				idp.editClaims = func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example" }
+			},
+			wantErr: true,
+		},
+		{
+			name: "nonce of another login",
+			setup: func(idp *stubIdP) {
+				idp.editClaims = func(claims jwt.MapClaims) { claims["nonce"] = "replayed" }
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newStubIdP(t)
+			if tt.setup != nil {
+				tt.setup(idp)
+			}
+			s := newTestOAuthService(t, idp)
+			ctx := context.Background()
+
+			authURL, err := s.BeginLogin(ctx, "hospital")
+			if err != nil {
+				t.Fatal(err)
+			}
+			request, err := url.Parse(authURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			query := request.Query()
+			if !strings.HasPrefix(authURL, idp.server.URL+"/authorize?") {
+				t.Errorf("authorization URL %s is not the discovered endpoint", authURL)
+			}
+			if !strings.Contains(" "+query.Get("scope")+" ", " openid ") {
+				t.Errorf("scope %q lacks openid", query.Get("scope"))
+			}
+			for _, param := range []string{"state", "nonce", "code_challenge"} {
+				if query.Get(param) == "" {
+					t.Errorf("authorization URL has no %s", param)
+				}
+			}
+			if query.Get("code_verifier") != "" {
+				t.Error("authorization URL leaks the code verifier")
+			}
+
+			code, state := idp.signIn(t, authURL)
+			if state != query.Get("state") {
+				t.Fatalf("state %q came back as %q", query.Get("state"), state)
+			}
+
+			result, err := s.HandleCallback(ctx, "hospital", code, state)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("login succeeded as %s", result.User.Email)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.User.Email != stubEmail || !result.User.EmailVerified || !result.User.IsNewUser {
+				t.Errorf("signed in as %+v", result.User)
+			}
+			account, err := s.oauthRepo.FindAccount(ctx, "hospital", stubSubject)
+			if err != nil || account.UserID != result.User.ID {
+				t.Errorf("account not linked: %+v, %v", account, err)
+			}
+
+			// the state is spent
+			if _, err := s.HandleCallback(ctx, "hospital", code, state); err == nil {
+				t.Error("replayed callback succeeded")
+			}
+		})
+	}
+}
+
+func TestOIDCDiscoveryOfAnotherIssuer(t *testing.T) {
+	idp := newStubIdP(t)
+	// serves the stub's document, which names the stub as its issuer
+	impostor := httptest.NewServer(http.HandlerFunc(idp.discovery))
+	defer impostor.Close()
+
+	s := newTestOAuthService(t, idp)
+	s.providers = oidc.NewRegistry([]config.OIDCProviderConfig{{
+		Name:         "hospital",
+		IssuerURL:    impostor.URL,
+		ClientID:     stubClientID,
+		ClientSecret: stubClientSecret,
+		RedirectURL:  stubRedirectURL,
+	}}, impostor.Client())
+
+	if _, err := s.BeginLogin(context.Background(), "hospital"); err == nil {
+		t.Error("login began with the discovery document of another issuer")
+	}
+}
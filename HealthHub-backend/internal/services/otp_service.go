@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// otpPolicy is how long a code of a purpose lives and how it may be retried
+type otpPolicy struct {
+	TTL         time.Duration
+	MaxAttempts int
+	Cooldown    time.Duration // minimum gap between two sends
+	MaxPerHour  int
+}
+
+var otpPolicies = map[models.OTPPurpose]otpPolicy{
+	models.OTPPurposeEmailVerify:   {TTL: 24 * time.Hour, MaxAttempts: 5, Cooldown: time.Minute, MaxPerHour: 5},
+	models.OTPPurposePasswordReset: {TTL: 15 * time.Minute, MaxAttempts: 5, Cooldown: time.Minute, MaxPerHour: 5},
+	models.OTPPurposeLoginMFA:      {TTL: 5 * time.Minute, MaxAttempts: 3, Cooldown: 30 * time.Second, MaxPerHour: 10},
+	models.OTPPurposePhoneVerify:   {TTL: 10 * time.Minute, MaxAttempts: 5, Cooldown: time.Minute, MaxPerHour: 5},
+}
+
+type OTPService struct {
+	otpRepo *repositories.OTPRepository
+}
+
+func NewOTPService(otpRepo *repositories.OTPRepository) *OTPService {
+	return &OTPService{otpRepo: otpRepo}
+}
+
+// Issue creates a new code for the purpose and returns it in plaintext for
+// delivery, replacing the previous one. Sends are rate limited per purpose.
+func (s *OTPService) Issue(ctx context.Context, userID uint, purpose models.OTPPurpose) (string, time.Duration, error) {
+	policy, ok := otpPolicies[purpose]
+	if !ok {
+		return "", 0, e.NewValidationError(fmt.Sprintf("unknown otp purpose: %s", purpose))
+	}
+
+	now := time.Now()
+	latest, err := s.otpRepo.FindLatest(ctx, userID, purpose)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", 0, e.NewInternalError()
+	}
+	if latest != nil {
+		if wait := latest.CreatedAt.Add(policy.Cooldown).Sub(now); wait > 0 {
+			return "", 0, e.NewTooManyRequestsError(fmt.Sprintf("please wait %d seconds before requesting another code", int(math.Ceil(wait.Seconds()))))
+		}
+	}
+
+	issued, err := s.otpRepo.CountIssuedSince(ctx, userID, purpose, now.Add(-time.Hour))
+	if err != nil {
+		return "", 0, e.NewInternalError()
+	}
+	if issued >= int64(policy.MaxPerHour) {
+		return "", 0, e.NewTooManyRequestsError("too many codes requested, please try again later")
+	}
+
+	code, err := utils.GenerateOTP()
+	if err != nil {
+		return "", 0, e.NewInternalError()
+	}
+	hash, err := utils.HashOTP(userID, string(purpose), code)
+	if err != nil {
+		log.Printf("Failed to hash otp: %v", err)
+		return "", 0, e.NewInternalError()
+	}
+
+	record := &models.OneTimeCode{
+		UserID:      userID,
+		Purpose:     purpose,
+		CodeHash:    hash,
+		MaxAttempts: policy.MaxAttempts,
+		ExpiresAt:   now.Add(policy.TTL),
+	}
+	if err := s.otpRepo.Replace(ctx, record); err != nil {
+		return "", 0, e.NewInternalError()
+	}
+
+	return code, policy.TTL, nil
+}
+
+// Verify consumes the live code of the purpose if it matches. Every call
+// spends one attempt, a code that ran out of attempts has to be re-issued.
+func (s *OTPService) Verify(ctx context.Context, userID uint, purpose models.OTPPurpose, code string) error {
+	if len(code) != utils.OTPLength || !utils.IsNumeric(code) {
+		return e.NewValidationError(fmt.Sprintf("invalid OTP format - must be %d digits", utils.OTPLength))
+	}
+
+	record, err := s.otpRepo.FindLatest(ctx, userID, purpose)
+	if err != nil || record.ConsumedAt != nil {
+		return e.NewValidationError("invalid OTP")
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return e.NewValidationError("OTP has expired")
+	}
+
+	allowed, err := s.otpRepo.RegisterAttempt(ctx, record.ID)
+	if err != nil {
+		return e.NewInternalError()
+	}
+	if !allowed {
+		return e.NewTooManyRequestsError("too many incorrect attempts, please request a new code")
+	}
+
+	hash, err := utils.HashOTP(userID, string(purpose), code)
+	if err != nil {
+		return e.NewInternalError()
+	}
+	if !hmac.Equal([]byte(hash), []byte(record.CodeHash)) {
+		return e.NewValidationError("invalid OTP")
+	}
+
+	consumed, err := s.otpRepo.Consume(ctx, record.ID)
+	if err != nil {
+		return e.NewInternalError()
+	}
+	if !consumed {
+		return e.NewValidationError("invalid OTP")
+	}
+	return nil
+}
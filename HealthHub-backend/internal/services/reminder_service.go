@@ -0,0 +1,135 @@
+package services
+
+import (
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/utils"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ReminderService emails patients ahead of their confirmed appointments at
+// the offsets set in the admin settings
+type ReminderService struct {
+	reminderRepo *repositories.ReminderRepository
+	adminRepo    *repositories.AdminRepository
+}
+
+func NewReminderService(reminderRepo *repositories.ReminderRepository, adminRepo *repositories.AdminRepository) *ReminderService {
+	return &ReminderService{
+		reminderRepo: reminderRepo,
+		adminRepo:    adminRepo,
+	}
+}
+
+func (s *ReminderService) schedule(ctx context.Context) []time.Duration {
+	settings, err := s.adminRepo.GetSystemSettings(ctx)
+	if err != nil {
+		log.Printf("Failed to load reminder settings, using defaults: %v", err)
+		return (&models.AdminSettings{}).ReminderSchedule()
+	}
+	return settings.ReminderSchedule()
+}
+
+// SendDue sends the reminders that are due at now and returns how many went
+// out. An appointment gets the reminder of the nearest offset it has reached,
+// one booked 30 minutes ahead gets the 1h reminder and not the 24h one too.
+func (s *ReminderService) SendDue(ctx context.Context, now time.Time) (int, error) {
+	offsets := s.schedule(ctx)
+
+	sent := 0
+	for i, offset := range offsets {
+		var nearer time.Duration
+		if i+1 < len(offsets) {
+			nearer = offsets[i+1]
+		}
+
+		offsetMinutes := int(offset / time.Minute)
+		appointments, err := s.reminderRepo.FindDue(ctx, now.Add(nearer), now.Add(offset), offsetMinutes)
+		if err != nil {
+			return sent, err
+		}
+
+		for j := range appointments {
+			ok, err := s.send(ctx, &appointments[j], offsetMinutes)
+			if err != nil {
+				return sent, err
+			}
+			if ok {
+				sent++
+			}
+		}
+	}
+	return sent, nil
+}
+
+// send claims the reminder and emails it. A reminder that was claimed is
+// never sent again, even when the email fails.
+func (s *ReminderService) send(ctx context.Context, appointment *models.Appointment, offsetMinutes int) (bool, error) {
+	reminder := &models.AppointmentReminder{
+		AppointmentID: appointment.ID,
+		OffsetMinutes: offsetMinutes,
+		Recipient:     appointment.Patient.Email,
+		Status:        models.ReminderSending,
+	}
+	claimed, err := s.reminderRepo.Claim(ctx, reminder)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	subject, body := reminderEmail(appointment)
+	if err := utils.SendEmail(appointment.Patient.Email, subject, body); err != nil {
+		log.Printf("Failed to send reminder for appointment %d: %v", appointment.ID, err)
+		reminder.Status = models.ReminderFailed
+		reminder.Error = err.Error()
+		return false, s.reminderRepo.Update(ctx, reminder)
+	}
+
+	sentAt := time.Now()
+	reminder.Status = models.ReminderSent
+	reminder.SentAt = &sentAt
+	return true, s.reminderRepo.Update(ctx, reminder)
+}
+
+func reminderEmail(appointment *models.Appointment) (string, string) {
+	var where string
+	switch appointment.Type {
+	case models.TypeOnline:
+		where = "This is an online consultation."
+		if appointment.MeetLink != "" {
+			where += "\nJoin the call at: " + appointment.MeetLink
+		}
+	default:
+		where = "This is an in-person consultation."
+		if appointment.Address != "" {
+			where += "\nAddress: " + appointment.Address
+		}
+	}
+
+	doctor := strings.TrimSpace(appointment.Doctor.Name)
+	if doctor == "" {
+		doctor = "your doctor"
+	} else {
+		doctor = "Dr. " + doctor
+	}
+
+	loc := utils.TimezoneOrUTC(appointment.Patient.Timezone)
+	subject := "Appointment Reminder - HealthHub"
+	body := fmt.Sprintf(`Dear %s,
+
+This is a reminder of your appointment with %s on %s to %s.
+
+%s
+
+If you can no longer make it, please cancel from your appointments page so the slot can go to someone else.
+
+Best regards,
+HealthHub Team`, appointment.Patient.Name, doctor,
+		appointment.StartTime.In(loc).Format("02 Jan 2006 15:04"),
+		appointment.EndTime.In(loc).Format("15:04 MST"),
+		where)
+	return subject, body
+}
@@ -0,0 +1,335 @@
+package services
+
+import (
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/utils"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// availabilityWeeks is how far ahead the availability rows are generated
+// when the schedule changes
+const availabilityWeeks = 12
+
+// scheduleSet is every schedule of a doctor that can be in force: the weekly
+// schedule and the current version of each named template
+type scheduleSet struct {
+	weekly    *models.Schedule
+	templates []models.ScheduleVersion
+}
+
+func (s *scheduleSet) empty() bool {
+	return s.weekly == nil && len(s.templates) == 0
+}
+
+// on returns the schedule in force on the calendar day of date. Of the
+// templates covering the day the one starting last wins, the one saved last
+// on a tie, and the weekly schedule applies where none does.
+func (s *scheduleSet) on(date time.Time) *models.Schedule {
+	var chosen *models.ScheduleVersion
+	for i := range s.templates {
+		template := &s.templates[i]
+		if !template.Covers(date) {
+			continue
+		}
+		if chosen == nil || !template.EffectiveFrom.Before(chosen.EffectiveFrom) {
+			chosen = template
+		}
+	}
+	if chosen != nil {
+		return chosen.Schedule
+	}
+	if s.weekly != nil {
+		return s.weekly
+	}
+	return &models.Schedule{}
+}
+
+// with returns the set as it would be with version saved, replacing the
+// earlier version of the same schedule
+func (s *scheduleSet) with(version *models.ScheduleVersion) *scheduleSet {
+	if version.Name == models.DefaultScheduleName {
+		return &scheduleSet{weekly: version.Schedule, templates: s.templates}
+	}
+
+	next := &scheduleSet{weekly: s.weekly}
+	for _, template := range s.templates {
+		if template.Name != version.Name {
+			next.templates = append(next.templates, template)
+		}
+	}
+	next.templates = append(next.templates, *version)
+	return next
+}
+
+// loadScheduleSet reads the doctor's weekly schedule and templates, an empty
+// set for a doctor who has saved neither
+func (g *slotEngine) loadScheduleSet(ctx context.Context, doctorID uint) (*scheduleSet, error) {
+	set := &scheduleSet{}
+
+	schedule, err := g.doctorRepo.GetScheduleWithoutValidation(ctx, doctorID)
+	switch {
+	case err == nil:
+		if set.weekly, err = parseSchedule(schedule.Schedule); err != nil {
+			return nil, err
+		}
+	case err != gorm.ErrRecordNotFound:
+		return nil, fmt.Errorf("error getting doctor schedule: %v", err)
+	}
+
+	templates, err := g.doctorRepo.FindCurrentScheduleVersions(ctx, doctorID)
+	if err != nil {
+		return nil, err
+	}
+	for _, template := range templates {
+		if template.Schedule, err = parseSchedule(template.Content); err != nil {
+			return nil, err
+		}
+		set.templates = append(set.templates, template)
+	}
+	return set, nil
+}
+
+// fitsSchedule tells whether r lies inside one slot of the schedule on day,
+// as Validate places appointments. Capacity and blocked time are left out,
+// they don't change with the schedule.
+func fitsSchedule(schedule *models.Schedule, day time.Time, r timeRange) bool {
+	daySchedule, exists := schedule.Days[strings.ToLower(day.Weekday().String())]
+	if !exists || !daySchedule.Enabled {
+		return false
+	}
+
+	breaks := dayBreaks(day, daySchedule)
+	for _, block := range scheduleBlocks(day, daySchedule, schedule.DefaultSettings.TimePerPatient, nil) {
+		for _, slot := range block.slots(breaks) {
+			if !r.start.Before(slot.start) && !r.end.After(slot.end) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// changedDays lists the weekdays whose hours differ between the two schedules
+func changedDays(current, next *models.Schedule) []string {
+	changed := []string{}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		day := strings.ToLower(d.String())
+		before, after := current.Days[day], next.Days[day]
+		if !before.Enabled && !after.Enabled {
+			continue
+		}
+		if !reflect.DeepEqual(before, after) || current.DefaultSettings != next.DefaultSettings {
+			changed = append(changed, day)
+		}
+	}
+	return changed
+}
+
+// PreviewScheduleTemplate shows what saving the request would change without
+// saving it. Without a name it previews a new weekly schedule.
+func (s *DoctorService) PreviewScheduleTemplate(ctx context.Context, doctorID uint, req *models.ScheduleTemplateRequest) (*models.ScheduleImpact, error) {
+	_, impact, err := s.previewVersion(ctx, doctorID, req)
+	return impact, err
+}
+
+// SaveScheduleTemplate saves the next version of a named template. A version
+// that would leave booked appointments outside every slot is refused unless
+// the request allows it, they then stay booked for the doctor to move.
+func (s *DoctorService) SaveScheduleTemplate(ctx context.Context, doctorID uint, req *models.ScheduleTemplateRequest) (*models.ScheduleImpact, error) {
+	if name := strings.TrimSpace(req.Name); name == "" || strings.EqualFold(name, models.DefaultScheduleName) {
+		return nil, e.NewValidationError(fmt.Sprintf("a template needs a name other than %q, the weekly schedule is saved on its own", models.DefaultScheduleName))
+	}
+
+	set, impact, err := s.previewVersion(ctx, doctorID, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOrphans(impact, req.AllowOrphans); err != nil {
+		return nil, err
+	}
+
+	version := impact.Version
+	if err := s.doctorRepo.CreateScheduleVersion(ctx, &version); err != nil {
+		return nil, err
+	}
+	impact.Version = version
+
+	if err := s.regenerateAvailability(ctx, doctorID, set.with(&version)); err != nil {
+		return nil, err
+	}
+	return impact, nil
+}
+
+// ListScheduleTemplates returns the current version of each named template
+func (s *DoctorService) ListScheduleTemplates(ctx context.Context, doctorID uint) ([]models.ScheduleVersion, error) {
+	if err := s.doctorRepo.ValidateDoctorAccess(ctx, doctorID); err != nil {
+		return nil, err
+	}
+
+	templates, err := s.doctorRepo.FindCurrentScheduleVersions(ctx, doctorID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range templates {
+		if templates[i].Schedule, err = parseSchedule(templates[i].Content); err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
+
+// ListScheduleVersions returns the version history of the doctor's weekly
+// schedule and templates, or of the named one, newest first
+func (s *DoctorService) ListScheduleVersions(ctx context.Context, doctorID uint, name string) ([]models.ScheduleVersion, error) {
+	if err := s.doctorRepo.ValidateDoctorAccess(ctx, doctorID); err != nil {
+		return nil, err
+	}
+	return s.doctorRepo.FindScheduleVersions(ctx, doctorID, strings.TrimSpace(name))
+}
+
+func (s *DoctorService) GetScheduleVersion(ctx context.Context, doctorID, id uint) (*models.ScheduleVersion, error) {
+	version, err := s.doctorRepo.FindScheduleVersion(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if version.DoctorID != doctorID {
+		return nil, e.NewForbiddenError("not authorized to access this schedule version")
+	}
+
+	if version.Schedule, err = parseSchedule(version.Content); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// previewVersion turns the request into the doctor's next version of the
+// schedule and works out its impact. It returns the schedules in force now
+// alongside.
+func (s *DoctorService) previewVersion(ctx context.Context, doctorID uint, req *models.ScheduleTemplateRequest) (*scheduleSet, *models.ScheduleImpact, error) {
+	if err := s.doctorRepo.ValidateDoctorAccess(ctx, doctorID); err != nil {
+		return nil, nil, err
+	}
+
+	version, err := req.ToVersion(doctorID, s.slots.location(ctx, doctorID))
+	if err != nil {
+		return nil, nil, e.NewValidationError(err.Error())
+	}
+	if err := s.slots.checkLocations(ctx, doctorID, req.Schedule); err != nil {
+		return nil, nil, err
+	}
+	if version.Version, err = s.doctorRepo.NextScheduleVersion(ctx, doctorID, version.Name); err != nil {
+		return nil, nil, err
+	}
+
+	set, err := s.slots.loadScheduleSet(ctx, doctorID)
+	if err != nil {
+		return nil, nil, err
+	}
+	impact, err := s.scheduleImpact(ctx, doctorID, set, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	return set, impact, nil
+}
+
+// scheduleImpact compares the schedules in force with and without version.
+// An appointment is orphaned when it fits a slot now and wouldn't any more,
+// those already outside the schedule aren't blamed on the new version.
+func (s *DoctorService) scheduleImpact(ctx context.Context, doctorID uint, set *scheduleSet, version *models.ScheduleVersion) (*models.ScheduleImpact, error) {
+	loc := s.slots.location(ctx, doctorID)
+	next := set.with(version)
+	impact := &models.ScheduleImpact{
+		Version:     *version,
+		ChangedDays: changedDays(set.on(version.EffectiveFrom), version.Schedule),
+		Orphaned:    []models.Appointment{},
+	}
+
+	now := time.Now()
+	end := now.Add(models.MaxSeriesAdvanceBooking)
+	if to := version.EffectiveTo; to != nil {
+		if last := utils.WallTime(to.Year(), to.Month(), to.Day()+1, 0, 0, loc); last.After(end) {
+			end = last
+		}
+	}
+
+	bookings, err := upcomingBookings(s.appointmentRepo, doctorID, now, end)
+	if err != nil {
+		return nil, err
+	}
+	for _, apt := range bookings {
+		day := utils.StartOfDay(apt.StartTime, loc)
+		r := timeRange{start: apt.StartTime, end: apt.EndTime}
+		if fitsSchedule(set.on(day), day, r) && !fitsSchedule(next.on(day), day, r) {
+			impact.Orphaned = append(impact.Orphaned, apt.In(loc))
+		}
+	}
+	return impact, nil
+}
+
+func checkOrphans(impact *models.ScheduleImpact, allowed bool) error {
+	if len(impact.Orphaned) == 0 || allowed {
+		return nil
+	}
+	return e.NewConflictError(fmt.Sprintf(
+		"%d booked appointment(s) would fall outside the new schedule, preview it to see them or save with allow_orphans to keep them as booked",
+		len(impact.Orphaned)))
+}
+
+// regenerateAvailability rebuilds the doctor's availability from today on,
+// from the schedule in force each day. The times of upcoming bookings are
+// kept available even where the schedule no longer has them, so nothing
+// booked is lost.
+func (s *DoctorService) regenerateAvailability(ctx context.Context, doctorID uint, set *scheduleSet) error {
+	loc := s.slots.location(ctx, doctorID)
+	now := time.Now().In(loc)
+	startDate := models.CalendarDate(now)
+
+	availabilities, err := s.generateAvailabilitySlots(doctorID, set, startDate, availabilityWeeks)
+	if err != nil {
+		return err
+	}
+
+	bookings, err := upcomingBookings(s.appointmentRepo, doctorID, now, now.Add(models.MaxSeriesAdvanceBooking))
+	if err != nil {
+		return err
+	}
+	for _, apt := range bookings {
+		booked := bookedAvailability(apt, loc)
+		if !coveredBy(booked, availabilities) {
+			availabilities = append(availabilities, booked)
+		}
+	}
+
+	return s.doctorRepo.SaveBulkAvailability(ctx, doctorID, startDate, availabilities)
+}
+
+// bookedAvailability is the availability row an appointment takes up, with
+// the date and clock times of the doctor's calendar as UTC labels like the
+// generated ones
+func bookedAvailability(apt models.Appointment, loc *time.Location) models.DoctorAvailability {
+	start, end := apt.StartTime.In(loc), apt.EndTime.In(loc)
+	date := models.CalendarDate(start)
+	return models.DoctorAvailability{
+		DoctorID:  apt.DoctorID,
+		Date:      date,
+		StartTime: onDay(date, start),
+		EndTime:   onDay(date, end),
+	}
+}
+
+func coveredBy(booked models.DoctorAvailability, availabilities []models.DoctorAvailability) bool {
+	for _, availability := range availabilities {
+		if availability.Date.Equal(booked.Date) &&
+			!booked.StartTime.Before(availability.StartTime) && !booked.EndTime.After(availability.EndTime) {
+			return true
+		}
+	}
+	return false
+}
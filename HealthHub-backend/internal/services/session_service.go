@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"HealthHubConnect/env"
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/utils"
+)
+
+const (
+	RevokeReasonLogout        = "logout"
+	RevokeReasonLogoutAll     = "logout_all"
+	RevokeReasonReuse         = "reuse_detected"
+	RevokeReasonSuspended     = "user_suspended"
+	RevokeReasonDeleted       = "user_deleted"
+	RevokeReasonPasswordReset = "password_reset"
+)
+
+// SessionService owns refresh token issuance and rotation. Each login starts a
+// token family; every refresh consumes the presented token and issues the next
+// one in the same family. Presenting an already consumed token revokes the
+// whole family, since either the client or an attacker is holding a stale copy.
+type SessionService struct {
+	sessionRepo *repositories.SessionRepository
+	userRepo    *repositories.UserRepository
+}
+
+func NewSessionService(sessionRepo *repositories.SessionRepository, userRepo *repositories.UserRepository) *SessionService {
+	return &SessionService{
+		sessionRepo: sessionRepo,
+		userRepo:    userRepo,
+	}
+}
+
+func (s *SessionService) StartSession(ctx context.Context, user *models.User) (utils.TokenPair, error) {
+	familyID, err := utils.NewRandomID()
+	if err != nil {
+		return utils.TokenPair{}, e.NewInternalError()
+	}
+	return s.issue(ctx, user, familyID)
+}
+
+func (s *SessionService) issue(ctx context.Context, user *models.User, familyID string) (utils.TokenPair, error) {
+	tokenPair, err := utils.GenerateTokenPair(user.ID, user.Role, familyID)
+	if err != nil {
+		return utils.TokenPair{}, e.NewInternalError()
+	}
+
+	ipAddress := "unknown"
+	if ip, ok := ctx.Value("ipAddress").(string); ok && ip != "" {
+		ipAddress = ip
+	}
+
+	session := &models.RefreshSession{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenID:   tokenPair.RefreshTokenID,
+		IPAddress: ipAddress,
+		ExpiresAt: tokenPair.RefreshExpiresAt,
+	}
+	if err := s.sessionRepo.CreateSession(ctx, session); err != nil {
+		log.Printf("Failed to persist refresh session: %v", err)
+		return utils.TokenPair{}, e.NewInternalError()
+	}
+
+	return tokenPair, nil
+}
+
+// Rotate redeems a refresh token exactly once and returns the next pair of the family
+func (s *SessionService) Rotate(ctx context.Context, refreshToken string) (*models.User, utils.TokenPair, error) {
+	claims, err := utils.ValidateToken(refreshToken, env.Jwt.RefreshTokenSecret, utils.RefreshToken)
+	if err != nil {
+		if errors.Is(err, utils.ErrExpiredRefreshToken) {
+			return nil, utils.TokenPair{}, e.NewNotAuthorizedError("refresh token has expired, please log in again")
+		}
+		return nil, utils.TokenPair{}, e.NewNotAuthorizedError("invalid refresh token")
+	}
+
+	session, err := s.sessionRepo.FindByTokenID(ctx, claims.ID)
+	if err != nil || session.FamilyID != claims.SessionID || session.UserID != claims.UserID {
+		return nil, utils.TokenPair{}, e.NewNotAuthorizedError("invalid refresh token")
+	}
+
+	if session.RevokedAt != nil {
+		return nil, utils.TokenPair{}, e.NewNotAuthorizedError("session has been revoked")
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, utils.TokenPair{}, e.NewNotAuthorizedError("refresh token has expired, please log in again")
+	}
+
+	consumed, err := s.sessionRepo.MarkUsed(ctx, session.TokenID)
+	if err != nil {
+		return nil, utils.TokenPair{}, e.NewInternalError()
+	}
+	if !consumed {
+		// token was already redeemed once, treat the family as compromised
+		if err := s.sessionRepo.RevokeFamily(ctx, session.FamilyID, RevokeReasonReuse); err != nil {
+			log.Printf("Failed to revoke session family %s: %v", session.FamilyID, err)
+		}
+		log.Printf("Refresh token reuse detected for user %d, family %s revoked", session.UserID, session.FamilyID)
+		return nil, utils.TokenPair{}, e.NewNotAuthorizedError("refresh token reuse detected, please log in again")
+	}
+
+	user, err := s.userRepo.FindByID(ctx, session.UserID)
+	if err != nil {
+		return nil, utils.TokenPair{}, e.NewNotAuthorizedError("invalid refresh token")
+	}
+	if !user.IsActive {
+		s.sessionRepo.RevokeFamily(ctx, session.FamilyID, RevokeReasonSuspended)
+		return nil, utils.TokenPair{}, e.NewForbiddenError("account is suspended")
+	}
+
+	tokenPair, err := s.issue(ctx, user, session.FamilyID)
+	if err != nil {
+		return nil, utils.TokenPair{}, err
+	}
+
+	user.PasswordHash = ""
+	return user, tokenPair, nil
+}
+
+// Logout revokes the family the given refresh token belongs to, i.e. the current device
+func (s *SessionService) Logout(ctx context.Context, refreshToken string) error {
+	claims, err := utils.ValidateToken(refreshToken, env.Jwt.RefreshTokenSecret, utils.RefreshToken)
+	if errors.Is(err, utils.ErrExpiredRefreshToken) {
+		// an expired family has nothing left to revoke
+		return nil
+	}
+	if err != nil {
+		return e.NewNotAuthorizedError("invalid refresh token")
+	}
+
+	if err := s.sessionRepo.RevokeFamily(ctx, claims.SessionID, RevokeReasonLogout); err != nil {
+		return e.NewInternalError()
+	}
+	return nil
+}
+
+func (s *SessionService) RevokeUserSessions(ctx context.Context, userID uint, reason string) error {
+	if err := s.sessionRepo.RevokeAllForUser(ctx, userID, reason); err != nil {
+		log.Printf("Failed to revoke sessions for user %d: %v", userID, err)
+		return e.NewInternalError()
+	}
+	return nil
+}
+
+func (s *SessionService) IsSessionActive(ctx context.Context, sessionID string) (bool, error) {
+	if sessionID == "" {
+		return false, nil
+	}
+	return s.sessionRepo.IsFamilyActive(ctx, sessionID)
+}
@@ -0,0 +1,570 @@
+package services
+
+import (
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultSlotDuration is used when neither the slot nor the schedule
+	// defaults say how long a consultation takes
+	defaultSlotDuration = 30 * time.Minute
+
+	// rejected bookings suggest up to maxSlotSuggestions free slots found
+	// within suggestionSearchDays of the requested time
+	maxSlotSuggestions   = 3
+	suggestionSearchDays = 7
+)
+
+type timeRange struct {
+	start time.Time
+	end   time.Time
+}
+
+func (t timeRange) overlaps(other timeRange) bool {
+	return t.start.Before(other.end) && other.start.Before(t.end)
+}
+
+type slotBlock struct {
+	timeRange
+	duration time.Duration
+	capacity int
+	location *models.SlotLocation
+}
+
+// dayPlan is a doctor's schedule for one calendar day expanded into dated
+// slots, with the breaks, blocked ranges, leave and holiday that shaped it
+type dayPlan struct {
+	Date         time.Time
+	Open         bool
+	Holiday      string
+	Hours        []timeRange
+	Breaks       []timeRange
+	Blocked      []timeRange
+	TimeOff      []timeRange
+	Slots        []models.TimeSlot
+	Appointments []models.Appointment
+	Holds        []models.SlotHold
+}
+
+func (p *dayPlan) available() []models.TimeSlot {
+	slots := []models.TimeSlot{}
+	for _, slot := range p.Slots {
+		if slot.Available {
+			slots = append(slots, slot)
+		}
+	}
+	return slots
+}
+
+// slotEngine turns the weekly schedule JSON into bookable slots for a date
+type slotEngine struct {
+	doctorRepo      *repositories.DoctorRepository
+	appointmentRepo repositories.AppointmentRepository
+	timeOffRepo     *repositories.TimeOffRepository
+	// horizon is how far ahead bookings are accepted, MaxAdvanceBooking
+	// when unset
+	horizon time.Duration
+}
+
+func newSlotEngine(doctorRepo *repositories.DoctorRepository, appointmentRepo repositories.AppointmentRepository, timeOffRepo *repositories.TimeOffRepository) *slotEngine {
+	return &slotEngine{
+		doctorRepo:      doctorRepo,
+		appointmentRepo: appointmentRepo,
+		timeOffRepo:     timeOffRepo,
+	}
+}
+
+// within returns a copy of the engine that accepts bookings up to horizon
+// ahead
+func (g *slotEngine) within(horizon time.Duration) *slotEngine {
+	engine := *g
+	engine.horizon = horizon
+	return &engine
+}
+
+func (g *slotEngine) maxAdvance() time.Duration {
+	if g.horizon > 0 {
+		return g.horizon
+	}
+	return models.MaxAdvanceBooking
+}
+
+// location returns the zone a doctor's schedule is written in. Doctors who
+// never set one work in UTC.
+func (g *slotEngine) location(ctx context.Context, doctorID uint) *time.Location {
+	name, err := g.doctorRepo.GetTimezone(ctx, doctorID)
+	if err != nil {
+		log.Printf("Error getting timezone of doctor %d: %v", doctorID, err)
+		return time.UTC
+	}
+	loc, err := utils.LoadTimezone(name)
+	if err != nil {
+		log.Printf("Doctor %d has an unknown timezone %q: %v", doctorID, name, err)
+		return time.UTC
+	}
+	return loc
+}
+
+// loadSchedule is loadScheduleSet for planning, a doctor without any
+// schedule has nothing to plan
+func (g *slotEngine) loadSchedule(ctx context.Context, doctorID uint) (*scheduleSet, error) {
+	schedules, err := g.loadScheduleSet(ctx, doctorID)
+	if err != nil {
+		return nil, err
+	}
+	if schedules.empty() {
+		return nil, e.NewNotFoundError("doctor schedule not found")
+	}
+	return schedules, nil
+}
+
+// Plan expands the schedule in force for the calendar day of date, read in
+// date's own zone. Pass instants converted to the doctor's location.
+func (g *slotEngine) Plan(ctx context.Context, doctorID uint, date time.Time) (*dayPlan, error) {
+	schedules, err := g.loadSchedule(ctx, doctorID)
+	if err != nil {
+		return nil, err
+	}
+	return g.plan(ctx, doctorID, schedules.on(date), date)
+}
+
+func (g *slotEngine) plan(ctx context.Context, doctorID uint, schedule *models.Schedule, date time.Time) (*dayPlan, error) {
+	day := utils.WallTime(date.Year(), date.Month(), date.Day(), 0, 0, g.location(ctx, doctorID))
+	plan := &dayPlan{Date: day}
+
+	daySchedule, exists := schedule.Days[strings.ToLower(day.Weekday().String())]
+	if !exists || !daySchedule.Enabled {
+		return plan, nil
+	}
+	plan.Open = true
+
+	var locations *practiceLocations
+	if refs := locationRefs(daySchedule); len(refs) > 0 {
+		loaded, err := g.loadLocations(ctx, doctorID, refs)
+		if err != nil {
+			return nil, err
+		}
+		locations = loaded
+	}
+
+	blocks := scheduleBlocks(day, daySchedule, schedule.DefaultSettings.TimePerPatient, locations)
+	for _, block := range blocks {
+		plan.Hours = append(plan.Hours, block.timeRange)
+	}
+
+	plan.Breaks = dayBreaks(day, daySchedule)
+
+	blockedSlots, err := g.doctorRepo.GetBlockedSlots(ctx, doctorID, day)
+	if err != nil {
+		return nil, err
+	}
+	for _, blocked := range blockedSlots {
+		plan.Blocked = append(plan.Blocked, timeRange{
+			start: onDay(day, blocked.StartTime),
+			end:   onDay(day, blocked.EndTime),
+		})
+	}
+
+	holidays, err := g.timeOffRepo.FindHolidaysOn(ctx, doctorID, day)
+	if err != nil {
+		return nil, err
+	}
+	if len(holidays) > 0 {
+		plan.Holiday = holidays[0].Name
+	}
+
+	// the next midnight rather than 24 hours on, DST days are 23 or 25 hours
+	nextDay := utils.AddDays(day, 1)
+	timeOff, err := g.timeOffRepo.FindOverlapping(ctx, doctorID, day, nextDay)
+	if err != nil {
+		return nil, err
+	}
+	for _, leave := range timeOff {
+		plan.TimeOff = append(plan.TimeOff, timeRange{start: leave.StartTime, end: leave.EndTime})
+	}
+
+	appointments, err := g.appointmentRepo.GetAppointmentsByDoctorAndDateRange(doctorID, day, nextDay)
+	if err != nil {
+		return nil, err
+	}
+	plan.Appointments = appointments
+
+	holds, err := g.appointmentRepo.GetActiveHoldsByDoctorAndDateRange(doctorID, day, nextDay)
+	if err != nil {
+		return nil, err
+	}
+	plan.Holds = holds
+
+	now := time.Now()
+	for _, block := range blocks {
+		for _, r := range block.slots(plan.Breaks) {
+			slot := models.TimeSlot{
+				StartTime: r.start,
+				EndTime:   r.end,
+				Capacity:  block.capacity,
+				Booked:    countBookings(r, appointments) + countHolds(r, holds),
+				Blocked:   plan.Holiday != "" || overlapsAny(r, plan.Blocked) || overlapsAny(r, plan.TimeOff),
+				Location:  block.location,
+			}
+			if slot.Booked < slot.Capacity {
+				slot.Remaining = slot.Capacity - slot.Booked
+			}
+			slot.Available = !slot.Blocked && slot.Remaining > 0 && r.start.After(now)
+			plan.Slots = append(plan.Slots, slot)
+		}
+	}
+
+	return plan, nil
+}
+
+// Validate checks that the appointment's time range sits inside one bookable
+// slot of its doctor. The appointment itself is not counted against capacity
+// so it can be moved within its own slot
+func (g *slotEngine) Validate(ctx context.Context, appointment *models.Appointment) (*models.TimeSlot, error) {
+	now := time.Now()
+	requested := timeRange{start: appointment.StartTime, end: appointment.EndTime}
+
+	switch {
+	case requested.start.Before(now):
+		return nil, g.reject(ctx, appointment, models.SlotInPast, "cannot schedule appointments in the past")
+	case requested.start.Before(now.Add(models.MinAdvanceBooking)):
+		return nil, g.reject(ctx, appointment, models.SlotTooSoon,
+			fmt.Sprintf("appointments must be booked at least %s in advance", formatDuration(models.MinAdvanceBooking)))
+	case requested.start.After(now.Add(g.maxAdvance())):
+		return nil, g.reject(ctx, appointment, models.SlotTooFarAhead,
+			fmt.Sprintf("appointments can be booked at most %s in advance", formatDuration(g.maxAdvance())))
+	}
+
+	plan, err := g.Plan(ctx, appointment.DoctorID, requested.start.In(g.location(ctx, appointment.DoctorID)))
+	if err != nil {
+		return nil, err
+	}
+	if !plan.Open {
+		return nil, g.reject(ctx, appointment, models.SlotDayClosed, "doctor is not available on this day")
+	}
+	if plan.Holiday != "" {
+		return nil, g.reject(ctx, appointment, models.SlotHoliday, fmt.Sprintf("doctor is closed for %s", plan.Holiday))
+	}
+	if overlapsAny(requested, plan.TimeOff) {
+		return nil, g.reject(ctx, appointment, models.SlotTimeOff, "doctor is on leave at the requested time")
+	}
+	if !withinAny(requested, plan.Hours) {
+		return nil, g.reject(ctx, appointment, models.SlotOutsideHours, "requested time is outside the doctor's working hours")
+	}
+	if overlapsAny(requested, plan.Breaks) {
+		return nil, g.reject(ctx, appointment, models.SlotDuringBreak, "requested time falls in the doctor's break")
+	}
+	if overlapsAny(requested, plan.Blocked) {
+		return nil, g.reject(ctx, appointment, models.SlotBlocked, "requested time has been blocked by the doctor")
+	}
+
+	for _, slot := range plan.Slots {
+		r := timeRange{start: slot.StartTime, end: slot.EndTime}
+		if requested.start.Before(r.start) || requested.end.After(r.end) {
+			continue
+		}
+
+		var others []models.Appointment
+		for _, apt := range plan.Appointments {
+			if apt.ID != appointment.ID {
+				others = append(others, apt)
+			}
+		}
+		if countBookings(r, others)+countHolds(r, plan.Holds) >= slot.Capacity {
+			return nil, g.reject(ctx, appointment, models.SlotFull, "time slot already booked")
+		}
+		return &slot, nil
+	}
+
+	return nil, g.reject(ctx, appointment, models.SlotNotBookable, "requested time does not match a bookable slot")
+}
+
+func (g *slotEngine) reject(ctx context.Context, appointment *models.Appointment, reason models.SlotRejectionReason, message string) error {
+	suggestions, err := g.Suggest(ctx, appointment.DoctorID, appointment.StartTime)
+	if err != nil {
+		log.Printf("Error finding alternative slots for doctor %d: %v", appointment.DoctorID, err)
+		suggestions = []models.TimeSlot{}
+	}
+
+	return e.NewSlotUnavailableError(message, models.SlotRejection{
+		Reason:      reason,
+		Suggestions: suggestions,
+	})
+}
+
+// Suggest returns the free slots closest to around that are inside the
+// booking window, searching suggestionSearchDays either side of it
+func (g *slotEngine) Suggest(ctx context.Context, doctorID uint, around time.Time) ([]models.TimeSlot, error) {
+	suggestions := []models.TimeSlot{}
+
+	schedules, err := g.loadSchedule(ctx, doctorID)
+	if err != nil {
+		if _, ok := err.(*e.CustomError); ok {
+			return suggestions, nil
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	earliest := now.Add(models.MinAdvanceBooking)
+	latest := now.Add(g.maxAdvance())
+	if around.Before(earliest) {
+		around = earliest
+	} else if around.After(latest) {
+		around = latest
+	}
+
+	var candidates []models.TimeSlot
+	day := utils.StartOfDay(around, g.location(ctx, doctorID))
+	for i := -suggestionSearchDays; i <= suggestionSearchDays; i++ {
+		date := utils.AddDays(day, i)
+		if utils.AddDays(date, 1).Before(earliest) || utils.AddDays(date, -1).After(latest) {
+			continue
+		}
+		plan, err := g.plan(ctx, doctorID, schedules.on(date), date)
+		if err != nil {
+			return nil, err
+		}
+		for _, slot := range plan.available() {
+			if slot.StartTime.Before(earliest) || slot.StartTime.After(latest) {
+				continue
+			}
+			candidates = append(candidates, slot)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return absDuration(candidates[i].StartTime.Sub(around)) < absDuration(candidates[j].StartTime.Sub(around))
+	})
+	if len(candidates) > maxSlotSuggestions {
+		candidates = candidates[:maxSlotSuggestions]
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].StartTime.Before(candidates[j].StartTime)
+	})
+
+	return append(suggestions, candidates...), nil
+}
+
+// scheduleBlocks returns the bookable blocks of a day. Explicit slots are
+// clipped to the working hours, without them the working hours form one block
+func scheduleBlocks(day time.Time, daySchedule models.DaySchedule, timePerPatient string, locations *practiceLocations) []slotBlock {
+	hours, hasHours := clockRange(day, daySchedule.WorkingHours.Start, daySchedule.WorkingHours.End)
+
+	if len(daySchedule.Slots) == 0 {
+		if !hasHours {
+			return nil
+		}
+		return []slotBlock{{
+			timeRange: hours,
+			duration:  slotDuration(0, timePerPatient),
+			capacity:  1,
+			location:  locations.lookup(daySchedule.Location),
+		}}
+	}
+
+	var blocks []slotBlock
+	for _, slot := range daySchedule.Slots {
+		r, ok := clockRange(day, slot.Start, slot.End)
+		if !ok {
+			log.Printf("Skipping invalid schedule slot %s-%s", slot.Start, slot.End)
+			continue
+		}
+		if hasHours {
+			if r.start.Before(hours.start) {
+				r.start = hours.start
+			}
+			if r.end.After(hours.end) {
+				r.end = hours.end
+			}
+			if !r.start.Before(r.end) {
+				continue
+			}
+		}
+
+		capacity := slot.Capacity
+		if capacity < 1 {
+			capacity = 1
+		}
+		ref := slot.Location
+		if ref == nil {
+			ref = daySchedule.Location
+		}
+		blocks = append(blocks, slotBlock{
+			timeRange: r,
+			duration:  slotDuration(slot.Duration, timePerPatient),
+			capacity:  capacity,
+			location:  locations.lookup(ref),
+		})
+	}
+	return blocks
+}
+
+// slots cuts the block into consecutive slots of its duration, skipping the
+// breaks
+func (b slotBlock) slots(breaks []timeRange) []timeRange {
+	var slots []timeRange
+	for _, segment := range subtractRanges(b.timeRange, breaks) {
+		for start := segment.start; !start.Add(b.duration).After(segment.end); start = start.Add(b.duration) {
+			slots = append(slots, timeRange{start: start, end: start.Add(b.duration)})
+		}
+	}
+	return slots
+}
+
+// dayBreaks places the day's enabled breaks on day
+func dayBreaks(day time.Time, daySchedule models.DaySchedule) []timeRange {
+	var breaks []timeRange
+	for _, br := range daySchedule.Breaks {
+		if !br.Enabled {
+			continue
+		}
+		if r, ok := clockRange(day, br.Start, br.End); ok {
+			breaks = append(breaks, r)
+		}
+	}
+	return breaks
+}
+
+// slotDuration picks the slot's own length in minutes, then the schedule's
+// timePerPatient ("20", "20m" or "20 minutes"), then defaultSlotDuration
+func slotDuration(minutes int, timePerPatient string) time.Duration {
+	if minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+
+	timePerPatient = strings.TrimSpace(timePerPatient)
+	if d, err := time.ParseDuration(timePerPatient); err == nil && d > 0 {
+		return d
+	}
+	var n int
+	if _, err := fmt.Sscanf(timePerPatient, "%d", &n); err == nil && n > 0 {
+		return time.Duration(n) * time.Minute
+	}
+	return defaultSlotDuration
+}
+
+// clockRange places two "15:04" clock times on day
+func clockRange(day time.Time, start, end string) (timeRange, bool) {
+	startClock, err := time.Parse("15:04", start)
+	if err != nil {
+		return timeRange{}, false
+	}
+	endClock, err := time.Parse("15:04", end)
+	if err != nil {
+		return timeRange{}, false
+	}
+
+	r := timeRange{start: onDay(day, startClock), end: onDay(day, endClock)}
+	return r, r.start.Before(r.end)
+}
+
+// onDay keeps the clock time of t and moves it onto day. A clock time skipped
+// by a DST change lands just after the gap.
+func onDay(day time.Time, t time.Time) time.Time {
+	return utils.WallTime(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), day.Location())
+}
+
+// subtractRanges cuts the given ranges out of r and returns what is left
+func subtractRanges(r timeRange, cuts []timeRange) []timeRange {
+	remaining := []timeRange{r}
+	for _, cut := range cuts {
+		var next []timeRange
+		for _, part := range remaining {
+			if !part.overlaps(cut) {
+				next = append(next, part)
+				continue
+			}
+			if part.start.Before(cut.start) {
+				next = append(next, timeRange{start: part.start, end: cut.start})
+			}
+			if cut.end.Before(part.end) {
+				next = append(next, timeRange{start: cut.end, end: part.end})
+			}
+		}
+		remaining = next
+	}
+	return remaining
+}
+
+func overlapsAny(r timeRange, ranges []timeRange) bool {
+	for _, other := range ranges {
+		if r.overlaps(other) {
+			return true
+		}
+	}
+	return false
+}
+
+func withinAny(r timeRange, ranges []timeRange) bool {
+	for _, other := range ranges {
+		if !r.start.Before(other.start) && !r.end.After(other.end) {
+			return true
+		}
+	}
+	return false
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// formatDuration renders whole days or minutes the way users read them
+func formatDuration(d time.Duration) string {
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%d days", int(d/(24*time.Hour)))
+	}
+	return fmt.Sprintf("%d minutes", int(d/time.Minute))
+}
+
+func countBookings(r timeRange, appointments []models.Appointment) int {
+	count := 0
+	for _, apt := range appointments {
+		if apt.Status == models.StatusCancelled || apt.IsCancelled {
+			continue
+		}
+		if r.overlaps(timeRange{start: apt.StartTime, end: apt.EndTime}) {
+			count++
+		}
+	}
+	return count
+}
+
+func countHolds(r timeRange, holds []models.SlotHold) int {
+	count := 0
+	for _, hold := range holds {
+		if r.overlaps(timeRange{start: hold.StartTime, end: hold.EndTime}) {
+			count++
+		}
+	}
+	return count
+}
+
+// parseSchedule decodes the stored schedule JSON, which SaveSchedule writes
+// as a JSON-encoded string
+func parseSchedule(raw string) (*models.Schedule, error) {
+	var parsedSchedule models.Schedule
+	if err := json.Unmarshal([]byte(raw), &parsedSchedule); err != nil {
+		var rawSchedule string
+		if err := json.Unmarshal([]byte(raw), &rawSchedule); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(rawSchedule), &parsedSchedule); err != nil {
+			return nil, err
+		}
+	}
+	return &parsedSchedule, nil
+}
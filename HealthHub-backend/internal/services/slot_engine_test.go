@@ -0,0 +1,192 @@
+package services
+
+import (
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/utils"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens an empty in-memory database with the tables the slot
+// engine reads
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection would get its own empty in-memory database
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.DoctorProfile{},
+		&models.Appointment{},
+		&models.SlotHold{},
+		&models.BlockedSlot{},
+		&models.DoctorTimeOff{},
+		&models.HolidayCalendar{},
+		&models.Holiday{},
+		&models.DoctorHolidayCalendar{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func createTestUser(t *testing.T, db *gorm.DB, role models.UserRole, timezone string) *models.User {
+	t.Helper()
+	var count int64
+	db.Model(&models.User{}).Count(&count)
+	user := &models.User{
+		Name:     fmt.Sprintf("%s %d", role, count+1),
+		Email:    fmt.Sprintf("%s%d@example.com", role, count+1),
+		Role:     role,
+		IsActive: true,
+		Timezone: timezone,
+	}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func createTestAppointment(t *testing.T, db *gorm.DB, doctorID, patientID uint, start time.Time, description string) {
+	t.Helper()
+	appointment := &models.Appointment{
+		PatientID:   patientID,
+		DoctorID:    doctorID,
+		Type:        models.TypeOnline,
+		Date:        start,
+		StartTime:   start.UTC(),
+		EndTime:     start.Add(30 * time.Minute).UTC(),
+		Status:      models.StatusConfirmed,
+		Description: description,
+	}
+	if err := db.Create(appointment).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// everyDay works the given hours in one-hour slots on every day of the week
+func everyDay(start, end string) *models.Schedule {
+	var day models.DaySchedule
+	day.Enabled = true
+	day.WorkingHours.Start = start
+	day.WorkingHours.End = end
+	day.Slots = []models.ScheduleTimeSlot{{Start: start, End: end, Duration: 60, Capacity: 1}}
+
+	schedule := &models.Schedule{Days: map[string]models.DaySchedule{}}
+	schedule.DefaultSettings.TimePerPatient = "60"
+	for _, name := range []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"} {
+		schedule.Days[name] = day
+	}
+	return schedule
+}
+
+func TestPlanAcrossDST(t *testing.T) {
+	tests := []struct {
+		name      string
+		timezone  string
+		date      time.Time
+		wantStart time.Time
+		wantSlots int
+	}{
+		{
+			name:      "ordinary day",
+			timezone:  "America/New_York",
+			date:      time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC),
+			wantStart: time.Date(2026, 1, 15, 5, 0, 0, 0, time.UTC),
+			wantSlots: 23,
+		},
+		{
+			name:      "23 hour day",
+			timezone:  "America/New_York",
+			date:      time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC),
+			wantStart: time.Date(2026, 3, 8, 5, 0, 0, 0, time.UTC),
+			wantSlots: 22,
+		},
+		{
+			name:      "25 hour day",
+			timezone:  "America/New_York",
+			date:      time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC),
+			wantStart: time.Date(2026, 11, 1, 4, 0, 0, 0, time.UTC),
+			wantSlots: 24,
+		},
+		{
+			// the day starts at 01:00, the first hour of the schedule is
+			// never on the clock
+			name:      "23 hour day with a skipped midnight",
+			timezone:  "America/Sao_Paulo",
+			date:      time.Date(2018, 11, 4, 0, 0, 0, 0, time.UTC),
+			wantStart: time.Date(2018, 11, 4, 3, 0, 0, 0, time.UTC),
+			wantSlots: 22,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			doctor := createTestUser(t, db, models.RoleDoctor, tt.timezone)
+			patient := createTestUser(t, db, models.RolePatient, "")
+			appointmentRepo := repositories.NewAppointmentRepository(db)
+			engine := newSlotEngine(repositories.NewDoctorRepository(db), appointmentRepo, repositories.NewTimeOffRepository(db))
+
+			loc, err := utils.LoadTimezone(tt.timezone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// noon is on the clock every day
+			date := time.Date(tt.date.Year(), tt.date.Month(), tt.date.Day(), 12, 0, 0, 0, loc)
+			nextDay := utils.WallTime(date.Year(), date.Month(), date.Day()+1, 0, 0, loc)
+
+			// after the working hours but on the day, and the next day
+			createTestAppointment(t, db, doctor.ID, patient.ID, nextDay.Add(-30*time.Minute), "late")
+			createTestAppointment(t, db, doctor.ID, patient.ID, nextDay, "next day")
+
+			plan, err := engine.plan(context.Background(), doctor.ID, everyDay("00:00", "23:00"), date)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !plan.Date.Equal(tt.wantStart) {
+				t.Errorf("plan.Date = %v, want %v", plan.Date.UTC(), tt.wantStart)
+			}
+			if len(plan.Slots) != tt.wantSlots {
+				t.Fatalf("got %d slots, want %d", len(plan.Slots), tt.wantSlots)
+			}
+			for i, slot := range plan.Slots {
+				if d := slot.EndTime.Sub(slot.StartTime); d != time.Hour {
+					t.Errorf("slot %d lasts %v", i, d)
+				}
+				if i > 0 && !slot.StartTime.Equal(plan.Slots[i-1].EndTime) {
+					t.Errorf("slot %d starts at %v, the one before ends at %v", i, slot.StartTime.UTC(), plan.Slots[i-1].EndTime.UTC())
+				}
+			}
+			if last := plan.Slots[len(plan.Slots)-1].EndTime.In(loc); last.Hour() != 23 || last.Day() != date.Day() {
+				t.Errorf("last slot ends at %v, want 23:00 of the day", last)
+			}
+
+			if len(plan.Appointments) != 1 || plan.Appointments[0].Description != "late" {
+				var got []string
+				for _, apt := range plan.Appointments {
+					got = append(got, apt.Description)
+				}
+				t.Errorf("plan.Appointments = %q, want only the late one", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// practiceLocations resolves the places a doctor's schedule refers to, the
+// affiliations in their profile and hospitals by ID
+type practiceLocations struct {
+	affiliations []models.Affiliation
+	hospitals    map[uint]models.Hospital
+}
+
+// locationRefs lists the locations a day of the schedule refers to
+func locationRefs(days ...models.DaySchedule) []*models.PracticeLocation {
+	var refs []*models.PracticeLocation
+	for _, day := range days {
+		if day.Location != nil {
+			refs = append(refs, day.Location)
+		}
+		for _, slot := range day.Slots {
+			if slot.Location != nil {
+				refs = append(refs, slot.Location)
+			}
+		}
+	}
+	return refs
+}
+
+func (g *slotEngine) loadLocations(ctx context.Context, doctorID uint, refs []*models.PracticeLocation) (*practiceLocations, error) {
+	locations := &practiceLocations{hospitals: map[uint]models.Hospital{}}
+
+	var hospitalIDs []uint
+	needAffiliations := false
+	for _, ref := range refs {
+		if ref.HospitalID != 0 {
+			hospitalIDs = append(hospitalIDs, ref.HospitalID)
+		} else if ref.Affiliation != "" {
+			needAffiliations = true
+		}
+	}
+
+	if needAffiliations {
+		affiliations, err := g.doctorRepo.GetAffiliations(ctx, doctorID)
+		if err != nil {
+			return nil, err
+		}
+		locations.affiliations = affiliations
+	}
+
+	hospitals, err := g.doctorRepo.FindHospitals(ctx, hospitalIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, hospital := range hospitals {
+		locations.hospitals[hospital.ID] = hospital
+	}
+	return locations, nil
+}
+
+// resolve returns where ref points, or an error saying why it points nowhere
+func (p *practiceLocations) resolve(ref *models.PracticeLocation) (*models.SlotLocation, error) {
+	switch {
+	case ref.HospitalID != 0 && ref.Affiliation != "":
+		return nil, fmt.Errorf("name either an affiliation or a hospital, not both")
+	case ref.HospitalID != 0:
+		hospital, ok := p.hospitals[ref.HospitalID]
+		if !ok {
+			return nil, fmt.Errorf("hospital %d not found", ref.HospitalID)
+		}
+		return &models.SlotLocation{
+			Name:       hospital.Name,
+			Address:    hospital.Address,
+			Latitude:   hospital.Location.Latitude,
+			Longitude:  hospital.Location.Longitude,
+			HospitalID: hospital.ID,
+		}, nil
+	case ref.Affiliation != "":
+		for _, affiliation := range p.affiliations {
+			if !strings.EqualFold(strings.TrimSpace(affiliation.Name), strings.TrimSpace(ref.Affiliation)) {
+				continue
+			}
+			return &models.SlotLocation{
+				Name:      affiliation.Name,
+				Address:   affiliationAddress(affiliation),
+				Latitude:  affiliation.Latitude,
+				Longitude: affiliation.Longitude,
+			}, nil
+		}
+		return nil, fmt.Errorf("no affiliation named %q in your profile", ref.Affiliation)
+	}
+	return nil, fmt.Errorf("name an affiliation or a hospital")
+}
+
+// lookup resolves ref for the slot engine. A location that no longer
+// resolves, say a renamed affiliation, leaves the slot without one.
+func (p *practiceLocations) lookup(ref *models.PracticeLocation) *models.SlotLocation {
+	if p == nil || ref == nil {
+		return nil
+	}
+	location, err := p.resolve(ref)
+	if err != nil {
+		log.Printf("Skipping schedule location: %v", err)
+		return nil
+	}
+	return location
+}
+
+func affiliationAddress(affiliation models.Affiliation) string {
+	var parts []string
+	for _, part := range []string{affiliation.Address, affiliation.City, affiliation.State, affiliation.Country} {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// checkLocations refuses a schedule naming a location that doesn't resolve
+func (g *slotEngine) checkLocations(ctx context.Context, doctorID uint, schedule models.Schedule) error {
+	days := make([]string, 0, len(schedule.Days))
+	for name := range schedule.Days {
+		days = append(days, name)
+	}
+	sort.Strings(days)
+
+	for _, name := range days {
+		refs := locationRefs(schedule.Days[name])
+		if len(refs) == 0 {
+			continue
+		}
+		locations, err := g.loadLocations(ctx, doctorID, refs)
+		if err != nil {
+			return err
+		}
+		for _, ref := range refs {
+			if _, err := locations.resolve(ref); err != nil {
+				return e.NewValidationError(fmt.Sprintf("%s: %v", name, err))
+			}
+		}
+	}
+	return nil
+}
+
+// locationOf returns the location of the doctor's slot that holds start-end
+func (g *slotEngine) locationOf(ctx context.Context, doctorID uint, start, end time.Time) *models.SlotLocation {
+	schedules, err := g.loadScheduleSet(ctx, doctorID)
+	if err != nil {
+		log.Printf("Failed to load the schedule of doctor %d to find a location: %v", doctorID, err)
+		return nil
+	}
+	if schedules.empty() {
+		return nil
+	}
+
+	day := start.In(g.location(ctx, doctorID))
+	plan, err := g.plan(ctx, doctorID, schedules.on(day), day)
+	if err != nil {
+		log.Printf("Failed to plan slots of doctor %d to find a location: %v", doctorID, err)
+		return nil
+	}
+	for _, slot := range plan.Slots {
+		if !start.Before(slot.StartTime) && !end.After(slot.EndTime) {
+			return slot.Location
+		}
+	}
+	return nil
+}
+
+// filterSlots keeps the slots at the filter's location and within its radius,
+// noting each slot's distance when the filter has a point to measure from
+func filterSlots(slots []models.TimeSlot, filter models.SlotFilter) []models.TimeSlot {
+	filtered := []models.TimeSlot{}
+	for _, slot := range slots {
+		location := slot.Location
+		if filter.HospitalID != 0 && (location == nil || location.HospitalID != filter.HospitalID) {
+			continue
+		}
+		if filter.Affiliation != "" && (location == nil || location.HospitalID != 0 ||
+			!strings.EqualFold(strings.TrimSpace(location.Name), strings.TrimSpace(filter.Affiliation))) {
+			continue
+		}
+
+		if filter.Near != nil {
+			if location == nil || !location.HasCoordinates() {
+				if filter.RadiusKm > 0 {
+					continue
+				}
+			} else {
+				distance := filter.Near.DistanceKm(models.Location{Latitude: location.Latitude, Longitude: location.Longitude})
+				if filter.RadiusKm > 0 && distance > filter.RadiusKm {
+					continue
+				}
+				measured := *location
+				measured.DistanceKm = &distance
+				slot.Location = &measured
+			}
+		}
+		filtered = append(filtered, slot)
+	}
+
+	if filter.Near != nil {
+		// nearest first, slots without a distance last, each in time order
+		sort.SliceStable(filtered, func(i, j int) bool {
+			a, b := filtered[i].Location, filtered[j].Location
+			if a == nil || a.DistanceKm == nil {
+				return false
+			}
+			if b == nil || b.DistanceKm == nil {
+				return true
+			}
+			return *a.DistanceKm < *b.DistanceKm
+		})
+	}
+	return filtered
+}
+
+// stampLocation gives an in-person appointment the address and coordinates
+// of the practice its slot is at, in place of whatever address was submitted
+func stampLocation(appointment *models.Appointment, location *models.SlotLocation) {
+	if appointment.Type != models.TypeOffline || location == nil {
+		return
+	}
+	appointment.Address = location.FullAddress()
+	appointment.Latitude = location.Latitude
+	appointment.Longitude = location.Longitude
+}
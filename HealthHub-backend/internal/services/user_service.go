@@ -12,6 +12,7 @@ import (
 	"HealthHubConnect/env"
 	e "HealthHubConnect/internal/errors"
 	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/oidc"
 	"HealthHubConnect/internal/repositories"
 	"HealthHubConnect/internal/utils"
 )
@@ -26,11 +27,21 @@ type GoogleUserInfo struct {
 
 type UserService struct {
 	userRepo *repositories.UserRepository
+	sessions *SessionService
+	mfa      *MFAService
+	lockout  *LockoutService
+	otp      *OTPService
+	oauth    *OAuthService
 }
 
-func NewUserService(userRepo *repositories.UserRepository) *UserService {
+func NewUserService(userRepo *repositories.UserRepository, sessionRepo *repositories.SessionRepository, mfaRepo *repositories.MFARepository, adminRepo *repositories.AdminRepository, lockoutRepo *repositories.LockoutRepository, otpRepo *repositories.OTPRepository, oauthRepo *repositories.OAuthRepository, providers *oidc.Registry) *UserService {
 	return &UserService{
 		userRepo: userRepo,
+		sessions: NewSessionService(sessionRepo, userRepo),
+		mfa:      NewMFAService(mfaRepo, userRepo, adminRepo),
+		lockout:  NewLockoutService(lockoutRepo, userRepo, adminRepo),
+		otp:      NewOTPService(otpRepo),
+		oauth:    NewOAuthService(oauthRepo, userRepo, providers),
 	}
 }
 
@@ -55,17 +66,14 @@ func (s *UserService) createUserCommon(ctx context.Context, name, email, passwor
 		return nil, fmt.Errorf("internal server error")
 	}
 
-	resetOTP := utils.GenerateResetOTP()
 	user := &models.User{
-		Name:             name,
-		Email:            email,
-		PasswordHash:     hashedPassword,
-		Phone:            phone,
-		Role:             role,
-		ResetToken:       resetOTP,
-		ResetTokenExpiry: time.Now().Add(24 * time.Hour),
-		IsActive:         true,
-		AuthProvider:     "local",
+		Name:         name,
+		Email:        email,
+		PasswordHash: hashedPassword,
+		Phone:        phone,
+		Role:         role,
+		IsActive:     true,
+		AuthProvider: "local",
 	}
 	// fmt.Println("testing_service", user.PasswordHash)
 
@@ -77,7 +85,6 @@ func (s *UserService) createUserCommon(ctx context.Context, name, email, passwor
 	// user.PasswordHash = hashedPassword
 
 	// s.userRepo.UpdateUser(user, ctx)
-	// s.sendVerificationEmail(email, name, resetOTP)
 
 	// user.PasswordHash = ""
 	return user, nil
@@ -92,68 +99,118 @@ func (s *UserService) CreateUserWithRole(ctx context.Context, name, email, passw
 }
 
 func (s *UserService) validateLogin(ctx context.Context, email, password string) (*models.User, error) {
-	user, err := s.userRepo.FindByEmail(ctx, email)
-	if err != nil {
-		//fmt.Println("error", err)
-		s.trackLoginAttempt(ctx, 0, email, false)
+	// a lookup failure is handled like an unknown email below
+	user, _ := s.userRepo.FindByEmail(ctx, email)
+
+	if err := s.lockout.Check(ctx, user); err != nil {
+		log.Printf("Login attempt rejected for %s: %v", email, err)
+		return nil, err
+	}
+
+	if user == nil {
 		log.Printf("Login attempt failed: email not found: %s", email)
+		if lockErr := s.lockout.RecordFailure(ctx, nil, email); lockErr != nil {
+			return nil, lockErr
+		}
 		return nil, e.NewValidationError("invalid email or password")
 	}
 
 	if err := utils.ComparePassword(password, user.PasswordHash); err != nil {
-		s.trackLoginAttempt(ctx, user.ID, email, false)
 		log.Printf("Password comparison failed for user %s: %v", email, err)
+		if lockErr := s.lockout.RecordFailure(ctx, user, email); lockErr != nil {
+			return nil, lockErr
+		}
 		return nil, e.NewValidationError("invalid email or password")
 	}
 
 	return user, nil
 }
 
-func (s *UserService) trackLoginAttempt(ctx context.Context, userID uint, email string, successful bool) {
-	ipAddress := "unknown"
-	if ip, ok := ctx.Value("ipAddress").(string); ok && ip != "" {
-		ipAddress = ip
+// Login checks the password. When the account needs a second factor no tokens
+// are issued and the returned challenge has to be completed via CompleteMFALogin.
+func (s *UserService) Login(ctx context.Context, email, password string) (*models.User, utils.TokenPair, *MFAChallenge, error) {
+	user, err := s.validateLogin(ctx, email, password)
+	if err != nil {
+		return nil, utils.TokenPair{}, nil, err
 	}
 
-	loginAttempt := &models.LoginAttempt{
-		UserID:     userID,
-		IPAddress:  ipAddress,
-		Email:      email,
-		Successful: successful,
-		Timestamp:  time.Now(),
+	return s.continueLogin(ctx, user)
+}
+
+func (s *UserService) LoginWithRole(ctx context.Context, email, password string, role models.UserRole) (*models.User, utils.TokenPair, *MFAChallenge, error) {
+	user, err := s.validateLogin(ctx, email, password)
+	if err != nil {
+		return nil, utils.TokenPair{}, nil, err
 	}
 
-	if err := s.userRepo.CreateLoginAttempt(ctx, loginAttempt); err != nil {
-		log.Printf("Failed to record login attempt: %v", err)
+	if user.Role != role {
+		return nil, utils.TokenPair{}, nil, e.NewValidationError("unauthorized access: invalid role")
 	}
+
+	return s.continueLogin(ctx, user)
 }
 
-func (s *UserService) Login(ctx context.Context, email, password string) (*models.User, utils.TokenPair, error) {
-	user, err := s.validateLogin(ctx, email, password)
+// ContinueExternalLogin signs in a user an identity provider has vouched for,
+// applying the same suspension and MFA checks as a password login
+func (s *UserService) ContinueExternalLogin(ctx context.Context, user *models.User) (*models.User, utils.TokenPair, *MFAChallenge, error) {
+	return s.continueLogin(ctx, user)
+}
+
+func (s *UserService) continueLogin(ctx context.Context, user *models.User) (*models.User, utils.TokenPair, *MFAChallenge, error) {
+	if !user.IsActive {
+		return nil, utils.TokenPair{}, nil, e.NewForbiddenError("account is suspended")
+	}
+
+	challenge, err := s.mfa.Challenge(ctx, user)
 	if err != nil {
-		return nil, utils.TokenPair{}, err
+		return nil, utils.TokenPair{}, nil, err
+	}
+	if challenge != nil {
+		return nil, utils.TokenPair{}, challenge, nil
 	}
 
-	return s.finalizeLogin(ctx, user)
+	user, tokenPair, err := s.finalizeLogin(ctx, user)
+	return user, tokenPair, nil, err
 }
 
-func (s *UserService) LoginWithRole(ctx context.Context, email, password string, role models.UserRole) (*models.User, utils.TokenPair, error) {
-	user, err := s.validateLogin(ctx, email, password)
+// CompleteMFALogin finishes a login that was answered with an MFA challenge.
+// Recovery codes are only returned when the login also completed enrollment.
+func (s *UserService) CompleteMFALogin(ctx context.Context, mfaToken, code, recoveryCode string) (*models.User, utils.TokenPair, []string, error) {
+	user, err := s.mfa.UserFromPendingToken(ctx, mfaToken)
 	if err != nil {
-		return nil, utils.TokenPair{}, err
+		return nil, utils.TokenPair{}, nil, err
 	}
 
-	if user.Role != role {
-		return nil, utils.TokenPair{}, e.NewValidationError("unauthorized access: invalid role")
+	// second factor guesses count toward the same lockout as passwords
+	if err := s.lockout.Check(ctx, user); err != nil {
+		return nil, utils.TokenPair{}, nil, err
 	}
 
-	return s.finalizeLogin(ctx, user)
+	recoveryCodes, err := s.mfa.VerifyLogin(ctx, user, code, recoveryCode)
+	if err != nil {
+		if customErr, ok := err.(*e.CustomError); ok && customErr.StatusCode == http.StatusBadRequest {
+			if lockErr := s.lockout.RecordFailure(ctx, user, user.Email); lockErr != nil {
+				return nil, utils.TokenPair{}, nil, lockErr
+			}
+		}
+		return nil, utils.TokenPair{}, nil, err
+	}
+
+	user, tokenPair, err := s.finalizeLogin(ctx, user)
+	if err != nil {
+		return nil, utils.TokenPair{}, nil, err
+	}
+	return user, tokenPair, recoveryCodes, nil
 }
 
 func (s *UserService) finalizeLogin(ctx context.Context, user *models.User) (*models.User, utils.TokenPair, error) {
-	tokenPair, err := utils.GenerateTokenPair(user.ID)
+	if !user.IsActive {
+		return nil, utils.TokenPair{}, e.NewForbiddenError("account is suspended")
+	}
+
+	tokenPair, err := s.sessions.StartSession(ctx, user)
 	if err != nil {
-		return nil, utils.TokenPair{}, e.NewInternalError()
+		return nil, utils.TokenPair{}, err
 	}
 
 	user.LastLogin = time.Now()
@@ -161,7 +218,7 @@ func (s *UserService) finalizeLogin(ctx context.Context, user *models.User) (*mo
 		return nil, utils.TokenPair{}, e.NewInternalError()
 	}
 
-	s.trackLoginAttempt(ctx, user.ID, user.Email, true)
+	s.lockout.RecordSuccess(ctx, user)
 
 	user.PasswordHash = ""
 	return user, tokenPair, nil
@@ -200,23 +257,15 @@ HealthHub Team`, name, otp)
 }
 
 func (s *UserService) RefreshUserToken(ctx context.Context, refreshToken string) (*models.User, utils.TokenPair, error) {
-	tokenPair, err := utils.RefreshAccessTokens(refreshToken)
-	if err != nil {
-		return nil, utils.TokenPair{}, e.NewValidationError("invalid refresh token")
-	}
-
-	userID, err := utils.ExtractUserIDFromToken(refreshToken, env.Jwt.RefreshTokenSecret)
-	if err != nil {
-		return nil, utils.TokenPair{}, e.NewValidationError("invalid token")
-	}
+	return s.sessions.Rotate(ctx, refreshToken)
+}
 
-	user, err := s.userRepo.FindByID(ctx, userID)
-	if err != nil {
-		return nil, utils.TokenPair{}, e.NewValidationError("user not found")
-	}
+func (s *UserService) Logout(ctx context.Context, refreshToken string) error {
+	return s.sessions.Logout(ctx, refreshToken)
+}
 
-	user.PasswordHash = ""
-	return user, tokenPair, nil
+func (s *UserService) LogoutAllDevices(ctx context.Context, userID uint) error {
+	return s.sessions.RevokeUserSessions(ctx, userID, RevokeReasonLogoutAll)
 }
 
 func (s *UserService) VerifyOTP(ctx context.Context, email, otp string) error {
@@ -224,22 +273,11 @@ func (s *UserService) VerifyOTP(ctx context.Context, email, otp string) error {
 	if err != nil {
 		return e.NewValidationError("invalid email")
 	}
-	if len(otp) != 6 || !utils.IsNumeric(otp) {
-		return e.NewValidationError("invalid OTP format - must be 6 digits")
-	}
-
-	if user.ResetToken != otp {
-		return e.NewValidationError("invalid OTP")
-	}
-
-	if time.Now().After(user.ResetTokenExpiry) {
-		return e.NewValidationError("OTP has expired")
+	if err := s.otp.Verify(ctx, user.ID, models.OTPPurposeEmailVerify, otp); err != nil {
+		return err
 	}
 
 	user.EmailVerified = true
-	user.ResetToken = ""
-	user.ResetTokenExpiry = time.Time{}
-
 	return s.userRepo.UpdateUser(user, ctx)
 }
 
@@ -249,12 +287,9 @@ func (s *UserService) ForgotPassword(ctx context.Context, email string) error {
 		return e.NewValidationError("email not found")
 	}
 
-	resetOTP := utils.GenerateResetOTP()
-	user.ResetToken = resetOTP
-	user.ResetTokenExpiry = time.Now().Add(15 * time.Minute)
-
-	if err := s.userRepo.UpdateUser(user, ctx); err != nil {
-		return e.NewInternalError()
+	resetOTP, _, err := s.otp.Issue(ctx, user.ID, models.OTPPurposePasswordReset)
+	if err != nil {
+		return err
 	}
 
 	subject := "Password Reset OTP - HealthHub"
@@ -285,68 +320,54 @@ func (s *UserService) ResetPassword(ctx context.Context, email, otp, newPassword
 		return e.NewValidationError("invalid email")
 	}
 
-	if len(otp) != 6 || !utils.IsNumeric(otp) {
-		return e.NewValidationError("invalid OTP format - must be 6 digits")
-	}
-
-	if user.ResetToken != otp {
-		return e.NewValidationError("invalid OTP")
-	}
-
-	if time.Now().After(user.ResetTokenExpiry) {
-		return e.NewValidationError("OTP has expired")
-	}
-
+	// validate before spending the code so a weak password doesn't burn it
 	if err := utils.ValidatePassword(newPassword); err != nil {
 		return fmt.Errorf("invalid password: %w", err)
 	}
 
+	if err := s.otp.Verify(ctx, user.ID, models.OTPPurposePasswordReset, otp); err != nil {
+		return err
+	}
+
 	hashedPassword, err := utils.HashPassword(newPassword)
 	if err != nil {
 		return e.NewInternalError()
 	}
 
 	user.PasswordHash = hashedPassword
-	user.ResetToken = ""
-	user.ResetTokenExpiry = time.Time{}
+	if err := s.userRepo.UpdateUser(user, ctx); err != nil {
+		return err
+	}
 
-	return s.userRepo.UpdateUser(user, ctx)
+	// whoever held the old password shouldn't keep a session
+	return s.sessions.RevokeUserSessions(ctx, user.ID, RevokeReasonPasswordReset)
 }
 
-func (s *UserService) HandleGoogleCallback(ctx context.Context, code string) (*models.User, utils.TokenPair, error) {
+func (s *UserService) HandleGoogleCallback(ctx context.Context, code string) (*models.User, utils.TokenPair, *MFAChallenge, error) {
 
 	token, err := env.GoogleOAuthConfig.Exchange(ctx, code)
 	if err != nil {
-		return nil, utils.TokenPair{}, e.NewInternalError()
+		return nil, utils.TokenPair{}, nil, e.NewInternalError()
 	}
 
 	userInfo, err := s.getGoogleUserInfo(token.AccessToken)
 	if err != nil {
-		return nil, utils.TokenPair{}, e.NewInternalError()
+		return nil, utils.TokenPair{}, nil, e.NewInternalError()
 	}
 
-	user, err := s.userRepo.FindByEmail(ctx, userInfo.Email)
+	user, err := s.oauth.ResolveUser(ctx, ExternalIdentity{
+		Provider:      "google",
+		Subject:       userInfo.ID,
+		Email:         userInfo.Email,
+		EmailVerified: userInfo.VerifiedEmail,
+		Name:          userInfo.Name,
+		Picture:       userInfo.Picture,
+	}, true)
 	if err != nil {
-		user = &models.User{
-			Email:          userInfo.Email,
-			Name:           userInfo.Name,
-			ProfilePicture: userInfo.Picture,
-			EmailVerified:  userInfo.VerifiedEmail,
-			IsActive:       true,
-			AuthProvider:   "google",
-		}
-
-		if err := s.userRepo.CreateUser(user, ctx); err != nil {
-			return nil, utils.TokenPair{}, e.NewInternalError()
-		}
+		return nil, utils.TokenPair{}, nil, err
 	}
 
-	tokenPair, err := utils.GenerateTokenPair(user.ID)
-	if err != nil {
-		return nil, utils.TokenPair{}, e.NewInternalError()
-	}
-
-	return user, tokenPair, nil
+	return s.continueLogin(ctx, user)
 }
 
 func (s *UserService) getGoogleUserInfo(accessToken string) (*GoogleUserInfo, error) {
@@ -379,12 +400,9 @@ func (s *UserService) ResendOTP(ctx context.Context, email string) error {
 		return e.NewValidationError("email already verified")
 	}
 
-	resetOTP := utils.GenerateResetOTP()
-	user.ResetToken = resetOTP
-	user.ResetTokenExpiry = time.Now().Add(24 * time.Hour)
-
-	if err := s.userRepo.UpdateUser(user, ctx); err != nil {
-		return e.NewInternalError()
+	resetOTP, _, err := s.otp.Issue(ctx, user.ID, models.OTPPurposeEmailVerify)
+	if err != nil {
+		return err
 	}
 
 	subject := "Email Verification OTP - HealthHub"
@@ -413,12 +431,9 @@ func (s *UserService) SendVerificationEmail(user *models.User) error {
 		return e.NewValidationError("email already verified")
 	}
 
-	resetOTP := utils.GenerateResetOTP()
-	user.ResetToken = resetOTP
-	user.ResetTokenExpiry = time.Now().Add(24 * time.Hour)
-
-	if err := s.userRepo.UpdateUser(user, context.Background()); err != nil {
-		return e.NewInternalError()
+	resetOTP, _, err := s.otp.Issue(context.Background(), user.ID, models.OTPPurposeEmailVerify)
+	if err != nil {
+		return err
 	}
 
 	subject := "Doctor Account Verification - HealthHub"
@@ -2,6 +2,7 @@ package utils
 
 import (
 	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
 	"context"
 )
 
@@ -12,3 +13,19 @@ func GetUserIDFromContext(ctx context.Context) (uint, error) {
 	}
 	return userID, nil
 }
+
+func GetUserRoleFromContext(ctx context.Context) (models.UserRole, error) {
+	role, ok := ctx.Value("userRole").(models.UserRole)
+	if !ok || role == "" {
+		return "", e.NewNotAuthorizedError("invalid or missing user role")
+	}
+	return role, nil
+}
+
+func GetPrincipalFromContext(ctx context.Context) (*models.Principal, error) {
+	principal, ok := ctx.Value("principal").(*models.Principal)
+	if !ok || principal == nil {
+		return nil, e.NewNotAuthorizedError("missing principal")
+	}
+	return principal, nil
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	ICalMethodPublish = "PUBLISH"
+	ICalMethodRequest = "REQUEST"
+	ICalMethodCancel  = "CANCEL"
+
+	icalTimeFormat = "20060102T150405Z"
+	icalLineLimit  = 75
+)
+
+// ICalPerson is an organizer or attendee of an event
+type ICalPerson struct {
+	Name  string
+	Email string
+}
+
+// ICalEvent is one VEVENT. Sequence has to grow with every change sent for
+// the same UID so calendar apps replace their copy instead of ignoring it.
+type ICalEvent struct {
+	UID         string
+	Sequence    int
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	Status      string // TENTATIVE, CONFIRMED or CANCELLED
+	Organizer   *ICalPerson
+	Attendees   []ICalPerson
+}
+
+// BuildICalendar renders the events as an RFC 5545 calendar. method is left
+// out for a subscribed feed and set to REQUEST or CANCEL for email invites.
+func BuildICalendar(name string, method string, events []ICalEvent, now time.Time) []byte {
+	var buf bytes.Buffer
+	line := func(content string) {
+		writeICalLine(&buf, content)
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//HealthHub//Appointments//EN")
+	line("CALSCALE:GREGORIAN")
+	if method != "" {
+		line("METHOD:" + method)
+	}
+	if name != "" {
+		line("X-WR-CALNAME:" + escapeICalText(name))
+	}
+
+	stamp := now.UTC().Format(icalTimeFormat)
+	for _, event := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + event.UID)
+		line(fmt.Sprintf("SEQUENCE:%d", event.Sequence))
+		line("DTSTAMP:" + stamp)
+		line("DTSTART:" + event.Start.UTC().Format(icalTimeFormat))
+		line("DTEND:" + event.End.UTC().Format(icalTimeFormat))
+		line("SUMMARY:" + escapeICalText(event.Summary))
+		if event.Description != "" {
+			line("DESCRIPTION:" + escapeICalText(event.Description))
+		}
+		if event.Location != "" {
+			line("LOCATION:" + escapeICalText(event.Location))
+		}
+		if event.URL != "" {
+			line("URL:" + event.URL)
+		}
+		if event.Status != "" {
+			line("STATUS:" + event.Status)
+		}
+		if event.Organizer != nil {
+			line(fmt.Sprintf("ORGANIZER;CN=%s:mailto:%s", quoteICalParam(event.Organizer.Name), event.Organizer.Email))
+		}
+		for _, attendee := range event.Attendees {
+			line(fmt.Sprintf("ATTENDEE;CN=%s;ROLE=REQ-PARTICIPANT:mailto:%s", quoteICalParam(attendee.Name), attendee.Email))
+		}
+		line("END:VEVENT")
+	}
+
+	line("END:VCALENDAR")
+	return buf.Bytes()
+}
+
+// writeICalLine folds the content line at 75 octets without splitting a
+// UTF-8 character, continuation lines start with a space
+func writeICalLine(buf *bytes.Buffer, content string) {
+	limit := icalLineLimit
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(content[cut]) {
+			cut--
+		}
+		buf.WriteString(content[:cut])
+		buf.WriteString("\r\n ")
+		content = content[cut:]
+		limit = icalLineLimit - 1
+	}
+	buf.WriteString(content)
+	buf.WriteString("\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+func escapeICalText(text string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(text)
+}
+
+func quoteICalParam(value string) string {
+	value = strings.NewReplacer(`"`, "'", "\r", "", "\n", " ").Replace(value)
+	return `"` + value + `"`
+}
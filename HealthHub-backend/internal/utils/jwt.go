@@ -2,9 +2,10 @@ package utils
 
 import (
 	"HealthHubConnect/env"
+	"HealthHubConnect/internal/models"
+	cryptorand "crypto/rand"
+	"encoding/hex"
 	"errors"
-	"fmt"
-	"math/rand"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -21,81 +22,119 @@ var (
 type TokenType string
 
 const (
-	AccessToken  TokenType = "access"
-	RefreshToken TokenType = "refresh"
+	AccessToken     TokenType = "access"
+	RefreshToken    TokenType = "refresh"
+	MFAPendingToken TokenType = "mfa_pending"
 )
 
+// MFAPendingTTL bounds how long a password-verified login waits for its second factor
+const MFAPendingTTL = 5 * time.Minute
+
 type Claims struct {
-	UserID uint      `json:"user_id"`
-	Type   TokenType `json:"type"`
+	UserID    uint            `json:"user_id"`
+	Role      models.UserRole `json:"role"`
+	Type      TokenType       `json:"type"`
+	SessionID string          `json:"sid"`
 	jwt.RegisteredClaims
 }
 
 type TokenPair struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
+
+	// set when minting so the refresh token can be persisted, never sent to clients
+	RefreshTokenID   string    `json:"-"`
+	RefreshExpiresAt time.Time `json:"-"`
 }
 
-func GenerateTokenPair(userID uint) (TokenPair, error) {
-	if len(env.Jwt.RefreshTokenSecret) == 0 || len(env.Jwt.AccessTokenSecret) == 0 {
+// GenerateTokenPair mints an access/refresh pair bound to the session family
+// sessionID. The refresh token gets its own random jti so each one can only be
+// redeemed once.
+func GenerateTokenPair(userID uint, role models.UserRole, sessionID string) (TokenPair, error) {
+	if len(env.Jwt.RefreshTokenSecret) == 0 {
 		return TokenPair{}, ErrMissingSecret
 	}
 
-	accessToken, err := generateToken(userID, AccessToken, env.Jwt.AccessTokenSecret, env.Jwt.AccessTokenTTL)
+	accessToken, err := signAccessToken(newClaims(userID, role, sessionID, "", AccessToken, env.Jwt.AccessTokenTTL))
 	if err != nil {
 		return TokenPair{}, err
 	}
 
-	refreshToken, err := generateToken(userID, RefreshToken, env.Jwt.RefreshTokenSecret, env.Jwt.RefreshTokenTTL)
+	refreshTokenID, err := NewRandomID()
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	// refresh tokens only ever come back to us, so they stay on the shared secret
+	refreshToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims(userID, role, sessionID, refreshTokenID, RefreshToken, env.Jwt.RefreshTokenTTL)).
+		SignedString(env.Jwt.RefreshTokenSecret)
 	if err != nil {
 		return TokenPair{}, err
 	}
 
 	return TokenPair{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		RefreshTokenID:   refreshTokenID,
+		RefreshExpiresAt: time.Now().Add(env.Jwt.RefreshTokenTTL),
 	}, nil
 }
 
-func generateToken(userID uint, tokenType TokenType, secret []byte, expiration time.Duration) (string, error) {
-	claims := Claims{
-		UserID: userID,
-		Type:   tokenType,
+func newClaims(userID uint, role models.UserRole, sessionID, tokenID string, tokenType TokenType, expiration time.Duration) Claims {
+	return Claims{
+		UserID:    userID,
+		Role:      role,
+		Type:      tokenType,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			Issuer:    env.Jwt.Issuer,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(secret)
 }
 
-// extractClaimsFromExpiredToken extracts claims from a token even if it's expired
-func extractClaimsFromExpiredToken(tokenString string, secret []byte) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
-		}
-		return secret, nil
-	})
-
+// signAccessToken signs with the active asymmetric key and names it in the
+// kid header, so other services can verify against our JWKS. Deployments
+// without keys keep using HS256 with the access token secret.
+func signAccessToken(claims Claims) (string, error) {
+	kr, err := accessKeyRing()
 	if err != nil {
-		//if the error is due to expiration
-		if errors.Is(err, jwt.ErrTokenExpired) {
-			if claims, ok := token.Claims.(*Claims); ok {
-				return claims, nil
-			}
-		}
-		return nil, err
+		return "", err
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok {
-		return claims, nil
+	if kr.signer != nil {
+		token := jwt.NewWithClaims(kr.signer.method, claims)
+		token.Header["kid"] = kr.signer.id
+		return token.SignedString(kr.signer.private)
 	}
 
-	return nil, ErrInvalidToken
+	if len(env.Jwt.AccessTokenSecret) == 0 {
+		return "", ErrMissingSecret
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(env.Jwt.AccessTokenSecret)
+}
+
+// GenerateMFAPendingToken is handed out after the password step for accounts
+// that need a second factor. It is not an access token and AuthMiddleware
+// rejects it.
+func GenerateMFAPendingToken(userID uint, role models.UserRole) (string, error) {
+	if len(env.Jwt.MFATokenSecret) == 0 {
+		return "", ErrMissingSecret
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims(userID, role, "", "", MFAPendingToken, MFAPendingTTL)).
+		SignedString(env.Jwt.MFATokenSecret)
+}
+
+// NewRandomID returns 32 hex characters from crypto/rand, used for token and session ids
+func NewRandomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := cryptorand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
 
 func ValidateToken(tokenString string, secret []byte, expectedType TokenType) (*Claims, error) {
@@ -132,45 +171,53 @@ func ValidateToken(tokenString string, secret []byte, expectedType TokenType) (*
 	return claims, nil
 }
 
-func RefreshAccessTokens(refreshToken string) (TokenPair, error) {
-	claims, err := ValidateToken(refreshToken, env.Jwt.RefreshTokenSecret, RefreshToken)
+// ValidateAccessToken accepts access tokens signed by any configured key, and
+// HS256 ones while acceptsHS256AccessTokens says so
+func ValidateAccessToken(tokenString string) (*Claims, error) {
+	kr, err := accessKeyRing()
 	if err != nil {
-		// If the refresh token is expired, try to extract the claims anyway
-		if errors.Is(err, ErrExpiredRefreshToken) {
-			claims, err = extractClaimsFromExpiredToken(refreshToken, env.Jwt.RefreshTokenSecret)
-			if err != nil {
-				return TokenPair{}, err
-			}
+		return nil, err
+	}
 
-			//completely new token pair
-			return GenerateTokenPair(claims.UserID)
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+			if !acceptsHS256AccessTokens(kr) {
+				return nil, ErrInvalidToken
+			}
+			return env.Jwt.AccessTokenSecret, nil
 		}
-		return TokenPair{}, err
+		return kr.verificationKey(token)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	//new access token
-	newAccessToken, err := generateToken(claims.UserID, AccessToken, env.Jwt.AccessTokenSecret, env.Jwt.AccessTokenTTL)
-	if err != nil {
-		return TokenPair{}, err
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
 	}
 
-	//using the same refresh token if it's still valid
-	return TokenPair{
-		AccessToken:  newAccessToken,
-		RefreshToken: refreshToken,
-	}, nil
+	if claims.Type != AccessToken {
+		return nil, ErrInvalidTokenType
+	}
+
+	return claims, nil
 }
 
-func ExtractUserIDFromToken(tokenString string, secret []byte) (uint, error) {
-	claims, err := ValidateToken(tokenString, secret, AccessToken) //only access token allowed
+// acceptsHS256AccessTokens tells whether HS256 access tokens are still valid:
+// always while they are what we sign, after the move to a signing key only
+// when the deployment explicitly keeps accepting them
+func acceptsHS256AccessTokens(kr *keyRing) bool {
+	if len(env.Jwt.AccessTokenSecret) == 0 {
+		return false
+	}
+	return kr.signer == nil || env.Jwt.AcceptHS256AccessTokens
+}
+
+func ExtractUserIDFromToken(tokenString string) (uint, error) {
+	claims, err := ValidateAccessToken(tokenString) //only access token allowed
 	if err != nil {
 		return 0, err
 	}
 	return claims.UserID, nil
 }
-
-func GenerateResetOTP() string {
-
-	otp := 100000 + rand.Intn(900000)
-	return fmt.Sprintf("%06d", otp)
-}
@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"HealthHubConnect/config"
+	"HealthHubConnect/env"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const minRSAKeyBits = 2048
+
+var (
+	ErrUnknownSigningKey = errors.New("unknown signing key")
+	ErrInvalidSigningKey = errors.New("invalid signing key configuration")
+)
+
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// keyRing holds the access token keys from env.Jwt, parsed once on first use
+type keyRing struct {
+	signer *signingKey
+	keys   map[string]*signingKey
+	order  []string
+}
+
+// JSONWebKey is one public key as published in the JWKS document
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+var (
+	ringOnce sync.Once
+	ring     *keyRing
+	ringErr  error
+)
+
+func accessKeyRing() (*keyRing, error) {
+	ringOnce.Do(func() {
+		ring, ringErr = loadKeyRing(env.Jwt)
+		if ringErr != nil {
+			log.Printf("Failed to load JWT signing keys: %v", ringErr)
+		}
+	})
+	return ring, ringErr
+}
+
+func loadKeyRing(cfg config.JwtConfig) (*keyRing, error) {
+	kr := &keyRing{keys: make(map[string]*signingKey)}
+	for _, keyCfg := range cfg.SigningKeys {
+		if keyCfg.ID == "" {
+			return nil, fmt.Errorf("%w: key without id", ErrInvalidSigningKey)
+		}
+		if _, exists := kr.keys[keyCfg.ID]; exists {
+			return nil, fmt.Errorf("%w: duplicate key id %q", ErrInvalidSigningKey, keyCfg.ID)
+		}
+		key, err := parseSigningKey(keyCfg)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q: %v", ErrInvalidSigningKey, keyCfg.ID, err)
+		}
+		kr.keys[key.id] = key
+		kr.order = append(kr.order, key.id)
+	}
+
+	if cfg.SigningKeyID != "" {
+		signer, ok := kr.keys[cfg.SigningKeyID]
+		if !ok || signer.private == nil {
+			return nil, fmt.Errorf("%w: signing key %q has no private key", ErrInvalidSigningKey, cfg.SigningKeyID)
+		}
+		kr.signer = signer
+	}
+	return kr, nil
+}
+
+func parseSigningKey(cfg config.JwtSigningKey) (*signingKey, error) {
+	key := &signingKey{id: cfg.ID}
+
+	if cfg.PrivateKeyPEM != "" {
+		private, err := parsePrivateKeyPEM(cfg.PrivateKeyPEM)
+		if err != nil {
+			return nil, err
+		}
+		key.private = private
+		key.public = private.(crypto.Signer).Public()
+	}
+	if cfg.PublicKeyPEM != "" {
+		block, _ := pem.Decode([]byte(cfg.PublicKeyPEM))
+		if block == nil {
+			return nil, errors.New("public key is not PEM encoded")
+		}
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if key.public == nil {
+			key.public = public
+		}
+	}
+	if key.public == nil {
+		return nil, errors.New("no key material")
+	}
+
+	switch cfg.Algorithm {
+	case "RS256":
+		public, ok := key.public.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("RS256 needs an RSA key")
+		}
+		if public.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key must be at least %d bits", minRSAKeyBits)
+		}
+		key.method = jwt.SigningMethodRS256
+	case "EdDSA":
+		if _, ok := key.public.(ed25519.PublicKey); !ok {
+			return nil, errors.New("EdDSA needs an Ed25519 key")
+		}
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", cfg.Algorithm)
+	}
+	return key, nil
+}
+
+func parsePrivateKeyPEM(data string) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		switch key.(type) {
+		case *rsa.PrivateKey, ed25519.PrivateKey:
+			return key, nil
+		}
+		return nil, errors.New("unsupported private key type")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// verificationKey resolves the key a token claims to be signed with. The
+// algorithm has to be the one configured for the kid, never the token's choice.
+func (kr *keyRing) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := kr.keys[kid]
+	if !ok {
+		return nil, ErrUnknownSigningKey
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, ErrInvalidToken
+	}
+	return key.public, nil
+}
+
+// PublicJWKS returns every configured access token key in JWKS form
+func PublicJWKS() (JSONWebKeySet, error) {
+	kr, err := accessKeyRing()
+	if err != nil {
+		return JSONWebKeySet{}, err
+	}
+
+	set := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(kr.order))}
+	for _, id := range kr.order {
+		key := kr.keys[id]
+		jwk := JSONWebKey{Kid: key.id, Use: "sig", Alg: key.method.Alg()}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"HealthHubConnect/config"
+	"HealthHubConnect/env"
+	"HealthHubConnect/internal/models"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+func TestHS256AccessTokens(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withKey := config.JwtConfig{
+		SigningKeyID: "k1",
+		SigningKeys: []config.JwtSigningKey{{
+			ID:            "k1",
+			Algorithm:     "EdDSA",
+			PrivateKeyPEM: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		}},
+	}
+	verifyOnly := withKey
+	verifyOnly.SigningKeyID = ""
+
+	tests := []struct {
+		name   string
+		keys   config.JwtConfig
+		secret []byte
+		accept bool
+		want   bool
+	}{
+		{"signed with the secret", config.JwtConfig{}, []byte("access-secret"), false, true},
+		{"no secret", config.JwtConfig{}, nil, false, false},
+		{"keys only published", verifyOnly, []byte("access-secret"), false, true},
+		{"signed with a key", withKey, []byte("access-secret"), false, false},
+		{"signed with a key while moving to it", withKey, []byte("access-secret"), true, true},
+	}
+
+	saved := env.Jwt
+	defer func() { env.Jwt = saved }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr, err := loadKeyRing(tt.keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			env.Jwt.AccessTokenSecret = tt.secret
+			env.Jwt.AcceptHS256AccessTokens = tt.accept
+			if got := acceptsHS256AccessTokens(kr); got != tt.want {
+				t.Errorf("acceptsHS256AccessTokens = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMFAPendingToken(t *testing.T) {
+	saved := env.Jwt
+	defer func() { env.Jwt = saved }()
+	env.Jwt.AccessTokenSecret = []byte("access-secret")
+	env.Jwt.MFATokenSecret = []byte("mfa-secret")
+
+	token, err := GenerateMFAPendingToken(7, models.RolePatient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ValidateToken(token, env.Jwt.MFATokenSecret, MFAPendingToken)
+	if err != nil || claims.UserID != 7 {
+		t.Fatalf("ValidateToken = %+v, %v", claims, err)
+	}
+	if _, err := ValidateToken(token, env.Jwt.AccessTokenSecret, MFAPendingToken); err == nil {
+		t.Error("pending token verified with the access token secret")
+	}
+
+	// a deployment that retired the access token secret still logs in
+	env.Jwt.AccessTokenSecret = nil
+	if _, err := GenerateMFAPendingToken(7, models.RolePatient); err != nil {
+		t.Errorf("GenerateMFAPendingToken without an access token secret: %v", err)
+	}
+
+	env.Jwt.MFATokenSecret = nil
+	if _, err := GenerateMFAPendingToken(7, models.RolePatient); !errors.Is(err, ErrMissingSecret) {
+		t.Errorf("GenerateMFAPendingToken without its secret = %v, want ErrMissingSecret", err)
+	}
+}
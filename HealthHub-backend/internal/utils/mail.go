@@ -2,14 +2,76 @@ package utils
 
 import (
 	"HealthHubConnect/env"
+	"bytes"
 	"crypto/tls"
+	"encoding/base64"
 	"fmt"
+	"mime/multipart"
 	"net/smtp"
+	"net/textproto"
 )
 
+// EmailAttachment is a file sent along with an email. Inline content goes in
+// the message body part, e.g. a text/calendar invite.
+type EmailAttachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
 func SendEmail(to string, subject string, bodyContent string) error {
-	// fmt.Println(to, subject, bodyContent)
-	// return nil
+	headers := make(map[string]string)
+	headers["Subject"] = subject
+	headers["MIME-Version"] = "1.0"
+	headers["Content-Type"] = "text/plain; charset=\"utf-8\""
+
+	return sendMessage(to, headers, bodyContent)
+}
+
+// SendEmailWithAttachment sends a plain text email with one attachment as a
+// multipart/mixed message
+func SendEmailWithAttachment(to string, subject string, bodyContent string, attachment EmailAttachment) error {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	textPart, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/plain; charset=\"utf-8\""},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := textPart.Write([]byte(bodyContent)); err != nil {
+		return err
+	}
+
+	filePart, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {attachment.ContentType},
+		"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", attachment.Filename)},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(attachment.Content)
+	for len(encoded) > 76 {
+		filePart.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	filePart.Write([]byte(encoded + "\r\n"))
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	headers := make(map[string]string)
+	headers["Subject"] = subject
+	headers["MIME-Version"] = "1.0"
+	headers["Content-Type"] = fmt.Sprintf("multipart/mixed; boundary=%q", writer.Boundary())
+
+	return sendMessage(to, headers, body.String())
+}
+
+func sendMessage(to string, headers map[string]string, bodyContent string) error {
 	// logger := logger.GetLogger()
 	smtpHost := env.Mail.SmtpHost
 	smtpPort := env.Mail.SmtpPort
@@ -46,12 +108,8 @@ func SendEmail(to string, subject string, bodyContent string) error {
 	from := username
 	// recipients := []string{to}
 
-	headers := make(map[string]string)
 	headers["From"] = "HealthHub <" + from + ">"
 	headers["To"] = to
-	headers["Subject"] = subject
-	headers["MIME-Version"] = "1.0"
-	headers["Content-Type"] = "text/plain; charset=\"utf-8\""
 
 	message := ""
 	for key, value := range headers {
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	cryptorand "crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+const OTPLength = 6
+
+// GenerateOTP returns a zero padded numeric code drawn from crypto/rand
+func GenerateOTP() (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(OTPLength), nil)
+	n, err := cryptorand.Int(cryptorand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", OTPLength, n.Int64()), nil
+}
+
+// HashOTP binds a code to its owner and purpose before hashing, so a hash
+// can't be replayed against another user or another flow
+func HashOTP(userID uint, purpose, code string) (string, error) {
+	return CreateHMAC(fmt.Sprintf("%d:%s:%s", userID, purpose, code))
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	// zone data is embedded so LoadTimezone works on hosts without tzdata
+	_ "time/tzdata"
+)
+
+// LoadTimezone resolves an IANA zone name such as "Europe/London". An empty
+// name is UTC; "Local" is refused since it depends on the server.
+func LoadTimezone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return time.UTC, nil
+	}
+	if name == "Local" {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return time.LoadLocation(name)
+}
+
+// TimezoneOrUTC resolves a stored zone name, falling back to UTC for names
+// that no longer load
+func TimezoneOrUTC(name string) *time.Location {
+	loc, err := LoadTimezone(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// WallTime returns the instant clocks in loc show the given time of day on
+// the given date, normalized like time.Date. A time skipped by a DST change
+// is moved on by the length of the gap, as the clocks are, so it stays on its
+// day; time.Date may move it back onto the day before.
+func WallTime(year int, month time.Month, day, hour, min int, loc *time.Location) time.Time {
+	// UTC has no gaps, it normalizes the fields
+	wall := time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	t := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), 0, 0, loc)
+	if t.YearDay() == wall.YearDay() && t.Hour() == wall.Hour() && t.Minute() == wall.Minute() {
+		return t
+	}
+
+	// read the skipped time with the offset in force before the gap, a day
+	// earlier is safely before it
+	_, offset := wall.Add(-24 * time.Hour).In(loc).Zone()
+	return wall.Add(-time.Duration(offset) * time.Second).In(loc)
+}
+
+// StartOfDay returns midnight of t's calendar day in loc. On days where a DST
+// change skips midnight this is the first instant of the day.
+func StartOfDay(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	return WallTime(local.Year(), local.Month(), local.Day(), 0, 0, loc)
+}
+
+// AddDays returns the start of the calendar day n days after day's, in day's
+// zone. Days are 23 or 25 hours long across DST changes.
+func AddDays(day time.Time, n int) time.Time {
+	return WallTime(day.Year(), day.Month(), day.Day()+n, 0, 0, day.Location())
+}
@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStartOfDay(t *testing.T) {
+	newYork, err := LoadTimezone("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saoPaulo, err := LoadTimezone("America/Sao_Paulo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		t         time.Time
+		loc       *time.Location
+		want      time.Time
+		dayLength time.Duration
+	}{
+		{
+			name:      "ordinary day",
+			t:         time.Date(2026, 1, 15, 3, 0, 0, 0, time.UTC),
+			loc:       newYork,
+			want:      time.Date(2026, 1, 14, 5, 0, 0, 0, time.UTC),
+			dayLength: 24 * time.Hour,
+		},
+		{
+			name:      "fall back day",
+			t:         time.Date(2026, 11, 1, 23, 0, 0, 0, time.UTC),
+			loc:       newYork,
+			want:      time.Date(2026, 11, 1, 4, 0, 0, 0, time.UTC),
+			dayLength: 25 * time.Hour,
+		},
+		{
+			name:      "late on fall back day",
+			t:         time.Date(2026, 11, 2, 4, 30, 0, 0, time.UTC),
+			loc:       newYork,
+			want:      time.Date(2026, 11, 1, 4, 0, 0, 0, time.UTC),
+			dayLength: 25 * time.Hour,
+		},
+		{
+			name:      "spring forward day",
+			t:         time.Date(2026, 3, 8, 16, 0, 0, 0, time.UTC),
+			loc:       newYork,
+			want:      time.Date(2026, 3, 8, 5, 0, 0, 0, time.UTC),
+			dayLength: 23 * time.Hour,
+		},
+		{
+			name:      "day before a skipped midnight",
+			t:         time.Date(2018, 11, 3, 15, 0, 0, 0, time.UTC),
+			loc:       saoPaulo,
+			want:      time.Date(2018, 11, 3, 3, 0, 0, 0, time.UTC),
+			dayLength: 24 * time.Hour,
+		},
+		{
+			name:      "midnight skipped by spring forward",
+			t:         time.Date(2018, 11, 4, 15, 0, 0, 0, time.UTC),
+			loc:       saoPaulo,
+			want:      time.Date(2018, 11, 4, 3, 0, 0, 0, time.UTC),
+			dayLength: 23 * time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := StartOfDay(tt.t, tt.loc)
+			if !got.Equal(tt.want) {
+				t.Fatalf("StartOfDay(%v) = %v, want %v", tt.t, got.UTC(), tt.want)
+			}
+			if length := AddDays(got, 1).Sub(got); length != tt.dayLength {
+				t.Errorf("day starting %v lasts %v, want %v", got, length, tt.dayLength)
+			}
+		})
+	}
+}
+
+func TestWallTime(t *testing.T) {
+	newYork, err := LoadTimezone("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saoPaulo, err := LoadTimezone("America/Sao_Paulo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name              string
+		year              int
+		month             time.Month
+		day, hour, minute int
+		loc               *time.Location
+		want              time.Time
+	}{
+		{"ordinary time", 2026, time.January, 15, 9, 30, newYork, time.Date(2026, 1, 15, 14, 30, 0, 0, time.UTC)},
+		{"skipped by spring forward", 2026, time.March, 8, 2, 30, newYork, time.Date(2026, 3, 8, 7, 30, 0, 0, time.UTC)},
+		{"repeated by fall back", 2026, time.November, 1, 1, 30, newYork, time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC)},
+		{"skipped midnight", 2018, time.November, 4, 0, 0, saoPaulo, time.Date(2018, 11, 4, 3, 0, 0, 0, time.UTC)},
+		{"day overflowing the month", 2026, time.January, 32, 8, 0, newYork, time.Date(2026, 2, 1, 13, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WallTime(tt.year, tt.month, tt.day, tt.hour, tt.minute, tt.loc)
+			if !got.Equal(tt.want) {
+				t.Errorf("WallTime = %v, want %v", got.UTC(), tt.want)
+			}
+			if got.Location() != tt.loc {
+				t.Errorf("WallTime is in %v, want %v", got.Location(), tt.loc)
+			}
+		})
+	}
+}
@@ -12,6 +12,10 @@ type Client struct {
 	Send        chan []byte
 	UserID      uint
 	RecipientID uint
+	// Topic is what a display client subscribed to, such as a doctor's
+	// waiting room queue. Chat clients have none, display clients have no
+	// UserID.
+	Topic string
 }
 
 type Manager struct {
@@ -68,7 +72,20 @@ func (m *Manager) GetClientsByUserID(userID uint) []*Client {
 	defer m.RUnlock()
 
 	for client := range m.clients {
-		if client.UserID == userID {
+		if client.UserID == userID && client.Topic == "" {
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
+func (m *Manager) GetClientsByTopic(topic string) []*Client {
+	var clients []*Client
+	m.RLock()
+	defer m.RUnlock()
+
+	for client := range m.clients {
+		if client.Topic == topic {
 			clients = append(clients, client)
 		}
 	}
@@ -1,49 +1,161 @@
 package middleware
 
 import (
-	"HealthHubConnect/env"
 	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
 	"HealthHubConnect/internal/utils"
 	"context"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
+// ActAsHeader carries the ID of the user a caregiver acts on behalf of
+const ActAsHeader = "X-Act-As"
+
+// SessionStore tells whether the refresh session family an access token was
+// issued for is still live, so revoking it cuts off access tokens too.
+type SessionStore interface {
+	IsFamilyActive(ctx context.Context, familyID string) (bool, error)
+}
+
+var sessionStore SessionStore
+
+// UseSessionStore wires the store AuthMiddleware checks on every request
+func UseSessionStore(store SessionStore) {
+	sessionStore = store
+}
+
+// APIKeyAuthenticator resolves the X-API-Key header of partner systems
+type APIKeyAuthenticator interface {
+	Authenticate(ctx context.Context, key string) (*models.Principal, error)
+}
+
+var apiKeyAuthenticator APIKeyAuthenticator
+
+// UseAPIKeyAuthenticator enables X-API-Key as an alternative to a Bearer token
+func UseAPIKeyAuthenticator(authenticator APIKeyAuthenticator) {
+	apiKeyAuthenticator = authenticator
+}
+
+// DelegationResolver validates X-Act-As against the caller's delegation grants
+// and audits the requests made with it
+type DelegationResolver interface {
+	ResolveActAs(ctx context.Context, caller *models.Principal, subjectID uint) (*models.Principal, error)
+	RecordActAs(ctx context.Context, principal *models.Principal, method, path string)
+}
+
+var delegationResolver DelegationResolver
+
+// UseDelegationResolver enables the X-Act-As header on policies that allow it
+func UseDelegationResolver(resolver DelegationResolver) {
+	delegationResolver = resolver
+}
+
+// AuthMiddleware accepts either a Bearer access token or an X-API-Key and
+// puts the resulting principal into the context. userID and userRole are set
+// as well whenever a user is behind the request.
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			err := e.NewNotAuthorizedError("missing authorization header")
-			http.Error(w, err.Error(), err.StatusCode)
-			return
-		}
+		ctx := context.WithValue(r.Context(), "ipAddress", ClientIP(r))
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			err := e.NewNotAuthorizedError("invalid authorization header format")
-			http.Error(w, err.Error(), err.StatusCode)
-			return
+		var principal *models.Principal
+		var err *e.CustomError
+		if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+			principal, err = authenticateAPIKey(ctx, apiKey)
+		} else {
+			principal, err = authenticateBearer(ctx, r.Header.Get("Authorization"))
 		}
-
-		userID, err := utils.ExtractUserIDFromToken(parts[1], env.Jwt.AccessTokenSecret)
 		if err != nil {
-			err := e.NewNotAuthorizedError("invalid token")
 			http.Error(w, err.Error(), err.StatusCode)
 			return
 		}
 
-		ip := r.Header.Get("X-Forwarded-For")
-		if ip == "" {
-			ip = r.Header.Get("X-Real-IP") //TODO: learn ip tracking in http requests
-		}
-		if ip == "" {
-			ip = strings.Split(r.RemoteAddr, ":")[0]
+		ctx = context.WithValue(ctx, "principal", principal)
+		if principal.UserID != 0 {
+			ctx = context.WithValue(ctx, "userID", principal.UserID)
+			ctx = context.WithValue(ctx, "userRole", principal.Role)
 		}
-
-		ctx := context.WithValue(r.Context(), "userID", userID)
-		ctx = context.WithValue(ctx, "ipAddress", ip)
 		r = r.WithContext(ctx)
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+func authenticateAPIKey(ctx context.Context, apiKey string) (*models.Principal, *e.CustomError) {
+	if apiKeyAuthenticator == nil {
+		return nil, e.NewNotAuthorizedError("api keys are not accepted")
+	}
+
+	principal, err := apiKeyAuthenticator.Authenticate(ctx, apiKey)
+	if err != nil {
+		if customErr, ok := err.(*e.CustomError); ok {
+			return nil, customErr
+		}
+		return nil, e.NewNotAuthorizedError("invalid api key")
+	}
+	return principal, nil
+}
+
+func authenticateBearer(ctx context.Context, authHeader string) (*models.Principal, *e.CustomError) {
+	if authHeader == "" {
+		return nil, e.NewNotAuthorizedError("missing authorization header")
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return nil, e.NewNotAuthorizedError("invalid authorization header format")
+	}
+
+	claims, err := utils.ValidateAccessToken(parts[1])
+	if err != nil {
+		return nil, e.NewNotAuthorizedError("invalid token")
+	}
+
+	if sessionStore != nil {
+		active, err := sessionStore.IsFamilyActive(ctx, claims.SessionID)
+		if err != nil || !active {
+			return nil, e.NewNotAuthorizedError("session has been revoked")
+		}
+	}
+
+	return &models.Principal{
+		Type:   models.PrincipalUser,
+		UserID: claims.UserID,
+		Role:   claims.Role,
+	}, nil
+}
+
+// resolveActAs swaps the caller's principal for the one acting on behalf of
+// the X-Act-As user, keeping userID and userRole in line with it
+func resolveActAs(r *http.Request) (*http.Request, *e.CustomError) {
+	ctx := r.Context()
+	caller, err := utils.GetPrincipalFromContext(ctx)
+	if err != nil {
+		return nil, e.NewNotAuthorizedError("missing principal")
+	}
+	if caller.IsAPIKey() || caller.UserID == 0 {
+		return nil, e.NewForbiddenError("api keys cannot act on behalf of a user")
+	}
+	if delegationResolver == nil {
+		return nil, e.NewForbiddenError("acting on behalf of another user is not enabled")
+	}
+
+	subjectID, err := strconv.ParseUint(r.Header.Get(ActAsHeader), 10, 32)
+	if err != nil || subjectID == 0 {
+		return nil, e.NewValidationError("invalid " + ActAsHeader + " header")
+	}
+
+	principal, err := delegationResolver.ResolveActAs(ctx, caller, uint(subjectID))
+	if err != nil {
+		if customErr, ok := err.(*e.CustomError); ok {
+			return nil, customErr
+		}
+		return nil, e.NewForbiddenError("you have no active delegated access to this user")
+	}
+
+	ctx = context.WithValue(ctx, "principal", principal)
+	ctx = context.WithValue(ctx, "userID", principal.UserID)
+	ctx = context.WithValue(ctx, "userRole", principal.Role)
+	return r.WithContext(ctx), nil
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// ClientIP resolves the caller's address, preferring the proxy headers
+func ClientIP(r *http.Request) string {
+	ip := r.Header.Get("X-Forwarded-For")
+	if ip != "" {
+		// the first entry is the original client, the rest are proxies
+		ip = strings.TrimSpace(strings.Split(ip, ",")[0])
+	}
+	if ip == "" {
+		ip = r.Header.Get("X-Real-IP")
+	}
+	if ip == "" {
+		ip = strings.Split(r.RemoteAddr, ":")[0]
+	}
+	return ip
+}
+
+// ClientIPMiddleware puts the caller's address in the context for public
+// routes too, login throttling keys on it before any token exists.
+func ClientIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), "ipAddress", ClientIP(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	e "HealthHubConnect/internal/errors"
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/internal/utils"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type Action string
+
+const (
+	ActionRead   Action = "read"
+	ActionWrite  Action = "write"
+	ActionDelete Action = "delete"
+	ActionManage Action = "manage" // privileged operations like confirming or completing an appointment
+)
+
+// Policy describes which roles may perform which actions on a route group.
+// By default the action is derived from the HTTP method, Routes can override
+// it for a single route using "METHOD /path/template" as the key.
+//
+// API keys additionally need the scope mapped to the action, or to the route
+// in RouteScopes. Groups without a scope for the request are closed to keys.
+// ActAs opens the group to caregivers acting for a patient through X-Act-As.
+type Policy struct {
+	Roles       map[Action][]models.UserRole
+	Routes      map[string]Action
+	Scopes      map[Action]string
+	RouteScopes map[string]string
+	ActAs       bool
+}
+
+func actionFromMethod(method string) Action {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return ActionRead
+	case http.MethodDelete:
+		return ActionDelete
+	default:
+		return ActionWrite
+	}
+}
+
+func routeKey(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return r.Method + " " + tpl
+		}
+	}
+	return ""
+}
+
+func (p Policy) actionFor(r *http.Request) Action {
+	if action, ok := p.Routes[routeKey(r)]; ok {
+		return action
+	}
+	return actionFromMethod(r.Method)
+}
+
+func (p Policy) scopeFor(r *http.Request, action Action) string {
+	if scope, ok := p.RouteScopes[routeKey(r)]; ok {
+		return scope
+	}
+	return p.Scopes[action]
+}
+
+func (p Policy) Allows(role models.UserRole, action Action) bool {
+	for _, allowed := range p.Roles[action] {
+		if allowed == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize must run after AuthMiddleware since it reads the principal from the request context.
+// X-Act-As is resolved here rather than in AuthMiddleware so that only groups
+// whose policy allows it accept the header, and requests are audited once allowed.
+// An API key needs the route's scope, and when it acts as a user that user's
+// role must be allowed as well, so a key never does more than its owner.
+func Authorize(policy Policy) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			action := policy.actionFor(r)
+
+			if r.Header.Get(ActAsHeader) != "" {
+				if !policy.ActAs {
+					err := e.NewForbiddenError("acting on behalf of another user is not allowed on this route")
+					http.Error(w, err.Error(), err.StatusCode)
+					return
+				}
+				var err *e.CustomError
+				if r, err = resolveActAs(r); err != nil {
+					http.Error(w, err.Error(), err.StatusCode)
+					return
+				}
+			}
+
+			if principal, err := utils.GetPrincipalFromContext(r.Context()); err == nil && principal.IsAPIKey() {
+				scope := policy.scopeFor(r, action)
+				if scope == "" || !principal.HasScope(scope) {
+					err := e.NewForbiddenError("api key is not permitted on this route")
+					if scope != "" {
+						err = e.NewForbiddenError(fmt.Sprintf("api key lacks the %s scope", scope))
+					}
+					http.Error(w, err.Error(), err.StatusCode)
+					return
+				}
+				if principal.Role == "" {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			role, err := utils.GetUserRoleFromContext(r.Context())
+			if err != nil {
+				err := e.NewNotAuthorizedError("missing role claim")
+				http.Error(w, err.Error(), err.StatusCode)
+				return
+			}
+
+			if !policy.Allows(role, action) {
+				err := e.NewPermissionDeniedError(string(role), string(action))
+				http.Error(w, err.Error(), err.StatusCode)
+				return
+			}
+
+			if principal, err := utils.GetPrincipalFromContext(r.Context()); err == nil && principal.IsDelegated() {
+				delegationResolver.RecordActAs(r.Context(), principal, r.Method, r.URL.Path)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
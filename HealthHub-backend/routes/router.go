@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"HealthHubConnect/internal/handlers"
 	"HealthHubConnect/internal/websocket"
 	"HealthHubConnect/pkg/middleware"
 	v1 "HealthHubConnect/routes/v1"
@@ -14,6 +15,9 @@ func SetupRoutes(router *mux.Router, db *gorm.DB, mapsClient *maps.Client, wsMan
 	//middlewares
 	router.Use(middleware.CorsMiddleware)
 	router.Use(middleware.LoggingMiddleware)
+	router.Use(middleware.ClientIPMiddleware)
+
+	router.HandleFunc("/.well-known/jwks.json", handlers.JWKS).Methods("GET")
 
 	// sub router for v1 routes
 	v1Router := router.PathPrefix("/v1").Subrouter()
@@ -0,0 +1,29 @@
+package v1
+
+import (
+	"HealthHubConnect/internal/handlers"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/services"
+	"HealthHubConnect/pkg/middleware"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+func RegisterAccountRoutes(router *mux.Router, db *gorm.DB) {
+	accountService := services.NewAccountService(repositories.NewAccountRepository(db), repositories.NewUserRepository(db))
+	accountHandler := handlers.NewAccountHandler(accountService)
+
+	p := router.PathPrefix("/account").Subrouter()
+	p.Use(middleware.AuthMiddleware)
+	p.Use(middleware.Authorize(routePolicies["account"]))
+
+	p.HandleFunc("/export", accountHandler.Export).Methods("GET")
+	p.HandleFunc("/deletion", accountHandler.GetDeletionRequest).Methods("GET")
+	p.HandleFunc("/deletion", accountHandler.RequestDeletion).Methods("POST")
+	p.HandleFunc("/deletion", accountHandler.CancelDeletion).Methods("DELETE")
+	p.HandleFunc("/notifications", accountHandler.GetNotificationPreference).Methods("GET")
+	p.HandleFunc("/notifications", accountHandler.UpdateNotificationPreference).Methods("PUT")
+	p.HandleFunc("/timezone", accountHandler.GetTimezone).Methods("GET")
+	p.HandleFunc("/timezone", accountHandler.UpdateTimezone).Methods("PUT")
+}
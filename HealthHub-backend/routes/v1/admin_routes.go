@@ -10,22 +10,30 @@ import (
 	"gorm.io/gorm"
 )
 
-func RegisterAdminRoutes(router *mux.Router, db *gorm.DB) {
+func RegisterAdminRoutes(router *mux.Router, db *gorm.DB, delegationService *services.DelegationService) {
 	userRepo := repositories.NewUserRepository(db)
 	doctorRepo := repositories.NewDoctorRepository(db)
 	adminRepo := repositories.NewAdminRepository(db)
-	adminService := services.NewAdminService(userRepo, doctorRepo, adminRepo)
+	sessionRepo := repositories.NewSessionRepository(db)
+	mfaRepo := repositories.NewMFARepository(db)
+	lockoutRepo := repositories.NewLockoutRepository(db)
+	apiKeyRepo := repositories.NewAPIKeyRepository(db)
+	adminService := services.NewAdminService(userRepo, doctorRepo, adminRepo, sessionRepo, mfaRepo, lockoutRepo, apiKeyRepo)
 	adminHandler := handlers.NewAdminHandler(adminService)
+	delegationHandler := handlers.NewDelegationHandler(delegationService)
+	holidayHandler := handlers.NewHolidayHandler(services.NewHolidayService(repositories.NewTimeOffRepository(db)))
+
+	// Authentication Routes (public, the admin policy can't apply before a token exists)
+	router.HandleFunc("/admin/login", adminHandler.Login).Methods("POST")
+	router.HandleFunc("/admin/refresh-token", adminHandler.RefreshToken).Methods("POST")
 
 	adminRouter := router.PathPrefix("/admin").Subrouter()
 	adminRouter.Use(middleware.AuthMiddleware)
+	adminRouter.Use(middleware.Authorize(routePolicies["admin"]))
 
 	// Admin routes
 	adminRouter.HandleFunc("/login-history", adminHandler.GetAllUserLoginHistory).Methods("GET")
 
-	// Authentication Routes
-	adminRouter.HandleFunc("/login", adminHandler.Login).Methods("POST")
-	adminRouter.HandleFunc("/refresh-token", adminHandler.RefreshToken).Methods("POST")
 	adminRouter.HandleFunc("/change-password", adminHandler.ChangePassword).Methods("POST")
 
 	// User Management Routes
@@ -33,6 +41,7 @@ func RegisterAdminRoutes(router *mux.Router, db *gorm.DB) {
 	adminRouter.HandleFunc("/users/{id}", adminHandler.GetUser).Methods("GET")
 	adminRouter.HandleFunc("/users/{id}/suspend", adminHandler.SuspendUser).Methods("POST")
 	adminRouter.HandleFunc("/users/{id}/activate", adminHandler.ActivateUser).Methods("POST")
+	adminRouter.HandleFunc("/users/{id}/unlock", adminHandler.UnlockUser).Methods("POST")
 	adminRouter.HandleFunc("/users/{id}/delete", adminHandler.DeleteUser).Methods("DELETE")
 	adminRouter.HandleFunc("/users/create", adminHandler.CreateUser).Methods("POST")
 
@@ -54,6 +63,23 @@ func RegisterAdminRoutes(router *mux.Router, db *gorm.DB) {
 	adminRouter.HandleFunc("/restore", adminHandler.RestoreBackup).Methods("POST")
 	adminRouter.HandleFunc("/maintenance", adminHandler.ToggleMaintenanceMode).Methods("POST")
 
+	// Delegation Routes (guardians of minors)
+	adminRouter.HandleFunc("/patients/{id}/delegations", delegationHandler.ListPatientDelegations).Methods("GET")
+	adminRouter.HandleFunc("/patients/{id}/delegations", delegationHandler.GrantForMinor).Methods("POST")
+	adminRouter.HandleFunc("/delegations/{id}", delegationHandler.RevokeAsAdmin).Methods("DELETE")
+
+	// API Key Routes
+	adminRouter.HandleFunc("/api-keys", adminHandler.ListAPIKeys).Methods("GET")
+	adminRouter.HandleFunc("/api-keys", adminHandler.CreateAPIKey).Methods("POST")
+	adminRouter.HandleFunc("/api-keys/{id}", adminHandler.RevokeAPIKey).Methods("DELETE")
+
+	// Holiday Calendar Routes
+	adminRouter.HandleFunc("/holiday-calendars", holidayHandler.ListCalendars).Methods("GET")
+	adminRouter.HandleFunc("/holiday-calendars", holidayHandler.CreateCalendar).Methods("POST")
+	adminRouter.HandleFunc("/holiday-calendars/{id}", holidayHandler.DeleteCalendar).Methods("DELETE")
+	adminRouter.HandleFunc("/holiday-calendars/{id}/holidays", holidayHandler.AddHoliday).Methods("POST")
+	adminRouter.HandleFunc("/holiday-calendars/{id}/holidays/{holidayId}", holidayHandler.RemoveHoliday).Methods("DELETE")
+
 	// Logging and Monitoring Routes
 	adminRouter.HandleFunc("/audit-logs", adminHandler.GetAuditLogs).Methods("GET")
 	adminRouter.HandleFunc("/system-logs", adminHandler.GetSystemLogs).Methods("GET")
@@ -78,5 +104,6 @@ func RegisterAdminRoutes(router *mux.Router, db *gorm.DB) {
 	// Doctor routes
 	doctorRouter := router.PathPrefix("/doctor").Subrouter()
 	doctorRouter.Use(middleware.AuthMiddleware)
+	doctorRouter.Use(middleware.Authorize(routePolicies["doctor"]))
 	doctorRouter.HandleFunc("/patient-login-history", adminHandler.GetPatientLoginHistory).Methods("GET")
 }
@@ -4,6 +4,7 @@ import (
 	"HealthHubConnect/internal/handlers"
 	"HealthHubConnect/internal/repositories"
 	"HealthHubConnect/internal/services"
+	"HealthHubConnect/internal/websocket"
 	"HealthHubConnect/pkg/middleware"
 	"log"
 
@@ -11,28 +12,64 @@ import (
 	"gorm.io/gorm"
 )
 
-func RegisterAppointmentRoutes(router *mux.Router, db *gorm.DB) {
+func RegisterAppointmentRoutes(router *mux.Router, db *gorm.DB, wsManager *websocket.Manager) {
 	appointmentRepo := repositories.NewAppointmentRepository(db)
 	userRepo := repositories.NewUserRepository(db)
 	doctorRepo := repositories.NewDoctorRepository(db)
+	waitlistRepo := repositories.NewWaitlistRepository(db)
+	calendarRepo := repositories.NewCalendarRepository(db)
+	timeOffRepo := repositories.NewTimeOffRepository(db)
+	frontDeskRepo := repositories.NewFrontDeskRepository(db)
 
-	appointmentService, err := services.NewAppointmentService(appointmentRepo, *userRepo, doctorRepo)
+	appointmentService, err := services.NewAppointmentService(appointmentRepo, *userRepo, doctorRepo, waitlistRepo, timeOffRepo, frontDeskRepo, wsManager)
 	if err != nil {
 		log.Fatalf("Failed to initialize appointment service: %v", err)
 	}
 
 	appointmentHandler := handlers.NewAppointmentHandler(appointmentService, userRepo, doctorRepo)
+	calendarHandler := handlers.NewCalendarHandler(services.NewCalendarService(calendarRepo, appointmentRepo, userRepo))
+
+	// Calendar apps can't send a bearer token, the feed token in the path is
+	// the credential
+	router.HandleFunc("/calendar/{token:[0-9a-f]{32}}.ics", calendarHandler.Feed).Methods("GET")
 
 	p := router.PathPrefix("/appointments").Subrouter()
 	p.Use(middleware.AuthMiddleware)
+	p.Use(middleware.Authorize(routePolicies["appointments"]))
 
 	// Move /my route before parameterized routes to ensure proper matching
 	p.HandleFunc("/my", appointmentHandler.GetMyAppointments).Methods("GET")
 
+	// Slot holds during checkout
+	p.HandleFunc("/holds", appointmentHandler.CreateHold).Methods("POST")
+	p.HandleFunc("/holds/{id}", appointmentHandler.GetHold).Methods("GET")
+	p.HandleFunc("/holds/{id}", appointmentHandler.ReleaseHold).Methods("DELETE")
+	p.HandleFunc("/holds/{id}/confirm", appointmentHandler.ConfirmHold).Methods("POST")
+
+	// Recurring series
+	p.HandleFunc("/series", appointmentHandler.CreateSeries).Methods("POST")
+	p.HandleFunc("/series/{id}", appointmentHandler.GetSeries).Methods("GET")
+	p.HandleFunc("/series/{id}/cancel", appointmentHandler.CancelSeries).Methods("PUT")
+	p.HandleFunc("/series/{id}/reschedule", appointmentHandler.RescheduleSeries).Methods("PUT")
+
+	// Waitlist and the offers made from it
+	p.HandleFunc("/waitlist", appointmentHandler.JoinWaitlist).Methods("POST")
+	p.HandleFunc("/waitlist", appointmentHandler.GetMyWaitlist).Methods("GET")
+	p.HandleFunc("/waitlist/{id}", appointmentHandler.LeaveWaitlist).Methods("DELETE")
+	p.HandleFunc("/waitlist/offers/{token}", appointmentHandler.GetWaitlistOffer).Methods("GET")
+	p.HandleFunc("/waitlist/offers/{token}/claim", appointmentHandler.ClaimWaitlistOffer).Methods("POST")
+	p.HandleFunc("/waitlist/offers/{token}/decline", appointmentHandler.DeclineWaitlistOffer).Methods("POST")
+
+	// Calendar feed subscription
+	p.HandleFunc("/calendar-feed", calendarHandler.GetFeed).Methods("GET")
+	p.HandleFunc("/calendar-feed", calendarHandler.RotateFeed).Methods("POST")
+	p.HandleFunc("/calendar-feed", calendarHandler.RevokeFeed).Methods("DELETE")
+
 	// General appointment routes
 	p.HandleFunc("", appointmentHandler.CreateAppointment).Methods("POST")
 	p.HandleFunc("/{id}", appointmentHandler.GetAppointment).Methods("GET")
 	p.HandleFunc("/{id}/status", appointmentHandler.GetAppointmentStatus).Methods("GET")
+	p.HandleFunc("/{id}/history", appointmentHandler.GetAppointmentHistory).Methods("GET")
 	//doctor
 	p.HandleFunc("/{id}/status", appointmentHandler.UpdateAppointmentStatus).Methods("PUT")
 
@@ -40,6 +77,7 @@ func RegisterAppointmentRoutes(router *mux.Router, db *gorm.DB) {
 	p.HandleFunc("/my/upcoming", appointmentHandler.GetMyUpcomingAppointments).Methods("GET")
 	p.HandleFunc("/my/past", appointmentHandler.GetMyPastAppointments).Methods("GET")
 	p.HandleFunc("/{id}/cancel", appointmentHandler.CancelAppointment).Methods("PUT")
+	p.HandleFunc("/{id}/cancellation-charge", appointmentHandler.GetCancellationCharge).Methods("GET")
 
 	// Doctor availability and slots
 	p.HandleFunc("/doctor/{doctorId}/slots", appointmentHandler.GetAvailableSlots).
@@ -56,6 +94,8 @@ func RegisterAppointmentRoutes(router *mux.Router, db *gorm.DB) {
 
 	// Appointment actions
 	p.HandleFunc("/{id}/confirm", appointmentHandler.ConfirmAppointment).Methods("PUT")
+	p.HandleFunc("/{id}/check-in", appointmentHandler.CheckInAppointment).Methods("PUT")
+	p.HandleFunc("/{id}/start", appointmentHandler.StartAppointment).Methods("PUT")
 	p.HandleFunc("/{id}/complete", appointmentHandler.CompleteAppointment).Methods("PUT")
 	p.HandleFunc("/{id}/reschedule", appointmentHandler.RescheduleAppointment).Methods("PUT")
 	p.HandleFunc("/{id}/no-show", appointmentHandler.MarkNoShow).Methods("PUT")
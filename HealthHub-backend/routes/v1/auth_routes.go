@@ -2,24 +2,39 @@ package v1
 
 import (
 	"HealthHubConnect/internal/handlers"
+	"HealthHubConnect/internal/oidc"
 	"HealthHubConnect/internal/repositories"
 	"HealthHubConnect/internal/services"
+	"HealthHubConnect/pkg/middleware"
 
 	"github.com/gorilla/mux"
 
 	"gorm.io/gorm"
 )
 
-func RegisterAuthRoutes(router *mux.Router, db *gorm.DB) {
+func RegisterAuthRoutes(router *mux.Router, db *gorm.DB, oidcProviders *oidc.Registry) {
 	userRepo := repositories.NewUserRepository(db)
-	userService := services.NewUserService(userRepo)
+	sessionRepo := repositories.NewSessionRepository(db)
+	mfaRepo := repositories.NewMFARepository(db)
+	adminRepo := repositories.NewAdminRepository(db)
+	lockoutRepo := repositories.NewLockoutRepository(db)
+	otpRepo := repositories.NewOTPRepository(db)
+	oauthRepo := repositories.NewOAuthRepository(db)
+	userService := services.NewUserService(userRepo, sessionRepo, mfaRepo, adminRepo, lockoutRepo, otpRepo, oauthRepo, oidcProviders)
+	mfaService := services.NewMFAService(mfaRepo, userRepo, adminRepo)
+	oauthService := services.NewOAuthService(oauthRepo, userRepo, oidcProviders)
 
 	authHandler := handlers.NewUserHandler(userService)
+	mfaHandler := handlers.NewMFAHandler(userService, mfaService)
+	oauthHandler := handlers.NewOAuthHandler(userService, oauthService)
 
 	router.HandleFunc("/auth/signup", authHandler.Signup).Methods("POST")
 	router.HandleFunc("/auth/verify-otp", authHandler.VerifyOTP).Methods("POST")
 	router.HandleFunc("/auth/login", authHandler.Login).Methods("POST")
+	router.HandleFunc("/auth/login/mfa", mfaHandler.VerifyLogin).Methods("POST")
+	router.HandleFunc("/auth/login/mfa/enroll", mfaHandler.EnrollWithToken).Methods("POST")
 	router.HandleFunc("/auth/refresh", authHandler.RefreshToken).Methods("GET")
+	router.HandleFunc("/auth/logout", authHandler.Logout).Methods("POST")
 	router.HandleFunc("/auth/forgot-password", authHandler.ForgotPassword).Methods("POST")
 	router.HandleFunc("/auth/reset-password", authHandler.ResetPassword).Methods("POST")
 	router.HandleFunc("/auth/resend-otp", authHandler.ResendOTP).Methods("POST")
@@ -27,4 +42,28 @@ func RegisterAuthRoutes(router *mux.Router, db *gorm.DB) {
 	router.HandleFunc("/auth/google/login", authHandler.GoogleLogin).Methods("GET")
 	router.HandleFunc("/auth/google/callback", authHandler.GoogleCallback).Methods("GET")
 
+	router.HandleFunc("/auth/oidc/providers", oauthHandler.ListProviders).Methods("GET")
+	router.HandleFunc("/auth/oidc/{provider}/login", oauthHandler.Login).Methods("GET")
+	router.HandleFunc("/auth/oidc/{provider}/callback", oauthHandler.Callback).Methods("GET")
+
+	sessionRouter := router.PathPrefix("/auth/sessions").Subrouter()
+	sessionRouter.Use(middleware.AuthMiddleware)
+	sessionRouter.Use(middleware.Authorize(routePolicies["protected"]))
+	sessionRouter.HandleFunc("/logout-all", authHandler.LogoutAllDevices).Methods("POST")
+
+	mfaRouter := router.PathPrefix("/auth/mfa").Subrouter()
+	mfaRouter.Use(middleware.AuthMiddleware)
+	mfaRouter.Use(middleware.Authorize(routePolicies["protected"]))
+	mfaRouter.HandleFunc("", mfaHandler.GetStatus).Methods("GET")
+	mfaRouter.HandleFunc("/enroll", mfaHandler.Enroll).Methods("POST")
+	mfaRouter.HandleFunc("/enroll/confirm", mfaHandler.ConfirmEnrollment).Methods("POST")
+	mfaRouter.HandleFunc("/recovery-codes", mfaHandler.RegenerateRecoveryCodes).Methods("POST")
+	mfaRouter.HandleFunc("/disable", mfaHandler.Disable).Methods("POST")
+
+	accountsRouter := router.PathPrefix("/auth/accounts").Subrouter()
+	accountsRouter.Use(middleware.AuthMiddleware)
+	accountsRouter.Use(middleware.Authorize(routePolicies["protected"]))
+	accountsRouter.HandleFunc("", oauthHandler.LinkedAccounts).Methods("GET")
+	accountsRouter.HandleFunc("/{provider}/link", oauthHandler.Link).Methods("POST")
+	accountsRouter.HandleFunc("/{provider}", oauthHandler.Unlink).Methods("DELETE")
 }
@@ -24,6 +24,7 @@ func RegisterChatRoutes(router *mux.Router, db *gorm.DB, wsManager *websocket.Ma
 
 	chatRouter.Use(middleware.LoggingMiddleware)
 	chatRouter.Use(middleware.AuthMiddleware)
+	chatRouter.Use(middleware.Authorize(routePolicies["chat"]))
 	chatRouter.Use(middleware.CorsMiddleware)
 	// chatRouter.Use(middleware.RateLimitMiddleware) TODO: will add later when get time
 
@@ -0,0 +1,22 @@
+package v1
+
+import (
+	"HealthHubConnect/internal/handlers"
+	"HealthHubConnect/internal/services"
+	"HealthHubConnect/pkg/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+func RegisterDelegationRoutes(router *mux.Router, delegationService *services.DelegationService) {
+	delegationHandler := handlers.NewDelegationHandler(delegationService)
+
+	p := router.PathPrefix("/delegations").Subrouter()
+	p.Use(middleware.AuthMiddleware)
+	p.Use(middleware.Authorize(routePolicies["delegations"]))
+
+	p.HandleFunc("", delegationHandler.ListGranted).Methods("GET")
+	p.HandleFunc("", delegationHandler.Grant).Methods("POST")
+	p.HandleFunc("/received", delegationHandler.ListReceived).Methods("GET")
+	p.HandleFunc("/{id}", delegationHandler.Revoke).Methods("DELETE")
+}
@@ -2,19 +2,28 @@ package v1
 
 import (
 	"HealthHubConnect/internal/handlers"
+	"HealthHubConnect/internal/oidc"
 	"HealthHubConnect/internal/repositories"
 	"HealthHubConnect/internal/services"
+	"HealthHubConnect/internal/websocket"
 	"HealthHubConnect/pkg/middleware"
+	"log"
 
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
 )
 
-func RegisterDoctorRoutes(router *mux.Router, db *gorm.DB) {
+func RegisterDoctorRoutes(router *mux.Router, db *gorm.DB, oidcProviders *oidc.Registry, wsManager *websocket.Manager) {
 	router.Use(middleware.CorsMiddleware)
 
 	userRepo := repositories.NewUserRepository(db)
-	userService := services.NewUserService(userRepo)
+	sessionRepo := repositories.NewSessionRepository(db)
+	mfaRepo := repositories.NewMFARepository(db)
+	adminRepo := repositories.NewAdminRepository(db)
+	lockoutRepo := repositories.NewLockoutRepository(db)
+	otpRepo := repositories.NewOTPRepository(db)
+	oauthRepo := repositories.NewOAuthRepository(db)
+	userService := services.NewUserService(userRepo, sessionRepo, mfaRepo, adminRepo, lockoutRepo, otpRepo, oauthRepo, oidcProviders)
 	doctorHandler := handlers.NewDoctorHandler(userService)
 
 	router.HandleFunc("/doctor/signup", doctorHandler.Signup).Methods("POST")
@@ -23,15 +32,24 @@ func RegisterDoctorRoutes(router *mux.Router, db *gorm.DB) {
 
 	doctorRepo := repositories.NewDoctorRepository(db)
 	appointmentRepo := repositories.NewAppointmentRepository(db)
-	prescriptionRepo := repositories.NewPrescriptionRepository(db)                            // Add this line
-	doctorService := services.NewDoctorService(doctorRepo, appointmentRepo, prescriptionRepo) // Add this parameter
+	prescriptionRepo := repositories.NewPrescriptionRepository(db) // Add this line
+	timeOffRepo := repositories.NewTimeOffRepository(db)
+	appointmentService, err := services.NewAppointmentService(appointmentRepo, *userRepo, doctorRepo, repositories.NewWaitlistRepository(db), timeOffRepo, repositories.NewFrontDeskRepository(db), wsManager)
+	if err != nil {
+		log.Fatalf("Failed to initialize appointment service: %v", err)
+	}
+	doctorService := services.NewDoctorService(doctorRepo, appointmentRepo, prescriptionRepo, timeOffRepo, appointmentService) // Add this parameter
 	doctorProfileHandler := handlers.NewDoctorProfileHandler(doctorService)
+	appointmentHandler := handlers.NewAppointmentHandler(appointmentService, userRepo, doctorRepo)
+	holidayHandler := handlers.NewHolidayHandler(services.NewHolidayService(timeOffRepo))
+	frontDeskHandler := handlers.NewFrontDeskHandler(appointmentHandler, wsManager)
 
 	router.HandleFunc("/doctors", doctorProfileHandler.ListDoctors).Methods("GET")
 	router.HandleFunc("/doctors/{id}", doctorProfileHandler.GetDoctorPublicProfile).Methods("GET")
 
 	protected := router.PathPrefix("/doctor").Subrouter()
 	protected.Use(middleware.AuthMiddleware)
+	protected.Use(middleware.Authorize(routePolicies["doctor"]))
 
 	protected.HandleFunc("/profile", doctorProfileHandler.SaveProfile).Methods("POST")
 	protected.HandleFunc("/profile", doctorProfileHandler.GetProfile).Methods("GET")
@@ -42,6 +60,33 @@ func RegisterDoctorRoutes(router *mux.Router, db *gorm.DB) {
 	protected.HandleFunc("/schedule", doctorProfileHandler.GetSchedule).Methods("GET")
 	protected.HandleFunc("/schedule/extend", doctorProfileHandler.ExtendAvailability).Methods("POST")
 	protected.HandleFunc("/schedule/block", doctorProfileHandler.BlockSlot).Methods("POST")
+	protected.HandleFunc("/schedule/block/{id}", doctorProfileHandler.UnblockSlot).Methods("DELETE")
+
+	// Named schedule templates with effective dates, and the version history
+	protected.HandleFunc("/schedule/templates", doctorProfileHandler.ListScheduleTemplates).Methods("GET")
+	protected.HandleFunc("/schedule/templates", doctorProfileHandler.SaveScheduleTemplate).Methods("POST")
+	protected.HandleFunc("/schedule/templates/preview", doctorProfileHandler.PreviewScheduleTemplate).Methods("POST")
+	protected.HandleFunc("/schedule/versions", doctorProfileHandler.ListScheduleVersions).Methods("GET")
+	protected.HandleFunc("/schedule/versions/{id}", doctorProfileHandler.GetScheduleVersion).Methods("GET")
+
+	// Leave and the appointments booked in it
+	protected.HandleFunc("/time-off", appointmentHandler.CreateTimeOff).Methods("POST")
+	protected.HandleFunc("/time-off", appointmentHandler.ListTimeOff).Methods("GET")
+	protected.HandleFunc("/time-off/{id}", appointmentHandler.GetTimeOff).Methods("GET")
+	protected.HandleFunc("/time-off/{id}", appointmentHandler.DeleteTimeOff).Methods("DELETE")
+	protected.HandleFunc("/time-off/{id}/resolve", appointmentHandler.ResolveTimeOff).Methods("POST")
+
+	// Holiday calendars the doctor follows
+	protected.HandleFunc("/holidays", appointmentHandler.GetHolidays).Methods("GET")
+	protected.HandleFunc("/holidays/{id}/resolve", appointmentHandler.ResolveHoliday).Methods("POST")
+	protected.HandleFunc("/holiday-calendars", holidayHandler.DoctorCalendars).Methods("GET")
+	protected.HandleFunc("/holiday-calendars/{id}", holidayHandler.FollowCalendar).Methods("PUT")
+	protected.HandleFunc("/holiday-calendars/{id}", holidayHandler.UnfollowCalendar).Methods("DELETE")
+
+	// Receptionists working the doctor's front desk
+	protected.HandleFunc("/front-desk", frontDeskHandler.ListStaff).Methods("GET")
+	protected.HandleFunc("/front-desk", frontDeskHandler.AddStaff).Methods("POST")
+	protected.HandleFunc("/front-desk/{receptionistId}", frontDeskHandler.RemoveStaff).Methods("DELETE")
 
 	protected.HandleFunc("/patients", doctorProfileHandler.ListPatients).Methods("GET")
 
@@ -0,0 +1,50 @@
+package v1
+
+import (
+	"HealthHubConnect/internal/handlers"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/services"
+	"HealthHubConnect/internal/websocket"
+	"HealthHubConnect/pkg/middleware"
+	"log"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+func RegisterFrontDeskRoutes(router *mux.Router, db *gorm.DB, wsManager *websocket.Manager) {
+	userRepo := repositories.NewUserRepository(db)
+	doctorRepo := repositories.NewDoctorRepository(db)
+
+	appointmentService, err := services.NewAppointmentService(
+		repositories.NewAppointmentRepository(db),
+		*userRepo,
+		doctorRepo,
+		repositories.NewWaitlistRepository(db),
+		repositories.NewTimeOffRepository(db),
+		repositories.NewFrontDeskRepository(db),
+		wsManager,
+	)
+	if err != nil {
+		log.Fatalf("Failed to initialize appointment service: %v", err)
+	}
+
+	frontDeskHandler := handlers.NewFrontDeskHandler(handlers.NewAppointmentHandler(appointmentService, userRepo, doctorRepo), wsManager)
+
+	p := router.PathPrefix("/front-desk").Subrouter()
+	p.Use(middleware.AuthMiddleware)
+	p.Use(middleware.Authorize(routePolicies["front-desk"]))
+
+	p.HandleFunc("/doctors", frontDeskHandler.ListDoctors).Methods("GET")
+	p.HandleFunc("/patients", frontDeskHandler.FindPatients).Methods("GET")
+
+	p.HandleFunc("/appointments", frontDeskHandler.BookAppointment).Methods("POST")
+	p.HandleFunc("/walk-ins", frontDeskHandler.RegisterWalkIn).Methods("POST")
+	p.HandleFunc("/appointments/{id}/check-in", frontDeskHandler.CheckIn).Methods("PUT")
+	p.HandleFunc("/appointments/{id}/no-show", frontDeskHandler.MarkNoShow).Methods("PUT")
+	p.HandleFunc("/appointments/{id}/cancel", frontDeskHandler.Cancel).Methods("PUT")
+
+	// Live queue, for the desk and the waiting room displays
+	p.HandleFunc("/queue/{doctorId}", frontDeskHandler.GetQueue).Methods("GET")
+	p.HandleFunc("/queue/{doctorId}/ws", frontDeskHandler.QueueSocket).Methods("GET")
+}
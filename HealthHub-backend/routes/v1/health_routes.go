@@ -17,6 +17,7 @@ func RegisterHealthRoutes(router *mux.Router, db *gorm.DB) {
 
 	p := router.PathPrefix("/health").Subrouter()
 	p.Use(middleware.AuthMiddleware)
+	p.Use(middleware.Authorize(routePolicies["health"]))
 
 	p.HandleFunc("/profile", healthHandler.CreateHealthProfile).Methods("POST")
 	p.HandleFunc("/profile", healthHandler.GetHealthProfile).Methods("GET")
@@ -18,6 +18,7 @@ func RegisterHospitalRoutes(router *mux.Router, db *gorm.DB, mapsClient *maps.Cl
 
 	protected := router.PathPrefix("/hospitals").Subrouter()
 	protected.Use(middleware.AuthMiddleware)
+	protected.Use(middleware.Authorize(routePolicies["hospitals"]))
 	protected.HandleFunc("/nearby", handler.FindNearbyHospitals).Methods("POST")
 	protected.HandleFunc("/search", handler.SearchHospitals).Methods("POST")
 	protected.HandleFunc("/{id}", handler.GetHospitalByID).Methods("GET")
@@ -0,0 +1,27 @@
+package v1
+
+import (
+	"HealthHubConnect/internal/handlers"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/services"
+	"HealthHubConnect/pkg/middleware"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// RegisterIntegrationRoutes exposes the read-only endpoints partner systems
+// call with an API key, every route needs its scope in the integrations policy
+func RegisterIntegrationRoutes(router *mux.Router, db *gorm.DB) {
+	doctorRepo := repositories.NewDoctorRepository(db)
+	appointmentRepo := repositories.NewAppointmentRepository(db)
+	prescriptionRepo := repositories.NewPrescriptionRepository(db)
+	doctorService := services.NewDoctorService(doctorRepo, appointmentRepo, prescriptionRepo, repositories.NewTimeOffRepository(db), nil)
+	doctorProfileHandler := handlers.NewDoctorProfileHandler(doctorService)
+
+	p := router.PathPrefix("/integrations").Subrouter()
+	p.Use(middleware.AuthMiddleware)
+	p.Use(middleware.Authorize(routePolicies["integrations"]))
+
+	p.HandleFunc("/appointments/{id}/prescription", doctorProfileHandler.GetPrescription).Methods("GET")
+}
@@ -0,0 +1,127 @@
+package v1
+
+import (
+	"HealthHubConnect/internal/models"
+	"HealthHubConnect/pkg/middleware"
+)
+
+var allRoles = []models.UserRole{
+	models.RoleAdmin,
+	models.RoleDoctor,
+	models.RoleNurse,
+	models.RolePatient,
+	models.RoleReceptionist,
+	models.RolePharmacist,
+}
+
+// routePolicies maps every authenticated route group to the roles allowed on it,
+// handlers still check ownership of the individual records
+var routePolicies = map[string]middleware.Policy{
+	"admin": {
+		Roles: map[middleware.Action][]models.UserRole{
+			middleware.ActionRead:   {models.RoleAdmin},
+			middleware.ActionWrite:  {models.RoleAdmin},
+			middleware.ActionDelete: {models.RoleAdmin},
+		},
+	},
+	"doctor": {
+		Roles: map[middleware.Action][]models.UserRole{
+			middleware.ActionRead:   {models.RoleDoctor},
+			middleware.ActionWrite:  {models.RoleDoctor},
+			middleware.ActionDelete: {models.RoleDoctor},
+		},
+	},
+	"appointments": {
+		Roles: map[middleware.Action][]models.UserRole{
+			middleware.ActionRead:   {models.RolePatient, models.RoleDoctor, models.RoleAdmin},
+			middleware.ActionWrite:  {models.RolePatient, models.RoleDoctor},
+			middleware.ActionManage: {models.RoleDoctor},
+		},
+		Scopes: map[middleware.Action]string{
+			middleware.ActionRead:  models.ScopeAppointmentsRead,
+			middleware.ActionWrite: models.ScopeAppointmentsWrite,
+		},
+		ActAs: true,
+		Routes: map[string]middleware.Action{
+			"PUT /v1/appointments/{id}/status":      middleware.ActionManage,
+			"PUT /v1/appointments/{id}/confirm":     middleware.ActionManage,
+			"PUT /v1/appointments/{id}/check-in":    middleware.ActionManage,
+			"PUT /v1/appointments/{id}/start":       middleware.ActionManage,
+			"PUT /v1/appointments/{id}/complete":    middleware.ActionManage,
+			"PUT /v1/appointments/{id}/no-show":     middleware.ActionManage,
+			"GET /v1/appointments/doctor/upcoming":  middleware.ActionManage,
+			"GET /v1/appointments/doctor/past":      middleware.ActionManage,
+			"GET /v1/appointments/doctor/today":     middleware.ActionManage,
+			"GET /v1/appointments/doctor/week":      middleware.ActionManage,
+			"DELETE /v1/appointments/holds/{id}":    middleware.ActionWrite,
+			"DELETE /v1/appointments/waitlist/{id}": middleware.ActionWrite,
+			"DELETE /v1/appointments/calendar-feed": middleware.ActionWrite,
+		},
+	},
+	"health": {
+		Roles: map[middleware.Action][]models.UserRole{
+			middleware.ActionRead:   {models.RolePatient},
+			middleware.ActionWrite:  {models.RolePatient},
+			middleware.ActionDelete: {models.RolePatient},
+		},
+		ActAs: true,
+	},
+	"delegations": {
+		Roles: map[middleware.Action][]models.UserRole{
+			middleware.ActionRead:   allRoles,
+			middleware.ActionWrite:  {models.RolePatient},
+			middleware.ActionDelete: allRoles,
+		},
+	},
+	"hospitals": {
+		Roles: map[middleware.Action][]models.UserRole{
+			middleware.ActionRead:  allRoles,
+			middleware.ActionWrite: {models.RoleAdmin},
+		},
+		Scopes: map[middleware.Action]string{
+			middleware.ActionRead: models.ScopeHospitalsRead,
+		},
+		Routes: map[string]middleware.Action{
+			"POST /v1/hospitals/nearby": middleware.ActionRead,
+			"POST /v1/hospitals/search": middleware.ActionRead,
+		},
+	},
+	"front-desk": {
+		Roles: map[middleware.Action][]models.UserRole{
+			middleware.ActionRead:  {models.RoleReceptionist, models.RoleDoctor},
+			middleware.ActionWrite: {models.RoleReceptionist},
+		},
+	},
+	"chat": {
+		Roles: map[middleware.Action][]models.UserRole{
+			middleware.ActionRead:  {models.RolePatient, models.RoleDoctor},
+			middleware.ActionWrite: {models.RolePatient, models.RoleDoctor},
+		},
+	},
+	"integrations": {
+		Roles: map[middleware.Action][]models.UserRole{
+			middleware.ActionRead: {models.RoleAdmin},
+		},
+		RouteScopes: map[string]string{
+			"GET /v1/integrations/appointments/{id}/prescription": models.ScopePrescriptionsRead,
+		},
+	},
+	"account": {
+		Roles: map[middleware.Action][]models.UserRole{
+			middleware.ActionRead:   allRoles,
+			middleware.ActionWrite:  {models.RolePatient},
+			middleware.ActionDelete: {models.RolePatient},
+			middleware.ActionManage: allRoles,
+		},
+		Routes: map[string]middleware.Action{
+			"PUT /v1/account/timezone": middleware.ActionManage,
+		},
+	},
+	"protected": {
+		Roles: map[middleware.Action][]models.UserRole{
+			middleware.ActionRead:   allRoles,
+			middleware.ActionWrite:  allRoles,
+			middleware.ActionDelete: allRoles,
+		},
+	},
+}
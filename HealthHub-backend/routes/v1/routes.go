@@ -1,7 +1,11 @@
 package v1
 
 import (
+	"HealthHubConnect/env"
 	"HealthHubConnect/internal/handlers"
+	"HealthHubConnect/internal/oidc"
+	"HealthHubConnect/internal/repositories"
+	"HealthHubConnect/internal/services"
 	"HealthHubConnect/internal/websocket"
 	"HealthHubConnect/pkg/middleware"
 	"encoding/json"
@@ -13,19 +17,35 @@ import (
 )
 
 func RegisterRoutes(router *mux.Router, db *gorm.DB, mapsClient *maps.Client, wsManager *websocket.Manager) {
+	middleware.UseSessionStore(repositories.NewSessionRepository(db))
+	middleware.UseAPIKeyAuthenticator(services.NewAPIKeyService(repositories.NewAPIKeyRepository(db), repositories.NewUserRepository(db)))
+	delegationService := services.NewDelegationService(
+		repositories.NewDelegationRepository(db),
+		repositories.NewUserRepository(db),
+		repositories.NewHealthRepository(db),
+		repositories.NewAdminRepository(db),
+	)
+	middleware.UseDelegationResolver(delegationService)
+	oidcProviders := oidc.NewRegistry(env.OIDCProviders, nil)
+
 	//different route groups
-	RegisterAuthRoutes(router, db)
+	RegisterAuthRoutes(router, db, oidcProviders)
 	RegisterHealthRoutes(router, db)
 	RegisterHospitalRoutes(router, db, mapsClient)
-	RegisterDoctorRoutes(router, db)
-	RegisterAppointmentRoutes(router, db)
+	RegisterDoctorRoutes(router, db, oidcProviders, wsManager)
+	RegisterAppointmentRoutes(router, db, wsManager)
+	RegisterFrontDeskRoutes(router, db, wsManager)
 	RegisterChatRoutes(router, db, wsManager)
-	RegisterAdminRoutes(router, db)
+	RegisterAdminRoutes(router, db, delegationService)
+	RegisterDelegationRoutes(router, delegationService)
+	RegisterAccountRoutes(router, db)
+	RegisterIntegrationRoutes(router, db)
 
 	router.HandleFunc("/health", handlers.HealthCheck).Methods("GET")
 
 	p := router.PathPrefix("/protected").Subrouter()
 	p.Use(middleware.AuthMiddleware)
+	p.Use(middleware.Authorize(routePolicies["protected"]))
 
 	p.HandleFunc("/", ProtectedHandler)
 